@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader is the header in which clients present an API key
+const APIKeyHeader = "X-API-Key"
+
+// APIKey describes a static API key. Only the SHA-256 hash of a key is ever configured, never the key itself
+type APIKey struct {
+	Name   string   `json:"name"`
+	SHA256 string   `json:"sha256"`
+	Scopes []string `json:"scopes"`
+
+	hash []byte
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash of an API key, as configured
+func HashAPIKey(key string) string {
+
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadAPIKeys parses the API keys configured inline, as a JSON array, and in a file of the same format
+func loadAPIKeys(inline string, file string) ([]*APIKey, error) {
+
+	var keys []*APIKey
+
+	if strings.TrimSpace(inline) != "" {
+		parsed, err := parseAPIKeys([]byte(inline))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, parsed...)
+	}
+
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parseAPIKeys(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		keys = append(keys, parsed...)
+	}
+
+	return keys, nil
+}
+
+func parseAPIKeys(b []byte) ([]*APIKey, error) {
+
+	var keys []*APIKey
+	err := json.Unmarshal(b, &keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		key.hash, err = hex.DecodeString(key.SHA256)
+		if err != nil || len(key.hash) != sha256.Size {
+			return nil, fmt.Errorf("API key %d (%s) must have a hex encoded SHA-256 hash", i, key.Name)
+		}
+	}
+	return keys, nil
+}
+
+// APIKeyAuthenticator authenticates requests presenting a static API key in the X-API-Key header
+type APIKeyAuthenticator struct {
+	keys []*APIKey
+}
+
+// NewAPIKeyAuthenticator returns an Authenticator accepting the given API keys
+func NewAPIKeyAuthenticator(keys []*APIKey) Authenticator {
+	return &APIKeyAuthenticator{
+		keys: keys,
+	}
+}
+
+// Authenticate identifies the caller by the name of the API key presented
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+
+	presented := r.Header.Get(APIKeyHeader)
+	if presented == "" {
+		return nil, ErrNoCredentials
+	}
+
+	sum := sha256.Sum256([]byte(presented))
+
+	// compare against every key, so that the time taken reveals nothing of which keys exist
+	var match *APIKey
+	for _, key := range a.keys {
+		if subtle.ConstantTimeCompare(sum[:], key.hash) == 1 {
+			match = key
+		}
+	}
+
+	if match == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{
+		Subject: "api-key:" + match.Name,
+		Scopes:  match.Scopes,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitAPIKeyAuthenticator(t *testing.T) {
+
+	keys, err := parseAPIKeys([]byte(fmt.Sprintf(
+		`[{"name": "reader", "sha256": "%s", "scopes": ["users:read"]}]`, HashAPIKey("secret"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := NewAPIKeyAuthenticator(keys)
+
+	Convey("Given a request without an API key", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+
+		Convey("Then I expect no credentials to be found", func() {
+
+			_, err := authenticator.Authenticate(req)
+			So(err, ShouldEqual, ErrNoCredentials)
+		})
+	})
+
+	Convey("Given a request with an unknown API key", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(APIKeyHeader, "guess")
+
+		Convey("Then I expect the credentials to be invalid", func() {
+
+			principal, err := authenticator.Authenticate(req)
+			So(err, ShouldEqual, ErrInvalidCredentials)
+			So(principal, ShouldBeNil)
+		})
+	})
+
+	Convey("Given a request with a known API key", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(APIKeyHeader, "secret")
+
+		Convey("Then I expect the principal to be named after the key, with its scopes", func() {
+
+			principal, err := authenticator.Authenticate(req)
+			So(err, ShouldBeNil)
+			So(principal.Subject, ShouldEqual, "api-key:reader")
+			So(principal.HasScope(ScopeUsersRead), ShouldBeTrue)
+			So(principal.HasScope(ScopeUsersWrite), ShouldBeFalse)
+		})
+	})
+}
+
+func TestUnitLoadAPIKeys(t *testing.T) {
+
+	Convey("Given API keys configured inline and in a file", t, func() {
+
+		file, err := ioutil.TempFile("", "api-keys-*.json")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+
+		_, err = file.WriteString(fmt.Sprintf(`[{"name": "file", "sha256": "%s"}]`, HashAPIKey("b")))
+		So(err, ShouldBeNil)
+		So(file.Close(), ShouldBeNil)
+
+		keys, err := loadAPIKeys(fmt.Sprintf(`[{"name": "inline", "sha256": "%s"}]`, HashAPIKey("a")), file.Name())
+
+		Convey("Then I expect the keys from both to be loaded", func() {
+
+			So(err, ShouldBeNil)
+			So(len(keys), ShouldEqual, 2)
+			So(keys[0].Name, ShouldEqual, "inline")
+			So(keys[1].Name, ShouldEqual, "file")
+		})
+	})
+
+	Convey("Given an API key configured without a valid hash", t, func() {
+
+		_, err := loadAPIKeys(`[{"name": "plain", "sha256": "secret"}]`, "")
+
+		Convey("Then I expect an error", func() {
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
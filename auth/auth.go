@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bpsaunders/user-api/config"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// ScopeUsersRead grants access to fetch users
+const ScopeUsersRead = "users:read"
+
+// ScopeUsersWrite grants access to create, update and delete users
+const ScopeUsersWrite = "users:write"
+
+// ScopeUsersErase grants access to irreversibly erase users, which is held apart from ScopeUsersWrite
+const ScopeUsersErase = "users:erase"
+
+// ScopeUsersExport grants access to export everything held about a user, which is held apart from ScopeUsersRead
+const ScopeUsersExport = "users:export"
+
+// ScopeAdmin grants access to administer the running application, e.g. to change its log level
+const ScopeAdmin = "admin"
+
+// ErrNoCredentials is returned when a request carries no credentials of a kind the authenticator accepts
+var ErrNoCredentials = errors.New("no credentials were provided")
+
+// ErrInvalidCredentials is returned when a request carries credentials which can't be verified
+var ErrInvalidCredentials = errors.New("the credentials provided are invalid")
+
+// Principal describes the caller on whose behalf a request is made
+type Principal struct {
+	Subject string
+	Scopes  []string
+}
+
+// HasScope determines whether the principal has been granted a scope
+func (p *Principal) HasScope(scope string) bool {
+
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator provides an interface by which to identify the caller making a request
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// chain authenticates a request with the first authenticator for which it carries credentials
+type chain []Authenticator
+
+func (c chain) Authenticate(r *http.Request) (*Principal, error) {
+
+	for _, authenticator := range c {
+		principal, err := authenticator.Authenticate(r)
+		if err != ErrNoCredentials {
+			return principal, err
+		}
+	}
+	return nil, ErrNoCredentials
+}
+
+// NewAuthenticator returns an Authenticator accepting the API keys and JWT signing keys configured
+func NewAuthenticator(cfg *config.Config) (Authenticator, error) {
+
+	keys, err := loadAPIKeys(cfg.APIKeys, cfg.APIKeysFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API keys: %s", err)
+	}
+
+	var jwks *KeySet
+	if cfg.JWKSFile != "" {
+		jwks, err = LoadKeySet(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWKS file: %s", err)
+		}
+	}
+
+	if len(keys) == 0 && jwks == nil {
+		log.Warn("no API keys or JWT signing keys are configured; every authenticated route will be refused")
+	}
+
+	return chain{
+		NewAPIKeyAuthenticator(keys),
+		NewJWTAuthenticator(jwks, cfg.JWTIssuer, cfg.JWTAudience),
+	}, nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal on whose behalf a request is made
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the principal carried by ctx, if any
+func FromContext(ctx context.Context) (*Principal, bool) {
+
+	principal, ok := ctx.Value(contextKey{}).(*Principal)
+	return principal, ok
+}
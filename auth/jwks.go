@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+)
+
+// JSONWebKey describes a key by which JWTs are signed, following RFC 7517. Symmetric (oct) keys verify HS256
+// tokens, and RSA public keys verify RS256 tokens
+type JSONWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	K   string `json:"k,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+
+	secret    []byte
+	publicKey *rsa.PublicKey
+}
+
+// KeySet describes a set of keys by which JWTs are signed, following RFC 7517
+type KeySet struct {
+	Keys []*JSONWebKey `json:"keys"`
+}
+
+// LoadKeySet reads a JWKS file
+func LoadKeySet(file string) (*KeySet, error) {
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeySet(b)
+}
+
+// ParseKeySet parses a JWKS document, rejecting any key which can't be used to verify HS256 or RS256 tokens
+func ParseKeySet(b []byte) (*KeySet, error) {
+
+	var set KeySet
+	err := json.Unmarshal(b, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range set.Keys {
+		err = key.parse()
+		if err != nil {
+			return nil, fmt.Errorf("key %d (%s): %s", i, key.Kid, err)
+		}
+	}
+	return &set, nil
+}
+
+func (k *JSONWebKey) parse() error {
+
+	switch k.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return fmt.Errorf("k must be a non-empty base64url encoded secret")
+		}
+		k.secret = secret
+
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil || len(n) == 0 {
+			return fmt.Errorf("n must be a base64url encoded modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return fmt.Errorf("e must be a base64url encoded exponent")
+		}
+		k.publicKey = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+
+	default:
+		return fmt.Errorf("unsupported kty: %s", k.Kty)
+	}
+	return nil
+}
+
+// verifies determines whether a key may verify tokens signed with an algorithm; a symmetric key must never
+// verify an RS256 token, nor an RSA key an HS256 token
+func (k *JSONWebKey) verifies(alg string) bool {
+	return (alg == algHS256 && k.secret != nil) || (alg == algRS256 && k.publicKey != nil)
+}
+
+// candidates returns the keys which may have signed a token, by its key id if given
+func (s *KeySet) candidates(alg string, kid string) []*JSONWebKey {
+
+	var keys []*JSONWebKey
+	for _, key := range s.Keys {
+		if key.verifies(alg) && (kid == "" || key.Kid == kid) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const algHS256 = "HS256"
+const algRS256 = "RS256"
+
+// clockSkew is the leeway given when checking the expiry and not-before times of a token
+const clockSkew = time.Minute
+
+// JWTAuthenticator authenticates requests presenting a JWT bearer token, signed with HS256 or RS256 by a key
+// in a locally configured key set
+type JWTAuthenticator struct {
+	keys     *KeySet
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+// NewJWTAuthenticator returns an Authenticator accepting JWTs signed by the given keys and, where configured,
+// issued by the given issuer for the given audience
+func NewJWTAuthenticator(keys *KeySet, issuer string, audience string) Authenticator {
+	return &JWTAuthenticator{
+		keys:     keys,
+		issuer:   issuer,
+		audience: audience,
+		now:      time.Now,
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwtClaims describes the registered claims of a token, and the scopes it grants, as either a space separated
+// scope claim or an scp array
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Scope     string   `json:"scope"`
+	Scp       []string `json:"scp"`
+}
+
+// audience may be a single string or an array of strings, per RFC 7519
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+
+	var single string
+	if json.Unmarshal(b, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	err := json.Unmarshal(b, &many)
+	*a = many
+	return err
+}
+
+// Authenticate identifies the caller by the subject of the token presented, granting the scopes it lists
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+
+	if a.keys == nil {
+		return nil, errors.New("no keys are configured by which to verify bearer tokens")
+	}
+
+	claims, err := a.verify(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := claims.Scp
+	if claims.Scope != "" {
+		scopes = append(scopes, strings.Fields(claims.Scope)...)
+	}
+
+	return &Principal{
+		Subject: claims.Subject,
+		Scopes:  scopes,
+	}, nil
+}
+
+// verify checks the signature and claims of a token, returning its claims if valid
+func (a *JWTAuthenticator) verify(token string) (*jwtClaims, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is malformed")
+	}
+
+	var header jwtHeader
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, fmt.Errorf("token header is malformed: %s", err)
+	}
+
+	// the algorithm is restricted up front, so that tokens can't opt out of verification with "none"
+	if header.Alg != algHS256 && header.Alg != algRS256 {
+		return nil, fmt.Errorf("unsupported token algorithm: %s", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("token signature is malformed")
+	}
+
+	if !a.verifySignature(header, parts[0]+"."+parts[1], signature) {
+		return nil, errors.New("token signature is invalid")
+	}
+
+	var claims jwtClaims
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, fmt.Errorf("token claims are malformed: %s", err)
+	}
+
+	err = a.validate(&claims)
+	if err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func (a *JWTAuthenticator) verifySignature(header jwtHeader, signingInput string, signature []byte) bool {
+
+	digest := sha256.Sum256([]byte(signingInput))
+
+	for _, key := range a.keys.candidates(header.Alg, header.Kid) {
+		switch header.Alg {
+		case algHS256:
+			mac := hmac.New(sha256.New, key.secret)
+			mac.Write([]byte(signingInput))
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return true
+			}
+		case algRS256:
+			if rsa.VerifyPKCS1v15(key.publicKey, crypto.SHA256, digest[:], signature) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validate checks the time-bound, issuer and audience claims of a token
+func (a *JWTAuthenticator) validate(claims *jwtClaims) error {
+
+	now := a.now()
+
+	if claims.ExpiresAt == nil {
+		return errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(*claims.ExpiresAt), 0).Add(clockSkew)) {
+		return errors.New("token has expired")
+	}
+	if claims.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(int64(*claims.NotBefore), 0)) {
+		return errors.New("token is not yet valid")
+	}
+	if claims.Subject == "" {
+		return errors.New("token has no subject")
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return fmt.Errorf("token issuer is not trusted: %s", claims.Issuer)
+	}
+	if a.audience != "" && !claims.Audience.contains(a.audience) {
+		return errors.New("token is not intended for this audience")
+	}
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var hmacSecret = []byte("a-secret-of-sufficient-length-for-hs256")
+
+func TestUnitJWTAuthenticator(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ParseKeySet([]byte(fmt.Sprintf(`{"keys": [
+		{"kid": "hmac", "kty": "oct", "k": "%s"},
+		{"kid": "rsa", "kty": "RSA", "n": "%s", "e": "%s"}
+	]}`,
+		base64.RawURLEncoding.EncodeToString(hmacSecret),
+		base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	authenticator := &JWTAuthenticator{
+		keys:     keys,
+		issuer:   "https://issuer.example.com",
+		audience: "user-api",
+		now:      func() time.Time { return now },
+	}
+
+	claims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":   "client",
+			"iss":   "https://issuer.example.com",
+			"aud":   []string{"user-api", "other-api"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"scope": "users:read users:write",
+		}
+	}
+
+	authenticate := func(token string) (*Principal, error) {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return authenticator.Authenticate(req)
+	}
+
+	Convey("Given a request without a bearer token", t, func() {
+
+		_, err := authenticator.Authenticate(httptest.NewRequest(http.MethodGet, "/users", nil))
+
+		Convey("Then I expect no credentials to be found", func() {
+
+			So(err, ShouldEqual, ErrNoCredentials)
+		})
+	})
+
+	Convey("Given a valid HS256 token", t, func() {
+
+		principal, err := authenticate(signHS256("hmac", claims()))
+
+		Convey("Then I expect the principal to be the subject, with the scopes granted", func() {
+
+			So(err, ShouldBeNil)
+			So(principal.Subject, ShouldEqual, "client")
+			So(principal.Scopes, ShouldResemble, []string{"users:read", "users:write"})
+		})
+	})
+
+	Convey("Given a valid RS256 token", t, func() {
+
+		c := claims()
+		delete(c, "scope")
+		c["scp"] = []string{"users:read"}
+		c["aud"] = "user-api"
+
+		principal, err := authenticate(signRS256(rsaKey, "rsa", c))
+
+		Convey("Then I expect the principal to be the subject, with the scopes granted", func() {
+
+			So(err, ShouldBeNil)
+			So(principal.Subject, ShouldEqual, "client")
+			So(principal.Scopes, ShouldResemble, []string{"users:read"})
+		})
+	})
+
+	Convey("Given an invalid token", t, func() {
+
+		Convey("When it has expired", func() {
+
+			c := claims()
+			c["exp"] = now.Add(-2 * clockSkew).Unix()
+
+			_, err := authenticate(signHS256("hmac", c))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When it isn't valid yet", func() {
+
+			c := claims()
+			c["nbf"] = now.Add(2 * clockSkew).Unix()
+
+			_, err := authenticate(signHS256("hmac", c))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When it has no expiry", func() {
+
+			c := claims()
+			delete(c, "exp")
+
+			_, err := authenticate(signHS256("hmac", c))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When it was issued by another issuer", func() {
+
+			c := claims()
+			c["iss"] = "https://attacker.example.com"
+
+			_, err := authenticate(signHS256("hmac", c))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When it was intended for another audience", func() {
+
+			c := claims()
+			c["aud"] = "other-api"
+
+			_, err := authenticate(signHS256("hmac", c))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When its claims have been tampered with", func() {
+
+			c := claims()
+			c["sub"] = "someone-else"
+			tampered, _ := json.Marshal(c)
+
+			parts := strings.Split(signHS256("hmac", claims()), ".")
+			parts[1] = base64.RawURLEncoding.EncodeToString(tampered)
+
+			_, err := authenticate(strings.Join(parts, "."))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When it is unsigned", func() {
+
+			_, err := authenticate(sign(map[string]interface{}{"alg": "none"}, claims(), func([]byte) []byte { return nil }))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When it is signed with HS256, using the RSA public key as the secret", func() {
+
+			secret := rsaKey.N.Bytes()
+			token := sign(map[string]interface{}{"alg": "HS256", "kid": "rsa"}, claims(), func(input []byte) []byte {
+				mac := hmac.New(sha256.New, secret)
+				mac.Write(input)
+				return mac.Sum(nil)
+			})
+
+			_, err := authenticate(token)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When it is malformed", func() {
+
+			_, err := authenticate("not-a-token")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func sign(header map[string]interface{}, claims map[string]interface{}, signer func([]byte) []byte) string {
+
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return input + "." + base64.RawURLEncoding.EncodeToString(signer([]byte(input)))
+}
+
+func signHS256(kid string, claims map[string]interface{}) string {
+
+	return sign(map[string]interface{}{"alg": "HS256", "kid": kid}, claims, func(input []byte) []byte {
+		mac := hmac.New(sha256.New, hmacSecret)
+		mac.Write(input)
+		return mac.Sum(nil)
+	})
+}
+
+func signRS256(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+
+	return sign(map[string]interface{}{"alg": "RS256", "kid": kid}, claims, func(input []byte) []byte {
+		digest := sha256.Sum256(input)
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		return signature
+	})
+}
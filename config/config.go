@@ -1,24 +1,114 @@
 package config
 
 import (
-	"errors"
+	"crypto/tls"
+	"fmt"
 	"github.com/companieshouse/gofigure"
 	log "github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 )
 
-// Config holds configuration details set by the environment
+// StorageBackendMongoDB denotes users are stored in MongoDB
+const StorageBackendMongoDB = "mongodb"
+
+// StorageBackendMemory denotes users are stored in memory, for the life of the application
+const StorageBackendMemory = "memory"
+
+// LogFormatText denotes logs are written as human-readable text
+const LogFormatText = "text"
+
+// LogFormatJSON denotes logs are written as JSON, one object per line
+const LogFormatJSON = "json"
+
+// Config holds configuration details set by the environment, command-line flags or a config file, in that order
+// of precedence. Settings in a config file are named as their flags are, and secret settings are never logged
 type Config struct {
-	MongoDBURL      string `env:"MONGODB_URL"       flag:"mongodb-url"       flagDesc:"MongoDB server URL"`
-	MongoDBDatabase string `env:"MONGODB_DATABASE"  flag:"mongodb-database"  flagDesc:"MongoDB database for data"`
-	LogLevel        string `env:"LOG_LEVEL"         flag:"log-level"         flagDesc:"Logging level of the application"`
+	gofigure interface{} `order:"flag,env"`
+
+	ConfigFile           string `env:"CONFIG_FILE"                  flag:"config-file"                  flagDesc:"Path to a YAML, TOML or JSON config file"`
+	StorageBackend       string `env:"STORAGE_BACKEND"              flag:"storage-backend"              flagDesc:"Storage backend for data (mongodb or memory)"`
+	MongoDBURL           string `env:"MONGODB_URL"                  flag:"mongodb-url"                  flagDesc:"MongoDB server URL"                             secret:"true"`
+	MongoDBDatabase      string `env:"MONGODB_DATABASE"             flag:"mongodb-database"             flagDesc:"MongoDB database for data"`
+	LogLevel             string `env:"LOG_LEVEL"                    flag:"log-level"                    flagDesc:"Logging level of the application" reload:"true"`
+	LogFormat            string `env:"LOG_FORMAT"                   flag:"log-format"                   flagDesc:"Format of the application logs (json or text)" reload:"true"`
+	DBReadTimeout        int    `env:"DB_READ_TIMEOUT_MS"           flag:"db-read-timeout-ms"           flagDesc:"Timeout in milliseconds for db reads"`
+	DBWriteTimeout       int    `env:"DB_WRITE_TIMEOUT_MS"          flag:"db-write-timeout-ms"          flagDesc:"Timeout in milliseconds for db writes"`
+	ShutdownDrainDelay   int    `env:"SHUTDOWN_DRAIN_DELAY_MS"      flag:"shutdown-drain-delay-ms"      flagDesc:"Time in milliseconds to fail readiness checks before shutting down" reload:"true"`
+	ShutdownGrace        int    `env:"SHUTDOWN_GRACE_MS"            flag:"shutdown-grace-ms"            flagDesc:"Time in milliseconds for in-flight requests to complete on shutdown" reload:"true"`
+	ListenAddr           string `env:"LISTEN_ADDR"                  flag:"listen-addr"                  flagDesc:"Address on which to serve requests, as host:port"`
+	ReadTimeout          int    `env:"READ_TIMEOUT_MS"              flag:"read-timeout-ms"              flagDesc:"Timeout in milliseconds for reading a whole request"`
+	WriteTimeout         int    `env:"WRITE_TIMEOUT_MS"             flag:"write-timeout-ms"             flagDesc:"Timeout in milliseconds for writing a whole response"`
+	IdleTimeout          int    `env:"IDLE_TIMEOUT_MS"              flag:"idle-timeout-ms"              flagDesc:"Timeout in milliseconds for an idle keep-alive connection"`
+	TLSCertFile          string `env:"TLS_CERT_FILE"                flag:"tls-cert-file"                flagDesc:"Path to a PEM certificate by which to serve HTTPS"`
+	TLSKeyFile           string `env:"TLS_KEY_FILE"                 flag:"tls-key-file"                 flagDesc:"Path to the PEM private key of the TLS certificate"`
+	MaxBodyBytes         int64  `env:"MAX_BODY_BYTES"               flag:"max-body-bytes"               flagDesc:"Largest request body accepted, in bytes" reload:"true"`
+	DeletedUserRetention int    `env:"DELETED_USER_RETENTION_HOURS" flag:"deleted-user-retention-hours" flagDesc:"Time in hours for which a deleted user may be restored before it's purged"`
+	PurgeInterval        int    `env:"PURGE_INTERVAL_MS"            flag:"purge-interval-ms"            flagDesc:"Time in milliseconds between purges of deleted users"`
+	StatsCacheTTL        int    `env:"STATS_CACHE_TTL_MS"           flag:"stats-cache-ttl-ms"           flagDesc:"Time in milliseconds for which statistics of users are cached"`
+	ErasureKey           string `env:"ERASURE_KEY"                  flag:"erasure-key"                  flagDesc:"Secret key by which erased emails are hashed and erasure receipts signed" secret:"true"`
+	PIIMasterKeys        string `env:"PII_MASTER_KEYS"              flag:"pii-master-keys"              flagDesc:"JSON array of master keys by which personal data is encrypted, the first being current" secret:"true"`
+	PIIMasterKeysFile    string `env:"PII_MASTER_KEYS_FILE"         flag:"pii-master-keys-file"         flagDesc:"Path to a JSON file of further master keys by which personal data is encrypted"`
+	PIIIndexKey          string `env:"PII_INDEX_KEY"                flag:"pii-index-key"                flagDesc:"Secret key by which emails are hashed to be looked up while encrypted" secret:"true"`
+	APIKeys              string `env:"API_KEYS"                   flag:"api-keys"                     flagDesc:"JSON array of hashed API keys and their scopes" secret:"true"`
+	APIKeysFile          string `env:"API_KEYS_FILE"                flag:"api-keys-file"                flagDesc:"Path to a JSON file of hashed API keys and their scopes"`
+	JWKSFile             string `env:"JWKS_FILE"                    flag:"jwks-file"                    flagDesc:"Path to a JWKS file of keys by which bearer tokens are verified"`
+	JWTIssuer            string `env:"JWT_ISSUER"                   flag:"jwt-issuer"                   flagDesc:"Issuer required of bearer tokens"`
+	JWTAudience          string `env:"JWT_AUDIENCE"                 flag:"jwt-audience"                 flagDesc:"Audience required of bearer tokens"`
+}
+
+// defaultDBTimeout is the timeout in milliseconds for db operations, where one isn't configured
+const defaultDBTimeout = 5000
+
+// defaultShutdownDrainDelay is the time in milliseconds for which readiness checks fail before the server shuts
+// down, where one isn't configured; long enough for a load balancer to notice and stop routing traffic to us
+const defaultShutdownDrainDelay = 5000
+
+// defaultShutdownGrace is the time in milliseconds given to in-flight requests to complete on shutdown
+const defaultShutdownGrace = 5000
+
+const defaultListenAddr = ":8888"
+
+// default server timeouts in milliseconds. Writes are given long enough to stream a large export
+const (
+	defaultReadTimeout  = 10000
+	defaultWriteTimeout = 300000
+	defaultIdleTimeout  = 120000
+)
+
+// defaultMaxBodyBytes is the largest request body accepted, where not configured; enough for a full import
+const defaultMaxBodyBytes = 10 << 20
+
+// defaultDeletedUserRetention is the time in hours for which a deleted user may be restored, where not configured
+const defaultDeletedUserRetention = 30 * 24
+
+// defaultPurgeInterval is the time in milliseconds between purges of deleted users, where not configured
+const defaultPurgeInterval = 3600000
+
+// defaultStatsCacheTTL is the time in milliseconds for which statistics of users are cached, where not configured
+const defaultStatsCacheTTL = 30000
+
+// ValidationReport lists every configuration value which is invalid or missing
+type ValidationReport struct {
+	Problems []string
+}
+
+func (r *ValidationReport) Error() string {
+	return "invalid configuration: " + strings.Join(r.Problems, "; ")
+}
+
+func (r *ValidationReport) add(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
 }
 
 var cfg *Config
 var mtx sync.Mutex
 
-// Get returns a pointer to a Config instance
-// populated with values from environment or command-line flags
+// Get returns a pointer to a Config instance populated with values from the environment, command-line flags or
+// a config file. Every invalid or missing value is listed in a *ValidationReport
 func Get() (*Config, error) {
 
 	mtx.Lock()
@@ -28,28 +118,243 @@ func Get() (*Config, error) {
 		return cfg, nil
 	}
 
-	cfg = &Config{}
+	c, err := load(gofigure.Gofigure)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg = c
+	return cfg, nil
+}
+
+// Reload re-reads the configuration from the environment, the command-line flags given on startup and the config
+// file, so that changes may be applied without a restart. Only the settings which can be changed while serving are
+// replaced in the configuration returned by Get, and only if the new configuration is valid; the others keep their
+// values until restart. The configuration now in effect is returned, with every change read
+func Reload() (*Config, []Change, error) {
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	next, err := load(readEnvAndFlags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg == nil {
+		cfg = next
+		return cfg, []Change{}, nil
+	}
+
+	changes := Diff(cfg, next)
+	cfg = reloadable(cfg, next)
+	return cfg, changes, nil
+}
+
+// load populates a configuration from the environment and flags, then from any config file, before validating it
+func load(populate func(interface{}) error) (*Config, error) {
 
-	err := gofigure.Gofigure(cfg)
+	c := &Config{}
+
+	err := populate(c)
 	if err != nil {
 		return nil, err
 	}
 
-	mandatoryConfigsMissing := false
+	report := &ValidationReport{}
+
+	if c.ConfigFile != "" {
+		settings, err := readFile(c.ConfigFile)
+		if err != nil {
+			report.add("CONFIG_FILE could not be read: %s", err)
+		} else {
+			applyFile(c, settings, report)
+			log.Info(fmt.Sprintf("Config file read: %s", c.ConfigFile))
+		}
+	}
+
+	setDefaults(c)
+	validate(c, report)
 
-	if cfg.MongoDBURL == "" {
-		log.Warn("MONGODB_URL not set in environment")
-		mandatoryConfigsMissing = true
+	if len(report.Problems) > 0 {
+		return nil, report
 	}
+	return c, nil
+}
 
-	if cfg.MongoDBDatabase == "" {
-		log.Warn("MONGODB_DATABASE not set in environment")
-		mandatoryConfigsMissing = true
+// setDefaults sets every unset value which has a default
+func setDefaults(c *Config) {
+
+	if c.DBReadTimeout == 0 {
+		c.DBReadTimeout = defaultDBTimeout
 	}
 
-	if mandatoryConfigsMissing {
-		return nil, errors.New("mandatory configs missing from environment")
+	if c.DBWriteTimeout == 0 {
+		c.DBWriteTimeout = defaultDBTimeout
 	}
 
-	return cfg, nil
+	if c.ShutdownDrainDelay == 0 {
+		c.ShutdownDrainDelay = defaultShutdownDrainDelay
+	}
+
+	if c.ShutdownGrace == 0 {
+		c.ShutdownGrace = defaultShutdownGrace
+	}
+
+	if c.ListenAddr == "" {
+		c.ListenAddr = defaultListenAddr
+	}
+
+	if c.ReadTimeout == 0 {
+		c.ReadTimeout = defaultReadTimeout
+	}
+
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = defaultWriteTimeout
+	}
+
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = defaultIdleTimeout
+	}
+
+	if c.MaxBodyBytes == 0 {
+		c.MaxBodyBytes = defaultMaxBodyBytes
+	}
+
+	if c.DeletedUserRetention == 0 {
+		c.DeletedUserRetention = defaultDeletedUserRetention
+	}
+
+	if c.PurgeInterval == 0 {
+		c.PurgeInterval = defaultPurgeInterval
+	}
+
+	if c.StatsCacheTTL == 0 {
+		c.StatsCacheTTL = defaultStatsCacheTTL
+	}
+
+	if c.LogFormat == "" {
+		c.LogFormat = LogFormatText
+	}
+
+	if c.StorageBackend == "" {
+		c.StorageBackend = StorageBackendMongoDB
+	}
+}
+
+// validate adds every invalid or missing value to the report
+func validate(c *Config, report *ValidationReport) {
+
+	if c.LogFormat != LogFormatText && c.LogFormat != LogFormatJSON {
+		report.add("unsupported LOG_FORMAT: %s", c.LogFormat)
+	}
+
+	if c.LogLevel != "" {
+		if _, err := log.ParseLevel(c.LogLevel); err != nil {
+			report.add("unsupported LOG_LEVEL: %s", c.LogLevel)
+		}
+	}
+
+	if c.StorageBackend != StorageBackendMongoDB && c.StorageBackend != StorageBackendMemory {
+		report.add("unsupported STORAGE_BACKEND: %s", c.StorageBackend)
+	}
+
+	// mongo settings are only required when data is stored in mongo
+	if c.StorageBackend == StorageBackendMongoDB {
+
+		if c.MongoDBURL == "" {
+			report.add("MONGODB_URL is missing")
+		}
+
+		if c.MongoDBDatabase == "" {
+			report.add("MONGODB_DATABASE is missing")
+		}
+
+		// personal data is encrypted in mongo, so can't be stored without keys
+		if c.PIIMasterKeys == "" && c.PIIMasterKeysFile == "" {
+			report.add("PII_MASTER_KEYS or PII_MASTER_KEYS_FILE is missing")
+		}
+
+		if c.PIIIndexKey == "" {
+			report.add("PII_INDEX_KEY is missing")
+		}
+
+		// tombstones and receipts must be reproducible by every replica, across restarts
+		if c.ErasureKey == "" {
+			report.add("ERASURE_KEY is missing")
+		}
+	}
+
+	durations := []struct {
+		name  string
+		value int
+	}{
+		{"DB_READ_TIMEOUT_MS", c.DBReadTimeout},
+		{"DB_WRITE_TIMEOUT_MS", c.DBWriteTimeout},
+		{"SHUTDOWN_DRAIN_DELAY_MS", c.ShutdownDrainDelay},
+		{"SHUTDOWN_GRACE_MS", c.ShutdownGrace},
+		{"READ_TIMEOUT_MS", c.ReadTimeout},
+		{"WRITE_TIMEOUT_MS", c.WriteTimeout},
+		{"IDLE_TIMEOUT_MS", c.IdleTimeout},
+		{"DELETED_USER_RETENTION_HOURS", c.DeletedUserRetention},
+		{"PURGE_INTERVAL_MS", c.PurgeInterval},
+		{"STATS_CACHE_TTL_MS", c.StatsCacheTTL},
+	}
+	for _, duration := range durations {
+		if duration.value < 0 {
+			report.add("%s must not be negative: %d", duration.name, duration.value)
+		}
+	}
+
+	if c.MaxBodyBytes < 0 {
+		report.add("MAX_BODY_BYTES must not be negative: %d", c.MaxBodyBytes)
+	}
+
+	validateListenAddr(c.ListenAddr, report)
+	validateTLS(c.TLSCertFile, c.TLSKeyFile, report)
+}
+
+func validateListenAddr(addr string, report *ValidationReport) {
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		report.add("LISTEN_ADDR must be given as host:port: %s", addr)
+		return
+	}
+
+	if number, err := strconv.Atoi(port); err != nil || number < 0 || number > 65535 {
+		report.add("LISTEN_ADDR has an invalid port: %s", addr)
+	}
+}
+
+// validateTLS requires a certificate and key to be given together, and to form a valid pair
+func validateTLS(certFile string, keyFile string, report *ValidationReport) {
+
+	if certFile == "" && keyFile == "" {
+		return
+	}
+
+	if certFile == "" || keyFile == "" {
+		report.add("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		return
+	}
+
+	if _, err := os.Stat(certFile); err != nil {
+		report.add("TLS_CERT_FILE could not be read: %s", err)
+		return
+	}
+
+	if _, err := os.Stat(keyFile); err != nil {
+		report.add("TLS_KEY_FILE could not be read: %s", err)
+		return
+	}
+
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		report.add("TLS_CERT_FILE and TLS_KEY_FILE are not a valid pair: %s", err)
+	}
+}
+
+// TLSEnabled determines whether requests are served over HTTPS
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
 }
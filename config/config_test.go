@@ -0,0 +1,231 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitReadFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	expected := map[string]string{
+		"listen-addr":    ":8443",
+		"max-body-bytes": "10000",
+		"mongodb-url":    "mongodb://localhost:27017/#primary",
+		"jwt-audience":   "it's",
+	}
+
+	Convey("Given a YAML config file", t, func() {
+
+		path := write("config.yaml", `---
+# server settings
+listen-addr: ":8443"
+max-body-bytes: 10000 # bytes
+mongodb-url: "mongodb://localhost:27017/#primary"
+jwt-audience: 'it''s'
+jwt-issuer:
+`)
+
+		Convey("Then I expect each setting to be read", func() {
+
+			settings, err := readFile(path)
+
+			So(err, ShouldBeNil)
+			So(settings, ShouldResemble, expected)
+		})
+	})
+
+	Convey("Given a TOML config file", t, func() {
+
+		path := write("config.toml", `# server settings
+listen-addr = ":8443"
+max-body-bytes = 10_000 # bytes
+mongodb-url = "mongodb://localhost:27017/#primary"
+jwt-audience = 'it''s'
+`)
+
+		Convey("Then I expect each setting to be read", func() {
+
+			settings, err := readFile(path)
+
+			So(err, ShouldBeNil)
+			So(settings, ShouldResemble, expected)
+		})
+	})
+
+	Convey("Given a JSON config file", t, func() {
+
+		path := write("config.json", `{"listen-addr": ":8443", "max-body-bytes": 10000,
+			"mongodb-url": "mongodb://localhost:27017/#primary", "jwt-audience": "it's", "jwt-issuer": null}`)
+
+		Convey("Then I expect each setting to be read", func() {
+
+			settings, err := readFile(path)
+
+			So(err, ShouldBeNil)
+			So(settings, ShouldResemble, expected)
+		})
+	})
+
+	Convey("Given config files with nested settings", t, func() {
+
+		yaml := write("nested.yaml", "server:\n  listen-addr: \":8443\"\n")
+		toml := write("nested.toml", "[server]\nlisten-addr = \":8443\"\n")
+		json := write("nested.json", `{"server": {"listen-addr": ":8443"}}`)
+
+		Convey("Then I expect them to be refused", func() {
+
+			for _, path := range []string{yaml, toml, json} {
+				_, err := readFile(path)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("Given a config file in an unsupported format", t, func() {
+
+		path := write("config.ini", "listen-addr=:8443\n")
+
+		Convey("Then I expect it to be refused", func() {
+
+			_, err := readFile(path)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestUnitApplyFile(t *testing.T) {
+
+	Convey("Given some values have been set by the environment or flags", t, func() {
+
+		c := &Config{ListenAddr: ":9000", DBReadTimeout: 100}
+		report := &ValidationReport{}
+
+		Convey("When I apply a config file", func() {
+
+			applyFile(c, map[string]string{
+				"listen-addr":         ":8443",
+				"db-read-timeout-ms":  "200",
+				"db-write-timeout-ms": "300",
+				"log-format":          "json",
+			}, report)
+
+			Convey("Then I expect the file to set only the values not already set", func() {
+
+				So(report.Problems, ShouldBeEmpty)
+				So(c.ListenAddr, ShouldEqual, ":9000")
+				So(c.DBReadTimeout, ShouldEqual, 100)
+				So(c.DBWriteTimeout, ShouldEqual, 300)
+				So(c.LogFormat, ShouldEqual, LogFormatJSON)
+			})
+		})
+
+		Convey("When I apply a config file with unknown and invalid settings", func() {
+
+			applyFile(c, map[string]string{
+				"listen-port":         "8443",
+				"config-file":         "other.yaml",
+				"db-write-timeout-ms": "soon",
+			}, report)
+
+			Convey("Then I expect each to be reported", func() {
+
+				So(report.Problems, ShouldResemble, []string{
+					"unknown setting in CONFIG_FILE: config-file",
+					"DB_WRITE_TIMEOUT_MS in CONFIG_FILE must be an integer: soon",
+					"unknown setting in CONFIG_FILE: listen-port",
+				})
+			})
+		})
+	})
+}
+
+func TestUnitValidate(t *testing.T) {
+
+	Convey("Given no values are set", t, func() {
+
+		c := &Config{}
+		setDefaults(c)
+
+		Convey("Then I expect defaults for everything but the mongo settings", func() {
+
+			report := &ValidationReport{}
+			validate(c, report)
+
+			So(report.Problems, ShouldResemble, []string{
+				"MONGODB_URL is missing",
+				"MONGODB_DATABASE is missing",
+				"PII_MASTER_KEYS or PII_MASTER_KEYS_FILE is missing",
+				"PII_INDEX_KEY is missing",
+				"ERASURE_KEY is missing",
+			})
+			So(c.ListenAddr, ShouldEqual, defaultListenAddr)
+			So(c.ShutdownGrace, ShouldEqual, defaultShutdownGrace)
+			So(c.MaxBodyBytes, ShouldEqual, defaultMaxBodyBytes)
+			So(c.TLSEnabled(), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given many values are invalid", t, func() {
+
+		c := &Config{
+			StorageBackend: StorageBackendMemory,
+			LogLevel:       "loud",
+			LogFormat:      "xml",
+			ListenAddr:     "localhost:http-alt",
+			IdleTimeout:    -1,
+			MaxBodyBytes:   -1,
+			TLSKeyFile:     "key.pem",
+		}
+		setDefaults(c)
+
+		Convey("Then I expect every one to be reported", func() {
+
+			report := &ValidationReport{}
+			validate(c, report)
+
+			So(report.Problems, ShouldResemble, []string{
+				"unsupported LOG_FORMAT: xml",
+				"unsupported LOG_LEVEL: loud",
+				"IDLE_TIMEOUT_MS must not be negative: -1",
+				"MAX_BODY_BYTES must not be negative: -1",
+				"LISTEN_ADDR has an invalid port: localhost:http-alt",
+				"TLS_CERT_FILE and TLS_KEY_FILE must be set together",
+			})
+			So(report.Error(), ShouldStartWith, "invalid configuration: unsupported LOG_FORMAT: xml; ")
+		})
+	})
+
+	Convey("Given a TLS certificate and key which can't be read", t, func() {
+
+		c := &Config{StorageBackend: StorageBackendMemory, TLSCertFile: "missing-cert.pem", TLSKeyFile: "missing-key.pem"}
+		setDefaults(c)
+
+		Convey("Then I expect it to be reported", func() {
+
+			report := &ValidationReport{}
+			validate(c, report)
+
+			So(len(report.Problems), ShouldEqual, 1)
+			So(report.Problems[0], ShouldStartWith, "TLS_CERT_FILE could not be read")
+		})
+	})
+}
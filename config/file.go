@@ -0,0 +1,264 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// readFile reads the settings of a config file, in a format chosen by its extension. Files are flat; each setting
+// is named as its flag is, e.g. listen-addr
+func readFile(path string) (map[string]string, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return parseJSON(data)
+	case ".yaml", ".yml":
+		return parseYAML(data)
+	case ".toml":
+		return parseTOML(data)
+	default:
+		return nil, fmt.Errorf("unsupported format, must be .yaml, .yml, .toml or .json: %s", path)
+	}
+}
+
+// applyFile sets each value not already set by the environment or a flag to its setting in a config file
+func applyFile(c *Config, settings map[string]string, report *ValidationReport) {
+
+	fields := make(map[string]reflect.Value)
+	envNames := make(map[string]string)
+
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if name := field.Tag.Get("flag"); name != "" {
+			fields[name] = value.Field(i)
+			envNames[name] = field.Tag.Get("env")
+		}
+	}
+
+	for _, name := range sortedKeys(settings) {
+
+		field, ok := fields[name]
+		if !ok || name == "config-file" {
+			report.add("unknown setting in CONFIG_FILE: %s", name)
+			continue
+		}
+
+		setting := settings[name]
+		switch field.Kind() {
+		case reflect.String:
+			if field.String() != "" {
+				// already set by the environment or a flag
+				continue
+			}
+			field.SetString(setting)
+		case reflect.Int, reflect.Int64:
+			if field.Int() != 0 {
+				continue
+			}
+			number, err := strconv.ParseInt(setting, 10, 64)
+			if err != nil {
+				report.add("%s in CONFIG_FILE must be an integer: %s", envNames[name], setting)
+				continue
+			}
+			field.SetInt(number)
+		}
+	}
+}
+
+// parseJSON reads a JSON object of settings, each of which must be a string, number or boolean
+func parseJSON(data []byte) (map[string]string, error) {
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document map[string]interface{}
+	err := decoder.Decode(&document)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]string, len(document))
+	for name, value := range document {
+		switch v := value.(type) {
+		case string:
+			settings[name] = v
+		case json.Number:
+			settings[name] = v.String()
+		case bool:
+			settings[name] = strconv.FormatBool(v)
+		case nil:
+			// a null setting is left unset
+		default:
+			return nil, fmt.Errorf("setting must be a string, number or boolean: %s", name)
+		}
+	}
+	return settings, nil
+}
+
+// lineFormat describes a format in which settings are written one per line, each as a key, a separator and a value
+type lineFormat struct {
+	separator string
+	// indented lines are nested settings, rather than merely indented
+	nested bool
+	// skip recognises lines which carry no setting, other than blank lines and comments
+	skip  func(line string) bool
+	value func(line int, raw string) (string, error)
+}
+
+var yamlFormat = lineFormat{
+	separator: ":",
+	nested:    true,
+	skip: func(line string) bool {
+		return line == "---"
+	},
+	value: func(line int, raw string) (string, error) {
+		if raw == "" || raw == "~" || raw == "null" {
+			return "", nil
+		}
+		if strings.ContainsAny(raw[:1], "[{|>") {
+			return "", fmt.Errorf("line %d: setting must be a scalar", line)
+		}
+		return parseScalar(line, raw)
+	},
+}
+
+var tomlFormat = lineFormat{
+	separator: "=",
+	skip: func(line string) bool {
+		return false
+	},
+	value: func(line int, raw string) (string, error) {
+		if raw == "" || strings.ContainsAny(raw[:1], "[{") {
+			return "", fmt.Errorf("line %d: setting must be a string, integer or boolean", line)
+		}
+		if !strings.ContainsAny(raw[:1], `"'`) {
+			// integers may be written with underscores between digits, e.g. 10_000
+			raw = strings.Replace(raw, "_", "", -1)
+		}
+		return parseScalar(line, raw)
+	},
+}
+
+// parseYAML reads a YAML mapping of settings, one per line as key: value. Only plain and quoted scalars are
+// supported, not nested mappings or sequences
+func parseYAML(data []byte) (map[string]string, error) {
+	return parseLines(data, yamlFormat)
+}
+
+// parseTOML reads TOML settings, one per line as key = value. Tables and arrays aren't supported
+func parseTOML(data []byte) (map[string]string, error) {
+	return parseLines(data, tomlFormat)
+}
+
+// parseLines reads settings written one per line. Blank lines and comments are skipped
+func parseLines(data []byte, format lineFormat) (map[string]string, error) {
+
+	settings := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || format.skip(text) {
+			continue
+		}
+
+		indented := strings.TrimLeft(scanner.Text(), " \t") != scanner.Text()
+		if strings.HasPrefix(text, "[") || (format.nested && indented) {
+			return nil, fmt.Errorf("line %d: settings must be given one per line, at the top level", line)
+		}
+
+		parts := strings.SplitN(text, format.separator, 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("line %d: expected a setting as key%svalue", line, format.separator)
+		}
+
+		name := unquoteKey(strings.TrimSpace(parts[0]))
+		if _, ok := settings[name]; ok {
+			return nil, fmt.Errorf("line %d: repeated setting: %s", line, name)
+		}
+
+		value, err := format.value(line, stripComment(strings.TrimSpace(parts[1])))
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			settings[name] = value
+		}
+	}
+
+	return settings, scanner.Err()
+}
+
+// parseScalar reads a double quoted, single quoted or plain value
+func parseScalar(line int, raw string) (string, error) {
+
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("line %d: invalid quoted string: %s", line, raw)
+		}
+		return value, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("line %d: invalid quoted string: %s", line, raw)
+		}
+		return strings.Replace(raw[1:len(raw)-1], "''", "'", -1), nil
+	}
+	return raw, nil
+}
+
+// stripComment removes a comment following a value, other than within quotes
+func stripComment(raw string) string {
+
+	var quote rune
+	escaped := false
+	for i, c := range raw {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#' && (i == 0 || raw[i-1] == ' ' || raw[i-1] == '\t'):
+			return strings.TrimSpace(raw[:i])
+		}
+	}
+	return raw
+}
+
+func unquoteKey(key string) string {
+
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
+
+func sortedKeys(settings map[string]string) []string {
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
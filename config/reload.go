@@ -0,0 +1,105 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+)
+
+// redacted stands in for the value of a secret setting wherever a change to it is described
+const redacted = "[redacted]"
+
+// Change describes a setting which differs between two configurations, named as its environment variable, and
+// whether it's applied on reload
+type Change struct {
+	Setting    string
+	Before     string
+	After      string
+	Reloadable bool
+}
+
+// Diff lists the settings which differ between two configurations, in the order they're declared. The values of
+// secret settings are redacted
+func Diff(before *Config, after *Config) []Change {
+
+	changes := make([]Change, 0)
+
+	b := reflect.ValueOf(before).Elem()
+	a := reflect.ValueOf(after).Elem()
+	for i := 0; i < b.NumField(); i++ {
+
+		field := b.Type().Field(i)
+		setting := field.Tag.Get("env")
+		if setting == "" {
+			continue
+		}
+
+		previous := fmt.Sprint(b.Field(i).Interface())
+		current := fmt.Sprint(a.Field(i).Interface())
+		if previous == current {
+			continue
+		}
+
+		if field.Tag.Get("secret") == "true" {
+			previous, current = redacted, redacted
+		}
+		changes = append(changes, Change{Setting: setting, Before: previous, After: current, Reloadable: field.Tag.Get("reload") == "true"})
+	}
+	return changes
+}
+
+// reloadable returns a copy of the current configuration, with the settings which can be changed while serving
+// taken from the next
+func reloadable(current *Config, next *Config) *Config {
+
+	applied := *current
+
+	a := reflect.ValueOf(&applied).Elem()
+	n := reflect.ValueOf(next).Elem()
+	for i := 0; i < a.NumField(); i++ {
+		if a.Type().Field(i).Tag.Get("reload") == "true" {
+			a.Field(i).Set(n.Field(i))
+		}
+	}
+	return &applied
+}
+
+// readEnvAndFlags populates a configuration from the environment and the command-line flags parsed on startup,
+// the environment taking precedence, as Get does. Flags can't be registered twice, so those already parsed are
+// read instead
+func readEnvAndFlags(s interface{}) error {
+
+	value := reflect.ValueOf(s).Elem()
+	for i := 0; i < value.NumField(); i++ {
+
+		field := value.Type().Field(i)
+		env := field.Tag.Get("env")
+		if env == "" {
+			continue
+		}
+
+		setting := os.Getenv(env)
+		if setting == "" {
+			if f := flag.Lookup(field.Tag.Get("flag")); f != nil {
+				setting = f.Value.String()
+			}
+		}
+		if setting == "" {
+			continue
+		}
+
+		switch value.Field(i).Kind() {
+		case reflect.String:
+			value.Field(i).SetString(setting)
+		case reflect.Int, reflect.Int64:
+			number, err := strconv.ParseInt(setting, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s must be an integer: %s", env, setting)
+			}
+			value.Field(i).SetInt(number)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package countries
+
+import (
+	"strings"
+)
+
+// Country describes an ISO 3166-1 country
+type Country struct {
+	Alpha2  string `json:"alpha_2"`
+	Alpha3  string `json:"alpha_3"`
+	Numeric string `json:"numeric"`
+	Name    string `json:"name"`
+}
+
+var byCode = index()
+
+func index() map[string]*Country {
+
+	codes := make(map[string]*Country, len(table)*3)
+	for i := range table {
+		country := &table[i]
+		codes[country.Alpha2] = country
+		codes[country.Alpha3] = country
+		codes[country.Numeric] = country
+	}
+	return codes
+}
+
+// All returns every ISO 3166-1 country, ordered by alpha-2 code
+func All() []Country {
+
+	all := make([]Country, len(table))
+	copy(all, table)
+	return all
+}
+
+// Lookup finds a country by its alpha-2, alpha-3 or numeric code, regardless of case
+func Lookup(code string) (Country, bool) {
+
+	country, ok := byCode[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return Country{}, false
+	}
+	return *country, true
+}
+
+// Normalise returns the alpha-2 code for any recognised country code, or the code unchanged if unrecognised
+func Normalise(code string) string {
+
+	country, ok := Lookup(code)
+	if !ok {
+		return code
+	}
+	return country.Alpha2
+}
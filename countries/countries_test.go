@@ -0,0 +1,88 @@
+package countries
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitLookup(t *testing.T) {
+
+	Convey("Given I look up a country by each of its codes, in any case", t, func() {
+
+		codes := []string{"GB", "gb", "GBR", "gbr", "826", " GB "}
+
+		Convey("Then I expect to find the same country", func() {
+
+			for _, code := range codes {
+				country, ok := Lookup(code)
+				So(ok, ShouldBeTrue)
+				So(country.Alpha2, ShouldEqual, "GB")
+				So(country.Alpha3, ShouldEqual, "GBR")
+				So(country.Numeric, ShouldEqual, "826")
+			}
+		})
+	})
+
+	Convey("Given I look up codes which aren't assigned to a country", t, func() {
+
+		codes := []string{"ZZ", "QQ", "XXX", "999", "", "G"}
+
+		Convey("Then I expect not to find a country", func() {
+
+			for _, code := range codes {
+				_, ok := Lookup(code)
+				So(ok, ShouldBeFalse)
+			}
+		})
+	})
+}
+
+func TestUnitNormalise(t *testing.T) {
+
+	Convey("Given I normalise a recognised country code", t, func() {
+
+		Convey("Then I expect its alpha-2 code", func() {
+
+			So(Normalise("fra"), ShouldEqual, "FR")
+			So(Normalise("250"), ShouldEqual, "FR")
+			So(Normalise("fr"), ShouldEqual, "FR")
+		})
+	})
+
+	Convey("Given I normalise an unrecognised country code", t, func() {
+
+		Convey("Then I expect it to be unchanged", func() {
+
+			So(Normalise("zz"), ShouldEqual, "zz")
+		})
+	})
+}
+
+func TestUnitAll(t *testing.T) {
+
+	Convey("Given I fetch all countries", t, func() {
+
+		all := All()
+
+		Convey("Then I expect every ISO 3166-1 country, with unique codes", func() {
+
+			So(len(all), ShouldEqual, 249)
+
+			seen := make(map[string]bool)
+			for _, country := range all {
+				So(seen[country.Alpha2] || seen[country.Alpha3] || seen[country.Numeric], ShouldBeFalse)
+				seen[country.Alpha2] = true
+				seen[country.Alpha3] = true
+				seen[country.Numeric] = true
+			}
+		})
+
+		Convey("Then changes to the result don't affect the table", func() {
+
+			all[0].Name = "changed"
+
+			So(All()[0].Name, ShouldNotEqual, "changed")
+		})
+	})
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"sort"
+)
+
+// AuditQuery describes criteria by which to page through the audit events of a user, most recent first
+type AuditQuery struct {
+	UserID string
+	Limit  int
+
+	// Before holds the sequence of the event before which to start the page, or zero to start from the most recent
+	Before int64
+}
+
+// toMongoFilter converts an audit query to a mongo filter document
+func (q *AuditQuery) toMongoFilter() bson.M {
+
+	filter := bson.M{"user_id": q.UserID}
+
+	// keyset pagination: events which precede the cursor position
+	if q.Before > 0 {
+		filter["sequence"] = bson.M{"$lt": q.Before}
+	}
+
+	return filter
+}
+
+// toMongoSort converts an audit query to a mongo sort document
+func (q *AuditQuery) toMongoSort() bson.D {
+	return bson.D{{Key: "sequence", Value: -1}}
+}
+
+// apply filters, sorts and pages an array of audit events in memory, with the same semantics as the mongo query
+func (q *AuditQuery) apply(events []*models.AuditEventDao) []*models.AuditEventDao {
+
+	matched := make([]*models.AuditEventDao, 0)
+	for _, event := range events {
+		if event.UserID == q.UserID && (q.Before <= 0 || event.Sequence < q.Before) {
+			matched = append(matched, event)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Sequence > matched[j].Sequence
+	})
+
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+
+	return matched
+}
+
+// createdEvents returns the audit events of the entities of a batch which were created, by the errors of the batch
+func createdEvents(errs []error, events []*models.AuditEventDao) []*models.AuditEventDao {
+
+	created := make([]*models.AuditEventDao, 0, len(events))
+	for i, event := range events {
+		if i < len(errs) && errs[i] == nil {
+			created = append(created, event)
+		}
+	}
+	return created
+}
@@ -4,34 +4,73 @@ import (
 	"context"
 	"fmt"
 	"github.com/bpsaunders/user-api/config"
+	"github.com/bpsaunders/user-api/encryption"
 	"github.com/bpsaunders/user-api/models"
 	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"os"
 	"time"
 )
 
 // Client provides an interface by which to interact with a database
 type Client interface {
-	CreateUser(entity *models.UserDao) error
-	GetUser(id string) (*models.UserDao, error)
-	GetAllUsers() (*[]*models.UserDao, error)
-	UserExistsWithEmail(email string) (bool, error)
+	CreateUser(ctx context.Context, entity *models.UserDao) error
+	CreateUsers(ctx context.Context, entities []*models.UserDao, events []*models.AuditEventDao, atomic bool) ([]error, error)
+	GetUser(ctx context.Context, id string) (*models.UserDao, error)
+	GetAllUsers(ctx context.Context, query *UserQuery) (*[]*models.UserDao, error)
+	CountUsers(ctx context.Context, filter *UserFilter) (int64, error)
+	StreamUsers(ctx context.Context, filter *UserFilter, fn func(entity *models.UserDao) error) error
+	GetUserByEmail(ctx context.Context, email string) (*models.UserDao, error)
+	SearchUsers(ctx context.Context, search *UserSearch) (*[]*models.UserDao, error)
+	GetUserStats(ctx context.Context, query *UserStatsQuery) (*models.UserStatsDao, error)
+	UserExistsWithEmail(ctx context.Context, email string) (bool, error)
+	ExistingEmails(ctx context.Context, emails []string) ([]string, error)
+	UpdateUser(ctx context.Context, entity *models.UserDao, version int64) error
+	DeleteUser(ctx context.Context, id string, version int64) (*models.UserDao, error)
+	GetDeletedUser(ctx context.Context, id string) (*models.UserDao, error)
+	RestoreUser(ctx context.Context, entity *models.UserDao, version int64) error
+	PurgeUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
+	EraseUser(ctx context.Context, entity *models.UserDao, version int64) error
+	CreateAuditEvent(ctx context.Context, event *models.AuditEventDao) error
+	GetAuditEvents(ctx context.Context, query *AuditQuery) (*[]*models.AuditEventDao, error)
+	RedactAuditEvents(ctx context.Context, userID string, fields []string, replacement string) error
+	CreateErasureReceipt(ctx context.Context, receipt *models.ErasureReceiptDao) error
+	GetErasureReceipt(ctx context.Context, userID string) (*models.ErasureReceiptDao, error)
+	CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecordDao) error
+	GetIdempotencyRecord(ctx context.Context, id string, fingerprint string) (*models.IdempotencyRecordDao, error)
+	CompleteIdempotencyRecord(ctx context.Context, id string, userID string, response []byte) error
+	GetUserIdempotencyRecords(ctx context.Context, userID string) ([]*models.IdempotencyRecordDao, error)
+	DeleteIdempotencyRecord(ctx context.Context, id string) error
+	Ping(ctx context.Context) error
 	Shutdown()
 }
 
-// DatabaseClient is a concrete implementation of the Client interface
+// DatabaseClient is a concrete implementation of the Client interface. The personal data of users is encrypted
+// before it's written, and decrypted as it's read
 type DatabaseClient struct {
-	db MongoDatabaseInterface
+	db      MongoDatabaseInterface
+	keyring *encryption.Keyring
 }
 
 // NewDatabaseClient returns a new implementation of the Client interface
-func NewDatabaseClient(cfg *config.Config) Client {
-	return &DatabaseClient{
-		db: getMongoDatabase(cfg.MongoDBURL, cfg.MongoDBDatabase),
+func NewDatabaseClient(cfg *config.Config) *DatabaseClient {
+
+	// as with connecting, the program must bail out if unable to encrypt personal data
+	keyring, err := encryption.NewKeyring(cfg)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to load encryption keys: %s", err))
+		os.Exit(1)
+	}
+
+	client := &DatabaseClient{
+		db:      getMongoDatabase(cfg.MongoDBURL, cfg.MongoDBDatabase),
+		keyring: keyring,
 	}
+	client.ensureIndexes()
+	return client
 }
 
 var mgoClient *mongo.Client
@@ -70,27 +109,247 @@ func getMongoDatabase(mongoDBURL, databaseName string) MongoDatabaseInterface {
 	return getMongoClient(mongoDBURL).Database(databaseName)
 }
 
+// ensureIndexes creates the indexes on which the integrity of the data depends
+func (c *DatabaseClient) ensureIndexes() {
+
+	ctx := context.Background()
+	collection := c.db.Collection("users")
+
+	// stamp any users created before timestamps were introduced with the time of the migration, as the best
+	// available approximation
+	_, err := collection.UpdateMany(ctx,
+		bson.M{"created_at": bson.M{"$exists": false}},
+		bson.M{"$currentDate": bson.M{"created_at": true, "updated_at": true}})
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to back-fill timestamps: %s", err))
+		os.Exit(1)
+	}
+
+	// users created before versions were introduced are at their first version
+	_, err = collection.UpdateMany(ctx,
+		bson.M{"version": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"version": 1}})
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to back-fill versions: %s", err))
+		os.Exit(1)
+	}
+
+	// encrypt anything stored in the clear before encryption was introduced, giving users the blind indexes of
+	// their emails, by which they're found and kept unique
+	encrypted, skipped, err := c.reencrypt(ctx, bson.M{"data_key": bson.M{"$exists": false}})
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to encrypt personal data stored in the clear: %s", err))
+		os.Exit(1)
+	}
+	if encrypted > 0 || skipped > 0 {
+		log.Info(fmt.Sprintf("encrypted %d records stored in the clear, skipping %d changed meanwhile", encrypted, skipped))
+	}
+
+	// users stored before search, or filtering by name prefix, was introduced are given the blind indexes by which
+	// they're found, as they're sealed afresh
+	filter := notDeleted()
+	filter[namePrefixesField] = bson.M{"$exists": false}
+	indexed, skipped, err := c.reencryptUsers(ctx, filter)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to back-fill search indexes: %s", err))
+		os.Exit(1)
+	}
+	if indexed > 0 || skipped > 0 {
+		log.Info(fmt.Sprintf("indexed %d users for searching and filtering, skipping %d changed meanwhile", indexed, skipped))
+	}
+
+	// the unique email index once covered deleted users too; it's replaced by one which doesn't, so that the email
+	// of a deleted user may be reused
+	_, err = collection.Indexes().DropOne(ctx, legacyEmailIndexName)
+	if err != nil && !isIndexNotFound(err) {
+		log.Error(fmt.Sprintf("failed to drop the previous unique email index: %s", err))
+		os.Exit(1)
+	}
+
+	// as with connecting, the program must bail out if unable to guarantee email uniqueness. Deleted users have no
+	// normalised email, so aren't indexed, whereas an erased user may hold the tombstone of its email in its place
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"normalised_email": 1},
+		Options: options.Index().SetName(emailIndexName).SetUnique(true).
+			SetPartialFilterExpression(bson.M{"normalised_email": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to create unique email index: %s", err))
+		os.Exit(1)
+	}
+
+	// deleted users are purged in order of deletion
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{deletedAtField: 1},
+		Options: options.Index().SetName("deleted_at").SetSparse(true),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to create deletion index: %s", err))
+		os.Exit(1)
+	}
+
+	// users are searched by the blind indexes of their tokens and prefixes, without stemming, as they're hashed
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "search.tokens", Value: "text"}, {Key: "search.prefixes", Value: "text"}},
+		Options: options.Index().SetName("search").SetDefaultLanguage("none").
+			SetWeights(bson.M{"search.tokens": tokenWeight, "search.prefixes": prefixWeight}),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to create search index: %s", err))
+		os.Exit(1)
+	}
+
+	// users are filtered by name prefix by its blind index
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{namePrefixesField: 1},
+		Options: options.Index().SetName("name_prefix").SetSparse(true),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to create name prefix index: %s", err))
+		os.Exit(1)
+	}
+
+	// the history of a user is read most recent first; no mutation of a user may be recorded twice
+	_, err = c.db.Collection("audit").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "sequence", Value: -1}},
+		Options: options.Index().SetName("user_history").SetUnique(true),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to create user history index: %s", err))
+		os.Exit(1)
+	}
+
+	// idempotency records stored before their fingerprints were indexed have the fingerprint replaced by its index
+	fingerprints, err := c.indexFingerprints(ctx)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to index the fingerprints of idempotency records: %s", err))
+		os.Exit(1)
+	}
+	if fingerprints > 0 {
+		log.Info(fmt.Sprintf("indexed the fingerprints of %d idempotency records", fingerprints))
+	}
+
+	// idempotency records are removed by mongodb once they've expired
+	_, err = c.db.Collection("idempotency").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"created_at": 1},
+		Options: options.Index().SetName("idempotency_ttl").SetExpireAfterSeconds(int32(IdempotencyTTL / time.Second)),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to create idempotency expiry index: %s", err))
+		os.Exit(1)
+	}
+
+	// the idempotency records of a user are found upon its export or erasure
+	_, err = c.db.Collection("idempotency").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"user_id": 1},
+		Options: options.Index().SetName("idempotency_user").SetSparse(true),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to create idempotency user index: %s", err))
+		os.Exit(1)
+	}
+}
+
 // MongoDatabaseInterface is an interface that describes the mongodb driver
 type MongoDatabaseInterface interface {
 	Collection(name string, opts ...*options.CollectionOptions) *mongo.Collection
+	Client() *mongo.Client
 }
 
-// CreateUser creates a user entity in the database
-func (c *DatabaseClient) CreateUser(entity *models.UserDao) error {
+// CreateUser creates a user entity in the database, returning ErrDuplicateEmail if the email is taken
+func (c *DatabaseClient) CreateUser(ctx context.Context, entity *models.UserDao) error {
+
+	document, err := c.sealUser(withNormalisedEmail(entity))
+	if err != nil {
+		return err
+	}
 
 	collection := c.db.Collection("users")
-	_, err := collection.InsertOne(context.Background(), entity)
+	_, err = collection.InsertOne(ctx, document)
 
-	return err
+	return toDuplicateEmailError(err)
+}
+
+// CreateUsers creates user entities in bulk, returning an error for each entity which wasn't created, by index:
+// ErrDuplicateEmail if its email is taken. The creation of each entity is recorded by the audit event of the same
+// index, in bulk once the entities are created; should that fail, the errors of the entities are returned along
+// with the failure. Atomically, either every entity and its event is created or none are, in a transaction (which
+// requires a replica set, ErrTransactionsUnsupported being returned otherwise), and every entity not at fault is
+// given ErrBatchAborted
+func (c *DatabaseClient) CreateUsers(ctx context.Context, entities []*models.UserDao, events []*models.AuditEventDao, atomic bool) ([]error, error) {
+
+	documents := make([]interface{}, 0, len(entities))
+	for _, entity := range entities {
+		document, err := c.sealUser(withNormalisedEmail(entity))
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	collection := c.db.Collection("users")
+
+	if !atomic {
+		// unordered, so that every entity is attempted regardless of the failure of others
+		_, err := collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+		errs, err := toBulkWriteErrors(err, len(entities))
+		if err != nil {
+			return nil, err
+		}
+		return errs, c.createAuditEvents(ctx, createdEvents(errs, events))
+	}
+
+	session, err := c.db.Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	// a failure to record the events aborts the transaction, but mustn't be mistaken for that of an entity
+	var auditErr error
+	_, err = session.WithTransaction(ctx, func(sessionContext mongo.SessionContext) (interface{}, error) {
+		auditErr = nil
+		if _, err := collection.InsertMany(sessionContext, documents); err != nil {
+			return nil, err
+		}
+		auditErr = c.createAuditEvents(sessionContext, events)
+		return nil, auditErr
+	})
+	if auditErr != nil {
+		return nil, auditErr
+	}
+	if isTransactionsUnsupported(err) {
+		return nil, ErrTransactionsUnsupported
+	}
+
+	errs, err := toBulkWriteErrors(err, len(entities))
+	if err != nil {
+		return nil, err
+	}
+	return abortBatch(errs), nil
+}
+
+// GetUser fetches a user from the db according to an id, unless it's deleted
+func (c *DatabaseClient) GetUser(ctx context.Context, id string) (*models.UserDao, error) {
+
+	return c.findUser(ctx, id, notDeleted())
 }
 
-// GetUser fetches a user from the db according to an id
-func (c *DatabaseClient) GetUser(id string) (*models.UserDao, error) {
+// GetDeletedUser fetches a deleted user from the db according to an id, including one which has been erased
+func (c *DatabaseClient) GetDeletedUser(ctx context.Context, id string) (*models.UserDao, error) {
 
-	var entity models.UserDao
+	return c.findUser(ctx, id, bson.M{deletedAtField: bson.M{"$exists": true}})
+}
+
+// findUser fetches a user from the db according to an id, if it matches a filter
+func (c *DatabaseClient) findUser(ctx context.Context, id string, filter bson.M) (*models.UserDao, error) {
+
+	var document userDocument
+
+	filter[idField] = id
 
 	collection := c.db.Collection("users")
-	dbResource := collection.FindOne(context.Background(), bson.M{"_id": id})
+	dbResource := collection.FindOne(ctx, filter)
 
 	err := dbResource.Err()
 	if err != nil {
@@ -100,47 +359,141 @@ func (c *DatabaseClient) GetUser(id string) (*models.UserDao, error) {
 		return nil, err
 	}
 
-	err = dbResource.Decode(&entity)
+	err = dbResource.Decode(&document)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &entity, nil
+	return c.openUser(&document)
 }
 
-// GetAllUsers returns an array of all users in the database
-func (c *DatabaseClient) GetAllUsers() (*[]*models.UserDao, error) {
+// GetAllUsers returns an array of users in the database which match a query
+func (c *DatabaseClient) GetAllUsers(ctx context.Context, query *UserQuery) (*[]*models.UserDao, error) {
+
+	// personal data can't be ordered while it's encrypted, as its blind indexes aren't, so the users matching the
+	// filter are decrypted and sorted in memory, provided there aren't too many of them
+	if query.sortsByPersonalData() {
+		return c.sortUsersInMemory(ctx, query)
+	}
 
 	entities := make([]*models.UserDao, 0)
 
+	findOptions := options.Find().SetSort(query.toMongoSort())
+	if query.Limit > 0 {
+		findOptions.SetLimit(int64(query.Limit))
+	}
+
 	collection := c.db.Collection("users")
-	cur, err := collection.Find(context.Background(), bson.M{})
+	cur, err := collection.Find(ctx, query.toMongoFilter(c.namePrefixIndex), findOptions)
 
 	if err != nil {
 		return nil, err
 	}
+	defer cur.Close(ctx)
 
-	for cur.Next(context.Background()) {
+	for cur.Next(ctx) {
 
-		var entity models.UserDao
-		err = cur.Decode(&entity)
+		var document userDocument
+		err = cur.Decode(&document)
 
 		if err != nil {
 			return nil, err
 		}
 
-		entities = append(entities, &entity)
+		entity, err := c.openUser(&document)
+		if err != nil {
+			return nil, err
+		}
+
+		entities = append(entities, entity)
+	}
+
+	return &entities, cur.Err()
+}
+
+// sortUsersInMemory returns the users which match a query sorting by personal data, once they're decrypted, failing
+// with ErrTooManyToSort rather than reading more users than may be sorted in memory
+func (c *DatabaseClient) sortUsersInMemory(ctx context.Context, query *UserQuery) (*[]*models.UserDao, error) {
+
+	count, err := c.CountUsers(ctx, &query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if count > personalSortLimit {
+		return nil, ErrTooManyToSort
+	}
+
+	// users may be created between counting and streaming them, so the bound is enforced as they're read too
+	entities := make([]*models.UserDao, 0, count)
+	err = c.StreamUsers(ctx, &query.Filter, func(entity *models.UserDao) error {
+		if int64(len(entities)) == personalSortLimit {
+			return ErrTooManyToSort
+		}
+		entities = append(entities, entity)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	matched := query.apply(entities)
+	return &matched, nil
+}
+
+// CountUsers returns the number of users in the database which match a filter
+func (c *DatabaseClient) CountUsers(ctx context.Context, filter *UserFilter) (int64, error) {
+
+	collection := c.db.Collection("users")
+	return collection.CountDocuments(ctx, filter.toMongoFilter(c.namePrefixIndex))
+}
+
+// streamBatchSize is the number of users fetched from mongodb at a time when streaming users
+const streamBatchSize = 500
+
+// StreamUsers calls fn with each user in the database which matches a filter, in order of id, one at a time as
+// they're read from the cursor, so that memory use is independent of the number of users. Streaming stops at the
+// first error, be it from the cursor or from fn
+func (c *DatabaseClient) StreamUsers(ctx context.Context, filter *UserFilter, fn func(entity *models.UserDao) error) error {
+
+	findOptions := options.Find().SetSort(bson.D{{Key: idField, Value: 1}}).SetBatchSize(streamBatchSize)
+
+	collection := c.db.Collection("users")
+	cur, err := collection.Find(ctx, filter.toMongoFilter(c.namePrefixIndex), findOptions)
+
+	if err != nil {
+		return err
 	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
 
-	return &entities, nil
+		var document userDocument
+		err = cur.Decode(&document)
+
+		if err != nil {
+			return err
+		}
+
+		entity, err := c.openUser(&document)
+		if err != nil {
+			return err
+		}
+
+		err = fn(entity)
+		if err != nil {
+			return err
+		}
+	}
+
+	return cur.Err()
 }
 
-// UserExistsWithEmail determines whether a user already exists in the database according to an email
-func (c *DatabaseClient) UserExistsWithEmail(email string) (bool, error) {
+// UserExistsWithEmail determines whether a user already exists in the database according to an email, regardless of case
+func (c *DatabaseClient) UserExistsWithEmail(ctx context.Context, email string) (bool, error) {
 
 	collection := c.db.Collection("users")
-	dbResource := collection.FindOne(context.Background(), bson.M{"email": email})
+	dbResource := collection.FindOne(ctx, bson.M{"normalised_email": c.emailIndex(email)})
 
 	err := dbResource.Err()
 	if err != nil {
@@ -152,6 +505,557 @@ func (c *DatabaseClient) UserExistsWithEmail(email string) (bool, error) {
 	return true, nil
 }
 
+// ExistingEmails returns those of the given emails which already belong to users, regardless of case
+func (c *DatabaseClient) ExistingEmails(ctx context.Context, emails []string) ([]string, error) {
+
+	// emails are found by their blind indexes, which can't be reversed, so are mapped back to the emails they index
+	indexes := make([]string, 0, len(emails))
+	indexed := make(map[string]string, len(emails))
+	for _, email := range emails {
+		index := c.emailIndex(email)
+		indexes = append(indexes, index)
+		indexed[index] = NormaliseEmail(email)
+	}
+
+	findOptions := options.Find().SetProjection(bson.M{"normalised_email": 1})
+
+	collection := c.db.Collection("users")
+	cur, err := collection.Find(ctx, bson.M{"normalised_email": bson.M{"$in": indexes}}, findOptions)
+
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	taken := make(map[string]bool)
+	for cur.Next(ctx) {
+
+		var document userDocument
+		err = cur.Decode(&document)
+
+		if err != nil {
+			return nil, err
+		}
+
+		taken[indexed[document.NormalisedEmail]] = true
+	}
+
+	if err = cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return takenEmails(emails, taken), nil
+}
+
+// GetUserByEmail fetches a user from the db according to an email, regardless of case
+func (c *DatabaseClient) GetUserByEmail(ctx context.Context, email string) (*models.UserDao, error) {
+
+	var document userDocument
+
+	filter := notDeleted()
+	filter["normalised_email"] = c.emailIndex(email)
+
+	collection := c.db.Collection("users")
+	dbResource := collection.FindOne(ctx, filter)
+
+	err := dbResource.Err()
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	err = dbResource.Decode(&document)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.openUser(&document)
+}
+
+// SearchUsers returns the users in the database, bar those deleted, which best match a search, most relevant
+// first, then in order of id. Personal data is encrypted, so users are matched by a text index over the blind
+// indexes of their tokens and prefixes
+func (c *DatabaseClient) SearchUsers(ctx context.Context, search *UserSearch) (*[]*models.UserDao, error) {
+
+	entities := make([]*models.UserDao, 0)
+
+	filter := notDeleted()
+	filter["$text"] = bson.M{"$search": c.searchText(search.Text)}
+
+	score := bson.M{"$meta": "textScore"}
+	findOptions := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: idField, Value: 1}})
+	if search.Limit > 0 {
+		findOptions.SetLimit(int64(search.Limit))
+	}
+
+	collection := c.db.Collection("users")
+	cur, err := collection.Find(ctx, filter, findOptions)
+
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+
+		var document userDocument
+		err = cur.Decode(&document)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entity, err := c.openUser(&document)
+		if err != nil {
+			return nil, err
+		}
+
+		entities = append(entities, entity)
+	}
+
+	return &entities, cur.Err()
+}
+
+// GetUserStats counts the users in the database which match a query, in a single aggregation. Only fields held in
+// the clear are counted, so nothing need be decrypted
+func (c *DatabaseClient) GetUserStats(ctx context.Context, query *UserStatsQuery) (*models.UserStatsDao, error) {
+
+	collection := c.db.Collection("users")
+	cur, err := collection.Aggregate(ctx, query.toMongoPipeline())
+
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	// the pipeline yields a single document, its total counted as an array of at most one count
+	var facets struct {
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+		Countries    []models.GroupCountDao  `bson:"countries"`
+		EmailDomains []models.GroupCountDao  `bson:"email_domains"`
+		Signups      []models.SignupCountDao `bson:"signups"`
+	}
+
+	if cur.Next(ctx) {
+		err = cur.Decode(&facets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = cur.Err(); err != nil {
+		return nil, err
+	}
+
+	stats := &models.UserStatsDao{
+		Countries:    facets.Countries,
+		EmailDomains: facets.EmailDomains,
+		Signups:      facets.Signups,
+	}
+	if len(facets.Total) > 0 {
+		stats.Total = facets.Total[0].Count
+	}
+
+	return stats, nil
+}
+
+// UpdateUser replaces an existing user entity in the database, conditional upon its version unless AnyVersion is
+// given; returning ErrDuplicateEmail if the email is taken, or ErrVersionConflict if the version doesn't match
+func (c *DatabaseClient) UpdateUser(ctx context.Context, entity *models.UserDao, version int64) error {
+
+	document, err := c.sealUser(withNormalisedEmail(entity))
+	if err != nil {
+		return err
+	}
+
+	collection := c.db.Collection("users")
+	res, err := collection.ReplaceOne(ctx, versionFilter(entity.ID, version), document)
+
+	if err != nil {
+		return toDuplicateEmailError(err)
+	}
+
+	if res.MatchedCount == 0 && version != AnyVersion {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// DeleteUser marks a user in the database as deleted according to an id and, unless AnyVersion is given, version,
+// returning the user as it was before deletion, or ErrVersionConflict if no user was deleted with the given
+// version. The user is kept, at its next version, until purged, but its email is freed for reuse
+func (c *DatabaseClient) DeleteUser(ctx context.Context, id string, version int64) (*models.UserDao, error) {
+
+	var document userDocument
+
+	collection := c.db.Collection("users")
+	dbResource := collection.FindOneAndUpdate(ctx, versionFilter(id, version), bson.M{
+		"$set":   bson.M{deletedAtField: deletionTime()},
+		"$inc":   bson.M{"version": 1},
+		"$unset": bson.M{"normalised_email": "", "search": ""},
+	})
+
+	err := dbResource.Err()
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			if version != AnyVersion {
+				return nil, ErrVersionConflict
+			}
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	err = dbResource.Decode(&document)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.openUser(&document)
+}
+
+// RestoreUser replaces a deleted user in the database with the given entity, which isn't deleted, conditional upon
+// the version of the deleted user; returning ErrDuplicateEmail if the email has since been taken, or
+// ErrVersionConflict if no deleted user has the given id and version. An erased user is never restored
+func (c *DatabaseClient) RestoreUser(ctx context.Context, entity *models.UserDao, version int64) error {
+
+	filter := notErased()
+	filter[idField] = entity.ID
+	filter["version"] = version
+	filter[deletedAtField] = bson.M{"$exists": true}
+
+	document, err := c.sealUser(withNormalisedEmail(entity))
+	if err != nil {
+		return err
+	}
+
+	collection := c.db.Collection("users")
+	res, err := collection.ReplaceOne(ctx, filter, document)
+
+	if err != nil {
+		return toDuplicateEmailError(err)
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// PurgeUsers permanently removes users from the database which were deleted before the given time, returning how
+// many were removed. Erased users are kept, so that their tombstones endure
+func (c *DatabaseClient) PurgeUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	filter := notErased()
+	filter[deletedAtField] = bson.M{"$lt": deletedBefore}
+
+	collection := c.db.Collection("users")
+	res, err := collection.DeleteMany(ctx, filter)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return res.DeletedCount, nil
+}
+
+// EraseUser replaces a user in the database with the given entity, which has been anonymised, conditional upon
+// the version of the user, whether deleted or not; returning ErrVersionConflict if no user which hasn't already
+// been erased has the given id and version. The entity is written as given, so its normalised email is only the
+// tombstone of its email where re-registration of the email is to be blocked, and is otherwise absent
+func (c *DatabaseClient) EraseUser(ctx context.Context, entity *models.UserDao, version int64) error {
+
+	filter := notErased()
+	filter[idField] = entity.ID
+	filter["version"] = version
+
+	document, err := c.sealUser(entity)
+	if err != nil {
+		return err
+	}
+
+	collection := c.db.Collection("users")
+	res, err := collection.ReplaceOne(ctx, filter, document)
+
+	if err != nil {
+		return toDuplicateEmailError(err)
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// CreateAuditEvent appends an audit event to the audit collection
+func (c *DatabaseClient) CreateAuditEvent(ctx context.Context, event *models.AuditEventDao) error {
+
+	document, err := c.sealAuditEvent(event)
+	if err != nil {
+		return err
+	}
+
+	collection := c.db.Collection("audit")
+	_, err = collection.InsertOne(ctx, document)
+
+	return err
+}
+
+// createAuditEvents appends audit events to the audit collection in bulk
+func (c *DatabaseClient) createAuditEvents(ctx context.Context, events []*models.AuditEventDao) error {
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		document, err := c.sealAuditEvent(event)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, document)
+	}
+
+	collection := c.db.Collection("audit")
+	_, err := collection.InsertMany(ctx, documents)
+
+	return err
+}
+
+// GetAuditEvents returns a page of the audit events of a user, most recent first
+func (c *DatabaseClient) GetAuditEvents(ctx context.Context, query *AuditQuery) (*[]*models.AuditEventDao, error) {
+
+	events := make([]*models.AuditEventDao, 0)
+
+	findOptions := options.Find().SetSort(query.toMongoSort())
+	if query.Limit > 0 {
+		findOptions.SetLimit(int64(query.Limit))
+	}
+
+	collection := c.db.Collection("audit")
+	cur, err := collection.Find(ctx, query.toMongoFilter(), findOptions)
+
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+
+		var document auditDocument
+		err = cur.Decode(&document)
+
+		if err != nil {
+			return nil, err
+		}
+
+		event, err := c.openAuditEvent(&document)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return &events, cur.Err()
+}
+
+// RedactAuditEvents replaces every value recorded in the history of a user for any of the given fields, bar those
+// recording that the user didn't exist. The replacement is written in the clear
+func (c *DatabaseClient) RedactAuditEvents(ctx context.Context, userID string, fields []string, replacement string) error {
+
+	updateOptions := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+		bson.M{"before.field": bson.M{"$in": fields}, "before.before": bson.M{"$ne": nil}},
+		bson.M{"after.field": bson.M{"$in": fields}, "after.after": bson.M{"$ne": nil}},
+	}})
+
+	collection := c.db.Collection("audit")
+	_, err := collection.UpdateMany(ctx, bson.M{"user_id": userID}, bson.M{"$set": bson.M{
+		"changes.$[before].before": replacement,
+		"changes.$[after].after":   replacement,
+	}}, updateOptions)
+
+	return err
+}
+
+// CreateErasureReceipt stores the erasure receipt of a user, returning ErrErasureReceiptExists if the user
+// already has one
+func (c *DatabaseClient) CreateErasureReceipt(ctx context.Context, receipt *models.ErasureReceiptDao) error {
+
+	collection := c.db.Collection("erasure_receipts")
+	_, err := collection.InsertOne(ctx, receipt)
+
+	if isDuplicateKey(err) {
+		return ErrErasureReceiptExists
+	}
+	return err
+}
+
+// GetErasureReceipt fetches the erasure receipt of a user, if it has been erased
+func (c *DatabaseClient) GetErasureReceipt(ctx context.Context, userID string) (*models.ErasureReceiptDao, error) {
+
+	var receipt models.ErasureReceiptDao
+
+	collection := c.db.Collection("erasure_receipts")
+	dbResource := collection.FindOne(ctx, bson.M{idField: userID})
+
+	err := dbResource.Err()
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	err = dbResource.Decode(&receipt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &receipt, nil
+}
+
+// CreateIdempotencyRecord stores an idempotency record, returning ErrIdempotencyKeyExists if its key is already
+// held by an unexpired record. An expired record which mongodb is yet to remove is replaced
+func (c *DatabaseClient) CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecordDao) error {
+
+	document := &idempotencyDocument{
+		ID:               record.ID,
+		FingerprintIndex: c.fingerprintIndex(record.Fingerprint),
+		CreatedAt:        record.CreatedAt,
+	}
+	if record.Response != nil {
+		var err error
+		document.Response, document.DataKey, err = c.sealResponse(record.ID, record.Response)
+		if err != nil {
+			return err
+		}
+	}
+
+	collection := c.db.Collection("idempotency")
+	_, err := collection.ReplaceOne(ctx,
+		bson.M{idField: record.ID, "created_at": bson.M{"$lte": idempotencyCutoff()}},
+		document,
+		options.Replace().SetUpsert(true))
+
+	// an unexpired record isn't matched, so the upsert collides with it
+	if isDuplicateKey(err) {
+		return ErrIdempotencyKeyExists
+	}
+	return err
+}
+
+// GetIdempotencyRecord fetches an unexpired idempotency record according to an id. Its fingerprint is stored as a
+// blind index, so is only given as such when it's the fingerprint of the request retrying it
+func (c *DatabaseClient) GetIdempotencyRecord(ctx context.Context, id string, fingerprint string) (*models.IdempotencyRecordDao, error) {
+
+	var document idempotencyDocument
+
+	collection := c.db.Collection("idempotency")
+	dbResource := collection.FindOne(ctx, bson.M{idField: id, "created_at": bson.M{"$gt": idempotencyCutoff()}})
+
+	err := dbResource.Err()
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	err = dbResource.Decode(&document)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.openIdempotencyRecord(&document, fingerprint)
+}
+
+// CompleteIdempotencyRecord stores the response to the request an idempotency record describes, encrypted, along
+// with the id of the user it created, if any
+func (c *DatabaseClient) CompleteIdempotencyRecord(ctx context.Context, id string, userID string, response []byte) error {
+
+	sealed, dataKey, err := c.sealResponse(id, response)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"response": sealed, "data_key": dataKey}
+	if userID != "" {
+		update["user_id"] = userID
+	}
+
+	collection := c.db.Collection("idempotency")
+	_, err = collection.UpdateOne(ctx, bson.M{idField: id}, bson.M{"$set": update})
+
+	return err
+}
+
+// GetUserIdempotencyRecords returns the unexpired idempotency records of the requests which created a user, oldest
+// first, their responses decrypted
+func (c *DatabaseClient) GetUserIdempotencyRecords(ctx context.Context, userID string) ([]*models.IdempotencyRecordDao, error) {
+
+	records := make([]*models.IdempotencyRecordDao, 0)
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: idField, Value: 1}})
+
+	collection := c.db.Collection("idempotency")
+	cur, err := collection.Find(ctx, bson.M{"user_id": userID, "created_at": bson.M{"$gt": idempotencyCutoff()}}, findOptions)
+
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+
+		var document idempotencyDocument
+		err = cur.Decode(&document)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// no request is being retried, so the fingerprint of none need be given
+		record, err := c.openIdempotencyRecord(&document, "")
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, cur.Err()
+}
+
+// DeleteIdempotencyRecord removes an idempotency record, so that its key may be reused
+func (c *DatabaseClient) DeleteIdempotencyRecord(ctx context.Context, id string) error {
+
+	collection := c.db.Collection("idempotency")
+	_, err := collection.DeleteOne(ctx, bson.M{idField: id})
+
+	return err
+}
+
+// Ping checks the primary of the mongodb deployment is reachable
+func (c *DatabaseClient) Ping(ctx context.Context) error {
+
+	return c.db.Client().Ping(ctx, readpref.Primary())
+}
+
 // Shutdown is a hook that can be used to clean up db resources
 func (c *DatabaseClient) Shutdown() {
 	log.Info("Attempting to close the db connection thread pool")
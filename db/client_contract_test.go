@@ -0,0 +1,1252 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bpsaunders/user-api/models"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ctx = context.Background()
+
+// clientContract runs the behaviours every implementation of the Client interface must honour,
+// against a fresh, empty client returned by newClient
+func clientContract(t *testing.T, newClient func() Client) {
+
+	Convey("Given I have an empty client", t, func() {
+
+		client := newClient()
+		defer client.Shutdown()
+
+		Convey("When I ping the db", func() {
+
+			err := client.Ping(ctx)
+
+			Convey("Then I expect it to be healthy", func() {
+
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When I fetch all users", func() {
+
+			users, err := client.GetAllUsers(ctx, &UserQuery{})
+
+			Convey("Then I expect an empty array and no errors", func() {
+
+				So(err, ShouldBeNil)
+				So(users, ShouldNotBeNil)
+				So(len(*users), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When I fetch a user that doesn't exist", func() {
+
+			user, err := client.GetUser(ctx, "missing")
+
+			Convey("Then I expect a nil user and no errors", func() {
+
+				So(err, ShouldBeNil)
+				So(user, ShouldBeNil)
+			})
+		})
+
+		Convey("When I fetch a user by an email that doesn't exist", func() {
+
+			user, err := client.GetUserByEmail(ctx, "missing@mail.com")
+			exists, existsErr := client.UserExistsWithEmail(ctx, "missing@mail.com")
+
+			Convey("Then I expect a nil user, that the user doesn't exist and no errors", func() {
+
+				So(err, ShouldBeNil)
+				So(user, ShouldBeNil)
+				So(existsErr, ShouldBeNil)
+				So(exists, ShouldBeFalse)
+			})
+		})
+
+		Convey("When I use a context which is already cancelled", func() {
+
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+
+			user, err := client.GetUser(cancelled, "missing")
+			createErr := client.CreateUser(cancelled, contractUser("1", "first@mail.com"))
+
+			Convey("Then I expect the operations to fail without effect", func() {
+
+				So(err, ShouldNotBeNil)
+				So(user, ShouldBeNil)
+				So(createErr, ShouldNotBeNil)
+
+				exists, err := client.UserExistsWithEmail(ctx, "first@mail.com")
+
+				So(err, ShouldBeNil)
+				So(exists, ShouldBeFalse)
+			})
+		})
+
+		Convey("When I delete a user that doesn't exist", func() {
+
+			deleted, err := client.DeleteUser(ctx, "missing", AnyVersion)
+
+			Convey("Then I expect nothing to be deleted and no errors", func() {
+
+				So(err, ShouldBeNil)
+				So(deleted, ShouldBeNil)
+			})
+		})
+
+		Convey("When I create users", func() {
+
+			first := contractUser("1", "first@mail.com")
+			second := contractUser("2", "second@mail.com")
+
+			So(client.CreateUser(ctx, first), ShouldBeNil)
+			So(client.CreateUser(ctx, second), ShouldBeNil)
+
+			Convey("Then I can fetch a user by id", func() {
+
+				user, err := client.GetUser(ctx, "1")
+
+				So(err, ShouldBeNil)
+				So(user, ShouldResemble, storedUser("1", "first@mail.com"))
+			})
+
+			Convey("Then I can fetch a user by email", func() {
+
+				user, err := client.GetUserByEmail(ctx, "second@mail.com")
+
+				So(err, ShouldBeNil)
+				So(user, ShouldResemble, storedUser("2", "second@mail.com"))
+			})
+
+			Convey("Then I can fetch a user by email regardless of case", func() {
+
+				user, err := client.GetUserByEmail(ctx, "Second@Mail.com")
+
+				So(err, ShouldBeNil)
+				So(user.ID, ShouldEqual, "2")
+			})
+
+			Convey("Then users exist with their emails regardless of case", func() {
+
+				exists, err := client.UserExistsWithEmail(ctx, "FIRST@mail.com")
+
+				So(err, ShouldBeNil)
+				So(exists, ShouldBeTrue)
+			})
+
+			Convey("Then I cannot create a user with an email which already exists in a different case", func() {
+
+				So(client.CreateUser(ctx, contractUser("3", "First@Mail.com")), ShouldEqual, ErrDuplicateEmail)
+			})
+
+			Convey("Then I cannot update a user with an email which belongs to another user", func() {
+
+				So(client.UpdateUser(ctx, contractUser("2", "FIRST@mail.com"), AnyVersion), ShouldEqual, ErrDuplicateEmail)
+			})
+
+			Convey("Then I can update a user with a differently cased copy of their own email", func() {
+
+				So(client.UpdateUser(ctx, contractUser("1", "First@mail.com"), AnyVersion), ShouldBeNil)
+			})
+
+			Convey("Then I can determine which of a set of emails belong to users, regardless of case", func() {
+
+				existing, err := client.ExistingEmails(ctx, []string{"FIRST@mail.com", "missing@mail.com"})
+
+				So(err, ShouldBeNil)
+				So(existing, ShouldResemble, []string{"FIRST@mail.com"})
+			})
+
+			Convey("Then I can create users in bulk, except those whose emails are taken", func() {
+
+				errs, err := client.CreateUsers(ctx, []*models.UserDao{
+					contractUser("3", "third@mail.com"),
+					contractUser("4", "SECOND@mail.com"),
+					contractUser("5", "fifth@mail.com"),
+					contractUser("6", "Fifth@mail.com"),
+				}, creationEvents("3", "4", "5", "6"), false)
+
+				So(err, ShouldBeNil)
+				So(errs, ShouldResemble, []error{nil, ErrDuplicateEmail, nil, ErrDuplicateEmail})
+
+				users, err := client.GetAllUsers(ctx, &UserQuery{})
+
+				So(err, ShouldBeNil)
+				So(ids(users), ShouldResemble, []string{"1", "2", "3", "5"})
+
+				Convey("And the creation of only those created to be recorded", func() {
+
+					for id, count := range map[string]int{"3": 1, "4": 0, "5": 1, "6": 0} {
+						events, err := client.GetAuditEvents(ctx, &AuditQuery{UserID: id})
+
+						So(err, ShouldBeNil)
+						So(len(*events), ShouldEqual, count)
+					}
+				})
+			})
+
+			Convey("Then I can create users in bulk atomically", func() {
+
+				errs, err := client.CreateUsers(ctx, []*models.UserDao{
+					contractUser("3", "third@mail.com"),
+					contractUser("4", "fourth@mail.com"),
+				}, creationEvents("3", "4"), true)
+
+				So(err, ShouldBeNil)
+				So(errs, ShouldResemble, []error{nil, nil})
+
+				user, err := client.GetUser(ctx, "4")
+
+				So(err, ShouldBeNil)
+				So(user, ShouldResemble, storedUser("4", "fourth@mail.com"))
+
+				events, err := client.GetAuditEvents(ctx, &AuditQuery{UserID: "4"})
+
+				So(err, ShouldBeNil)
+				So(auditIDs(events), ShouldResemble, []string{"create-4"})
+			})
+
+			Convey("Then I cannot create users in bulk atomically if any email is taken", func() {
+
+				errs, err := client.CreateUsers(ctx, []*models.UserDao{
+					contractUser("3", "third@mail.com"),
+					contractUser("4", "first@mail.com"),
+				}, creationEvents("3", "4"), true)
+
+				So(err, ShouldBeNil)
+				So(errs, ShouldResemble, []error{ErrBatchAborted, ErrDuplicateEmail})
+
+				user, err := client.GetUser(ctx, "3")
+
+				So(err, ShouldBeNil)
+				So(user, ShouldBeNil)
+
+				events, err := client.GetAuditEvents(ctx, &AuditQuery{UserID: "3"})
+
+				So(err, ShouldBeNil)
+				So(len(*events), ShouldEqual, 0)
+			})
+
+			Convey("Then I can fetch all users ordered by id", func() {
+
+				users, err := client.GetAllUsers(ctx, &UserQuery{})
+
+				So(err, ShouldBeNil)
+				So(len(*users), ShouldEqual, 2)
+				So((*users)[0].ID, ShouldEqual, "1")
+				So((*users)[1].ID, ShouldEqual, "2")
+			})
+
+			Convey("Then I can count all users", func() {
+
+				count, err := client.CountUsers(ctx, &UserFilter{})
+
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 2)
+			})
+
+			Convey("Then I cannot create a user with an id which already exists", func() {
+
+				So(client.CreateUser(ctx, contractUser("1", "other@mail.com")), ShouldNotBeNil)
+			})
+
+			Convey("Then I can reuse the email of a deleted user", func() {
+
+				_, err := client.DeleteUser(ctx, "1", AnyVersion)
+
+				So(err, ShouldBeNil)
+				So(client.CreateUser(ctx, contractUser("3", "first@mail.com")), ShouldBeNil)
+			})
+
+			Convey("Then changes to an entity are not persisted until it is updated", func() {
+
+				first.FirstName = "changed"
+
+				user, err := client.GetUser(ctx, "1")
+
+				So(err, ShouldBeNil)
+				So(user.FirstName, ShouldEqual, "firstName")
+
+				So(client.UpdateUser(ctx, first, AnyVersion), ShouldBeNil)
+
+				user, err = client.GetUser(ctx, "1")
+
+				So(err, ShouldBeNil)
+				So(user.FirstName, ShouldEqual, "changed")
+			})
+
+			Convey("Then I can update a user conditional upon its current version", func() {
+
+				updated := contractUser("1", "first@mail.com")
+				updated.Version = 2
+
+				So(client.UpdateUser(ctx, updated, 1), ShouldBeNil)
+
+				user, err := client.GetUser(ctx, "1")
+
+				So(err, ShouldBeNil)
+				So(user.Version, ShouldEqual, 2)
+
+				Convey("But I cannot update it conditional upon a previous version", func() {
+
+					So(client.UpdateUser(ctx, contractUser("1", "first@mail.com"), 1), ShouldEqual, ErrVersionConflict)
+				})
+
+				Convey("And I cannot delete it conditional upon a previous version", func() {
+
+					deleted, err := client.DeleteUser(ctx, "1", 1)
+
+					So(err, ShouldEqual, ErrVersionConflict)
+					So(deleted, ShouldBeNil)
+				})
+
+				Convey("But I can delete it conditional upon its current version", func() {
+
+					deleted, err := client.DeleteUser(ctx, "1", 2)
+
+					So(err, ShouldBeNil)
+					So(deleted.Version, ShouldEqual, 2)
+				})
+			})
+
+			Convey("Then I cannot conditionally update a user which doesn't exist", func() {
+
+				So(client.UpdateUser(ctx, contractUser("missing", "missing@mail.com"), 1), ShouldEqual, ErrVersionConflict)
+			})
+
+			Convey("Then I can delete a user", func() {
+
+				deleted, err := client.DeleteUser(ctx, "1", AnyVersion)
+
+				So(err, ShouldBeNil)
+				So(deleted, ShouldResemble, storedUser("1", "first@mail.com"))
+
+				user, err := client.GetUser(ctx, "1")
+
+				So(err, ShouldBeNil)
+				So(user, ShouldBeNil)
+
+				exists, err := client.UserExistsWithEmail(ctx, "first@mail.com")
+
+				So(err, ShouldBeNil)
+				So(exists, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+// concurrencyContract asserts that only one of many concurrent creates with the same email succeeds
+func concurrencyContract(t *testing.T, newClient func() Client) {
+
+	Convey("Given I concurrently create users with the same email", t, func() {
+
+		client := newClient()
+		defer client.Shutdown()
+
+		const attempts = 20
+
+		var wg sync.WaitGroup
+		errs := make(chan error, attempts)
+
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				email := "same@mail.com"
+				if i%2 == 0 {
+					email = "SAME@mail.com"
+				}
+				errs <- client.CreateUser(ctx, contractUser(fmt.Sprint(i), email))
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		Convey("Then I expect exactly one to win, and the rest to be rejected as duplicates", func() {
+
+			created := 0
+			duplicates := 0
+			for err := range errs {
+				if err == nil {
+					created++
+				} else if err == ErrDuplicateEmail {
+					duplicates++
+				}
+			}
+
+			So(created, ShouldEqual, 1)
+			So(duplicates, ShouldEqual, attempts-1)
+		})
+	})
+}
+
+func queryContract(t *testing.T, newClient func() Client) {
+
+	Convey("Given I have a client populated with users", t, func() {
+
+		client := newClient()
+		defer client.Shutdown()
+
+		users := []*models.UserDao{
+			{ID: "1", FirstName: "Alice", LastName: "Smith", Email: "alice@example.com", Country: "GB"},
+			{ID: "2", FirstName: "Bob", LastName: "Jones", Email: "bob@EXAMPLE.com", Country: "FR"},
+			{ID: "3", FirstName: "Carol", LastName: "Smith", Email: "carol@mail.com", Country: "GB"},
+			{ID: "4", FirstName: "Dave", LastName: "Alison", Email: "dave@mail.com", Country: "GB"},
+			{ID: "5", FirstName: "Eve", LastName: "Jones", Email: "eve@example.org", Country: "DE"},
+		}
+		for _, user := range users {
+			So(client.CreateUser(ctx, user), ShouldBeNil)
+		}
+
+		Convey("When I filter by country", func() {
+
+			filter := UserFilter{Country: "GB"}
+			result, err := client.GetAllUsers(ctx, &UserQuery{Filter: filter})
+			count, countErr := client.CountUsers(ctx, &filter)
+
+			Convey("Then I expect only users in that country", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(result), ShouldResemble, []string{"1", "3", "4"})
+				So(countErr, ShouldBeNil)
+				So(count, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When I filter by email domain", func() {
+
+			result, err := client.GetAllUsers(ctx, &UserQuery{Filter: UserFilter{EmailDomain: "example.com"}})
+
+			Convey("Then I expect only users with that domain, regardless of case", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(result), ShouldResemble, []string{"1", "2"})
+			})
+		})
+
+		Convey("When I filter by name prefix", func() {
+
+			filter := UserFilter{NamePrefix: "AL"}
+			result, err := client.GetAllUsers(ctx, &UserQuery{Filter: filter})
+			count, countErr := client.CountUsers(ctx, &filter)
+
+			Convey("Then I expect users whose first or last name starts with the prefix, regardless of case", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(result), ShouldResemble, []string{"1", "4"})
+				So(countErr, ShouldBeNil)
+				So(count, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When I sort by country", func() {
+
+			result, err := client.GetAllUsers(ctx, &UserQuery{Sort: []SortField{{Field: "country", Descending: true}}})
+
+			Convey("Then I expect users in that order, tie-broken by id", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(result), ShouldResemble, []string{"1", "3", "4", "2", "5"})
+			})
+		})
+
+		Convey("When I sort by multiple fields of personal data", func() {
+
+			result, err := client.GetAllUsers(ctx, &UserQuery{Sort: []SortField{
+				{Field: "last_name"},
+				{Field: "email", Descending: true},
+			}})
+
+			Convey("Then I expect users in that order", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(result), ShouldResemble, []string{"4", "5", "2", "3", "1"})
+			})
+		})
+
+		Convey("When more users match a sort by personal data than may be sorted in memory", func() {
+
+			personalSortLimit = 2
+			Reset(func() { personalSortLimit = MaxPersonalSortUsers })
+
+			_, err := client.GetAllUsers(ctx, &UserQuery{Filter: UserFilter{Country: "GB"}, Sort: []SortField{{Field: "last_name"}}})
+			narrowed, narrowedErr := client.GetAllUsers(ctx, &UserQuery{Filter: UserFilter{NamePrefix: "al"}, Sort: []SortField{{Field: "last_name"}}})
+
+			Convey("Then I expect it to be refused, unless the filter is narrowed to few enough users", func() {
+
+				So(err, ShouldEqual, ErrTooManyToSort)
+				So(narrowedErr, ShouldBeNil)
+				So(ids(narrowed), ShouldResemble, []string{"4", "1"})
+			})
+		})
+
+		Convey("When I stream users matching a filter", func() {
+
+			streamed := make([]*models.UserDao, 0)
+			err := client.StreamUsers(ctx, &UserFilter{Country: "GB"}, func(entity *models.UserDao) error {
+				streamed = append(streamed, entity)
+				return nil
+			})
+
+			Convey("Then I expect each matching user in order of id", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(&streamed), ShouldResemble, []string{"1", "3", "4"})
+			})
+		})
+
+		Convey("When streaming users is stopped by an error", func() {
+
+			stop := errors.New("stop")
+
+			streamed := make([]*models.UserDao, 0)
+			err := client.StreamUsers(ctx, &UserFilter{}, func(entity *models.UserDao) error {
+				streamed = append(streamed, entity)
+				if len(streamed) == 2 {
+					return stop
+				}
+				return nil
+			})
+
+			Convey("Then I expect no further users, and the error to be returned", func() {
+
+				So(err, ShouldEqual, stop)
+				So(ids(&streamed), ShouldResemble, []string{"1", "2"})
+			})
+		})
+
+		Convey("When I page through sorted users", func() {
+
+			sort := []SortField{{Field: "country", Descending: true}}
+
+			first, err := client.GetAllUsers(ctx, &UserQuery{Sort: sort, Limit: 2})
+
+			So(err, ShouldBeNil)
+			So(ids(first), ShouldResemble, []string{"1", "3"})
+
+			last := (*first)[1]
+			second, err := client.GetAllUsers(ctx, &UserQuery{Sort: sort, Limit: 2, After: &models.Cursor{
+				Values: []string{last.Country},
+				ID:     last.ID,
+			}})
+
+			Convey("Then I expect the next page to start after the last user of the previous page", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(second), ShouldResemble, []string{"4", "2"})
+			})
+		})
+
+		Convey("When I page through users sorted by personal data", func() {
+
+			sort := []SortField{{Field: "last_name", Descending: true}}
+
+			first, err := client.GetAllUsers(ctx, &UserQuery{Sort: sort, Limit: 2})
+
+			So(err, ShouldBeNil)
+			So(ids(first), ShouldResemble, []string{"1", "3"})
+
+			last := (*first)[1]
+			second, err := client.GetAllUsers(ctx, &UserQuery{Sort: sort, Limit: 2, After: &models.Cursor{
+				Values: []string{last.LastName},
+				ID:     last.ID,
+			}})
+
+			Convey("Then I expect the next page to start after the last user of the previous page", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(second), ShouldResemble, []string{"2", "5"})
+			})
+		})
+	})
+}
+
+func searchContract(t *testing.T, newClient func() Client) {
+
+	Convey("Given I have a client populated with users", t, func() {
+
+		client := newClient()
+		defer client.Shutdown()
+
+		users := []*models.UserDao{
+			{ID: "1", FirstName: "Alice", LastName: "Smith", Email: "alice@example.com", Country: "GB"},
+			{ID: "2", FirstName: "Bob", LastName: "Jones", Email: "bob@EXAMPLE.com", Country: "FR"},
+			{ID: "3", FirstName: "Carol", LastName: "Smith", Email: "carol@mail.com", Country: "GB"},
+			{ID: "4", FirstName: "Dave", LastName: "Alison", Email: "dave@mail.com", Country: "GB"},
+			{ID: "5", FirstName: "Eve", LastName: "Jones", Email: "eve@example.org", Country: "DE"},
+		}
+		for _, user := range users {
+			So(client.CreateUser(ctx, user), ShouldBeNil)
+		}
+
+		Convey("When I search by a whole word", func() {
+
+			result, err := client.SearchUsers(ctx, &UserSearch{Text: "SMITH"})
+
+			Convey("Then I expect users holding that word, regardless of case, equally relevant so in order of id", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(result), ShouldResemble, []string{"1", "3"})
+			})
+		})
+
+		Convey("When I search by a prefix", func() {
+
+			result, err := client.SearchUsers(ctx, &UserSearch{Text: "al"})
+
+			Convey("Then I expect users holding a word starting with the prefix", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(result), ShouldResemble, []string{"1", "4"})
+			})
+		})
+
+		Convey("When I search by several words", func() {
+
+			result, err := client.SearchUsers(ctx, &UserSearch{Text: "bob jones"})
+
+			Convey("Then I expect users matching more of them to be more relevant", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(result), ShouldResemble, []string{"2", "5"})
+			})
+		})
+
+		Convey("When I search by a whole email, for only the most relevant users", func() {
+
+			result, err := client.SearchUsers(ctx, &UserSearch{Text: "Bob@Example.com", Limit: 2})
+
+			Convey("Then I expect the user it belongs to first, then those sharing its domain", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(result), ShouldResemble, []string{"2", "1"})
+			})
+		})
+
+		Convey("When I search for a user since deleted", func() {
+
+			_, err := client.DeleteUser(ctx, "3", AnyVersion)
+			So(err, ShouldBeNil)
+
+			result, err := client.SearchUsers(ctx, &UserSearch{Text: "smith"})
+
+			Convey("Then I expect it not to be found", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(result), ShouldResemble, []string{"1"})
+			})
+		})
+
+		Convey("When I search by a word no user holds", func() {
+
+			result, err := client.SearchUsers(ctx, &UserSearch{Text: "zed"})
+
+			Convey("Then I expect no users", func() {
+
+				So(err, ShouldBeNil)
+				So(ids(result), ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func statsContract(t *testing.T, newClient func() Client) {
+
+	Convey("Given I have a client populated with users created over several weeks", t, func() {
+
+		client := newClient()
+		defer client.Shutdown()
+
+		users := []*models.UserDao{
+			{ID: "1", Email: "alice@example.com", Country: "GB", CreatedAt: time.Date(2020, time.January, 6, 10, 0, 0, 0, time.UTC)},
+			{ID: "2", Email: "bob@EXAMPLE.com", Country: "FR", CreatedAt: time.Date(2020, time.January, 8, 23, 59, 59, 0, time.UTC)},
+			{ID: "3", Email: "carol@mail.com", Country: "GB", CreatedAt: time.Date(2020, time.January, 13, 0, 0, 0, 0, time.UTC)},
+			{ID: "4", Email: "dave@mail.com", Country: "GB", CreatedAt: time.Date(2020, time.February, 1, 12, 0, 0, 0, time.UTC)},
+			{ID: "5", Email: "eve@example.org", Country: "DE", CreatedAt: time.Date(2020, time.February, 3, 12, 0, 0, 0, time.UTC)},
+		}
+		for _, user := range users {
+			So(client.CreateUser(ctx, user), ShouldBeNil)
+		}
+
+		_, err := client.DeleteUser(ctx, "5", AnyVersion)
+		So(err, ShouldBeNil)
+
+		Convey("When I count every user by week, and only the top email domain", func() {
+
+			stats, err := client.GetUserStats(ctx, &UserStatsQuery{Interval: models.IntervalWeek, TopDomains: 1})
+
+			Convey("Then I expect every user bar those deleted to be counted, groups by count then value", func() {
+
+				So(err, ShouldBeNil)
+				So(stats.Total, ShouldEqual, 4)
+				So(stats.Countries, ShouldResemble, []models.GroupCountDao{{Value: "GB", Count: 3}, {Value: "FR", Count: 1}})
+				So(stats.EmailDomains, ShouldResemble, []models.GroupCountDao{{Value: "example.com", Count: 2}})
+			})
+
+			Convey("Then I expect signups counted by the week, starting on Monday, in which they fall", func() {
+
+				So(stats.Signups, ShouldResemble, []models.SignupCountDao{
+					{Start: time.Date(2020, time.January, 6, 0, 0, 0, 0, time.UTC), Count: 2},
+					{Start: time.Date(2020, time.January, 13, 0, 0, 0, 0, time.UTC), Count: 1},
+					{Start: time.Date(2020, time.January, 27, 0, 0, 0, 0, time.UTC), Count: 1},
+				})
+			})
+		})
+
+		Convey("When I count users in a country created since a time, by month", func() {
+
+			stats, err := client.GetUserStats(ctx, &UserStatsQuery{
+				Country:     "GB",
+				CreatedFrom: time.Date(2020, time.January, 13, 0, 0, 0, 0, time.UTC),
+				Interval:    models.IntervalMonth,
+			})
+
+			Convey("Then I expect only those users to be counted", func() {
+
+				So(err, ShouldBeNil)
+				So(stats.Total, ShouldEqual, 2)
+				So(stats.EmailDomains, ShouldResemble, []models.GroupCountDao{{Value: "mail.com", Count: 2}})
+				So(stats.Signups, ShouldResemble, []models.SignupCountDao{
+					{Start: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), Count: 1},
+					{Start: time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC), Count: 1},
+				})
+			})
+		})
+
+		Convey("When I count users with an email domain created before a time, by day", func() {
+
+			stats, err := client.GetUserStats(ctx, &UserStatsQuery{
+				EmailDomain:   "EXAMPLE.com",
+				CreatedBefore: time.Date(2020, time.January, 9, 0, 0, 0, 0, time.UTC),
+				Interval:      models.IntervalDay,
+			})
+
+			Convey("Then I expect only those users to be counted, regardless of the case of the domain", func() {
+
+				So(err, ShouldBeNil)
+				So(stats.Total, ShouldEqual, 2)
+				So(stats.Signups, ShouldResemble, []models.SignupCountDao{
+					{Start: time.Date(2020, time.January, 6, 0, 0, 0, 0, time.UTC), Count: 1},
+					{Start: time.Date(2020, time.January, 8, 0, 0, 0, 0, time.UTC), Count: 1},
+				})
+			})
+		})
+
+		Convey("When I count users matching nothing", func() {
+
+			stats, err := client.GetUserStats(ctx, &UserStatsQuery{Country: "US", Interval: models.IntervalDay})
+
+			Convey("Then I expect no users to be counted", func() {
+
+				So(err, ShouldBeNil)
+				So(stats.Total, ShouldEqual, 0)
+				So(stats.Countries, ShouldBeEmpty)
+				So(stats.Signups, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func auditContract(t *testing.T, newClient func() Client) {
+
+	Convey("Given I have a client with audit events for several users", t, func() {
+
+		client := newClient()
+		defer client.Shutdown()
+
+		events := []*models.AuditEventDao{
+			{ID: "a", UserID: "1", Operation: "create", Sequence: 1},
+			{ID: "b", UserID: "2", Operation: "create", Sequence: 1},
+			{ID: "c", UserID: "1", Operation: "update", Sequence: 2},
+			{ID: "d", UserID: "1", Operation: "patch", Sequence: 3},
+			{ID: "e", UserID: "1", Operation: "delete", Sequence: 4, Changes: []models.FieldChangeDao{
+				{Field: "email", Before: stringPointer("first@mail.com")},
+			}},
+		}
+		for _, event := range events {
+			So(client.CreateAuditEvent(ctx, event), ShouldBeNil)
+		}
+
+		Convey("When I fetch the history of a user", func() {
+
+			result, err := client.GetAuditEvents(ctx, &AuditQuery{UserID: "1"})
+
+			Convey("Then I expect only their events, most recent first", func() {
+
+				So(err, ShouldBeNil)
+				So(auditIDs(result), ShouldResemble, []string{"e", "d", "c", "a"})
+				So((*result)[0].Changes, ShouldResemble, events[4].Changes)
+			})
+		})
+
+		Convey("When I page through the history of a user", func() {
+
+			first, err := client.GetAuditEvents(ctx, &AuditQuery{UserID: "1", Limit: 2})
+
+			So(err, ShouldBeNil)
+			So(auditIDs(first), ShouldResemble, []string{"e", "d"})
+
+			last := (*first)[1]
+			second, err := client.GetAuditEvents(ctx, &AuditQuery{UserID: "1", Limit: 2, Before: last.Sequence})
+
+			Convey("Then I expect the next page to start after the last event of the previous page", func() {
+
+				So(err, ShouldBeNil)
+				So(auditIDs(second), ShouldResemble, []string{"c", "a"})
+			})
+		})
+
+		Convey("When I fetch the history of a user without events", func() {
+
+			result, err := client.GetAuditEvents(ctx, &AuditQuery{UserID: "missing"})
+
+			Convey("Then I expect an empty array and no errors", func() {
+
+				So(err, ShouldBeNil)
+				So(len(*result), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func deletionContract(t *testing.T, newClient func() Client) {
+
+	Convey("Given I have a client with a deleted user", t, func() {
+
+		client := newClient()
+		defer client.Shutdown()
+
+		So(client.CreateUser(ctx, contractUser("1", "first@mail.com")), ShouldBeNil)
+		So(client.CreateUser(ctx, contractUser("2", "second@mail.com")), ShouldBeNil)
+
+		before := time.Now().Add(-time.Second)
+		_, err := client.DeleteUser(ctx, "1", 1)
+		So(err, ShouldBeNil)
+		after := time.Now().Add(time.Second)
+
+		Convey("Then I expect it to be left out of every read of users", func() {
+
+			user, err := client.GetUser(ctx, "1")
+			So(err, ShouldBeNil)
+			So(user, ShouldBeNil)
+
+			user, err = client.GetUserByEmail(ctx, "first@mail.com")
+			So(err, ShouldBeNil)
+			So(user, ShouldBeNil)
+
+			users, err := client.GetAllUsers(ctx, &UserQuery{})
+			So(err, ShouldBeNil)
+			So(ids(users), ShouldResemble, []string{"2"})
+
+			count, err := client.CountUsers(ctx, &UserFilter{})
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			streamed := make([]string, 0)
+			So(client.StreamUsers(ctx, &UserFilter{}, func(entity *models.UserDao) error {
+				streamed = append(streamed, entity.ID)
+				return nil
+			}), ShouldBeNil)
+			So(streamed, ShouldResemble, []string{"2"})
+
+			existing, err := client.ExistingEmails(ctx, []string{"first@mail.com", "second@mail.com"})
+			So(err, ShouldBeNil)
+			So(existing, ShouldResemble, []string{"second@mail.com"})
+		})
+
+		Convey("Then I expect it to be kept, at its next version, with the time it was deleted", func() {
+
+			deleted, err := client.GetDeletedUser(ctx, "1")
+
+			So(err, ShouldBeNil)
+			So(deleted.Version, ShouldEqual, 2)
+			So(deleted.DeletedAt, ShouldNotBeNil)
+			So(deleted.DeletedAt.After(before) && deleted.DeletedAt.Before(after), ShouldBeTrue)
+
+			live, err := client.GetDeletedUser(ctx, "2")
+
+			So(err, ShouldBeNil)
+			So(live, ShouldBeNil)
+		})
+
+		Convey("Then I cannot update or delete it again", func() {
+
+			So(client.UpdateUser(ctx, contractUser("1", "first@mail.com"), 2), ShouldEqual, ErrVersionConflict)
+
+			deleted, err := client.DeleteUser(ctx, "1", AnyVersion)
+			So(err, ShouldBeNil)
+			So(deleted, ShouldBeNil)
+		})
+
+		Convey("Then I can restore it, conditional upon its version", func() {
+
+			restored := contractUser("1", "first@mail.com")
+			restored.Version = 3
+
+			So(client.RestoreUser(ctx, restored, 1), ShouldEqual, ErrVersionConflict)
+			So(client.RestoreUser(ctx, restored, 2), ShouldBeNil)
+
+			user, err := client.GetUser(ctx, "1")
+			So(err, ShouldBeNil)
+			So(user, ShouldResemble, restored)
+
+			exists, err := client.UserExistsWithEmail(ctx, "FIRST@mail.com")
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeTrue)
+
+			So(client.RestoreUser(ctx, restored, 3), ShouldEqual, ErrVersionConflict)
+		})
+
+		Convey("Then I cannot restore it once its email has been taken", func() {
+
+			So(client.CreateUser(ctx, contractUser("3", "First@mail.com")), ShouldBeNil)
+
+			restored := contractUser("1", "first@mail.com")
+			restored.Version = 3
+
+			So(client.RestoreUser(ctx, restored, 2), ShouldEqual, ErrDuplicateEmail)
+		})
+
+		Convey("Then I can purge it, once it was deleted before the given time", func() {
+
+			purged, err := client.PurgeUsers(ctx, before)
+			So(err, ShouldBeNil)
+			So(purged, ShouldEqual, 0)
+
+			purged, err = client.PurgeUsers(ctx, after)
+			So(err, ShouldBeNil)
+			So(purged, ShouldEqual, 1)
+
+			deleted, err := client.GetDeletedUser(ctx, "1")
+			So(err, ShouldBeNil)
+			So(deleted, ShouldBeNil)
+
+			user, err := client.GetUser(ctx, "2")
+			So(err, ShouldBeNil)
+			So(user, ShouldNotBeNil)
+		})
+	})
+}
+
+func erasureContract(t *testing.T, newClient func() Client) {
+
+	Convey("Given I have a client with a user and its history", t, func() {
+
+		client := newClient()
+		defer client.Shutdown()
+
+		So(client.CreateUser(ctx, contractUser("1", "first@mail.com")), ShouldBeNil)
+		So(client.CreateUser(ctx, contractUser("2", "second@mail.com")), ShouldBeNil)
+
+		events := []*models.AuditEventDao{
+			{ID: "a", UserID: "1", Operation: "create", Sequence: 1, Changes: []models.FieldChangeDao{
+				{Field: "email", After: stringPointer("first@mail.com")},
+				{Field: "country", After: stringPointer("GB")},
+			}},
+			{ID: "b", UserID: "1", Operation: "update", Sequence: 2, Changes: []models.FieldChangeDao{
+				{Field: "first_name", Before: stringPointer("firstName"), After: stringPointer("renamed")},
+			}},
+			{ID: "c", UserID: "2", Operation: "create", Sequence: 1, Changes: []models.FieldChangeDao{
+				{Field: "email", After: stringPointer("second@mail.com")},
+			}},
+		}
+		for _, event := range events {
+			So(client.CreateAuditEvent(ctx, event), ShouldBeNil)
+		}
+
+		erased := func(normalisedEmail string) *models.UserDao {
+			erasedAt := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+			user := contractUser("1", "tombstone")
+			user.FirstName, user.LastName = "tombstone", "tombstone"
+			user.NormalisedEmail = normalisedEmail
+			user.DeletedAt, user.ErasedAt = &erasedAt, &erasedAt
+			user.Version = 2
+			return user
+		}
+
+		Convey("When I erase the user, blocking its email from re-registration", func() {
+
+			So(client.EraseUser(ctx, erased("tombstone"), 2), ShouldEqual, ErrVersionConflict)
+			So(client.EraseUser(ctx, erased("tombstone"), 1), ShouldBeNil)
+
+			Convey("Then I expect it to be kept as erased, and its tombstone to be taken", func() {
+
+				user, err := client.GetUser(ctx, "1")
+				So(err, ShouldBeNil)
+				So(user, ShouldBeNil)
+
+				deleted, err := client.GetDeletedUser(ctx, "1")
+				So(err, ShouldBeNil)
+				So(deleted, ShouldResemble, erased("tombstone"))
+
+				exists, err := client.UserExistsWithEmail(ctx, "tombstone")
+				So(err, ShouldBeNil)
+				So(exists, ShouldBeTrue)
+
+				user, err = client.GetUserByEmail(ctx, "tombstone")
+				So(err, ShouldBeNil)
+				So(user, ShouldBeNil)
+
+				exists, err = client.UserExistsWithEmail(ctx, "first@mail.com")
+				So(err, ShouldBeNil)
+				So(exists, ShouldBeFalse)
+			})
+
+			Convey("Then I cannot erase, restore or purge it again", func() {
+
+				So(client.EraseUser(ctx, erased("tombstone"), 2), ShouldEqual, ErrVersionConflict)
+
+				restored := contractUser("1", "first@mail.com")
+				restored.Version = 3
+				So(client.RestoreUser(ctx, restored, 2), ShouldEqual, ErrVersionConflict)
+
+				purged, err := client.PurgeUsers(ctx, time.Now().Add(time.Hour))
+				So(err, ShouldBeNil)
+				So(purged, ShouldEqual, 0)
+			})
+
+			Convey("Then I cannot erase another user with the same tombstone", func() {
+
+				other := erased("tombstone")
+				other.ID = "2"
+				So(client.EraseUser(ctx, other, 1), ShouldEqual, ErrDuplicateEmail)
+			})
+		})
+
+		Convey("When I erase the user without blocking its email", func() {
+
+			So(client.EraseUser(ctx, erased(""), 1), ShouldBeNil)
+
+			Convey("Then I expect neither its email nor its tombstone to be taken", func() {
+
+				existing, err := client.ExistingEmails(ctx, []string{"first@mail.com", "tombstone"})
+				So(err, ShouldBeNil)
+				So(existing, ShouldResemble, []string{})
+			})
+		})
+
+		Convey("When I redact its history", func() {
+
+			So(client.RedactAuditEvents(ctx, "1", []string{"first_name", "email"}, "tombstone"), ShouldBeNil)
+
+			Convey("Then I expect only the values of the given fields to be replaced", func() {
+
+				history, err := client.GetAuditEvents(ctx, &AuditQuery{UserID: "1"})
+				So(err, ShouldBeNil)
+				So((*history)[0].Changes, ShouldResemble, []models.FieldChangeDao{
+					{Field: "first_name", Before: stringPointer("tombstone"), After: stringPointer("tombstone")},
+				})
+				So((*history)[1].Changes, ShouldResemble, []models.FieldChangeDao{
+					{Field: "email", After: stringPointer("tombstone")},
+					{Field: "country", After: stringPointer("GB")},
+				})
+
+				others, err := client.GetAuditEvents(ctx, &AuditQuery{UserID: "2"})
+				So(err, ShouldBeNil)
+				So((*others)[0].Changes, ShouldResemble, events[2].Changes)
+			})
+		})
+
+		Convey("When I store its erasure receipt", func() {
+
+			receipt := &models.ErasureReceiptDao{
+				UserID:             "1",
+				Actor:              "actor",
+				ErasedAt:           time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Tombstone:          "tombstone",
+				SignatureAlgorithm: "HMAC-SHA256",
+				Signature:          "signature",
+			}
+			So(client.CreateErasureReceipt(ctx, receipt), ShouldBeNil)
+
+			Convey("Then I expect to fetch it, and to be unable to store another", func() {
+
+				fetched, err := client.GetErasureReceipt(ctx, "1")
+				So(err, ShouldBeNil)
+				So(fetched, ShouldResemble, receipt)
+
+				missing, err := client.GetErasureReceipt(ctx, "2")
+				So(err, ShouldBeNil)
+				So(missing, ShouldBeNil)
+
+				So(client.CreateErasureReceipt(ctx, receipt), ShouldEqual, ErrErasureReceiptExists)
+			})
+		})
+	})
+}
+
+func idempotencyContract(t *testing.T, newClient func() Client) {
+
+	Convey("Given I have a client with an idempotency record in progress", t, func() {
+
+		client := newClient()
+		defer client.Shutdown()
+
+		createdAt := time.Now().UTC().Truncate(time.Millisecond)
+		So(client.CreateIdempotencyRecord(ctx, &models.IdempotencyRecordDao{
+			ID: "key", Fingerprint: "fingerprint", CreatedAt: createdAt,
+		}), ShouldBeNil)
+
+		Convey("When I fetch the record", func() {
+
+			record, err := client.GetIdempotencyRecord(ctx, "key", "fingerprint")
+
+			Convey("Then I expect it to have no response yet", func() {
+
+				So(err, ShouldBeNil)
+				So(record, ShouldNotBeNil)
+				So(record.Fingerprint, ShouldEqual, "fingerprint")
+				So(record.CreatedAt.Equal(createdAt), ShouldBeTrue)
+				So(record.Response, ShouldBeNil)
+			})
+		})
+
+		Convey("When I fetch the record for a request with a different fingerprint", func() {
+
+			record, err := client.GetIdempotencyRecord(ctx, "key", "other")
+
+			Convey("Then I expect its fingerprint not to match that of the request", func() {
+
+				So(err, ShouldBeNil)
+				So(record, ShouldNotBeNil)
+				So(record.Fingerprint, ShouldNotEqual, "other")
+			})
+		})
+
+		Convey("When I create another record with the same key", func() {
+
+			err := client.CreateIdempotencyRecord(ctx, &models.IdempotencyRecordDao{
+				ID: "key", Fingerprint: "other", CreatedAt: createdAt,
+			})
+
+			Convey("Then I expect it to be refused", func() {
+
+				So(err, ShouldEqual, ErrIdempotencyKeyExists)
+			})
+		})
+
+		Convey("When I complete the record", func() {
+
+			So(client.CompleteIdempotencyRecord(ctx, "key", "user", []byte(`{"status":"created"}`)), ShouldBeNil)
+			record, err := client.GetIdempotencyRecord(ctx, "key", "fingerprint")
+
+			Convey("Then I expect its response to be stored, along with the user it created", func() {
+
+				So(err, ShouldBeNil)
+				So(string(record.Response), ShouldEqual, `{"status":"created"}`)
+				So(record.UserID, ShouldEqual, "user")
+			})
+
+			Convey("Then I expect it among the records of the user it created alone", func() {
+
+				So(client.CreateIdempotencyRecord(ctx, &models.IdempotencyRecordDao{
+					ID: "other", Fingerprint: "other", CreatedAt: createdAt,
+				}), ShouldBeNil)
+				So(client.CompleteIdempotencyRecord(ctx, "other", "", []byte(`{"status":"invalid"}`)), ShouldBeNil)
+
+				records, err := client.GetUserIdempotencyRecords(ctx, "user")
+				So(err, ShouldBeNil)
+				So(len(records), ShouldEqual, 1)
+				So(records[0].ID, ShouldEqual, "key")
+				So(string(records[0].Response), ShouldEqual, `{"status":"created"}`)
+
+				records, err = client.GetUserIdempotencyRecords(ctx, "other")
+				So(err, ShouldBeNil)
+				So(records, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When I delete the record", func() {
+
+			So(client.DeleteIdempotencyRecord(ctx, "key"), ShouldBeNil)
+			record, err := client.GetIdempotencyRecord(ctx, "key", "fingerprint")
+
+			Convey("Then I expect it to be gone, and its key free to reuse", func() {
+
+				So(err, ShouldBeNil)
+				So(record, ShouldBeNil)
+				So(client.CreateIdempotencyRecord(ctx, &models.IdempotencyRecordDao{
+					ID: "key", Fingerprint: "other", CreatedAt: createdAt,
+				}), ShouldBeNil)
+			})
+		})
+
+		Convey("When a record has expired", func() {
+
+			expired := createdAt.Add(-IdempotencyTTL - time.Minute)
+			So(client.CreateIdempotencyRecord(ctx, &models.IdempotencyRecordDao{
+				ID: "expired", Fingerprint: "fingerprint", CreatedAt: expired,
+			}), ShouldBeNil)
+
+			record, err := client.GetIdempotencyRecord(ctx, "expired", "fingerprint")
+
+			Convey("Then I expect it not to be found, and its key free to reuse", func() {
+
+				So(err, ShouldBeNil)
+				So(record, ShouldBeNil)
+				So(client.CreateIdempotencyRecord(ctx, &models.IdempotencyRecordDao{
+					ID: "expired", Fingerprint: "other", CreatedAt: createdAt,
+				}), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func auditIDs(events *[]*models.AuditEventDao) []string {
+
+	result := make([]string, 0)
+	for _, event := range *events {
+		result = append(result, event.ID)
+	}
+	return result
+}
+
+func stringPointer(s string) *string {
+	return &s
+}
+
+func ids(users *[]*models.UserDao) []string {
+
+	result := make([]string, 0)
+	for _, user := range *users {
+		result = append(result, user.ID)
+	}
+	return result
+}
+
+func storedUser(id string, email string) *models.UserDao {
+
+	user := contractUser(id, email)
+	user.NormalisedEmail = email
+	return user
+}
+
+func contractUser(id string, email string) *models.UserDao {
+
+	return &models.UserDao{
+		ID:        id,
+		FirstName: "firstName",
+		LastName:  "lastName",
+		Email:     email,
+		Country:   "GB",
+		Version:   1,
+	}
+}
+
+// creationEvents returns the audit events recording the creation of users
+func creationEvents(ids ...string) []*models.AuditEventDao {
+
+	events := make([]*models.AuditEventDao, 0, len(ids))
+	for _, id := range ids {
+		events = append(events, &models.AuditEventDao{ID: "create-" + id, UserID: id, Operation: "create", Sequence: 1})
+	}
+	return events
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"github.com/bpsaunders/user-api/config"
+	"github.com/bpsaunders/user-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestIntegrationDatabaseClient runs the client contract against a real MongoDB instance,
+// and is skipped unless MONGODB_URL is set in the environment
+func TestIntegrationDatabaseClient(t *testing.T) {
+
+	mongoDBURL := os.Getenv("MONGODB_URL")
+	if mongoDBURL == "" {
+		t.Skip("MONGODB_URL not set in environment")
+	}
+
+	cfg := &config.Config{
+		MongoDBURL:      mongoDBURL,
+		MongoDBDatabase: "user_api_contract_test",
+		PIIMasterKeys:   testMasterKeys,
+		PIIIndexKey:     testIndexKey,
+	}
+
+	newClient := func() Client {
+		client := NewDatabaseClient(cfg)
+		for _, collection := range []string{"users", "audit", "idempotency", "erasure_receipts"} {
+			err := client.db.Collection(collection).Drop(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return client
+	}
+
+	clientContract(t, newClient)
+	queryContract(t, newClient)
+	searchContract(t, newClient)
+	statsContract(t, newClient)
+	auditContract(t, newClient)
+	deletionContract(t, newClient)
+	erasureContract(t, newClient)
+	idempotencyContract(t, newClient)
+	concurrencyContract(t, newClient)
+}
+
+// TestIntegrationReencrypt re-encrypts records under a new master key against a real MongoDB instance, and is
+// skipped unless MONGODB_URL is set in the environment
+func TestIntegrationReencrypt(t *testing.T) {
+
+	mongoDBURL := os.Getenv("MONGODB_URL")
+	if mongoDBURL == "" {
+		t.Skip("MONGODB_URL not set in environment")
+	}
+
+	ctx := context.Background()
+
+	cfg := &config.Config{
+		MongoDBURL:      mongoDBURL,
+		MongoDBDatabase: "user_api_reencrypt_test",
+		PIIMasterKeys:   testRetiredMasterKeys,
+		PIIIndexKey:     testIndexKey,
+	}
+
+	Convey("Given users stored under a retired master key, and in the clear", t, func() {
+
+		retired := NewDatabaseClient(cfg)
+		for _, collection := range []string{"users", "audit", "idempotency"} {
+			So(retired.db.Collection(collection).Drop(ctx), ShouldBeNil)
+		}
+
+		So(retired.CreateUser(ctx, &models.UserDao{ID: "sealed", Email: "sealed@example.com", Version: 1}), ShouldBeNil)
+
+		email := "old@example.com"
+		So(retired.CreateAuditEvent(ctx, &models.AuditEventDao{
+			ID: "event", UserID: "sealed", Sequence: 1, Changes: []models.FieldChangeDao{{Field: "email", After: &email}},
+		}), ShouldBeNil)
+
+		So(retired.CreateIdempotencyRecord(ctx, &models.IdempotencyRecordDao{ID: "key", CreatedAt: time.Now()}), ShouldBeNil)
+		So(retired.CompleteIdempotencyRecord(ctx, "key", "", []byte("response")), ShouldBeNil)
+
+		_, err := retired.db.Collection("users").InsertOne(ctx, bson.M{
+			"_id": "clear", "email": "Clear@example.com", "created_at": time.Now(), "version": 1,
+		})
+		So(err, ShouldBeNil)
+
+		_, err = retired.db.Collection("idempotency").InsertOne(ctx, bson.M{
+			"_id": "legacy", "fingerprint": "fingerprint", "created_at": time.Now(),
+		})
+		So(err, ShouldBeNil)
+
+		Convey("When I start with a new master key, and re-encrypt", func() {
+
+			rotated := *cfg
+			rotated.PIIMasterKeys = testMasterKeys
+			client := NewDatabaseClient(&rotated)
+
+			reencrypted, skipped, err := client.Reencrypt(ctx)
+
+			Convey("Then I expect the user stored in the clear to have been encrypted on startup, and the rest now", func() {
+
+				So(err, ShouldBeNil)
+				So(reencrypted, ShouldEqual, 3)
+				So(skipped, ShouldEqual, 0)
+
+				count, err := client.db.Collection("users").CountDocuments(ctx, bson.M{dataKeyIDField: "current"})
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 2)
+
+				exists, err := client.UserExistsWithEmail(ctx, "CLEAR@example.com")
+				So(err, ShouldBeNil)
+				So(exists, ShouldBeTrue)
+
+				events, err := client.GetAuditEvents(ctx, &AuditQuery{UserID: "sealed"})
+				So(err, ShouldBeNil)
+				So(*(*events)[0].Changes[0].After, ShouldEqual, email)
+
+				record, err := client.GetIdempotencyRecord(ctx, "key", "")
+				So(err, ShouldBeNil)
+				So(string(record.Response), ShouldEqual, "response")
+			})
+
+			Convey("Then I expect a fingerprint stored in the clear to have been replaced by its blind index", func() {
+
+				count, err := client.db.Collection("idempotency").CountDocuments(ctx, bson.M{"fingerprint": "fingerprint"})
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 0)
+
+				record, err := client.GetIdempotencyRecord(ctx, "legacy", "fingerprint")
+				So(err, ShouldBeNil)
+				So(record.Fingerprint, ShouldEqual, "fingerprint")
+			})
+
+			Convey("Then I expect the retired master key to be no longer needed", func() {
+
+				current := rotated
+				current.PIIMasterKeys = `[{"id": "current", "key": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}]`
+
+				entity, err := NewDatabaseClient(&current).GetUser(ctx, "sealed")
+				So(err, ShouldBeNil)
+				So(entity.Email, ShouldEqual, "sealed@example.com")
+			})
+		})
+	})
+}
@@ -0,0 +1,20 @@
+package db
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+// deletedAtField is the bson name of the field marking a user as deleted
+const deletedAtField = "deleted_at"
+
+// notDeleted matches users which haven't been deleted
+func notDeleted() bson.M {
+	return bson.M{deletedAtField: bson.M{"$exists": false}}
+}
+
+// deletionTime returns the time at which a user is deleted, truncated to the millisecond precision with which
+// mongodb stores dates
+func deletionTime() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"errors"
+	"github.com/bpsaunders/user-api/models"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+)
+
+// ErrDuplicateEmail is returned when writing a user whose email already belongs to another user
+var ErrDuplicateEmail = errors.New("a user already exists with the given email")
+
+// ErrBatchAborted is returned for each user of a batch created atomically which wasn't created, because another
+// user of the batch couldn't be
+var ErrBatchAborted = errors.New("the user was not created, as another user in its batch could not be")
+
+// ErrTransactionsUnsupported is returned when creating a batch of users atomically where the mongodb deployment
+// doesn't support transactions, as a standalone server doesn't
+var ErrTransactionsUnsupported = errors.New("transactions aren't supported by the mongodb deployment, which must be a replica set")
+
+// emailIndexName is the name of the unique index on the normalised emails of users which aren't deleted
+const emailIndexName = "normalised_email_live_unique"
+
+// legacyEmailIndexName is the name of the unique index on normalised emails which emailIndexName replaced
+const legacyEmailIndexName = "normalised_email_unique"
+
+// indexNotFoundCode is the mongodb error code for an index which doesn't exist
+const indexNotFoundCode = 27
+
+// duplicateKeyCode is the mongodb error code for unique index violations
+const duplicateKeyCode = 11000
+
+// illegalOperationCode is the mongodb error code for operations the deployment doesn't allow, such as a
+// transaction on a standalone server
+const illegalOperationCode = 20
+
+// NormaliseEmail returns the form of an email against which uniqueness is enforced
+func NormaliseEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// withNormalisedEmail stamps the normalised email on an entity prior to it being written
+func withNormalisedEmail(entity *models.UserDao) *models.UserDao {
+	entity.NormalisedEmail = NormaliseEmail(entity.Email)
+	return entity
+}
+
+// toDuplicateEmailError maps a mongo write error to ErrDuplicateEmail, if caused by the unique email index
+func toDuplicateEmailError(err error) error {
+
+	if writeException, ok := err.(mongo.WriteException); ok {
+		for _, writeError := range writeException.WriteErrors {
+			if isDuplicateEmail(writeError) {
+				return ErrDuplicateEmail
+			}
+		}
+	}
+
+	return err
+}
+
+// toBulkWriteErrors maps the error of a bulk insert to an error for each entity at fault, by index, mapping those
+// caused by the unique email index to ErrDuplicateEmail. Any error not attributable to an entity is returned as is
+func toBulkWriteErrors(err error, count int) ([]error, error) {
+
+	errs := make([]error, count)
+	if err == nil {
+		return errs, nil
+	}
+
+	bulkWriteException, ok := err.(mongo.BulkWriteException)
+	if !ok || bulkWriteException.WriteConcernError != nil {
+		return nil, err
+	}
+
+	for _, writeError := range bulkWriteException.WriteErrors {
+		if writeError.Index < 0 || writeError.Index >= count {
+			return nil, err
+		}
+		if isDuplicateEmail(writeError.WriteError) {
+			errs[writeError.Index] = ErrDuplicateEmail
+		} else {
+			errs[writeError.Index] = writeError
+		}
+	}
+
+	return errs, nil
+}
+
+func isDuplicateEmail(writeError mongo.WriteError) bool {
+	return writeError.Code == duplicateKeyCode && strings.Contains(writeError.Message, emailIndexName)
+}
+
+// isTransactionsUnsupported returns whether an error is that of a transaction on a deployment which doesn't support them
+func isTransactionsUnsupported(err error) bool {
+	commandErr, ok := err.(mongo.CommandError)
+	return ok && commandErr.Code == illegalOperationCode
+}
+
+// takenEmails returns those of the given emails whose normalised forms are taken
+func takenEmails(emails []string, taken map[string]bool) []string {
+
+	existing := make([]string, 0)
+	for _, email := range emails {
+		if taken[NormaliseEmail(email)] {
+			existing = append(existing, email)
+		}
+	}
+	return existing
+}
+
+// abortBatch gives ErrBatchAborted to every entity of a batch not at fault, if any is at fault
+func abortBatch(errs []error) []error {
+
+	failed := false
+	for _, err := range errs {
+		failed = failed || err != nil
+	}
+
+	if failed {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = ErrBatchAborted
+			}
+		}
+	}
+	return errs
+}
+
+// isIndexNotFound determines whether an error was caused by an index not existing
+func isIndexNotFound(err error) bool {
+
+	commandError, ok := err.(mongo.CommandError)
+	return ok && commandError.Code == indexNotFoundCode
+}
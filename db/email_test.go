@@ -0,0 +1,145 @@
+package db
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitToDuplicateEmailError(t *testing.T) {
+
+	Convey("Given a write fails with a duplicate key error on the email index", t, func() {
+
+		err := mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+			Code:    duplicateKeyCode,
+			Message: "E11000 duplicate key error collection: users index: " + emailIndexName + " dup key",
+		}}}
+
+		Convey("Then I expect it to be mapped to a duplicate email error", func() {
+
+			So(toDuplicateEmailError(err), ShouldEqual, ErrDuplicateEmail)
+		})
+	})
+
+	Convey("Given a write fails with a duplicate key error on the id", t, func() {
+
+		err := mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+			Code:    duplicateKeyCode,
+			Message: "E11000 duplicate key error collection: users index: _id_ dup key",
+		}}}
+
+		Convey("Then I expect the error to be returned unchanged", func() {
+
+			So(toDuplicateEmailError(err), ShouldResemble, err)
+		})
+	})
+
+	Convey("Given a write fails for another reason", t, func() {
+
+		err := errors.New("error")
+
+		Convey("Then I expect the error to be returned unchanged", func() {
+
+			So(toDuplicateEmailError(err), ShouldEqual, err)
+		})
+	})
+
+	Convey("Given a write succeeds", t, func() {
+
+		Convey("Then I expect no error", func() {
+
+			So(toDuplicateEmailError(nil), ShouldBeNil)
+		})
+	})
+}
+
+func TestUnitToBulkWriteErrors(t *testing.T) {
+
+	Convey("Given a bulk insert fails for some entities", t, func() {
+
+		err := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+			{WriteError: mongo.WriteError{
+				Index:   1,
+				Code:    duplicateKeyCode,
+				Message: "E11000 duplicate key error collection: users index: " + emailIndexName + " dup key",
+			}},
+			{WriteError: mongo.WriteError{
+				Index:   2,
+				Code:    duplicateKeyCode,
+				Message: "E11000 duplicate key error collection: users index: _id_ dup key",
+			}},
+		}}
+
+		errs, bulkErr := toBulkWriteErrors(err, 3)
+
+		Convey("Then I expect an error for each entity at fault, by index", func() {
+
+			So(bulkErr, ShouldBeNil)
+			So(errs[0], ShouldBeNil)
+			So(errs[1], ShouldEqual, ErrDuplicateEmail)
+			So(errs[2], ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a bulk insert fails for a reason not attributable to an entity", t, func() {
+
+		err := errors.New("error")
+
+		errs, bulkErr := toBulkWriteErrors(err, 3)
+
+		Convey("Then I expect the error to be returned unchanged", func() {
+
+			So(errs, ShouldBeNil)
+			So(bulkErr, ShouldEqual, err)
+		})
+	})
+
+	Convey("Given a bulk insert succeeds", t, func() {
+
+		errs, bulkErr := toBulkWriteErrors(nil, 2)
+
+		Convey("Then I expect no errors", func() {
+
+			So(bulkErr, ShouldBeNil)
+			So(errs, ShouldResemble, []error{nil, nil})
+		})
+	})
+}
+
+func TestUnitIsTransactionsUnsupported(t *testing.T) {
+
+	Convey("Given a transaction fails as the deployment is a standalone server", t, func() {
+
+		err := mongo.CommandError{
+			Code:    illegalOperationCode,
+			Message: "Transaction numbers are only allowed on a replica set member or mongos",
+			Name:    "IllegalOperation",
+		}
+
+		Convey("Then I expect transactions to be reported unsupported", func() {
+
+			So(isTransactionsUnsupported(err), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a transaction fails with another command error", t, func() {
+
+		err := mongo.CommandError{Code: 112, Name: "WriteConflict"}
+
+		Convey("Then I expect transactions not to be reported unsupported", func() {
+
+			So(isTransactionsUnsupported(err), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a transaction fails for another reason", t, func() {
+
+		Convey("Then I expect transactions not to be reported unsupported", func() {
+
+			So(isTransactionsUnsupported(errors.New("error")), ShouldBeFalse)
+			So(isTransactionsUnsupported(nil), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,475 @@
+package db
+
+import (
+	"fmt"
+	"github.com/bpsaunders/user-api/encryption"
+	"github.com/bpsaunders/user-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+// PersonalFields holds the bson names of the user fields which identify its subject, so are encrypted in mongodb,
+// in the user and its history alike
+var PersonalFields = []string{"first_name", "last_name", "email"}
+
+// dataKeyIDField is the bson path of the id of the master key by which the data key of a record is wrapped
+const dataKeyIDField = "data_key.master_key_id"
+
+// dataKeyDocument describes the data key of a record, as wrapped by a master key
+type dataKeyDocument struct {
+	MasterKeyID string `bson:"master_key_id"`
+	Wrapped     []byte `bson:"wrapped"`
+}
+
+// userDocument describes the form in which a user is stored in mongodb, its personal data encrypted
+type userDocument struct {
+	ID        string    `bson:"_id"`
+	Country   string    `bson:"country"`
+	CreatedAt time.Time `bson:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at"`
+	Version   int64     `bson:"version"`
+
+	// EmailDomain holds the lower-cased domain of the email in the clear, so that users may be filtered by it
+	EmailDomain string `bson:"email_domain,omitempty"`
+
+	// NormalisedEmail holds the blind index of the normalised email, against which uniqueness is enforced
+	NormalisedEmail string `bson:"normalised_email,omitempty"`
+
+	DeletedAt *time.Time `bson:"deleted_at,omitempty"`
+	ErasedAt  *time.Time `bson:"erased_at,omitempty"`
+
+	DataKey *dataKeyDocument `bson:"data_key,omitempty"`
+	PII     *sealedUser      `bson:"pii,omitempty"`
+
+	// Search holds the blind indexes by which a user which isn't deleted is found by searching
+	Search *searchDocument `bson:"search,omitempty"`
+
+	// a user stored before encryption was introduced holds its personal data in the clear, and its normalised
+	// email unhashed, until it's encrypted
+	FirstName string `bson:"first_name,omitempty"`
+	LastName  string `bson:"last_name,omitempty"`
+	Email     string `bson:"email,omitempty"`
+}
+
+// sealedUser holds the personal data of a user, each field encrypted under the data key of the user
+type sealedUser struct {
+	FirstName []byte `bson:"first_name"`
+	LastName  []byte `bson:"last_name"`
+	Email     []byte `bson:"email"`
+}
+
+// searchDocument holds the blind indexes of the search tokens of a user, and of their prefixes, each truncated, as
+// they only need narrow a search. They're covered by a text index, which ranks users by how many of each they match.
+// Names holds those of every prefix of its first and last names, by which users are filtered by name prefix
+type searchDocument struct {
+	Tokens   []string `bson:"tokens"`
+	Prefixes []string `bson:"prefixes"`
+	Names    []string `bson:"names"`
+}
+
+// namePrefixesField is the bson path of the blind indexes of the prefixes of the names of a user
+const namePrefixesField = "search.names"
+
+// auditDocument describes the form in which an audit event is stored in mongodb
+type auditDocument struct {
+	ID        string           `bson:"_id"`
+	UserID    string           `bson:"user_id"`
+	Actor     string           `bson:"actor"`
+	Operation string           `bson:"operation"`
+	Timestamp time.Time        `bson:"timestamp"`
+	Changes   []changeDocument `bson:"changes"`
+	Sequence  int64            `bson:"sequence"`
+
+	DataKey *dataKeyDocument `bson:"data_key,omitempty"`
+}
+
+// changeDocument describes the form in which a field change is stored in mongodb. A value of a personal field is
+// binary, encrypted under the data key of its event; any other value is a string, as is one redacted upon erasure
+// or recorded before encryption was introduced
+type changeDocument struct {
+	Field  string      `bson:"field"`
+	Before interface{} `bson:"before"`
+	After  interface{} `bson:"after"`
+}
+
+// idempotencyDocument describes the form in which an idempotency record is stored in mongodb, its response
+// encrypted once the request completes. The fingerprint of the request is derived from personal data, so is stored
+// as a blind index
+type idempotencyDocument struct {
+	ID               string    `bson:"_id"`
+	FingerprintIndex string    `bson:"fingerprint_index"`
+	CreatedAt        time.Time `bson:"created_at"`
+	Response         []byte    `bson:"response"`
+	UserID           string    `bson:"user_id,omitempty"`
+
+	DataKey *dataKeyDocument `bson:"data_key,omitempty"`
+}
+
+// emailDomain returns the lower-cased domain of an email
+func emailDomain(email string) string {
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// isPersonal determines whether a field holds personal data
+func isPersonal(field string) bool {
+
+	for _, personal := range PersonalFields {
+		if field == personal {
+			return true
+		}
+	}
+	return false
+}
+
+// emailIndex returns the blind index of an email, regardless of case, by which users are found by email
+func (c *DatabaseClient) emailIndex(email string) string {
+	return c.keyring.BlindIndex(NormaliseEmail(email))
+}
+
+// searchIndexLength is the number of hex digits to which the blind index of a search token or prefix is truncated
+const searchIndexLength = 16
+
+// searchIndex returns the truncated blind index of a search token or prefix, which are indexed apart, so that a
+// prefix never matches a whole token
+func (c *DatabaseClient) searchIndex(kind string, value string) string {
+	return c.keyring.BlindIndex(kind + ":" + value)[:searchIndexLength]
+}
+
+// sealSearch returns the blind indexes by which a user is found by searching
+func (c *DatabaseClient) sealSearch(entity *models.UserDao) *searchDocument {
+
+	tokens := searchTokens(entity)
+
+	document := &searchDocument{Tokens: make([]string, 0, len(tokens)), Prefixes: make([]string, 0)}
+	for _, token := range tokens {
+		document.Tokens = append(document.Tokens, c.searchIndex("token", token))
+	}
+	for _, prefix := range searchPrefixes(tokens) {
+		document.Prefixes = append(document.Prefixes, c.searchIndex("prefix", prefix))
+	}
+
+	prefixes := namePrefixes(entity)
+
+	document.Names = make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		document.Names = append(document.Names, c.namePrefixIndex(prefix))
+	}
+	return document
+}
+
+// namePrefixIndex returns the truncated blind index of a lower-cased prefix of a name
+func (c *DatabaseClient) namePrefixIndex(prefix string) string {
+	return c.searchIndex("name", prefix)
+}
+
+// searchText returns the text of a mongo text search for the terms of a search, as the blind indexes of tokens and
+// prefixes which they may match
+func (c *DatabaseClient) searchText(text string) string {
+
+	indexes := make([]string, 0)
+	for _, term := range searchTerms(text) {
+		indexes = append(indexes, c.searchIndex("token", term))
+		if isSearchPrefix(term) {
+			indexes = append(indexes, c.searchIndex("prefix", term))
+		}
+	}
+	return strings.Join(indexes, " ")
+}
+
+// newDataKey generates a data key for a record, by the collection in which it's stored and its id
+func (c *DatabaseClient) newDataKey(collection string, id string) (*encryption.DataKey, *dataKeyDocument, error) {
+
+	key, err := c.keyring.NewDataKey(collection + "/" + id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, &dataKeyDocument{MasterKeyID: key.MasterKeyID, Wrapped: key.Wrapped}, nil
+}
+
+// openDataKey unwraps the data key of a record, by the collection in which it's stored and its id
+func (c *DatabaseClient) openDataKey(collection string, id string, document *dataKeyDocument) (*encryption.DataKey, error) {
+	return c.keyring.OpenDataKey(document.MasterKeyID, document.Wrapped, collection+"/"+id)
+}
+
+// sealUser returns the document in which a user is stored, its personal data encrypted under a new data key. Its
+// normalised email, if it has one, is stored as a blind index, as are its search tokens unless it's deleted
+func (c *DatabaseClient) sealUser(entity *models.UserDao) (*userDocument, error) {
+
+	key, dataKey, err := c.newDataKey("users", entity.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	document := &userDocument{
+		ID:          entity.ID,
+		Country:     entity.Country,
+		CreatedAt:   entity.CreatedAt,
+		UpdatedAt:   entity.UpdatedAt,
+		Version:     entity.Version,
+		EmailDomain: emailDomain(entity.Email),
+		DeletedAt:   entity.DeletedAt,
+		ErasedAt:    entity.ErasedAt,
+		DataKey:     dataKey,
+		PII:         &sealedUser{},
+	}
+
+	if entity.NormalisedEmail != "" {
+		document.NormalisedEmail = c.keyring.BlindIndex(entity.NormalisedEmail)
+	}
+
+	if entity.DeletedAt == nil {
+		document.Search = c.sealSearch(entity)
+	}
+
+	fields := []struct {
+		name      string
+		plaintext string
+		sealed    *[]byte
+	}{
+		{"first_name", entity.FirstName, &document.PII.FirstName},
+		{"last_name", entity.LastName, &document.PII.LastName},
+		{"email", entity.Email, &document.PII.Email},
+	}
+	for _, field := range fields {
+		*field.sealed, err = key.Encrypt(field.plaintext, field.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return document, nil
+}
+
+// openUser returns the user stored in a document, decrypting its personal data. The blind index of its normalised
+// email can't be reversed, so is given as the normalised email it indexes
+func (c *DatabaseClient) openUser(document *userDocument) (*models.UserDao, error) {
+
+	entity := &models.UserDao{
+		ID:              document.ID,
+		FirstName:       document.FirstName,
+		LastName:        document.LastName,
+		Email:           document.Email,
+		Country:         document.Country,
+		CreatedAt:       document.CreatedAt,
+		UpdatedAt:       document.UpdatedAt,
+		Version:         document.Version,
+		NormalisedEmail: document.NormalisedEmail,
+		DeletedAt:       document.DeletedAt,
+		ErasedAt:        document.ErasedAt,
+	}
+
+	if document.DataKey == nil || document.PII == nil {
+		return entity, nil
+	}
+
+	key, err := c.openDataKey("users", document.ID, document.DataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []struct {
+		name      string
+		sealed    []byte
+		plaintext *string
+	}{
+		{"first_name", document.PII.FirstName, &entity.FirstName},
+		{"last_name", document.PII.LastName, &entity.LastName},
+		{"email", document.PII.Email, &entity.Email},
+	}
+	for _, field := range fields {
+		*field.plaintext, err = key.Decrypt(field.sealed, field.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if document.NormalisedEmail != "" {
+		entity.NormalisedEmail = NormaliseEmail(entity.Email)
+	}
+
+	return entity, nil
+}
+
+// sealAuditEvent returns the document in which an audit event is stored, the values of its personal fields
+// encrypted under a new data key
+func (c *DatabaseClient) sealAuditEvent(event *models.AuditEventDao) (*auditDocument, error) {
+
+	key, dataKey, err := c.newDataKey("audit", event.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	document := &auditDocument{
+		ID:        event.ID,
+		UserID:    event.UserID,
+		Actor:     event.Actor,
+		Operation: event.Operation,
+		Timestamp: event.Timestamp,
+		Changes:   make([]changeDocument, 0, len(event.Changes)),
+		Sequence:  event.Sequence,
+		DataKey:   dataKey,
+	}
+
+	for _, change := range event.Changes {
+
+		sealed := changeDocument{Field: change.Field}
+
+		sealed.Before, err = sealValue(key, change.Field, change.Before, "before")
+		if err != nil {
+			return nil, err
+		}
+
+		sealed.After, err = sealValue(key, change.Field, change.After, "after")
+		if err != nil {
+			return nil, err
+		}
+
+		document.Changes = append(document.Changes, sealed)
+	}
+
+	return document, nil
+}
+
+// sealValue returns the value of a field change as stored: encrypted if the field is personal, bound to the field
+// and to whether it's the value before or after the change
+func sealValue(key *encryption.DataKey, field string, value *string, side string) (interface{}, error) {
+
+	if value == nil {
+		return nil, nil
+	}
+	if !isPersonal(field) {
+		return *value, nil
+	}
+	return key.Encrypt(*value, field+"."+side)
+}
+
+// openAuditEvent returns the audit event stored in a document, decrypting the values of its personal fields
+func (c *DatabaseClient) openAuditEvent(document *auditDocument) (*models.AuditEventDao, error) {
+
+	event := &models.AuditEventDao{
+		ID:        document.ID,
+		UserID:    document.UserID,
+		Actor:     document.Actor,
+		Operation: document.Operation,
+		Timestamp: document.Timestamp,
+		Changes:   make([]models.FieldChangeDao, 0, len(document.Changes)),
+		Sequence:  document.Sequence,
+	}
+
+	var key *encryption.DataKey
+	if document.DataKey != nil {
+		var err error
+		key, err = c.openDataKey("audit", document.ID, document.DataKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, sealed := range document.Changes {
+
+		change := models.FieldChangeDao{Field: sealed.Field}
+
+		var err error
+		change.Before, err = openValue(key, sealed.Field, sealed.Before, "before")
+		if err != nil {
+			return nil, err
+		}
+
+		change.After, err = openValue(key, sealed.Field, sealed.After, "after")
+		if err != nil {
+			return nil, err
+		}
+
+		event.Changes = append(event.Changes, change)
+	}
+
+	return event, nil
+}
+
+// openValue returns the value of a field change as stored, decrypting it if it's encrypted
+func openValue(key *encryption.DataKey, field string, value interface{}, side string) (*string, error) {
+
+	var sealed []byte
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return &v, nil
+	case primitive.Binary:
+		sealed = v.Data
+	case []byte:
+		sealed = v
+	default:
+		return nil, fmt.Errorf("unexpected %T value of %s", value, field)
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("%s is encrypted without a data key", field)
+	}
+
+	plaintext, err := key.Decrypt(sealed, field+"."+side)
+	if err != nil {
+		return nil, err
+	}
+	return &plaintext, nil
+}
+
+// sealResponse encrypts the response to the request an idempotency record describes, under a new data key
+func (c *DatabaseClient) sealResponse(id string, response []byte) ([]byte, *dataKeyDocument, error) {
+
+	key, dataKey, err := c.newDataKey("idempotency", id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sealed, err := key.Encrypt(string(response), "response")
+	if err != nil {
+		return nil, nil, err
+	}
+	return sealed, dataKey, nil
+}
+
+// fingerprintIndex returns the blind index of the fingerprint of a request made with an idempotency key
+func (c *DatabaseClient) fingerprintIndex(fingerprint string) string {
+	return c.keyring.BlindIndex("fingerprint:" + fingerprint)
+}
+
+// openIdempotencyRecord returns the idempotency record stored in a document, decrypting its response. The blind
+// index of its fingerprint can't be reversed, so is given as the fingerprint of a request if it's that it indexes
+func (c *DatabaseClient) openIdempotencyRecord(document *idempotencyDocument, fingerprint string) (*models.IdempotencyRecordDao, error) {
+
+	record := &models.IdempotencyRecordDao{
+		ID:          document.ID,
+		Fingerprint: document.FingerprintIndex,
+		CreatedAt:   document.CreatedAt,
+		Response:    document.Response,
+		UserID:      document.UserID,
+	}
+	if document.FingerprintIndex == c.fingerprintIndex(fingerprint) {
+		record.Fingerprint = fingerprint
+	}
+
+	if document.DataKey == nil || document.Response == nil {
+		return record, nil
+	}
+
+	key, err := c.openDataKey("idempotency", document.ID, document.DataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := key.Decrypt(document.Response, "response")
+	if err != nil {
+		return nil, err
+	}
+	record.Response = []byte(response)
+
+	return record, nil
+}
@@ -0,0 +1,272 @@
+package db
+
+import (
+	"github.com/bpsaunders/user-api/config"
+	"github.com/bpsaunders/user-api/encryption"
+	"github.com/bpsaunders/user-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// test keys, the first master key being current and the second retired
+const (
+	testMasterKeys = `[{"id": "current", "key": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}, ` +
+		`{"id": "retired", "key": "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="}]`
+	testRetiredMasterKeys = `[{"id": "retired", "key": "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="}]`
+	testIndexKey          = "aW5kZXgta2V5LWluZGV4LWtleS1pbmRleC1rZXktaXg="
+)
+
+// newEncryptingClient returns a client which encrypts under the given master keys, without a database
+func newEncryptingClient(masterKeys string) *DatabaseClient {
+
+	keyring, err := encryption.NewKeyring(&config.Config{PIIMasterKeys: masterKeys, PIIIndexKey: testIndexKey})
+	So(err, ShouldBeNil)
+	return &DatabaseClient{keyring: keyring}
+}
+
+// roundTrip encodes a document as it's written to mongo, and decodes it as it's read back
+func roundTrip(document interface{}, decoded interface{}) {
+
+	b, err := bson.Marshal(document)
+	So(err, ShouldBeNil)
+	So(bson.Unmarshal(b, decoded), ShouldBeNil)
+}
+
+func TestUnitSealUser(t *testing.T) {
+
+	Convey("Given I seal a user", t, func() {
+
+		client := newEncryptingClient(testMasterKeys)
+
+		entity := withNormalisedEmail(&models.UserDao{
+			ID:        "id",
+			FirstName: "Alice",
+			LastName:  "Smith",
+			Email:     "Alice@Example.com",
+			Country:   "GB",
+			CreatedAt: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+			UpdatedAt: time.Date(2020, time.January, 2, 0, 0, 0, 0, time.UTC),
+			Version:   2,
+		})
+
+		document, err := client.sealUser(entity)
+		So(err, ShouldBeNil)
+
+		b, err := bson.Marshal(document)
+		So(err, ShouldBeNil)
+
+		Convey("Then I expect none of its personal data to be stored in the clear", func() {
+
+			for _, personal := range []string{"Alice", "Smith", "Alice@Example.com", "alice@example.com"} {
+				So(string(b), ShouldNotContainSubstring, personal)
+			}
+			So(document.NormalisedEmail, ShouldEqual, client.emailIndex("ALICE@example.com"))
+			So(document.EmailDomain, ShouldEqual, "example.com")
+			So(document.DataKey.MasterKeyID, ShouldEqual, "current")
+		})
+
+		Convey("Then I expect it to be found by searching the blind indexes of its words and their prefixes", func() {
+
+			So(document.Search.Tokens, ShouldContain, client.searchIndex("token", "alice"))
+			So(document.Search.Tokens, ShouldContain, client.searchIndex("token", "alice@example.com"))
+			So(document.Search.Prefixes, ShouldContain, client.searchIndex("prefix", "sm"))
+			So(document.Search.Prefixes, ShouldNotContain, client.searchIndex("token", "sm"))
+
+			So(client.searchText("Alice"), ShouldEqual,
+				client.searchIndex("token", "alice")+" "+client.searchIndex("prefix", "alice"))
+		})
+
+		Convey("Then I expect it to be filtered by the blind indexes of the prefixes of its names", func() {
+
+			So(document.Search.Names, ShouldContain, client.namePrefixIndex("al"))
+			So(document.Search.Names, ShouldContain, client.namePrefixIndex("smith"))
+			So(document.Search.Names, ShouldNotContain, client.namePrefixIndex("alice@"))
+		})
+
+		Convey("Then I expect to open it as it was", func() {
+
+			var decoded userDocument
+			roundTrip(document, &decoded)
+
+			opened, err := client.openUser(&decoded)
+
+			So(err, ShouldBeNil)
+			So(opened, ShouldResemble, entity)
+		})
+
+		Convey("Then I expect not to open it once its data key is moved to another user", func() {
+
+			other, err := client.sealUser(&models.UserDao{ID: "other", Email: "bob@example.com"})
+			So(err, ShouldBeNil)
+
+			other.PII = document.PII
+			other.DataKey = document.DataKey
+
+			_, err = client.openUser(other)
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Then I expect not to open it without the master key which wrapped its data key", func() {
+
+			_, err := newEncryptingClient(testRetiredMasterKeys).openUser(document)
+
+			So(err, ShouldEqual, encryption.ErrUnknownMasterKey)
+		})
+	})
+
+	Convey("Given I seal a deleted user", t, func() {
+
+		client := newEncryptingClient(testMasterKeys)
+
+		deletedAt := time.Date(2020, time.January, 3, 0, 0, 0, 0, time.UTC)
+		document, err := client.sealUser(&models.UserDao{ID: "id", Email: "alice@example.com", DeletedAt: &deletedAt})
+		So(err, ShouldBeNil)
+
+		Convey("Then I expect it to have no normalised email, so that its email is free, nor to be found by searching", func() {
+
+			So(document.NormalisedEmail, ShouldBeEmpty)
+			So(document.Search, ShouldBeNil)
+
+			opened, err := client.openUser(document)
+			So(err, ShouldBeNil)
+			So(opened.NormalisedEmail, ShouldBeEmpty)
+			So(opened.Email, ShouldEqual, "alice@example.com")
+		})
+	})
+
+	Convey("Given a user stored before encryption was introduced", t, func() {
+
+		client := newEncryptingClient(testMasterKeys)
+
+		var legacy userDocument
+		roundTrip(bson.M{
+			"_id": "id", "first_name": "Alice", "last_name": "Smith", "email": "Alice@example.com",
+			"normalised_email": "alice@example.com", "country": "GB", "version": 1,
+		}, &legacy)
+
+		Convey("Then I expect to open it as stored in the clear", func() {
+
+			opened, err := client.openUser(&legacy)
+
+			So(err, ShouldBeNil)
+			So(opened.FirstName, ShouldEqual, "Alice")
+			So(opened.Email, ShouldEqual, "Alice@example.com")
+			So(opened.NormalisedEmail, ShouldEqual, "alice@example.com")
+		})
+	})
+}
+
+func TestUnitSealAuditEvent(t *testing.T) {
+
+	Convey("Given I seal an audit event changing personal data", t, func() {
+
+		client := newEncryptingClient(testMasterKeys)
+
+		before, after, country := "old@example.com", "new@example.com", "GB"
+		event := &models.AuditEventDao{
+			ID:        "event",
+			UserID:    "id",
+			Actor:     "api-key:admin",
+			Operation: "patch",
+			Timestamp: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+			Changes: []models.FieldChangeDao{
+				{Field: "email", Before: &before, After: &after},
+				{Field: "country", Before: nil, After: &country},
+			},
+			Sequence: 2,
+		}
+
+		document, err := client.sealAuditEvent(event)
+		So(err, ShouldBeNil)
+
+		b, err := bson.Marshal(document)
+		So(err, ShouldBeNil)
+
+		Convey("Then I expect only the values of personal fields to be encrypted", func() {
+
+			So(string(b), ShouldNotContainSubstring, before)
+			So(string(b), ShouldNotContainSubstring, after)
+			So(document.Changes[1].After, ShouldEqual, country)
+		})
+
+		Convey("Then I expect to open it as it was", func() {
+
+			var decoded auditDocument
+			roundTrip(document, &decoded)
+
+			opened, err := client.openAuditEvent(&decoded)
+
+			So(err, ShouldBeNil)
+			So(opened, ShouldResemble, event)
+		})
+
+		Convey("Then I expect to open it once its personal data is redacted in the clear", func() {
+
+			var decoded auditDocument
+			roundTrip(document, &decoded)
+			decoded.Changes[0].Before = "tombstone"
+
+			opened, err := client.openAuditEvent(&decoded)
+
+			So(err, ShouldBeNil)
+			So(*opened.Changes[0].Before, ShouldEqual, "tombstone")
+			So(*opened.Changes[0].After, ShouldEqual, after)
+		})
+	})
+}
+
+func TestUnitSealResponse(t *testing.T) {
+
+	Convey("Given I seal the response to a request", t, func() {
+
+		client := newEncryptingClient(testMasterKeys)
+
+		response := []byte(`{"email": "alice@example.com"}`)
+
+		sealed, dataKey, err := client.sealResponse("key", response)
+		So(err, ShouldBeNil)
+
+		Convey("Then I expect to open it as it was, for the same idempotency key alone", func() {
+
+			So(string(sealed), ShouldNotContainSubstring, "alice@example.com")
+
+			record, err := client.openIdempotencyRecord(&idempotencyDocument{ID: "key", Response: sealed, DataKey: dataKey}, "")
+			So(err, ShouldBeNil)
+			So(record.Response, ShouldResemble, response)
+
+			_, err = client.openIdempotencyRecord(&idempotencyDocument{ID: "other", Response: sealed, DataKey: dataKey}, "")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestUnitFingerprintIndex(t *testing.T) {
+
+	Convey("Given I store the fingerprint of a request made with an idempotency key", t, func() {
+
+		client := newEncryptingClient(testMasterKeys)
+
+		fingerprint := "0123456789abcdef"
+		document := &idempotencyDocument{ID: "key", FingerprintIndex: client.fingerprintIndex(fingerprint)}
+
+		Convey("Then I expect it to be stored as a blind index, rather than in the clear", func() {
+
+			So(document.FingerprintIndex, ShouldNotContainSubstring, fingerprint)
+		})
+
+		Convey("Then I expect it to be given as the fingerprint of a request it indexes, and no other", func() {
+
+			record, err := client.openIdempotencyRecord(document, fingerprint)
+			So(err, ShouldBeNil)
+			So(record.Fingerprint, ShouldEqual, fingerprint)
+
+			record, err = client.openIdempotencyRecord(document, "fedcba9876543210")
+			So(err, ShouldBeNil)
+			So(record.Fingerprint, ShouldNotEqual, "fedcba9876543210")
+		})
+	})
+}
@@ -0,0 +1,17 @@
+package db
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrErasureReceiptExists is returned when creating the erasure receipt of a user which already has one
+var ErrErasureReceiptExists = errors.New("an erasure receipt already exists for the given user")
+
+// erasedAtField is the bson name of the field marking a user as erased
+const erasedAtField = "erased_at"
+
+// notErased matches users which haven't been erased
+func notErased() bson.M {
+	return bson.M{erasedAtField: bson.M{"$exists": false}}
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// ErrIdempotencyKeyExists is returned when creating an idempotency record whose key is already held by an
+// unexpired record
+var ErrIdempotencyKeyExists = errors.New("an idempotency record already exists with the given key")
+
+// IdempotencyTTL is how long an idempotency record is kept for, after which its key may be reused
+const IdempotencyTTL = 24 * time.Hour
+
+// idempotencyCutoff returns the time before which idempotency records have expired. Mongodb removes expired
+// records periodically rather than immediately, so they're disregarded until they're gone
+func idempotencyCutoff() time.Time {
+	return time.Now().Add(-IdempotencyTTL)
+}
+
+// indexFingerprints replaces the fingerprint stored in the clear by each idempotency record stored before
+// fingerprints were indexed with its blind index, returning the number of records indexed
+func (c *DatabaseClient) indexFingerprints(ctx context.Context) (int64, error) {
+
+	var indexed int64
+
+	collection := c.db.Collection("idempotency")
+	cur, err := collection.Find(ctx, bson.M{"fingerprint": bson.M{"$exists": true}})
+
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+
+		var document struct {
+			ID          string `bson:"_id"`
+			Fingerprint string `bson:"fingerprint"`
+		}
+		err = cur.Decode(&document)
+
+		if err != nil {
+			return indexed, err
+		}
+
+		_, err = collection.UpdateOne(ctx, bson.M{idField: document.ID}, bson.M{
+			"$set":   bson.M{"fingerprint_index": c.fingerprintIndex(document.Fingerprint)},
+			"$unset": bson.M{"fingerprint": ""},
+		})
+		if err != nil {
+			return indexed, err
+		}
+		indexed++
+	}
+
+	return indexed, cur.Err()
+}
+
+// isDuplicateKey determines whether an error was caused by a unique index, including that on ids
+func isDuplicateKey(err error) bool {
+
+	if writeException, ok := err.(mongo.WriteException); ok {
+		for _, writeError := range writeException.WriteErrors {
+			if writeError.Code == duplicateKeyCode {
+				return true
+			}
+		}
+	}
+	return false
+}
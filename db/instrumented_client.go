@@ -0,0 +1,288 @@
+package db
+
+import (
+	"context"
+	"github.com/bpsaunders/user-api/metrics"
+	"github.com/bpsaunders/user-api/models"
+	"time"
+)
+
+// InstrumentedClient decorates a Client, recording metrics for each db operation
+type InstrumentedClient struct {
+	client Client
+}
+
+// NewInstrumentedClient returns a Client which records metrics for each operation of the given client
+func NewInstrumentedClient(client Client) Client {
+	return &InstrumentedClient{
+		client: client,
+	}
+}
+
+func observe(operation string, start time.Time, err error) {
+
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+
+	metrics.DBOperations.Inc(operation, outcome)
+	metrics.DBOperationDuration.Observe(time.Since(start).Seconds(), operation)
+}
+
+// CreateUser records metrics for creating a user
+func (c *InstrumentedClient) CreateUser(ctx context.Context, entity *models.UserDao) error {
+
+	start := time.Now()
+	err := c.client.CreateUser(ctx, entity)
+	observe("create_user", start, err)
+	return err
+}
+
+// CreateUsers records metrics for creating users in bulk
+func (c *InstrumentedClient) CreateUsers(ctx context.Context, entities []*models.UserDao, events []*models.AuditEventDao, atomic bool) ([]error, error) {
+
+	start := time.Now()
+	errs, err := c.client.CreateUsers(ctx, entities, events, atomic)
+	observe("create_users", start, err)
+	return errs, err
+}
+
+// GetUser records metrics for fetching a user
+func (c *InstrumentedClient) GetUser(ctx context.Context, id string) (*models.UserDao, error) {
+
+	start := time.Now()
+	entity, err := c.client.GetUser(ctx, id)
+	observe("get_user", start, err)
+	return entity, err
+}
+
+// GetAllUsers records metrics for fetching users
+func (c *InstrumentedClient) GetAllUsers(ctx context.Context, query *UserQuery) (*[]*models.UserDao, error) {
+
+	start := time.Now()
+	entities, err := c.client.GetAllUsers(ctx, query)
+	observe("get_all_users", start, err)
+	return entities, err
+}
+
+// CountUsers records metrics for counting users
+func (c *InstrumentedClient) CountUsers(ctx context.Context, filter *UserFilter) (int64, error) {
+
+	start := time.Now()
+	count, err := c.client.CountUsers(ctx, filter)
+	observe("count_users", start, err)
+	return count, err
+}
+
+// StreamUsers records metrics for streaming users
+func (c *InstrumentedClient) StreamUsers(ctx context.Context, filter *UserFilter, fn func(entity *models.UserDao) error) error {
+
+	start := time.Now()
+	err := c.client.StreamUsers(ctx, filter, fn)
+	observe("stream_users", start, err)
+	return err
+}
+
+// GetUserByEmail records metrics for fetching a user by email
+func (c *InstrumentedClient) GetUserByEmail(ctx context.Context, email string) (*models.UserDao, error) {
+
+	start := time.Now()
+	entity, err := c.client.GetUserByEmail(ctx, email)
+	observe("get_user_by_email", start, err)
+	return entity, err
+}
+
+// SearchUsers records metrics for searching users
+func (c *InstrumentedClient) SearchUsers(ctx context.Context, search *UserSearch) (*[]*models.UserDao, error) {
+
+	start := time.Now()
+	entities, err := c.client.SearchUsers(ctx, search)
+	observe("search_users", start, err)
+	return entities, err
+}
+
+// GetUserStats records metrics for counting users
+func (c *InstrumentedClient) GetUserStats(ctx context.Context, query *UserStatsQuery) (*models.UserStatsDao, error) {
+
+	start := time.Now()
+	stats, err := c.client.GetUserStats(ctx, query)
+	observe("get_user_stats", start, err)
+	return stats, err
+}
+
+// UserExistsWithEmail records metrics for determining whether a user exists with an email
+func (c *InstrumentedClient) UserExistsWithEmail(ctx context.Context, email string) (bool, error) {
+
+	start := time.Now()
+	exists, err := c.client.UserExistsWithEmail(ctx, email)
+	observe("user_exists_with_email", start, err)
+	return exists, err
+}
+
+// ExistingEmails records metrics for determining which emails already belong to users
+func (c *InstrumentedClient) ExistingEmails(ctx context.Context, emails []string) ([]string, error) {
+
+	start := time.Now()
+	existing, err := c.client.ExistingEmails(ctx, emails)
+	observe("existing_emails", start, err)
+	return existing, err
+}
+
+// UpdateUser records metrics for updating a user
+func (c *InstrumentedClient) UpdateUser(ctx context.Context, entity *models.UserDao, version int64) error {
+
+	start := time.Now()
+	err := c.client.UpdateUser(ctx, entity, version)
+	observe("update_user", start, err)
+	return err
+}
+
+// DeleteUser records metrics for deleting a user
+func (c *InstrumentedClient) DeleteUser(ctx context.Context, id string, version int64) (*models.UserDao, error) {
+
+	start := time.Now()
+	entity, err := c.client.DeleteUser(ctx, id, version)
+	observe("delete_user", start, err)
+	return entity, err
+}
+
+// GetDeletedUser records metrics for fetching a deleted user
+func (c *InstrumentedClient) GetDeletedUser(ctx context.Context, id string) (*models.UserDao, error) {
+
+	start := time.Now()
+	entity, err := c.client.GetDeletedUser(ctx, id)
+	observe("get_deleted_user", start, err)
+	return entity, err
+}
+
+// RestoreUser records metrics for restoring a deleted user
+func (c *InstrumentedClient) RestoreUser(ctx context.Context, entity *models.UserDao, version int64) error {
+
+	start := time.Now()
+	err := c.client.RestoreUser(ctx, entity, version)
+	observe("restore_user", start, err)
+	return err
+}
+
+// PurgeUsers records metrics for permanently removing deleted users
+func (c *InstrumentedClient) PurgeUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	start := time.Now()
+	purged, err := c.client.PurgeUsers(ctx, deletedBefore)
+	observe("purge_users", start, err)
+	return purged, err
+}
+
+// EraseUser records metrics for erasing a user
+func (c *InstrumentedClient) EraseUser(ctx context.Context, entity *models.UserDao, version int64) error {
+
+	start := time.Now()
+	err := c.client.EraseUser(ctx, entity, version)
+	observe("erase_user", start, err)
+	return err
+}
+
+// CreateAuditEvent records metrics for recording an audit event
+func (c *InstrumentedClient) CreateAuditEvent(ctx context.Context, event *models.AuditEventDao) error {
+
+	start := time.Now()
+	err := c.client.CreateAuditEvent(ctx, event)
+	observe("create_audit_event", start, err)
+	return err
+}
+
+// GetAuditEvents records metrics for fetching audit events
+func (c *InstrumentedClient) GetAuditEvents(ctx context.Context, query *AuditQuery) (*[]*models.AuditEventDao, error) {
+
+	start := time.Now()
+	events, err := c.client.GetAuditEvents(ctx, query)
+	observe("get_audit_events", start, err)
+	return events, err
+}
+
+// RedactAuditEvents records metrics for redacting the history of a user
+func (c *InstrumentedClient) RedactAuditEvents(ctx context.Context, userID string, fields []string, replacement string) error {
+
+	start := time.Now()
+	err := c.client.RedactAuditEvents(ctx, userID, fields, replacement)
+	observe("redact_audit_events", start, err)
+	return err
+}
+
+// CreateErasureReceipt records metrics for storing an erasure receipt
+func (c *InstrumentedClient) CreateErasureReceipt(ctx context.Context, receipt *models.ErasureReceiptDao) error {
+
+	start := time.Now()
+	err := c.client.CreateErasureReceipt(ctx, receipt)
+	observe("create_erasure_receipt", start, err)
+	return err
+}
+
+// GetErasureReceipt records metrics for fetching an erasure receipt
+func (c *InstrumentedClient) GetErasureReceipt(ctx context.Context, userID string) (*models.ErasureReceiptDao, error) {
+
+	start := time.Now()
+	receipt, err := c.client.GetErasureReceipt(ctx, userID)
+	observe("get_erasure_receipt", start, err)
+	return receipt, err
+}
+
+// CreateIdempotencyRecord records metrics for storing an idempotency record
+func (c *InstrumentedClient) CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecordDao) error {
+
+	start := time.Now()
+	err := c.client.CreateIdempotencyRecord(ctx, record)
+	observe("create_idempotency_record", start, err)
+	return err
+}
+
+// GetIdempotencyRecord records metrics for fetching an idempotency record
+func (c *InstrumentedClient) GetIdempotencyRecord(ctx context.Context, id string, fingerprint string) (*models.IdempotencyRecordDao, error) {
+
+	start := time.Now()
+	record, err := c.client.GetIdempotencyRecord(ctx, id, fingerprint)
+	observe("get_idempotency_record", start, err)
+	return record, err
+}
+
+// CompleteIdempotencyRecord records metrics for storing the response to a request made with an idempotency key
+func (c *InstrumentedClient) CompleteIdempotencyRecord(ctx context.Context, id string, userID string, response []byte) error {
+
+	start := time.Now()
+	err := c.client.CompleteIdempotencyRecord(ctx, id, userID, response)
+	observe("complete_idempotency_record", start, err)
+	return err
+}
+
+// GetUserIdempotencyRecords records metrics for fetching the idempotency records of a user
+func (c *InstrumentedClient) GetUserIdempotencyRecords(ctx context.Context, userID string) ([]*models.IdempotencyRecordDao, error) {
+
+	start := time.Now()
+	records, err := c.client.GetUserIdempotencyRecords(ctx, userID)
+	observe("get_user_idempotency_records", start, err)
+	return records, err
+}
+
+// DeleteIdempotencyRecord records metrics for removing an idempotency record
+func (c *InstrumentedClient) DeleteIdempotencyRecord(ctx context.Context, id string) error {
+
+	start := time.Now()
+	err := c.client.DeleteIdempotencyRecord(ctx, id)
+	observe("delete_idempotency_record", start, err)
+	return err
+}
+
+// Ping records metrics for checking the health of the db
+func (c *InstrumentedClient) Ping(ctx context.Context) error {
+
+	start := time.Now()
+	err := c.client.Ping(ctx)
+	observe("ping", start, err)
+	return err
+}
+
+// Shutdown shuts down the decorated client
+func (c *InstrumentedClient) Shutdown() {
+	c.client.Shutdown()
+}
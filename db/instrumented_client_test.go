@@ -0,0 +1,33 @@
+package db
+
+import (
+	"github.com/bpsaunders/user-api/metrics"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitInstrumentedClient(t *testing.T) {
+
+	clientContract(t, func() Client {
+		return NewInstrumentedClient(NewMemoryClient())
+	})
+
+	Convey("Given I perform db operations through an instrumented client", t, func() {
+
+		client := NewInstrumentedClient(NewMemoryClient())
+
+		successes := metrics.DBOperations.Value("create_user", "success")
+		errors := metrics.DBOperations.Value("create_user", "error")
+
+		So(client.CreateUser(ctx, contractUser("1", "user@mail.com")), ShouldBeNil)
+		So(client.CreateUser(ctx, contractUser("2", "user@mail.com")), ShouldEqual, ErrDuplicateEmail)
+
+		Convey("Then I expect each operation to be counted by outcome, and timed", func() {
+
+			So(metrics.DBOperations.Value("create_user", "success"), ShouldEqual, successes+1)
+			So(metrics.DBOperations.Value("create_user", "error"), ShouldEqual, errors+1)
+			So(metrics.DBOperationDuration.Count("create_user"), ShouldBeGreaterThanOrEqualTo, 2)
+		})
+	})
+}
@@ -0,0 +1,752 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/bpsaunders/user-api/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryClient is an in-memory implementation of the Client interface, for use
+// where a MongoDB instance isn't available. As with mongo, operations fail if
+// their context is already done
+type MemoryClient struct {
+	mtx   sync.RWMutex
+	users map[string]*models.UserDao
+	order []string
+	audit []*models.AuditEventDao
+
+	idempotency map[string]*models.IdempotencyRecordDao
+	receipts    map[string]*models.ErasureReceiptDao
+}
+
+// NewMemoryClient returns a new in-memory implementation of the Client interface
+func NewMemoryClient() Client {
+	return &MemoryClient{
+		users:       make(map[string]*models.UserDao),
+		idempotency: make(map[string]*models.IdempotencyRecordDao),
+		receipts:    make(map[string]*models.ErasureReceiptDao),
+	}
+}
+
+// CreateUser stores a copy of a user entity, returning ErrDuplicateEmail if the email is taken
+func (c *MemoryClient) CreateUser(ctx context.Context, entity *models.UserDao) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.users[entity.ID]; ok {
+		return fmt.Errorf("user already exists with id: %s", entity.ID)
+	}
+
+	if c.emailTaken(entity) {
+		return ErrDuplicateEmail
+	}
+
+	c.users[entity.ID] = copyUser(withNormalisedEmail(entity))
+	c.order = append(c.order, entity.ID)
+
+	return nil
+}
+
+// CreateUsers stores copies of user entities in bulk, returning an error for each entity which wasn't created, by
+// index: ErrDuplicateEmail if its email is taken. The creation of each entity is recorded by the audit event of the
+// same index. Atomically, either every entity and its event is created or none are, and every entity not at fault
+// is given ErrBatchAborted
+func (c *MemoryClient) CreateUsers(ctx context.Context, entities []*models.UserDao, events []*models.AuditEventDao, atomic bool) ([]error, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	errs := make([]error, len(entities))
+	created := make([]string, 0, len(entities))
+
+	for i, entity := range entities {
+		if _, ok := c.users[entity.ID]; ok {
+			errs[i] = fmt.Errorf("user already exists with id: %s", entity.ID)
+		} else if c.emailTaken(entity) {
+			errs[i] = ErrDuplicateEmail
+		} else {
+			c.users[entity.ID] = copyUser(withNormalisedEmail(entity))
+			c.order = append(c.order, entity.ID)
+			created = append(created, entity.ID)
+			continue
+		}
+
+		// an atomic batch stops at its first failure, as with mongo, and is rolled back
+		if atomic {
+			for _, id := range created {
+				c.remove(id)
+			}
+			return abortBatch(errs), nil
+		}
+	}
+
+	for _, event := range createdEvents(errs, events) {
+		c.audit = append(c.audit, copyAuditEvent(event))
+	}
+
+	return errs, nil
+}
+
+// GetUser fetches a copy of a user according to an id
+func (c *MemoryClient) GetUser(ctx context.Context, id string) (*models.UserDao, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	entity, ok := c.users[id]
+	if !ok || entity.DeletedAt != nil {
+		return nil, nil
+	}
+
+	return copyUser(entity), nil
+}
+
+// GetDeletedUser fetches a copy of a deleted user according to an id, including one which has been erased
+func (c *MemoryClient) GetDeletedUser(ctx context.Context, id string) (*models.UserDao, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	entity, ok := c.users[id]
+	if !ok || entity.DeletedAt == nil {
+		return nil, nil
+	}
+
+	return copyUser(entity), nil
+}
+
+// GetAllUsers returns copies of users which match a query
+func (c *MemoryClient) GetAllUsers(ctx context.Context, query *UserQuery) (*[]*models.UserDao, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	// as in mongo, so that the backends agree
+	if query.sortsByPersonalData() && c.countUsers(&query.Filter) > personalSortLimit {
+		return nil, ErrTooManyToSort
+	}
+
+	matched := query.apply(c.all())
+
+	entities := make([]*models.UserDao, 0, len(matched))
+	for _, entity := range matched {
+		entities = append(entities, copyUser(entity))
+	}
+
+	return &entities, nil
+}
+
+// CountUsers returns the number of users which match a filter
+func (c *MemoryClient) CountUsers(ctx context.Context, filter *UserFilter) (int64, error) {
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return c.countUsers(filter), nil
+}
+
+// countUsers returns the number of users which match a filter, the lock being held by the caller
+func (c *MemoryClient) countUsers(filter *UserFilter) int64 {
+
+	var count int64
+	for _, entity := range c.all() {
+		if filter.matches(entity) {
+			count++
+		}
+	}
+	return count
+}
+
+// ExistingEmails returns those of the given emails which already belong to users, regardless of case
+func (c *MemoryClient) ExistingEmails(ctx context.Context, emails []string) ([]string, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	taken := make(map[string]bool)
+	for _, entity := range c.users {
+		if entity.NormalisedEmail != "" {
+			taken[entity.NormalisedEmail] = true
+		}
+	}
+
+	return takenEmails(emails, taken), nil
+}
+
+// StreamUsers calls fn with a copy of each user which matches a filter, in order of id. The matching users are
+// copied up front, so that fn is never called while the client is locked. Streaming stops at the first error,
+// be it from fn or the context being done
+func (c *MemoryClient) StreamUsers(ctx context.Context, filter *UserFilter, fn func(entity *models.UserDao) error) error {
+
+	entities, err := c.GetAllUsers(ctx, &UserQuery{Filter: *filter})
+	if err != nil {
+		return err
+	}
+
+	for _, entity := range *entities {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(entity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetUserByEmail fetches a copy of a user according to an email, regardless of case
+func (c *MemoryClient) GetUserByEmail(ctx context.Context, email string) (*models.UserDao, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	entity := c.findByEmail(email)
+	if entity == nil {
+		return nil, nil
+	}
+
+	return copyUser(entity), nil
+}
+
+// SearchUsers returns copies of the users, bar those deleted, which best match a search, most relevant first, then
+// in order of id
+func (c *MemoryClient) SearchUsers(ctx context.Context, search *UserSearch) (*[]*models.UserDao, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	matched := search.apply(c.all())
+
+	entities := make([]*models.UserDao, 0, len(matched))
+	for _, entity := range matched {
+		entities = append(entities, copyUser(entity))
+	}
+
+	return &entities, nil
+}
+
+// GetUserStats counts the users which match a query
+func (c *MemoryClient) GetUserStats(ctx context.Context, query *UserStatsQuery) (*models.UserStatsDao, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return query.apply(c.all()), nil
+}
+
+// UserExistsWithEmail determines whether a user is stored with the given email, regardless of case
+func (c *MemoryClient) UserExistsWithEmail(ctx context.Context, email string) (bool, error) {
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return c.findByNormalisedEmail(email) != nil, nil
+}
+
+// UpdateUser replaces an existing user entity, conditional upon its version unless AnyVersion is given; returning
+// ErrDuplicateEmail if the email is taken, or ErrVersionConflict if the version doesn't match. Unconditionally
+// updating a user which doesn't exist is a no-op
+func (c *MemoryClient) UpdateUser(ctx context.Context, entity *models.UserDao, version int64) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.versionMatches(entity.ID, version) {
+		if version == AnyVersion {
+			return nil
+		}
+		return ErrVersionConflict
+	}
+
+	if c.emailTaken(entity) {
+		return ErrDuplicateEmail
+	}
+
+	c.users[entity.ID] = copyUser(withNormalisedEmail(entity))
+
+	return nil
+}
+
+// DeleteUser marks a user as deleted according to an id and, unless AnyVersion is given, version, returning the
+// user as it was before deletion, or ErrVersionConflict if no user was deleted with the given version. The user
+// is kept, at its next version, until purged, but its email is freed for reuse
+func (c *MemoryClient) DeleteUser(ctx context.Context, id string, version int64) (*models.UserDao, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.versionMatches(id, version) {
+		if version == AnyVersion {
+			return nil, nil
+		}
+		return nil, ErrVersionConflict
+	}
+
+	entity := c.users[id]
+
+	deleted := copyUser(entity)
+	deletedAt := deletionTime()
+	deleted.DeletedAt = &deletedAt
+	deleted.Version++
+	deleted.NormalisedEmail = ""
+	c.users[id] = deleted
+
+	return entity, nil
+}
+
+// RestoreUser replaces a deleted user with a copy of the given entity, which isn't deleted, conditional upon the
+// version of the deleted user; returning ErrDuplicateEmail if the email has since been taken, or
+// ErrVersionConflict if no deleted user has the given id and version. An erased user is never restored
+func (c *MemoryClient) RestoreUser(ctx context.Context, entity *models.UserDao, version int64) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	existing, ok := c.users[entity.ID]
+	if !ok || existing.DeletedAt == nil || existing.ErasedAt != nil || existing.Version != version {
+		return ErrVersionConflict
+	}
+
+	if c.emailTaken(entity) {
+		return ErrDuplicateEmail
+	}
+
+	c.users[entity.ID] = copyUser(withNormalisedEmail(entity))
+
+	return nil
+}
+
+// PurgeUsers permanently removes users which were deleted before the given time, returning how many were removed.
+// Erased users are kept, so that their tombstones endure
+func (c *MemoryClient) PurgeUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var purged int64
+	for _, id := range append([]string(nil), c.order...) {
+		entity := c.users[id]
+		if entity.ErasedAt == nil && entity.DeletedAt != nil && entity.DeletedAt.Before(deletedBefore) {
+			c.remove(id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// EraseUser replaces a user with a copy of the given entity, which has been anonymised, conditional upon the
+// version of the user, whether deleted or not; returning ErrVersionConflict if no user which hasn't already been
+// erased has the given id and version. The entity is stored as given, normalised email and all
+func (c *MemoryClient) EraseUser(ctx context.Context, entity *models.UserDao, version int64) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	existing, ok := c.users[entity.ID]
+	if !ok || existing.ErasedAt != nil || existing.Version != version {
+		return ErrVersionConflict
+	}
+
+	if entity.NormalisedEmail != "" {
+		if holder := c.findByNormalisedEmail(entity.NormalisedEmail); holder != nil && holder.ID != entity.ID {
+			return ErrDuplicateEmail
+		}
+	}
+
+	c.users[entity.ID] = copyUser(entity)
+
+	return nil
+}
+
+func (c *MemoryClient) remove(id string) {
+
+	delete(c.users, id)
+	for i, orderedID := range c.order {
+		if orderedID == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// CreateAuditEvent appends a copy of an audit event
+func (c *MemoryClient) CreateAuditEvent(ctx context.Context, event *models.AuditEventDao) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.audit = append(c.audit, copyAuditEvent(event))
+
+	return nil
+}
+
+// GetAuditEvents returns copies of a page of the audit events of a user, most recent first
+func (c *MemoryClient) GetAuditEvents(ctx context.Context, query *AuditQuery) (*[]*models.AuditEventDao, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	matched := query.apply(c.audit)
+
+	events := make([]*models.AuditEventDao, 0, len(matched))
+	for _, event := range matched {
+		events = append(events, copyAuditEvent(event))
+	}
+
+	return &events, nil
+}
+
+// RedactAuditEvents replaces every value recorded in the history of a user for any of the given fields, bar those
+// recording that the user didn't exist
+func (c *MemoryClient) RedactAuditEvents(ctx context.Context, userID string, fields []string, replacement string) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	redacted := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		redacted[field] = true
+	}
+
+	for _, event := range c.audit {
+		if event.UserID != userID {
+			continue
+		}
+		for i, change := range event.Changes {
+			if !redacted[change.Field] {
+				continue
+			}
+			// values are replaced rather than overwritten, as copies of the event share them
+			if change.Before != nil {
+				event.Changes[i].Before = &replacement
+			}
+			if change.After != nil {
+				event.Changes[i].After = &replacement
+			}
+		}
+	}
+
+	return nil
+}
+
+// CreateErasureReceipt stores a copy of the erasure receipt of a user, returning ErrErasureReceiptExists if the
+// user already has one
+func (c *MemoryClient) CreateErasureReceipt(ctx context.Context, receipt *models.ErasureReceiptDao) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.receipts[receipt.UserID]; ok {
+		return ErrErasureReceiptExists
+	}
+
+	copied := *receipt
+	c.receipts[receipt.UserID] = &copied
+
+	return nil
+}
+
+// GetErasureReceipt fetches a copy of the erasure receipt of a user, if it has been erased
+func (c *MemoryClient) GetErasureReceipt(ctx context.Context, userID string) (*models.ErasureReceiptDao, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	receipt, ok := c.receipts[userID]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *receipt
+	return &copied, nil
+}
+
+// CreateIdempotencyRecord stores a copy of an idempotency record, returning ErrIdempotencyKeyExists if its key
+// is already held by an unexpired record
+func (c *MemoryClient) CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecordDao) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.findIdempotencyRecord(record.ID) != nil {
+		return ErrIdempotencyKeyExists
+	}
+
+	c.idempotency[record.ID] = copyIdempotencyRecord(record)
+
+	return nil
+}
+
+// GetIdempotencyRecord fetches a copy of an unexpired idempotency record according to an id. Its fingerprint is
+// held as it was given, so is returned as such whatever the fingerprint of the request retrying it
+func (c *MemoryClient) GetIdempotencyRecord(ctx context.Context, id string, fingerprint string) (*models.IdempotencyRecordDao, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	record := c.findIdempotencyRecord(id)
+	if record == nil {
+		return nil, nil
+	}
+
+	return copyIdempotencyRecord(record), nil
+}
+
+// CompleteIdempotencyRecord stores the response to the request an idempotency record describes, along with the id
+// of the user it created, if any
+func (c *MemoryClient) CompleteIdempotencyRecord(ctx context.Context, id string, userID string, response []byte) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if record, ok := c.idempotency[id]; ok {
+		record.Response = append([]byte(nil), response...)
+		if userID != "" {
+			record.UserID = userID
+		}
+	}
+
+	return nil
+}
+
+// GetUserIdempotencyRecords returns copies of the unexpired idempotency records of the requests which created a
+// user, oldest first
+func (c *MemoryClient) GetUserIdempotencyRecords(ctx context.Context, userID string) ([]*models.IdempotencyRecordDao, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	records := make([]*models.IdempotencyRecordDao, 0)
+	for id, record := range c.idempotency {
+		if record.UserID == userID && c.findIdempotencyRecord(id) != nil {
+			records = append(records, copyIdempotencyRecord(record))
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return records[i].CreatedAt.Before(records[j].CreatedAt)
+		}
+		return records[i].ID < records[j].ID
+	})
+
+	return records, nil
+}
+
+// DeleteIdempotencyRecord removes an idempotency record, so that its key may be reused
+func (c *MemoryClient) DeleteIdempotencyRecord(ctx context.Context, id string) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.idempotency, id)
+
+	return nil
+}
+
+// findIdempotencyRecord returns the idempotency record with the given id, unless it has expired
+func (c *MemoryClient) findIdempotencyRecord(id string) *models.IdempotencyRecordDao {
+
+	record, ok := c.idempotency[id]
+	if !ok || !record.CreatedAt.After(idempotencyCutoff()) {
+		return nil
+	}
+	return record
+}
+
+// versionMatches determines whether a user exists with the given id and, unless AnyVersion is given, version
+func (c *MemoryClient) versionMatches(id string, version int64) bool {
+
+	user, ok := c.users[id]
+	return ok && user.DeletedAt == nil && (version == AnyVersion || user.Version == version)
+}
+
+// Ping always succeeds for in-memory storage, unless the context is already done
+func (c *MemoryClient) Ping(ctx context.Context) error {
+
+	return ctx.Err()
+}
+
+// Shutdown is a no-op for in-memory storage
+func (c *MemoryClient) Shutdown() {}
+
+func (c *MemoryClient) all() []*models.UserDao {
+
+	entities := make([]*models.UserDao, 0, len(c.order))
+	for _, id := range c.order {
+		if c.users[id].DeletedAt == nil {
+			entities = append(entities, c.users[id])
+		}
+	}
+	return entities
+}
+
+// findByEmail returns the user with the given email, regardless of case. Deleted users are never found
+func (c *MemoryClient) findByEmail(email string) *models.UserDao {
+
+	normalised := NormaliseEmail(email)
+	for _, id := range c.order {
+		if c.users[id].DeletedAt == nil && c.users[id].NormalisedEmail == normalised {
+			return c.users[id]
+		}
+	}
+	return nil
+}
+
+// findByNormalisedEmail returns the user holding the given email, regardless of case, against which uniqueness is
+// enforced: one which isn't deleted, or the tombstone of an erased user whose email is blocked from re-registration
+func (c *MemoryClient) findByNormalisedEmail(email string) *models.UserDao {
+
+	normalised := NormaliseEmail(email)
+	for _, id := range c.order {
+		if c.users[id].NormalisedEmail != "" && c.users[id].NormalisedEmail == normalised {
+			return c.users[id]
+		}
+	}
+	return nil
+}
+
+// emailTaken determines whether an entity's email belongs to a different user
+func (c *MemoryClient) emailTaken(entity *models.UserDao) bool {
+
+	existing := c.findByNormalisedEmail(entity.Email)
+	return existing != nil && existing.ID != entity.ID
+}
+
+// copyUser guards stored entities, and their deletion and erasure times, against mutation by callers
+func copyUser(entity *models.UserDao) *models.UserDao {
+	user := *entity
+	if entity.DeletedAt != nil {
+		deletedAt := *entity.DeletedAt
+		user.DeletedAt = &deletedAt
+	}
+	if entity.ErasedAt != nil {
+		erasedAt := *entity.ErasedAt
+		user.ErasedAt = &erasedAt
+	}
+	return &user
+}
+
+// copyIdempotencyRecord guards stored idempotency records, and their responses, against mutation by callers
+func copyIdempotencyRecord(record *models.IdempotencyRecordDao) *models.IdempotencyRecordDao {
+	copied := *record
+	copied.Response = append([]byte(nil), record.Response...)
+	return &copied
+}
+
+// copyAuditEvent guards stored audit events, and their changes, against mutation by callers
+func copyAuditEvent(event *models.AuditEventDao) *models.AuditEventDao {
+	copied := *event
+	copied.Changes = append([]models.FieldChangeDao(nil), event.Changes...)
+	return &copied
+}
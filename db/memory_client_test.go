@@ -0,0 +1,49 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitMemoryClient(t *testing.T) {
+
+	clientContract(t, NewMemoryClient)
+	queryContract(t, NewMemoryClient)
+	searchContract(t, NewMemoryClient)
+	statsContract(t, NewMemoryClient)
+	auditContract(t, NewMemoryClient)
+	deletionContract(t, NewMemoryClient)
+	erasureContract(t, NewMemoryClient)
+	idempotencyContract(t, NewMemoryClient)
+	concurrencyContract(t, NewMemoryClient)
+}
+
+func TestUnitMemoryClientConcurrency(t *testing.T) {
+
+	Convey("Given I create users concurrently", t, func() {
+
+		client := NewMemoryClient()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_ = client.CreateUser(ctx, contractUser(fmt.Sprint(i), fmt.Sprintf("%d@mail.com", i)))
+				_, _ = client.GetAllUsers(ctx, &UserQuery{})
+			}(i)
+		}
+		wg.Wait()
+
+		Convey("Then I expect every user to be stored", func() {
+
+			users, err := client.GetAllUsers(ctx, &UserQuery{})
+
+			So(err, ShouldBeNil)
+			So(len(*users), ShouldEqual, 50)
+		})
+	})
+}
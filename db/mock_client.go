@@ -1,13 +1,15 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/BSaunders95/user-api/db (interfaces: Client)
+// Source: github.com/bpsaunders/user-api/db (interfaces: Client)
 
 // Package db is a generated GoMock package.
 package db
 
 import (
+	context "context"
 	models "github.com/bpsaunders/user-api/models"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
+	time "time"
 )
 
 // MockClient is a mock of Client interface
@@ -33,48 +35,369 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 	return m.recorder
 }
 
+// CompleteIdempotencyRecord mocks base method
+func (m *MockClient) CompleteIdempotencyRecord(arg0 context.Context, arg1, arg2 string, arg3 []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteIdempotencyRecord", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompleteIdempotencyRecord indicates an expected call of CompleteIdempotencyRecord
+func (mr *MockClientMockRecorder) CompleteIdempotencyRecord(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteIdempotencyRecord", reflect.TypeOf((*MockClient)(nil).CompleteIdempotencyRecord), arg0, arg1, arg2, arg3)
+}
+
+// CountUsers mocks base method
+func (m *MockClient) CountUsers(arg0 context.Context, arg1 *UserFilter) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountUsers", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountUsers indicates an expected call of CountUsers
+func (mr *MockClientMockRecorder) CountUsers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountUsers", reflect.TypeOf((*MockClient)(nil).CountUsers), arg0, arg1)
+}
+
+// CreateAuditEvent mocks base method
+func (m *MockClient) CreateAuditEvent(arg0 context.Context, arg1 *models.AuditEventDao) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAuditEvent", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAuditEvent indicates an expected call of CreateAuditEvent
+func (mr *MockClientMockRecorder) CreateAuditEvent(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAuditEvent", reflect.TypeOf((*MockClient)(nil).CreateAuditEvent), arg0, arg1)
+}
+
+// CreateErasureReceipt mocks base method
+func (m *MockClient) CreateErasureReceipt(arg0 context.Context, arg1 *models.ErasureReceiptDao) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateErasureReceipt", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateErasureReceipt indicates an expected call of CreateErasureReceipt
+func (mr *MockClientMockRecorder) CreateErasureReceipt(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateErasureReceipt", reflect.TypeOf((*MockClient)(nil).CreateErasureReceipt), arg0, arg1)
+}
+
+// CreateIdempotencyRecord mocks base method
+func (m *MockClient) CreateIdempotencyRecord(arg0 context.Context, arg1 *models.IdempotencyRecordDao) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateIdempotencyRecord", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateIdempotencyRecord indicates an expected call of CreateIdempotencyRecord
+func (mr *MockClientMockRecorder) CreateIdempotencyRecord(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateIdempotencyRecord", reflect.TypeOf((*MockClient)(nil).CreateIdempotencyRecord), arg0, arg1)
+}
+
 // CreateUser mocks base method
-func (m *MockClient) CreateUser(arg0 *models.UserDao) error {
+func (m *MockClient) CreateUser(arg0 context.Context, arg1 *models.UserDao) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateUser", arg0)
+	ret := m.ctrl.Call(m, "CreateUser", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // CreateUser indicates an expected call of CreateUser
-func (mr *MockClientMockRecorder) CreateUser(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) CreateUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockClient)(nil).CreateUser), arg0, arg1)
+}
+
+// CreateUsers mocks base method
+func (m *MockClient) CreateUsers(arg0 context.Context, arg1 []*models.UserDao, arg2 []*models.AuditEventDao, arg3 bool) ([]error, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUsers", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]error)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUsers indicates an expected call of CreateUsers
+func (mr *MockClientMockRecorder) CreateUsers(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUsers", reflect.TypeOf((*MockClient)(nil).CreateUsers), arg0, arg1, arg2, arg3)
+}
+
+// DeleteIdempotencyRecord mocks base method
+func (m *MockClient) DeleteIdempotencyRecord(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteIdempotencyRecord", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteIdempotencyRecord indicates an expected call of DeleteIdempotencyRecord
+func (mr *MockClientMockRecorder) DeleteIdempotencyRecord(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockClient)(nil).CreateUser), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteIdempotencyRecord", reflect.TypeOf((*MockClient)(nil).DeleteIdempotencyRecord), arg0, arg1)
+}
+
+// DeleteUser mocks base method
+func (m *MockClient) DeleteUser(arg0 context.Context, arg1 string, arg2 int64) (*models.UserDao, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*models.UserDao)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteUser indicates an expected call of DeleteUser
+func (mr *MockClientMockRecorder) DeleteUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockClient)(nil).DeleteUser), arg0, arg1, arg2)
+}
+
+// EraseUser mocks base method
+func (m *MockClient) EraseUser(arg0 context.Context, arg1 *models.UserDao, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EraseUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EraseUser indicates an expected call of EraseUser
+func (mr *MockClientMockRecorder) EraseUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EraseUser", reflect.TypeOf((*MockClient)(nil).EraseUser), arg0, arg1, arg2)
+}
+
+// ExistingEmails mocks base method
+func (m *MockClient) ExistingEmails(arg0 context.Context, arg1 []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExistingEmails", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExistingEmails indicates an expected call of ExistingEmails
+func (mr *MockClientMockRecorder) ExistingEmails(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExistingEmails", reflect.TypeOf((*MockClient)(nil).ExistingEmails), arg0, arg1)
 }
 
 // GetAllUsers mocks base method
-func (m *MockClient) GetAllUsers() (*[]*models.UserDao, error) {
+func (m *MockClient) GetAllUsers(arg0 context.Context, arg1 *UserQuery) (*[]*models.UserDao, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllUsers")
+	ret := m.ctrl.Call(m, "GetAllUsers", arg0, arg1)
 	ret0, _ := ret[0].(*[]*models.UserDao)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAllUsers indicates an expected call of GetAllUsers
-func (mr *MockClientMockRecorder) GetAllUsers() *gomock.Call {
+func (mr *MockClientMockRecorder) GetAllUsers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllUsers", reflect.TypeOf((*MockClient)(nil).GetAllUsers), arg0, arg1)
+}
+
+// GetAuditEvents mocks base method
+func (m *MockClient) GetAuditEvents(arg0 context.Context, arg1 *AuditQuery) (*[]*models.AuditEventDao, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuditEvents", arg0, arg1)
+	ret0, _ := ret[0].(*[]*models.AuditEventDao)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuditEvents indicates an expected call of GetAuditEvents
+func (mr *MockClientMockRecorder) GetAuditEvents(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuditEvents", reflect.TypeOf((*MockClient)(nil).GetAuditEvents), arg0, arg1)
+}
+
+// GetDeletedUser mocks base method
+func (m *MockClient) GetDeletedUser(arg0 context.Context, arg1 string) (*models.UserDao, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeletedUser", arg0, arg1)
+	ret0, _ := ret[0].(*models.UserDao)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeletedUser indicates an expected call of GetDeletedUser
+func (mr *MockClientMockRecorder) GetDeletedUser(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllUsers", reflect.TypeOf((*MockClient)(nil).GetAllUsers))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeletedUser", reflect.TypeOf((*MockClient)(nil).GetDeletedUser), arg0, arg1)
+}
+
+// GetErasureReceipt mocks base method
+func (m *MockClient) GetErasureReceipt(arg0 context.Context, arg1 string) (*models.ErasureReceiptDao, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetErasureReceipt", arg0, arg1)
+	ret0, _ := ret[0].(*models.ErasureReceiptDao)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetErasureReceipt indicates an expected call of GetErasureReceipt
+func (mr *MockClientMockRecorder) GetErasureReceipt(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetErasureReceipt", reflect.TypeOf((*MockClient)(nil).GetErasureReceipt), arg0, arg1)
+}
+
+// GetIdempotencyRecord mocks base method
+func (m *MockClient) GetIdempotencyRecord(arg0 context.Context, arg1, arg2 string) (*models.IdempotencyRecordDao, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIdempotencyRecord", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*models.IdempotencyRecordDao)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetIdempotencyRecord indicates an expected call of GetIdempotencyRecord
+func (mr *MockClientMockRecorder) GetIdempotencyRecord(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIdempotencyRecord", reflect.TypeOf((*MockClient)(nil).GetIdempotencyRecord), arg0, arg1, arg2)
 }
 
 // GetUser mocks base method
-func (m *MockClient) GetUser(arg0 string) (*models.UserDao, error) {
+func (m *MockClient) GetUser(arg0 context.Context, arg1 string) (*models.UserDao, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUser", arg0)
+	ret := m.ctrl.Call(m, "GetUser", arg0, arg1)
 	ret0, _ := ret[0].(*models.UserDao)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUser indicates an expected call of GetUser
-func (mr *MockClientMockRecorder) GetUser(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) GetUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockClient)(nil).GetUser), arg0, arg1)
+}
+
+// GetUserByEmail mocks base method
+func (m *MockClient) GetUserByEmail(arg0 context.Context, arg1 string) (*models.UserDao, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByEmail", arg0, arg1)
+	ret0, _ := ret[0].(*models.UserDao)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail
+func (mr *MockClientMockRecorder) GetUserByEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockClient)(nil).GetUserByEmail), arg0, arg1)
+}
+
+// GetUserIdempotencyRecords mocks base method
+func (m *MockClient) GetUserIdempotencyRecords(arg0 context.Context, arg1 string) ([]*models.IdempotencyRecordDao, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserIdempotencyRecords", arg0, arg1)
+	ret0, _ := ret[0].([]*models.IdempotencyRecordDao)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserIdempotencyRecords indicates an expected call of GetUserIdempotencyRecords
+func (mr *MockClientMockRecorder) GetUserIdempotencyRecords(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserIdempotencyRecords", reflect.TypeOf((*MockClient)(nil).GetUserIdempotencyRecords), arg0, arg1)
+}
+
+// GetUserStats mocks base method
+func (m *MockClient) GetUserStats(arg0 context.Context, arg1 *UserStatsQuery) (*models.UserStatsDao, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserStats", arg0, arg1)
+	ret0, _ := ret[0].(*models.UserStatsDao)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserStats indicates an expected call of GetUserStats
+func (mr *MockClientMockRecorder) GetUserStats(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserStats", reflect.TypeOf((*MockClient)(nil).GetUserStats), arg0, arg1)
+}
+
+// Ping mocks base method
+func (m *MockClient) Ping(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping
+func (mr *MockClientMockRecorder) Ping(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockClient)(nil).GetUser), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockClient)(nil).Ping), arg0)
+}
+
+// PurgeUsers mocks base method
+func (m *MockClient) PurgeUsers(arg0 context.Context, arg1 time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeUsers", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeUsers indicates an expected call of PurgeUsers
+func (mr *MockClientMockRecorder) PurgeUsers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeUsers", reflect.TypeOf((*MockClient)(nil).PurgeUsers), arg0, arg1)
+}
+
+// RedactAuditEvents mocks base method
+func (m *MockClient) RedactAuditEvents(arg0 context.Context, arg1 string, arg2 []string, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RedactAuditEvents", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RedactAuditEvents indicates an expected call of RedactAuditEvents
+func (mr *MockClientMockRecorder) RedactAuditEvents(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RedactAuditEvents", reflect.TypeOf((*MockClient)(nil).RedactAuditEvents), arg0, arg1, arg2, arg3)
+}
+
+// RestoreUser mocks base method
+func (m *MockClient) RestoreUser(arg0 context.Context, arg1 *models.UserDao, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreUser indicates an expected call of RestoreUser
+func (mr *MockClientMockRecorder) RestoreUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreUser", reflect.TypeOf((*MockClient)(nil).RestoreUser), arg0, arg1, arg2)
+}
+
+// SearchUsers mocks base method
+func (m *MockClient) SearchUsers(arg0 context.Context, arg1 *UserSearch) (*[]*models.UserDao, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", arg0, arg1)
+	ret0, _ := ret[0].(*[]*models.UserDao)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchUsers indicates an expected call of SearchUsers
+func (mr *MockClientMockRecorder) SearchUsers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockClient)(nil).SearchUsers), arg0, arg1)
 }
 
 // Shutdown mocks base method
@@ -89,17 +412,45 @@ func (mr *MockClientMockRecorder) Shutdown() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockClient)(nil).Shutdown))
 }
 
+// StreamUsers mocks base method
+func (m *MockClient) StreamUsers(arg0 context.Context, arg1 *UserFilter, arg2 func(*models.UserDao) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamUsers", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamUsers indicates an expected call of StreamUsers
+func (mr *MockClientMockRecorder) StreamUsers(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamUsers", reflect.TypeOf((*MockClient)(nil).StreamUsers), arg0, arg1, arg2)
+}
+
+// UpdateUser mocks base method
+func (m *MockClient) UpdateUser(arg0 context.Context, arg1 *models.UserDao, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUser indicates an expected call of UpdateUser
+func (mr *MockClientMockRecorder) UpdateUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockClient)(nil).UpdateUser), arg0, arg1, arg2)
+}
+
 // UserExistsWithEmail mocks base method
-func (m *MockClient) UserExistsWithEmail(arg0 string) (bool, error) {
+func (m *MockClient) UserExistsWithEmail(arg0 context.Context, arg1 string) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UserExistsWithEmail", arg0)
+	ret := m.ctrl.Call(m, "UserExistsWithEmail", arg0, arg1)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UserExistsWithEmail indicates an expected call of UserExistsWithEmail
-func (mr *MockClientMockRecorder) UserExistsWithEmail(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) UserExistsWithEmail(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserExistsWithEmail", reflect.TypeOf((*MockClient)(nil).UserExistsWithEmail), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserExistsWithEmail", reflect.TypeOf((*MockClient)(nil).UserExistsWithEmail), arg0, arg1)
 }
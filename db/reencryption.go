@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Reencrypt re-encrypts every user, audit event and idempotency response which isn't encrypted under the current
+// master key, including any stored in the clear, so that retired master keys may be removed. It returns how many
+// records were re-encrypted, and how many were skipped, having changed while being re-encrypted. A record which
+// changed was written afresh, so is only left under a retired key if written by a client yet to be given the
+// current one
+func (c *DatabaseClient) Reencrypt(ctx context.Context) (int64, int64, error) {
+
+	return c.reencrypt(ctx, bson.M{dataKeyIDField: bson.M{"$ne": c.keyring.CurrentMasterKeyID()}})
+}
+
+// reencrypt re-encrypts every record which matches a filter, in every collection holding personal data, under
+// the current master key
+func (c *DatabaseClient) reencrypt(ctx context.Context, filter bson.M) (int64, int64, error) {
+
+	var reencrypted, skipped int64
+
+	for _, reencryptCollection := range []func(context.Context, bson.M) (int64, int64, error){
+		c.reencryptUsers,
+		c.reencryptAuditEvents,
+		c.reencryptIdempotencyRecords,
+	} {
+		done, changed, err := reencryptCollection(ctx, filter)
+		reencrypted += done
+		skipped += changed
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+	}
+
+	return reencrypted, skipped, nil
+}
+
+// reencryptUsers re-encrypts every user which matches a filter, conditional upon its version. A user stored before
+// its email was normalised is given a normalised email, unless it's deleted
+func (c *DatabaseClient) reencryptUsers(ctx context.Context, filter bson.M) (int64, int64, error) {
+
+	var reencrypted, skipped int64
+
+	collection := c.db.Collection("users")
+	cur, err := collection.Find(ctx, filter)
+
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+
+		var document userDocument
+		err = cur.Decode(&document)
+
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+
+		entity, err := c.openUser(&document)
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+
+		if entity.DeletedAt == nil {
+			withNormalisedEmail(entity)
+		}
+
+		sealed, err := c.sealUser(entity)
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+
+		res, err := collection.ReplaceOne(ctx, bson.M{idField: entity.ID, "version": entity.Version}, sealed)
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+
+		if res.MatchedCount == 0 {
+			skipped++
+		} else {
+			reencrypted++
+		}
+	}
+
+	return reencrypted, skipped, cur.Err()
+}
+
+// reencryptAuditEvents re-encrypts every audit event which matches a filter, conditional upon its changes being
+// as they were read, so that a redaction made meanwhile isn't undone
+func (c *DatabaseClient) reencryptAuditEvents(ctx context.Context, filter bson.M) (int64, int64, error) {
+
+	var reencrypted, skipped int64
+
+	collection := c.db.Collection("audit")
+	cur, err := collection.Find(ctx, filter)
+
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+
+		var document auditDocument
+		err = cur.Decode(&document)
+
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+
+		event, err := c.openAuditEvent(&document)
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+
+		sealed, err := c.sealAuditEvent(event)
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+
+		res, err := collection.ReplaceOne(ctx, bson.M{idField: event.ID, "changes": document.Changes}, sealed)
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+
+		if res.MatchedCount == 0 {
+			skipped++
+		} else {
+			reencrypted++
+		}
+	}
+
+	return reencrypted, skipped, cur.Err()
+}
+
+// reencryptIdempotencyRecords re-encrypts the response of every completed idempotency record which matches a
+// filter, conditional upon the response being as it was read, as the key of an expired record may be reused
+func (c *DatabaseClient) reencryptIdempotencyRecords(ctx context.Context, filter bson.M) (int64, int64, error) {
+
+	var reencrypted, skipped int64
+
+	completed := bson.M{"$and": bson.A{filter, bson.M{"response": bson.M{"$ne": nil}}}}
+
+	collection := c.db.Collection("idempotency")
+	cur, err := collection.Find(ctx, completed)
+
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+
+		var document idempotencyDocument
+		err = cur.Decode(&document)
+
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+
+		// only the response is re-encrypted, so the fingerprint of no request need be given
+		record, err := c.openIdempotencyRecord(&document, "")
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+
+		sealed, dataKey, err := c.sealResponse(record.ID, record.Response)
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+
+		res, err := collection.UpdateOne(ctx,
+			bson.M{idField: record.ID, "response": document.Response},
+			bson.M{"$set": bson.M{"response": sealed, "data_key": dataKey}})
+		if err != nil {
+			return reencrypted, skipped, err
+		}
+
+		if res.MatchedCount == 0 {
+			skipped++
+		} else {
+			reencrypted++
+		}
+	}
+
+	return reencrypted, skipped, cur.Err()
+}
@@ -0,0 +1,237 @@
+package db
+
+import (
+	"errors"
+	"github.com/bpsaunders/user-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"sort"
+	"strings"
+)
+
+// UserFilter describes criteria by which to filter users
+type UserFilter struct {
+	Country     string
+	EmailDomain string
+	NamePrefix  string
+}
+
+// SortField describes a field by which to sort users
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// UserQuery describes criteria by which to filter, sort and page through users
+type UserQuery struct {
+	Filter UserFilter
+	Sort   []SortField
+	Limit  int
+
+	// After holds the values of the sort fields, and the id, of the user after which to start the page
+	After *models.Cursor
+}
+
+const idField = "_id"
+
+// MaxPersonalSortUsers is the largest number of users which may match a query sorting by personal data. Personal
+// data is encrypted in mongo, so such a query is sorted in memory, once every matching user is decrypted
+const MaxPersonalSortUsers = 10000
+
+// personalSortLimit bounds the users sorted by personal data in memory; it's only lowered by tests
+var personalSortLimit int64 = MaxPersonalSortUsers
+
+// ErrTooManyToSort is returned when more users match a query sorting by personal data than may be sorted in memory
+var ErrTooManyToSort = errors.New("too many users match the query to sort them by personal data")
+
+// sortFields returns the requested sort, with the id as a final tie-breaker so that ordering is total
+func (q *UserQuery) sortFields() []SortField {
+
+	fields := make([]SortField, 0, len(q.Sort)+1)
+	for _, field := range q.Sort {
+		if field.Field != idField {
+			fields = append(fields, field)
+		}
+	}
+
+	return append(fields, SortField{Field: idField})
+}
+
+// SortValue returns the value of an entity's field, by bson field name
+func SortValue(entity *models.UserDao, field string) string {
+
+	switch field {
+	case "first_name":
+		return entity.FirstName
+	case "last_name":
+		return entity.LastName
+	case "email":
+		return entity.Email
+	case "country":
+		return entity.Country
+	default:
+		return entity.ID
+	}
+}
+
+// toMongoFilter converts a user query to a mongo filter document, matching a name prefix by its blind index
+func (q *UserQuery) toMongoFilter(namePrefixIndex func(prefix string) string) bson.M {
+
+	clauses := q.Filter.toMongoClauses(namePrefixIndex)
+
+	if q.After != nil {
+		fields := q.sortFields()
+		values := append(append([]string{}, q.After.Values...), q.After.ID)
+
+		// keyset pagination: users which sort strictly after the cursor position
+		or := bson.A{}
+		for i, field := range fields {
+			clause := bson.M{}
+			for j := 0; j < i; j++ {
+				clause[fields[j].Field] = values[j]
+			}
+			operator := "$gt"
+			if field.Descending {
+				operator = "$lt"
+			}
+			clause[field.Field] = bson.M{operator: values[i]}
+			or = append(or, clause)
+		}
+		clauses = append(clauses, bson.M{"$or": or})
+	}
+
+	return bson.M{"$and": clauses}
+}
+
+// toMongoSort converts a user query to a mongo sort document
+func (q *UserQuery) toMongoSort() bson.D {
+
+	sortDoc := bson.D{}
+	for _, field := range q.sortFields() {
+		direction := 1
+		if field.Descending {
+			direction = -1
+		}
+		sortDoc = append(sortDoc, bson.E{Key: field.Field, Value: direction})
+	}
+	return sortDoc
+}
+
+// sortsByPersonalData determines whether a query sorts by personal data, which is encrypted in mongo, so can't be
+// compared there. Unlike a name prefix, the order of a field isn't preserved by a blind index
+func (q *UserQuery) sortsByPersonalData() bool {
+
+	for _, field := range q.Sort {
+		if isPersonal(field.Field) {
+			return true
+		}
+	}
+	return false
+}
+
+// toMongoClauses converts a user filter to the clauses of a mongo filter document. Names are encrypted in mongo, so
+// a name prefix is matched by its blind index, as given by namePrefixIndex. Deleted users never match
+func (f *UserFilter) toMongoClauses(namePrefixIndex func(prefix string) string) bson.A {
+
+	clauses := bson.A{notDeleted()}
+
+	if f.Country != "" {
+		clauses = append(clauses, bson.M{"country": f.Country})
+	}
+
+	if f.EmailDomain != "" {
+		clauses = append(clauses, bson.M{"email_domain": strings.ToLower(f.EmailDomain)})
+	}
+
+	if f.NamePrefix != "" {
+		clauses = append(clauses, bson.M{namePrefixesField: namePrefixIndex(strings.ToLower(f.NamePrefix))})
+	}
+
+	return clauses
+}
+
+// toMongoFilter converts a user filter to a mongo filter document, matching a name prefix by its blind index
+func (f *UserFilter) toMongoFilter(namePrefixIndex func(prefix string) string) bson.M {
+
+	return bson.M{"$and": f.toMongoClauses(namePrefixIndex)}
+}
+
+// matches determines whether an entity satisfies the filter, with the same semantics as the mongo filter
+func (f *UserFilter) matches(entity *models.UserDao) bool {
+
+	if entity.DeletedAt != nil {
+		return false
+	}
+
+	if f.Country != "" && entity.Country != f.Country {
+		return false
+	}
+
+	if f.EmailDomain != "" && emailDomain(entity.Email) != strings.ToLower(f.EmailDomain) {
+		return false
+	}
+
+	if f.NamePrefix != "" {
+		prefix := strings.ToLower(f.NamePrefix)
+		if !strings.HasPrefix(strings.ToLower(entity.FirstName), prefix) &&
+			!strings.HasPrefix(strings.ToLower(entity.LastName), prefix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// apply filters, sorts and pages an array of entities in memory, with the same semantics as the mongo query
+func (q *UserQuery) apply(entities []*models.UserDao) []*models.UserDao {
+
+	fields := q.sortFields()
+
+	matched := make([]*models.UserDao, 0)
+	for _, entity := range entities {
+		if q.Filter.matches(entity) && (q.After == nil || q.compareToCursor(entity, fields) > 0) {
+			matched = append(matched, entity)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return compareEntities(matched[i], matched[j], fields) < 0
+	})
+
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+
+	return matched
+}
+
+// compareToCursor compares an entity to the cursor position in the query's sort order
+func (q *UserQuery) compareToCursor(entity *models.UserDao, fields []SortField) int {
+
+	values := append(append([]string{}, q.After.Values...), q.After.ID)
+
+	for i, field := range fields {
+		if c := compareField(SortValue(entity, field.Field), values[i], field.Descending); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareEntities(a, b *models.UserDao, fields []SortField) int {
+
+	for _, field := range fields {
+		if c := compareField(SortValue(a, field.Field), SortValue(b, field.Field), field.Descending); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareField(a, b string, descending bool) int {
+
+	c := strings.Compare(a, b)
+	if descending {
+		return -c
+	}
+	return c
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitToMongoFilter(t *testing.T) {
+
+	Convey("Given I have a query without criteria", t, func() {
+
+		query := &UserQuery{}
+
+		Convey("Then I expect a filter only excluding deleted users, sorted by id", func() {
+
+			So(query.toMongoFilter(fakeNamePrefixIndex), ShouldResemble, bson.M{"$and": bson.A{bson.M{"deleted_at": bson.M{"$exists": false}}}})
+			So(query.toMongoSort(), ShouldResemble, bson.D{{Key: "_id", Value: 1}})
+		})
+	})
+
+	Convey("Given I have a query with filters, a sort and a cursor", t, func() {
+
+		query := &UserQuery{
+			Filter: UserFilter{Country: "GB", EmailDomain: "Example.com"},
+			Sort:   []SortField{{Field: "country", Descending: true}},
+			After:  &models.Cursor{Values: []string{"GB"}, ID: "1"},
+		}
+
+		Convey("Then I expect the filters and keyset conditions to be combined", func() {
+
+			So(query.toMongoFilter(fakeNamePrefixIndex), ShouldResemble, bson.M{"$and": bson.A{
+				bson.M{"deleted_at": bson.M{"$exists": false}},
+				bson.M{"country": "GB"},
+				bson.M{"email_domain": "example.com"},
+				bson.M{"$or": bson.A{
+					bson.M{"country": bson.M{"$lt": "GB"}},
+					bson.M{"country": "GB", "_id": bson.M{"$gt": "1"}},
+				}},
+			}})
+		})
+
+		Convey("Then I expect the sort to be tie-broken by id", func() {
+
+			So(query.toMongoSort(), ShouldResemble, bson.D{
+				{Key: "country", Value: -1},
+				{Key: "_id", Value: 1},
+			})
+		})
+	})
+
+	Convey("Given I have a query filtering by name prefix, which is encrypted in mongo", t, func() {
+
+		query := &UserQuery{Filter: UserFilter{Country: "GB", NamePrefix: "Al"}}
+
+		Convey("Then I expect the lower-cased prefix to be matched by its blind index", func() {
+
+			So(query.toMongoFilter(fakeNamePrefixIndex), ShouldResemble, bson.M{"$and": bson.A{
+				bson.M{"deleted_at": bson.M{"$exists": false}},
+				bson.M{"country": "GB"},
+				bson.M{"search.names": "index:al"},
+			}})
+		})
+	})
+
+	Convey("Given I have a query sorting by personal data, which is encrypted in mongo", t, func() {
+
+		query := &UserQuery{Sort: []SortField{{Field: "country"}, {Field: "last_name"}}}
+
+		Convey("Then I expect it to be recognised as such", func() {
+
+			So(query.sortsByPersonalData(), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given I have a query filtering by email domain and sorting by country", t, func() {
+
+		query := &UserQuery{Filter: UserFilter{EmailDomain: "example.com"}, Sort: []SortField{{Field: "country"}}}
+
+		Convey("Then I expect it not to sort by personal data", func() {
+
+			So(query.sortsByPersonalData(), ShouldBeFalse)
+		})
+	})
+}
+
+// fakeNamePrefixIndex stands in for the blind index of a name prefix
+func fakeNamePrefixIndex(prefix string) string {
+	return "index:" + prefix
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// UserSearch describes the text by which to search users, and how many of the most relevant to return
+type UserSearch struct {
+	Text  string
+	Limit int
+}
+
+// a term of a search matches a user holding it as a token, and, once it's long enough, a user holding a token
+// which starts with it. Matching a whole token is worth more than matching its prefix
+const (
+	minSearchPrefix = 2
+	maxSearchPrefix = 20
+
+	tokenWeight  = 2
+	prefixWeight = 1
+)
+
+// maxNamePrefix is the length of the longest name prefix by which users are filtered, that of the longest valid name
+const maxNamePrefix = 30
+
+// searchTokens returns the distinct tokens by which a user is found: the words of its names and email, and its
+// whole normalised email
+func searchTokens(entity *models.UserDao) []string {
+
+	tokens := make([]string, 0)
+	for _, value := range []string{entity.FirstName, entity.LastName, entity.Email} {
+		tokens = append(tokens, words(value)...)
+	}
+	if email := NormaliseEmail(entity.Email); email != "" {
+		tokens = append(tokens, email)
+	}
+	return distinct(tokens)
+}
+
+// searchTerms returns the distinct terms of a search text: its words, and the whole text as normalised like an
+// email, so that an email given whole ranks the user it belongs to first
+func searchTerms(text string) []string {
+
+	terms := words(text)
+	if whole := NormaliseEmail(text); whole != "" {
+		terms = append(terms, whole)
+	}
+	return distinct(terms)
+}
+
+// searchPrefixes returns the distinct prefixes of tokens which a term may match, from the shortest to the longest
+// searched by prefix
+func searchPrefixes(tokens []string) []string {
+
+	prefixes := make([]string, 0)
+	for _, token := range tokens {
+		runes := []rune(token)
+		for n := minSearchPrefix; n <= len(runes) && n <= maxSearchPrefix; n++ {
+			prefixes = append(prefixes, string(runes[:n]))
+		}
+	}
+	return distinct(prefixes)
+}
+
+// namePrefixes returns the distinct lower-cased prefixes of the first and last names of a user, by which users are
+// filtered by name prefix, up to the longest a valid name may be
+func namePrefixes(entity *models.UserDao) []string {
+
+	prefixes := make([]string, 0)
+	for _, name := range []string{entity.FirstName, entity.LastName} {
+		runes := []rune(strings.ToLower(name))
+		for n := 1; n <= len(runes) && n <= maxNamePrefix; n++ {
+			prefixes = append(prefixes, string(runes[:n]))
+		}
+	}
+	return distinct(prefixes)
+}
+
+// isSearchPrefix determines whether a term is of a length to be matched against the prefixes of tokens
+func isSearchPrefix(term string) bool {
+
+	n := len([]rune(term))
+	return n >= minSearchPrefix && n <= maxSearchPrefix
+}
+
+// words splits a value into its lower-cased runs of letters and digits
+func words(value string) []string {
+
+	return strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func distinct(values []string) []string {
+
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// relevance scores how well a user matches the terms of a search, zero being no match at all
+func relevance(entity *models.UserDao, terms []string) int {
+
+	held := searchTokens(entity)
+
+	tokens := make(map[string]bool)
+	for _, token := range held {
+		tokens[token] = true
+	}
+	prefixes := make(map[string]bool)
+	for _, prefix := range searchPrefixes(held) {
+		prefixes[prefix] = true
+	}
+
+	score := 0
+	for _, term := range terms {
+		if tokens[term] {
+			score += tokenWeight
+		}
+		if isSearchPrefix(term) && prefixes[term] {
+			score += prefixWeight
+		}
+	}
+	return score
+}
+
+// apply returns the most relevant of an array of entities which match a search, most relevant first, then in
+// order of id, with the same semantics as the mongo search. Deleted users never match
+func (s *UserSearch) apply(entities []*models.UserDao) []*models.UserDao {
+
+	terms := searchTerms(s.Text)
+
+	scores := make(map[string]int)
+	matched := make([]*models.UserDao, 0)
+	for _, entity := range entities {
+		if entity.DeletedAt != nil {
+			continue
+		}
+		if score := relevance(entity, terms); score > 0 {
+			scores[entity.ID] = score
+			matched = append(matched, entity)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if scores[matched[i].ID] != scores[matched[j].ID] {
+			return scores[matched[i].ID] > scores[matched[j].ID]
+		}
+		return matched[i].ID < matched[j].ID
+	})
+
+	if s.Limit > 0 && len(matched) > s.Limit {
+		matched = matched[:s.Limit]
+	}
+
+	return matched
+}
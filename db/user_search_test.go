@@ -0,0 +1,68 @@
+package db
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitSearchTokens(t *testing.T) {
+
+	Convey("Given I have a user", t, func() {
+
+		entity := &models.UserDao{FirstName: "Mary-Jane", LastName: "O'Brien", Email: " MJ.OBrien@Example.com "}
+
+		Convey("Then I expect its tokens to be the distinct, lower-cased words of its names and email, and its whole email", func() {
+
+			So(searchTokens(entity), ShouldResemble, []string{
+				"mary", "jane", "o", "brien", "mj", "obrien", "example", "com", "mj.obrien@example.com",
+			})
+		})
+
+		Convey("Then I expect the prefixes of its tokens to be of bounded length", func() {
+
+			prefixes := searchPrefixes([]string{"o", "brien", "abcdefghijklmnopqrstuvwxyz"})
+
+			So(prefixes, ShouldContain, "br")
+			So(prefixes, ShouldContain, "brien")
+			So(prefixes, ShouldNotContain, "o")
+			So(prefixes, ShouldContain, "abcdefghijklmnopqrst")
+			So(prefixes, ShouldNotContain, "abcdefghijklmnopqrstu")
+		})
+		Convey("Then I expect the prefixes of its names to be distinct and lower-cased, of up to the longest valid name", func() {
+
+			So(namePrefixes(&models.UserDao{FirstName: "Al", LastName: "ALB"}), ShouldResemble, []string{"a", "al", "alb"})
+
+			prefixes := namePrefixes(&models.UserDao{FirstName: "Abcdefghijklmnopqrstuvwxyzabcdefgh"})
+
+			So(prefixes, ShouldContain, "abcdefghijklmnopqrstuvwxyzabcd")
+			So(prefixes, ShouldNotContain, "abcdefghijklmnopqrstuvwxyzabcde")
+		})
+	})
+
+	Convey("Given I have a search text", t, func() {
+
+		Convey("Then I expect its terms to be its distinct words, and the whole text", func() {
+
+			So(searchTerms("Bob bob@example.com"), ShouldResemble, []string{"bob", "example", "com", "bob bob@example.com"})
+			So(searchTerms("  Bob "), ShouldResemble, []string{"bob"})
+		})
+	})
+}
+
+func TestUnitRelevance(t *testing.T) {
+
+	Convey("Given I have a user", t, func() {
+
+		entity := &models.UserDao{FirstName: "Bob", LastName: "Bobbins", Email: "bob@example.com"}
+
+		Convey("Then I expect a whole word to be more relevant than a prefix alone", func() {
+
+			So(relevance(entity, []string{"bob"}), ShouldEqual, tokenWeight+prefixWeight)
+			So(relevance(entity, []string{"bobb"}), ShouldEqual, prefixWeight)
+			So(relevance(entity, []string{"b"}), ShouldEqual, 0)
+			So(relevance(entity, []string{"alice"}), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
+	"time"
+)
+
+// UserStatsQuery describes the users to count, by the fields held in the clear, and how to count their signups
+type UserStatsQuery struct {
+	Country     string
+	EmailDomain string
+
+	// CreatedFrom and CreatedBefore bound the times at which users were created, where not zero
+	CreatedFrom   time.Time
+	CreatedBefore time.Time
+
+	// Interval is that by which signups are counted, and TopDomains the number of email domains to count, those
+	// with the most users
+	Interval   string
+	TopDomains int
+}
+
+// filter returns the filter of users to count
+func (q *UserStatsQuery) filter() *UserFilter {
+	return &UserFilter{Country: q.Country, EmailDomain: q.EmailDomain}
+}
+
+// toMongoFilter converts a stats query to a mongo filter document. Deleted users are never counted
+func (q *UserStatsQuery) toMongoFilter() bson.M {
+
+	// users aren't counted by name, so no blind index of a name prefix is needed
+	clauses := q.filter().toMongoClauses(nil)
+
+	created := bson.M{}
+	if !q.CreatedFrom.IsZero() {
+		created["$gte"] = q.CreatedFrom
+	}
+	if !q.CreatedBefore.IsZero() {
+		created["$lt"] = q.CreatedBefore
+	}
+	if len(created) > 0 {
+		clauses = append(clauses, bson.M{"created_at": created})
+	}
+
+	return bson.M{"$and": clauses}
+}
+
+// toMongoPipeline converts a stats query to a mongo aggregation pipeline, counting users every way at once. Groups
+// are ordered by count, most first, then by value; signups in order of time
+func (q *UserStatsQuery) toMongoPipeline() mongo.Pipeline {
+
+	byCount := bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: idField, Value: 1}}}
+	count := bson.M{"$sum": 1}
+
+	domains := bson.A{bson.M{"$group": bson.M{idField: "$email_domain", "count": count}}, byCount}
+	if q.TopDomains > 0 {
+		domains = append(domains, bson.M{"$limit": q.TopDomains})
+	}
+
+	return mongo.Pipeline{
+		{{Key: "$match", Value: q.toMongoFilter()}},
+		{{Key: "$facet", Value: bson.M{
+			"total": bson.A{bson.M{"$count": "count"}},
+			"countries": bson.A{
+				bson.M{"$group": bson.M{idField: "$country", "count": count}},
+				byCount,
+			},
+			"email_domains": domains,
+			"signups": bson.A{
+				bson.M{"$group": bson.M{idField: intervalStartExpression(q.Interval), "count": count}},
+				bson.M{"$sort": bson.M{idField: 1}},
+			},
+		}}},
+	}
+}
+
+// intervalStartExpression returns the mongo expression of the start of the interval in which a user was created
+func intervalStartExpression(interval string) bson.M {
+
+	created := "$created_at"
+
+	switch interval {
+	case models.IntervalWeek:
+		return bson.M{"$dateFromParts": bson.M{
+			"isoWeekYear":  bson.M{"$isoWeekYear": created},
+			"isoWeek":      bson.M{"$isoWeek": created},
+			"isoDayOfWeek": 1,
+		}}
+	case models.IntervalMonth:
+		return bson.M{"$dateFromParts": bson.M{
+			"year":  bson.M{"$year": created},
+			"month": bson.M{"$month": created},
+		}}
+	default:
+		return bson.M{"$dateFromParts": bson.M{
+			"year":  bson.M{"$year": created},
+			"month": bson.M{"$month": created},
+			"day":   bson.M{"$dayOfMonth": created},
+		}}
+	}
+}
+
+// intervalStart returns the start of the interval in which a time falls, with the same semantics as the mongo
+// expression
+func intervalStart(t time.Time, interval string) time.Time {
+
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch interval {
+	case models.IntervalWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case models.IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// matches determines whether an entity is counted by the query, with the same semantics as the mongo filter
+func (q *UserStatsQuery) matches(entity *models.UserDao) bool {
+
+	if !q.filter().matches(entity) {
+		return false
+	}
+	if !q.CreatedFrom.IsZero() && entity.CreatedAt.Before(q.CreatedFrom) {
+		return false
+	}
+	return q.CreatedBefore.IsZero() || entity.CreatedAt.Before(q.CreatedBefore)
+}
+
+// apply counts an array of entities in memory, with the same semantics as the mongo pipeline
+func (q *UserStatsQuery) apply(entities []*models.UserDao) *models.UserStatsDao {
+
+	stats := &models.UserStatsDao{}
+
+	countries := make(map[string]int64)
+	domains := make(map[string]int64)
+	signups := make(map[time.Time]int64)
+
+	for _, entity := range entities {
+		if !q.matches(entity) {
+			continue
+		}
+		stats.Total++
+		countries[entity.Country]++
+		domains[emailDomain(entity.Email)]++
+		signups[intervalStart(entity.CreatedAt, q.Interval)]++
+	}
+
+	stats.Countries = byCount(countries)
+	stats.EmailDomains = byCount(domains)
+	if q.TopDomains > 0 && len(stats.EmailDomains) > q.TopDomains {
+		stats.EmailDomains = stats.EmailDomains[:q.TopDomains]
+	}
+
+	stats.Signups = make([]models.SignupCountDao, 0, len(signups))
+	for start, count := range signups {
+		stats.Signups = append(stats.Signups, models.SignupCountDao{Start: start, Count: count})
+	}
+	sort.Slice(stats.Signups, func(i, j int) bool {
+		return stats.Signups[i].Start.Before(stats.Signups[j].Start)
+	})
+
+	return stats
+}
+
+// byCount returns the counts of values, most first, then in order of value
+func byCount(counts map[string]int64) []models.GroupCountDao {
+
+	groups := make([]models.GroupCountDao, 0, len(counts))
+	for value, count := range counts {
+		groups = append(groups, models.GroupCountDao{Value: value, Count: count})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Value < groups[j].Value
+	})
+	return groups
+}
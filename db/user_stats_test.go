@@ -0,0 +1,53 @@
+package db
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitStatsToMongoFilter(t *testing.T) {
+
+	Convey("Given I have a stats query with filters and a range of creation times", t, func() {
+
+		from := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+		before := time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC)
+
+		query := &UserStatsQuery{Country: "GB", EmailDomain: "Example.com", CreatedFrom: from, CreatedBefore: before}
+
+		Convey("Then I expect the filters and the range to be combined, excluding deleted users", func() {
+
+			So(query.toMongoFilter(), ShouldResemble, bson.M{"$and": bson.A{
+				bson.M{"deleted_at": bson.M{"$exists": false}},
+				bson.M{"country": "GB"},
+				bson.M{"email_domain": "example.com"},
+				bson.M{"created_at": bson.M{"$gte": from, "$lt": before}},
+			}})
+		})
+	})
+}
+
+func TestUnitIntervalStart(t *testing.T) {
+
+	Convey("Given I have a time late on a Sunday, in a week spanning two years", t, func() {
+
+		sunday := time.Date(2021, time.January, 3, 23, 30, 0, 0, time.UTC)
+
+		Convey("Then I expect it to fall in the day, ISO week and month starting at midnight UTC", func() {
+
+			So(intervalStart(sunday, models.IntervalDay), ShouldResemble, time.Date(2021, time.January, 3, 0, 0, 0, 0, time.UTC))
+			So(intervalStart(sunday, models.IntervalWeek), ShouldResemble, time.Date(2020, time.December, 28, 0, 0, 0, 0, time.UTC))
+			So(intervalStart(sunday, models.IntervalMonth), ShouldResemble, time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC))
+		})
+
+		Convey("Then I expect the same of the time in another zone", func() {
+
+			zone := time.FixedZone("UTC+2", 2*60*60)
+
+			So(intervalStart(sunday.In(zone), models.IntervalWeek), ShouldResemble, time.Date(2020, time.December, 28, 0, 0, 0, 0, time.UTC))
+		})
+	})
+}
@@ -0,0 +1,24 @@
+package db
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrVersionConflict is returned when a conditional write finds no user with the expected id and version,
+// i.e. the user has been modified or deleted since it was read
+var ErrVersionConflict = errors.New("the user has been modified since it was read")
+
+// AnyVersion may be given in place of a version, to write to a user unconditionally
+const AnyVersion int64 = 0
+
+// versionFilter matches the user with the given id and, unless AnyVersion is given, version, unless it's deleted
+func versionFilter(id string, version int64) bson.M {
+
+	filter := notDeleted()
+	filter[idField] = id
+	if version != AnyVersion {
+		filter["version"] = version
+	}
+	return filter
+}
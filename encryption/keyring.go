@@ -0,0 +1,220 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bpsaunders/user-api/config"
+	"io/ioutil"
+	"strings"
+)
+
+// keySize is the size in bytes of master and data keys, for AES-256
+const keySize = 32
+
+// ErrUnknownMasterKey is returned when opening a data key wrapped by a master key which isn't configured
+var ErrUnknownMasterKey = errors.New("the data key is wrapped by a master key which is not configured")
+
+// MasterKey describes a master key, by which data keys are wrapped. Each is configured as a base64 encoded 256-bit
+// key, with an id by which the data keys it wraps refer to it
+type MasterKey struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+
+	aead cipher.AEAD
+}
+
+// Keyring holds the master keys by which data keys are wrapped, and the key by which blind indexes are computed.
+// New data keys are wrapped by the first master key configured; the others are retired, and only open data keys
+// wrapped before they were, until every record is re-encrypted
+type Keyring struct {
+	current  *MasterKey
+	keys     map[string]*MasterKey
+	indexKey []byte
+}
+
+// NewKeyring returns a Keyring holding the master keys configured inline, then those in a file, and the index key
+func NewKeyring(cfg *config.Config) (*Keyring, error) {
+
+	keys, err := loadMasterKeys(cfg.PIIMasterKeys, cfg.PIIMasterKeysFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load master keys: %s", err)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no master keys are configured")
+	}
+
+	indexKey, err := base64.StdEncoding.DecodeString(cfg.PIIIndexKey)
+	if err != nil || len(indexKey) < keySize {
+		return nil, fmt.Errorf("the index key must be a base64 encoded secret of at least %d bytes", keySize)
+	}
+
+	keyring := &Keyring{
+		current:  keys[0],
+		keys:     make(map[string]*MasterKey),
+		indexKey: indexKey,
+	}
+	for _, key := range keys {
+		if _, ok := keyring.keys[key.ID]; ok {
+			return nil, fmt.Errorf("master key %s is configured more than once", key.ID)
+		}
+		keyring.keys[key.ID] = key
+	}
+	return keyring, nil
+}
+
+// loadMasterKeys parses the master keys configured inline, as a JSON array, and in a file of the same format
+func loadMasterKeys(inline string, file string) ([]*MasterKey, error) {
+
+	var keys []*MasterKey
+
+	if strings.TrimSpace(inline) != "" {
+		parsed, err := parseMasterKeys([]byte(inline))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, parsed...)
+	}
+
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parseMasterKeys(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		keys = append(keys, parsed...)
+	}
+
+	return keys, nil
+}
+
+func parseMasterKeys(b []byte) ([]*MasterKey, error) {
+
+	var keys []*MasterKey
+	err := json.Unmarshal(b, &keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		if key.ID == "" {
+			return nil, fmt.Errorf("master key %d must have an id", i)
+		}
+		secret, err := base64.StdEncoding.DecodeString(key.Key)
+		if err != nil || len(secret) != keySize {
+			return nil, fmt.Errorf("master key %d (%s) must be a base64 encoded %d-byte key", i, key.ID, keySize)
+		}
+		key.aead = newAEAD(secret)
+	}
+	return keys, nil
+}
+
+// CurrentMasterKeyID returns the id of the master key by which new data keys are wrapped
+func (k *Keyring) CurrentMasterKeyID() string {
+	return k.current.ID
+}
+
+// NewDataKey generates a data key for the record named by context, wrapped by the current master key. The wrapped
+// key is bound to the context, so that it can't be opened for any other record
+func (k *Keyring) NewDataKey(context string) (*DataKey, error) {
+
+	secret := make([]byte, keySize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := seal(k.current.aead, secret, []byte(context))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataKey{MasterKeyID: k.current.ID, Wrapped: wrapped, aead: newAEAD(secret)}, nil
+}
+
+// OpenDataKey unwraps the data key of the record named by context, returning ErrUnknownMasterKey if the master key
+// which wrapped it isn't configured
+func (k *Keyring) OpenDataKey(masterKeyID string, wrapped []byte, context string) (*DataKey, error) {
+
+	key, ok := k.keys[masterKeyID]
+	if !ok {
+		return nil, ErrUnknownMasterKey
+	}
+
+	secret, err := open(key.aead, wrapped, []byte(context))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap the data key of %s: %s", context, err)
+	}
+
+	return &DataKey{MasterKeyID: masterKeyID, Wrapped: wrapped, aead: newAEAD(secret)}, nil
+}
+
+// BlindIndex returns a keyed hash of a value, by which records may be found by the value, and its uniqueness
+// enforced, without the value itself being stored
+func (k *Keyring) BlindIndex(value string) string {
+
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DataKey encrypts the fields of a single record. Each record has a data key of its own, stored alongside it as
+// wrapped by a master key
+type DataKey struct {
+	MasterKeyID string
+	Wrapped     []byte
+
+	aead cipher.AEAD
+}
+
+// Encrypt encrypts the value of a field. The ciphertext is bound to the field, so that it can't stand in for the
+// value of any other
+func (d *DataKey) Encrypt(plaintext string, field string) ([]byte, error) {
+	return seal(d.aead, []byte(plaintext), []byte(field))
+}
+
+// Decrypt decrypts the value of a field
+func (d *DataKey) Decrypt(ciphertext []byte, field string) (string, error) {
+
+	plaintext, err := open(d.aead, ciphertext, []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %s", field, err)
+	}
+	return string(plaintext), nil
+}
+
+// newAEAD returns AES-GCM under a key, which has already been checked to be a valid AES key size
+func newAEAD(key []byte) cipher.AEAD {
+
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	return aead
+}
+
+// seal encrypts a plaintext under a random nonce, which is prepended to the ciphertext
+func seal(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, ciphertext []byte, additionalData []byte) ([]byte, error) {
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, additionalData)
+}
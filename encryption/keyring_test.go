@@ -0,0 +1,148 @@
+package encryption
+
+import (
+	"github.com/bpsaunders/user-api/config"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	currentKey = `{"id": "current", "key": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}`
+	retiredKey = `{"id": "retired", "key": "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="}`
+	indexKey   = "aW5kZXgta2V5LWluZGV4LWtleS1pbmRleC1rZXktaXg="
+)
+
+func TestUnitNewKeyring(t *testing.T) {
+
+	Convey("Given master keys configured inline and in a file", t, func() {
+
+		file, err := ioutil.TempFile("", "master-keys-*.json")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+
+		_, err = file.WriteString("[" + retiredKey + "]")
+		So(err, ShouldBeNil)
+		So(file.Close(), ShouldBeNil)
+
+		keyring, err := NewKeyring(&config.Config{PIIMasterKeys: "[" + currentKey + "]", PIIMasterKeysFile: file.Name(), PIIIndexKey: indexKey})
+
+		Convey("Then I expect the first key configured inline to be current, and the rest retired", func() {
+
+			So(err, ShouldBeNil)
+			So(keyring.CurrentMasterKeyID(), ShouldEqual, "current")
+			So(len(keyring.keys), ShouldEqual, 2)
+		})
+	})
+
+	Convey("Given keys which are missing or invalid", t, func() {
+
+		invalid := map[string]*config.Config{
+			"no master keys are configured":                   {PIIMasterKeys: "[]", PIIIndexKey: indexKey},
+			"master key 0 must have an id":                    {PIIMasterKeys: `[{"key": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}]`, PIIIndexKey: indexKey},
+			"master key 0 (short) must be a base64 encoded":   {PIIMasterKeys: `[{"id": "short", "key": "c2hvcnQ="}]`, PIIIndexKey: indexKey},
+			"master key current is configured more than once": {PIIMasterKeys: "[" + currentKey + ", " + currentKey + "]", PIIIndexKey: indexKey},
+			"the index key must be a base64 encoded secret":   {PIIMasterKeys: "[" + currentKey + "]", PIIIndexKey: "c2hvcnQ="},
+			"no such file or directory":                       {PIIMasterKeysFile: "missing.json", PIIIndexKey: indexKey},
+		}
+
+		Convey("Then I expect each to be refused", func() {
+
+			for problem, cfg := range invalid {
+				keyring, err := NewKeyring(cfg)
+				So(keyring, ShouldBeNil)
+				So(err.Error(), ShouldContainSubstring, problem)
+			}
+		})
+	})
+}
+
+func TestUnitDataKey(t *testing.T) {
+
+	retired, err := NewKeyring(&config.Config{PIIMasterKeys: "[" + retiredKey + "]", PIIIndexKey: indexKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := NewKeyring(&config.Config{PIIMasterKeys: "[" + currentKey + ", " + retiredKey + "]", PIIIndexKey: indexKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Given I encrypt a field under a new data key", t, func() {
+
+		key, err := keyring.NewDataKey("users/id")
+		So(err, ShouldBeNil)
+		So(key.MasterKeyID, ShouldEqual, "current")
+
+		ciphertext, err := key.Encrypt("alice@example.com", "email")
+		So(err, ShouldBeNil)
+
+		Convey("Then I expect to decrypt it with the data key as unwrapped for the same record and field", func() {
+
+			opened, err := keyring.OpenDataKey(key.MasterKeyID, key.Wrapped, "users/id")
+			So(err, ShouldBeNil)
+
+			plaintext, err := opened.Decrypt(ciphertext, "email")
+			So(err, ShouldBeNil)
+			So(plaintext, ShouldEqual, "alice@example.com")
+
+			_, err = opened.Decrypt(ciphertext, "first_name")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Then I expect not to unwrap the data key for another record", func() {
+
+			_, err := keyring.OpenDataKey(key.MasterKeyID, key.Wrapped, "users/other")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Then I expect not to unwrap the data key without its master key", func() {
+
+			_, err := retired.OpenDataKey(key.MasterKeyID, key.Wrapped, "users/id")
+			So(err, ShouldEqual, ErrUnknownMasterKey)
+		})
+
+		Convey("Then I expect the same value to be encrypted differently each time", func() {
+
+			again, err := key.Encrypt("alice@example.com", "email")
+			So(err, ShouldBeNil)
+			So(again, ShouldNotResemble, ciphertext)
+		})
+	})
+
+	Convey("Given a data key wrapped by a master key since retired", t, func() {
+
+		key, err := retired.NewDataKey("users/id")
+		So(err, ShouldBeNil)
+
+		Convey("Then I expect to unwrap it while the master key is configured", func() {
+
+			_, err := keyring.OpenDataKey(key.MasterKeyID, key.Wrapped, "users/id")
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func TestUnitBlindIndex(t *testing.T) {
+
+	Convey("Given I compute the blind index of a value", t, func() {
+
+		keyring, err := NewKeyring(&config.Config{PIIMasterKeys: "[" + currentKey + "]", PIIIndexKey: indexKey})
+		So(err, ShouldBeNil)
+
+		index := keyring.BlindIndex("alice@example.com")
+
+		Convey("Then I expect it to be the same for the same value alone, whatever the master keys", func() {
+
+			rotated, err := NewKeyring(&config.Config{PIIMasterKeys: "[" + retiredKey + "]", PIIIndexKey: indexKey})
+			So(err, ShouldBeNil)
+
+			So(rotated.BlindIndex("alice@example.com"), ShouldEqual, index)
+			So(keyring.BlindIndex("bob@example.com"), ShouldNotEqual, index)
+			So(index, ShouldNotContainSubstring, "alice")
+		})
+	})
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bpsaunders/user-api/auth"
+	"github.com/bpsaunders/user-api/logging"
+	"github.com/bpsaunders/user-api/service"
+	"net/http"
+	"strings"
+)
+
+// LogLevel describes the level at which the application logs
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// getLogLevel returns the level at which the application currently logs
+func getLogLevel(w http.ResponseWriter, r *http.Request) {
+
+	logging.FromContext(r.Context()).Debug("Log level fetched successfully")
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, http.StatusOK, &LogLevel{Level: logging.Level()})
+}
+
+// putLogLevel changes the level at which the application logs, until it's next changed, the configuration is
+// reloaded or the application restarts
+func putLogLevel(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+
+	var level LogLevel
+	err := json.NewDecoder(r.Body).Decode(&level)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to decode request body to log level: %v", err))
+		writeBodyProblem(w, r, "The request body could not be read as a log level", err)
+		return
+	}
+
+	previous, err := logging.SetLevel(level.Level)
+	if err != nil {
+		writeProblem(w, r, service.InvalidData,
+			fmt.Sprintf("The level must be one of: %s", strings.Join(logging.Levels(), ", ")), nil, err)
+		return
+	}
+
+	actor := "unknown"
+	if principal, ok := auth.FromContext(r.Context()); ok {
+		actor = principal.Subject
+	}
+
+	// logged as a warning, so that the change is recorded whatever the new level
+	logger.WithField("actor", actor).Warn(fmt.Sprintf("Log level changed from %s to %s", previous, logging.Level()))
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, http.StatusOK, &LogLevel{Level: logging.Level()})
+}
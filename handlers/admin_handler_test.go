@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"github.com/bpsaunders/user-api/auth"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitLogLevel(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	defer log.SetLevel(log.GetLevel())
+
+	authenticator := auth.NewMockAuthenticator(mockCtrl)
+
+	router := mux.NewRouter()
+	Register(router, nil, authenticator)
+
+	admin := &auth.Principal{Subject: "ops", Scopes: []string{auth.ScopeAdmin}}
+
+	Convey("Given the application logs at info", t, func() {
+
+		log.SetLevel(log.InfoLevel)
+
+		Convey("When I fetch the log level as an admin", func() {
+
+			authenticator.EXPECT().Authenticate(gomock.Any()).Return(admin, nil)
+
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/admin/log-level", nil))
+
+			Convey("Then I expect the current level", func() {
+
+				So(res.Code, ShouldEqual, http.StatusOK)
+				So(res.Body.String(), ShouldEqual, "{\"level\":\"info\"}\n")
+			})
+		})
+
+		Convey("When I change the log level as an admin", func() {
+
+			authenticator.EXPECT().Authenticate(gomock.Any()).Return(admin, nil)
+
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, httptest.NewRequest(http.MethodPut, "/admin/log-level", strings.NewReader(`{"level":"debug"}`)))
+
+			Convey("Then I expect the level to be changed live", func() {
+
+				So(res.Code, ShouldEqual, http.StatusOK)
+				So(res.Body.String(), ShouldEqual, "{\"level\":\"debug\"}\n")
+				So(log.GetLevel(), ShouldEqual, log.DebugLevel)
+			})
+		})
+
+		Convey("When I change the log level to one which doesn't exist", func() {
+
+			authenticator.EXPECT().Authenticate(gomock.Any()).Return(admin, nil)
+
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, httptest.NewRequest(http.MethodPut, "/admin/log-level", strings.NewReader(`{"level":"loud"}`)))
+
+			Convey("Then I expect a 400 response, and the level to be unchanged", func() {
+
+				So(res.Code, ShouldEqual, http.StatusBadRequest)
+				So(res.Body.String(), ShouldContainSubstring, "The level must be one of: panic, fatal")
+				So(log.GetLevel(), ShouldEqual, log.InfoLevel)
+			})
+		})
+
+		Convey("When I change the log level without the admin scope", func() {
+
+			authenticator.EXPECT().Authenticate(gomock.Any()).Return(&auth.Principal{Subject: "app", Scopes: []string{auth.ScopeUsersWrite}}, nil)
+
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, httptest.NewRequest(http.MethodPut, "/admin/log-level", strings.NewReader(`{"level":"debug"}`)))
+
+			Convey("Then I expect a 403 response, and the level to be unchanged", func() {
+
+				So(res.Code, ShouldEqual, http.StatusForbidden)
+				So(log.GetLevel(), ShouldEqual, log.InfoLevel)
+			})
+		})
+	})
+}
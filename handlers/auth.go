@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/bpsaunders/user-api/auth"
+	"github.com/bpsaunders/user-api/logging"
+	"net/http"
+)
+
+// requireScope authenticates requests before they reach a handler, refusing those made without credentials,
+// with invalid credentials, or on behalf of a principal lacking the given scope
+func requireScope(authenticator auth.Authenticator, scope string, next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logging.FromContext(r.Context())
+
+		principal, err := authenticator.Authenticate(r)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Request refused authentication: %v", err))
+
+			detail := "The credentials provided could not be verified"
+			if err == auth.ErrNoCredentials {
+				detail = "An API key or bearer token is required"
+			}
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="user-api"`)
+			renderProblem(w, r, newProblem(r, http.StatusUnauthorized, problemUnauthenticated, detail))
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			logger.Info(fmt.Sprintf("Request refused for %s, lacking scope: %s", principal.Subject, scope))
+			renderProblem(w, r, newProblem(r, http.StatusForbidden, problemInsufficientScope,
+				fmt.Sprintf("The %s scope is required", scope)))
+			return
+		}
+
+		logger.Debug(fmt.Sprintf("Request authenticated for %s", principal.Subject))
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+	})
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/bpsaunders/user-api/auth"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitRequireScope(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	authenticator := auth.NewMockAuthenticator(mockCtrl)
+
+	var principal *auth.Principal
+	handler := requireScope(authenticator, auth.ScopeUsersWrite, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = auth.FromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	Convey("Given I make a request without credentials", t, func() {
+
+		authenticator.EXPECT().Authenticate(gomock.Any()).Return(nil, auth.ErrNoCredentials)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/users", nil))
+
+		Convey("Then I expect a 401 problem, with a challenge", func() {
+
+			So(res.Code, ShouldEqual, http.StatusUnauthorized)
+			So(res.Header().Get("Content-Type"), ShouldEqual, problemContentType)
+			So(res.Header().Get("WWW-Authenticate"), ShouldStartWith, "Bearer")
+
+			var problem Problem
+			So(json.NewDecoder(res.Body).Decode(&problem), ShouldBeNil)
+			So(problem.Type, ShouldEqual, "/problems/unauthenticated")
+		})
+	})
+
+	Convey("Given I make a request with invalid credentials", t, func() {
+
+		authenticator.EXPECT().Authenticate(gomock.Any()).Return(nil, auth.ErrInvalidCredentials)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/users", nil))
+
+		Convey("Then I expect a 401 problem", func() {
+
+			So(res.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+
+	Convey("Given I make a request on behalf of a principal lacking the scope", t, func() {
+
+		authenticator.EXPECT().Authenticate(gomock.Any()).Return(&auth.Principal{
+			Subject: "reader",
+			Scopes:  []string{auth.ScopeUsersRead},
+		}, nil)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/users", nil))
+
+		Convey("Then I expect a 403 problem", func() {
+
+			So(res.Code, ShouldEqual, http.StatusForbidden)
+
+			var problem Problem
+			So(json.NewDecoder(res.Body).Decode(&problem), ShouldBeNil)
+			So(problem.Type, ShouldEqual, "/problems/insufficient-scope")
+			So(problem.Detail, ShouldContainSubstring, auth.ScopeUsersWrite)
+		})
+	})
+
+	Convey("Given I make a request on behalf of a principal with the scope", t, func() {
+
+		writer := &auth.Principal{
+			Subject: "writer",
+			Scopes:  []string{auth.ScopeUsersWrite},
+		}
+		authenticator.EXPECT().Authenticate(gomock.Any()).Return(writer, nil)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/users", nil))
+
+		Convey("Then I expect the request to reach the handler, on behalf of the principal", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNoContent)
+			So(principal, ShouldEqual, writer)
+		})
+	})
+}
+
+func TestUnitRegisteredRoutesRequireAuthentication(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	authenticator := auth.NewMockAuthenticator(mockCtrl)
+	authenticator.EXPECT().Authenticate(gomock.Any()).Return(nil, auth.ErrNoCredentials).AnyTimes()
+
+	router := mux.NewRouter()
+	Register(router, nil, authenticator)
+
+	Convey("Given I make unauthenticated requests to routes exposing users, or administering the application", t, func() {
+
+		for _, route := range []struct{ method, path string }{
+			{http.MethodGet, "/users"},
+			{http.MethodPost, "/users"},
+			{http.MethodPost, "/users:batch"},
+			{http.MethodGet, "/users/id"},
+			{http.MethodPut, "/users/id"},
+			{http.MethodPatch, "/users/id"},
+			{http.MethodDelete, "/users/id"},
+			{http.MethodPost, "/users/id:restore"},
+			{http.MethodPost, "/users/id:erase"},
+			{http.MethodGet, "/users/id/history"},
+			{http.MethodGet, "/users/id/data-export"},
+			{http.MethodGet, "/users/export"},
+			{http.MethodGet, "/users/search"},
+			{http.MethodGet, "/users/stats"},
+			{http.MethodGet, "/admin/log-level"},
+			{http.MethodPut, "/admin/log-level"},
+		} {
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, httptest.NewRequest(route.method, route.path, nil))
+
+			So(res.Code, ShouldEqual, http.StatusUnauthorized)
+		}
+	})
+
+	Convey("Given I request everything held about a user on behalf of a principal only able to read users", t, func() {
+
+		reader := auth.NewMockAuthenticator(mockCtrl)
+		reader.EXPECT().Authenticate(gomock.Any()).Return(&auth.Principal{
+			Subject: "reader",
+			Scopes:  []string{auth.ScopeUsersRead},
+		}, nil)
+
+		router := mux.NewRouter()
+		Register(router, nil, reader)
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/users/id/data-export", nil))
+
+		Convey("Then I expect it to be forbidden, as exporting requires its own scope", func() {
+
+			So(res.Code, ShouldEqual, http.StatusForbidden)
+		})
+	})
+
+	Convey("Given I make an unauthenticated request to check the application is live", t, func() {
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+
+		Convey("Then I expect it to be public", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+		})
+	})
+}
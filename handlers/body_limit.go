@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bpsaunders/user-api/service"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// errBodyTooLarge is returned when reading a request body beyond the largest accepted
+var errBodyTooLarge = errors.New("request body too large")
+
+// BodyLimit refuses request bodies larger than a number of bytes, which may be changed while serving
+type BodyLimit struct {
+	maxBytes int64
+}
+
+// NewBodyLimit returns a BodyLimit refusing request bodies larger than maxBytes
+func NewBodyLimit(maxBytes int64) *BodyLimit {
+	return &BodyLimit{
+		maxBytes: maxBytes,
+	}
+}
+
+// Set changes the largest request body accepted, for requests received from now on
+func (l *BodyLimit) Set(maxBytes int64) {
+	atomic.StoreInt64(&l.maxBytes, maxBytes)
+}
+
+// Middleware refuses request bodies larger than the limit. Those declared larger upfront are refused outright;
+// others fail to be read once the limit is passed
+func (l *BodyLimit) Middleware(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		maxBytes := atomic.LoadInt64(&l.maxBytes)
+
+		if r.ContentLength > maxBytes {
+			renderProblem(w, r, bodyTooLargeProblem(r, maxBytes))
+			return
+		}
+
+		r.Body = &limitedBody{ReadCloser: r.Body, remaining: maxBytes, max: maxBytes}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitedBody reads a request body until its limit is passed, then fails with errBodyTooLarge
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	max       int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+
+	if b.remaining < 0 {
+		return 0, errBodyTooLarge
+	}
+
+	// read one byte beyond the limit, to tell a body of exactly the limit from a longer one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), errBodyTooLarge
+	}
+	return n, err
+}
+
+// writeBodyProblem renders a failure to read a request body; as too large where the limit was passed, otherwise
+// as invalid with the given detail
+func writeBodyProblem(w http.ResponseWriter, r *http.Request, detail string, err error) {
+
+	if body, ok := r.Body.(*limitedBody); ok && err == errBodyTooLarge {
+		renderProblem(w, r, bodyTooLargeProblem(r, body.max))
+		return
+	}
+	writeProblem(w, r, service.InvalidData, detail, nil, err)
+}
+
+func bodyTooLargeProblem(r *http.Request, maxBytes int64) *Problem {
+
+	return newProblem(r, http.StatusRequestEntityTooLarge, problemRequestTooLarge,
+		fmt.Sprintf("The request body may be no larger than %d bytes", maxBytes))
+}
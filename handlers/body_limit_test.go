@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"github.com/bpsaunders/user-api/service"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitLimitRequestBodies(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	router := mux.NewRouter()
+	router.Handle("/users", NewCreateUserHandler(svc)).Methods(http.MethodPost)
+	limit := NewBodyLimit(64)
+	router.Use(limit.Middleware)
+
+	Convey("Given I create a user with a body declared larger than accepted", t, func() {
+
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(strings.Repeat(" ", 65)))
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		Convey("Then I expect a 413 response, without the body being read", func() {
+
+			So(res.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(res.Body.String(), ShouldContainSubstring, "/problems/request-too-large")
+		})
+	})
+
+	Convey("Given I create a user with a body of undeclared length, larger than accepted", t, func() {
+
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"first_name":"`+strings.Repeat("a", 64)+`"}`))
+		req.ContentLength = -1
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		Convey("Then I expect a 413 response once the limit is passed", func() {
+
+			So(res.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+		})
+	})
+
+	Convey("Given I create a user with a malformed body, within the limit", t, func() {
+
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"first_name":`))
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		Convey("Then I expect a 400 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+
+	Convey("Given the limit is lowered while serving", t, func() {
+
+		limit.Set(8)
+		defer limit.Set(64)
+
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"first_name":""}`))
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		Convey("Then I expect later requests to be held to the new limit", func() {
+
+			So(res.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(res.Body.String(), ShouldContainSubstring, "no larger than 8 bytes")
+		})
+	})
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"github.com/bpsaunders/user-api/countries"
+	"github.com/bpsaunders/user-api/logging"
+	"net/http"
+)
+
+// getCountries returns every country a user may belong to, so clients may use the same source of truth as validation
+func getCountries(w http.ResponseWriter, r *http.Request) {
+
+	logging.FromContext(r.Context()).Info("Countries fetched successfully")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	writeJSON(w, r, http.StatusOK, countries.All())
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/bpsaunders/user-api/countries"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitGetCountries(t *testing.T) {
+
+	Convey("Given I fetch all countries", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/countries", nil)
+		res := httptest.NewRecorder()
+
+		getCountries(res, req)
+
+		var body []countries.Country
+		err := json.NewDecoder(res.Body).Decode(&body)
+
+		Convey("Then I expect a 200 response with every country", func() {
+
+			So(err, ShouldBeNil)
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(body, ShouldResemble, countries.All())
+		})
+	})
+}
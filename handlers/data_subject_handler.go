@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/bpsaunders/user-api/logging"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/service"
+	"net/http"
+	"strconv"
+)
+
+const mediaTypeZip = "application/zip"
+
+// dataExportFile is the name of the document within a zipped data export
+const dataExportFile = "data-export.json"
+
+// dataExportOffers maps the media ranges by which a data export may be requested to the media type each selects
+var dataExportOffers = map[string]string{
+	mediaTypeJSON:   mediaTypeJSON,
+	"*/*":           mediaTypeJSON,
+	"application/*": mediaTypeJSON,
+	mediaTypeZip:    mediaTypeZip,
+}
+
+const concurrentErasureDetail = "The user was modified while being erased; the request may be retried"
+
+// ExportUserDataHandler offers a handler by which to fetch everything held about a user, upon a subject access
+// request
+type ExportUserDataHandler struct {
+	service service.UserService
+}
+
+// NewExportUserDataHandler returns a new ExportUserDataHandler
+func NewExportUserDataHandler(service service.UserService) ExportUserDataHandler {
+	return ExportUserDataHandler{
+		service,
+	}
+}
+
+// EraseUserHandler offers a handler by which to irreversibly erase a user, upon a request for erasure
+type EraseUserHandler struct {
+	service service.UserService
+}
+
+// NewEraseUserHandler returns a new EraseUserHandler
+func NewEraseUserHandler(service service.UserService) EraseUserHandler {
+	return EraseUserHandler{
+		service,
+	}
+}
+
+func (h ExportUserDataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	mediaType, ok := negotiate(r.Header.Get("Accept"), dataExportOffers, mediaTypeJSON)
+	if !ok {
+		renderProblem(w, r, newProblem(r, http.StatusNotAcceptable, problemNotAcceptable,
+			fmt.Sprintf("User data may only be exported as %s or %s", mediaTypeJSON, mediaTypeZip)))
+		return
+	}
+
+	responseType, export, err := h.service.ExportUserData(r.Context(), userID)
+	if responseType != service.Success {
+		writeProblem(w, r, responseType, "", nil, err)
+		return
+	}
+
+	// the export is assembled in full before responding, so that a failure can still be rendered as a problem
+	body, err := encodeDataExport(export, mediaType)
+	if err != nil {
+		writeProblem(w, r, service.Error, "", nil, err)
+		return
+	}
+
+	logger.Info("User data exported successfully")
+	logger.Debug(fmt.Sprintf("User data exported for id: %s", userID))
+
+	// the export holds personal data, so mustn't linger in any cache
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", mediaType)
+	if mediaType == mediaTypeZip {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%s-data-export.zip"`, userID))
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		logger.Error(fmt.Sprintf("Error writing response: %v", err))
+	}
+}
+
+// encodeDataExport renders a data export as JSON, zipped as a single document where requested
+func encodeDataExport(export *models.DataExport, mediaType string) ([]byte, error) {
+
+	document, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if mediaType != mediaTypeZip {
+		return document, nil
+	}
+
+	var archive bytes.Buffer
+	zipWriter := zip.NewWriter(&archive)
+
+	file, err := zipWriter.CreateHeader(&zip.FileHeader{Name: dataExportFile, Method: zip.Deflate, Modified: export.ExportedAt})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Write(document); err != nil {
+		return nil, err
+	}
+
+	if err = zipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
+
+func (h EraseUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	blockReregistration := false
+	if value := r.URL.Query().Get("block_reregistration"); value != "" {
+		var err error
+		blockReregistration, err = strconv.ParseBool(value)
+		if err != nil {
+			writeProblem(w, r, service.InvalidData, "block_reregistration must be true or false", nil, nil)
+			return
+		}
+	}
+
+	responseType, receipt, err := h.service.EraseUser(r.Context(), userID, blockReregistration)
+	if responseType == service.Conflict {
+		writeProblem(w, r, responseType, concurrentErasureDetail, nil, err)
+		return
+	}
+	if responseType != service.Success {
+		writeProblem(w, r, responseType, "", nil, err)
+		return
+	}
+
+	logger.Info("User erased successfully")
+	logger.Debug(fmt.Sprintf("User erased with id: %s", userID))
+	writeJSON(w, r, http.StatusOK, receipt)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/service"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitExportUserData(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewExportUserDataHandler(svc)
+
+	newRequest := func(accept string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/users/id/data-export", nil)
+		req.Header.Set("Accept", accept)
+		return mux.SetURLVars(req, map[string]string{"user_id": "id"})
+	}
+
+	export := &models.DataExport{
+		ExportedAt: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		User:       &models.UserRecord{ID: "id", Email: "user@mail.com", Version: 2},
+		History:    []*models.AuditEvent{{ID: "event", UserID: "id", Operation: "create"}},
+	}
+
+	Convey("Given I export the data of a user as JSON", t, func() {
+
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().ExportUserData(gomock.Any(), "id").Return(service.Success, export, nil)
+
+		handler.ServeHTTP(res, newRequest(""))
+
+		Convey("Then I expect the export, never to be cached", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Header().Get("Content-Type"), ShouldEqual, mediaTypeJSON)
+			So(res.Header().Get("Cache-Control"), ShouldEqual, "no-store")
+
+			var body models.DataExport
+			So(json.NewDecoder(res.Body).Decode(&body), ShouldBeNil)
+			So(&body, ShouldResemble, export)
+		})
+	})
+
+	Convey("Given I export the data of a user as a zip archive", t, func() {
+
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().ExportUserData(gomock.Any(), "id").Return(service.Success, export, nil)
+
+		handler.ServeHTTP(res, newRequest(mediaTypeZip))
+
+		Convey("Then I expect an attachment, holding the export as JSON", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Header().Get("Content-Type"), ShouldEqual, mediaTypeZip)
+			So(res.Header().Get("Content-Disposition"), ShouldEqual, `attachment; filename="user-id-data-export.zip"`)
+
+			archive, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+			So(err, ShouldBeNil)
+			So(len(archive.File), ShouldEqual, 1)
+			So(archive.File[0].Name, ShouldEqual, dataExportFile)
+
+			file, err := archive.File[0].Open()
+			So(err, ShouldBeNil)
+			document, err := ioutil.ReadAll(file)
+			So(err, ShouldBeNil)
+
+			var body models.DataExport
+			So(json.Unmarshal(document, &body), ShouldBeNil)
+			So(&body, ShouldResemble, export)
+		})
+	})
+
+	Convey("Given I export the data of a user in a media type which isn't offered", t, func() {
+
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, newRequest(mediaTypeCSV))
+
+		Convey("Then I expect a 406 problem", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNotAcceptable)
+		})
+	})
+
+	Convey("Given I export the data of a user which doesn't exist", t, func() {
+
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().ExportUserData(gomock.Any(), "id").Return(service.NotFound, nil, nil)
+
+		handler.ServeHTTP(res, newRequest(mediaTypeJSON))
+
+		Convey("Then I expect a 404 problem", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+}
+
+func TestUnitEraseUser(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewEraseUserHandler(svc)
+
+	newRequest := func(target string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		return mux.SetURLVars(req, map[string]string{"user_id": "id"})
+	}
+
+	Convey("Given I erase a user, blocking its email from re-registration", t, func() {
+
+		res := httptest.NewRecorder()
+
+		receipt := &models.ErasureReceipt{UserID: "id", Tombstone: "tombstone", ReregistrationBlocked: true, Signature: "signature"}
+		svc.EXPECT().EraseUser(gomock.Any(), "id", true).Return(service.Success, receipt, nil)
+
+		handler.ServeHTTP(res, newRequest("/users/id:erase?block_reregistration=true"))
+
+		Convey("Then I expect a 200 response, with the receipt", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+
+			var body models.ErasureReceipt
+			So(json.NewDecoder(res.Body).Decode(&body), ShouldBeNil)
+			So(&body, ShouldResemble, receipt)
+		})
+	})
+
+	Convey("Given I erase a user without saying whether to block its email", t, func() {
+
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().EraseUser(gomock.Any(), "id", false).Return(service.Success, &models.ErasureReceipt{}, nil)
+
+		handler.ServeHTTP(res, newRequest("/users/id:erase"))
+
+		Convey("Then I expect its email not to be blocked", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+		})
+	})
+
+	Convey("Given I erase a user, saying whether to block its email other than with true or false", t, func() {
+
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, newRequest("/users/id:erase?block_reregistration=maybe"))
+
+		Convey("Then I expect a 400 problem, without the user being erased", func() {
+
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+			So(res.Body.String(), ShouldContainSubstring, "block_reregistration")
+		})
+	})
+
+	Convey("Given I erase a user which is modified meanwhile", t, func() {
+
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().EraseUser(gomock.Any(), "id", false).Return(service.Conflict, nil, nil)
+
+		handler.ServeHTTP(res, newRequest("/users/id:erase"))
+
+		Convey("Then I expect a 409 problem, inviting a retry", func() {
+
+			So(res.Code, ShouldEqual, http.StatusConflict)
+			So(res.Body.String(), ShouldContainSubstring, concurrentErasureDetail)
+		})
+	})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag returns the strong entity tag of a version of a user
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// entityTags splits a list of entity tags, as found in If-Match and If-None-Match headers
+func entityTags(header string) []string {
+
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// precondition returns the precondition described by the If-Match header of a request, or nil if there is none.
+// If-Match requires strong comparison, so weak or malformed tags never match
+func precondition(r *http.Request) *models.Precondition {
+
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+
+	precondition := &models.Precondition{}
+	for _, tag := range entityTags(header) {
+		if tag == "*" {
+			precondition.Any = true
+			continue
+		}
+		if version, ok := parseETag(tag); ok {
+			precondition.Versions = append(precondition.Versions, version)
+		}
+	}
+	return precondition
+}
+
+// notModified determines whether the If-None-Match header of a request matches a version of a user, using the
+// weak comparison If-None-Match calls for
+func notModified(r *http.Request, version int64) bool {
+
+	for _, tag := range entityTags(r.Header.Get("If-None-Match")) {
+		if tag == "*" {
+			return true
+		}
+		if v, ok := parseETag(strings.TrimPrefix(tag, "W/")); ok && v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETag returns the version of a user from its strong entity tag
+func parseETag(tag string) (int64, bool) {
+
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitPrecondition(t *testing.T) {
+
+	Convey("Given a request without an If-Match header", t, func() {
+
+		req := httptest.NewRequest(http.MethodPut, "/users/id", nil)
+
+		Convey("Then I expect no precondition", func() {
+
+			So(precondition(req), ShouldBeNil)
+		})
+	})
+
+	Convey("Given a request with an If-Match header", t, func() {
+
+		req := httptest.NewRequest(http.MethodPut, "/users/id", nil)
+
+		Convey("When it lists strong entity tags", func() {
+
+			req.Header.Set("If-Match", `"2", "3"`)
+
+			Convey("Then I expect a precondition upon those versions", func() {
+
+				So(precondition(req), ShouldResemble, &models.Precondition{Versions: []int64{2, 3}})
+			})
+		})
+
+		Convey("When it is a wildcard", func() {
+
+			req.Header.Set("If-Match", "*")
+
+			Convey("Then I expect a precondition upon any version", func() {
+
+				So(precondition(req), ShouldResemble, &models.Precondition{Any: true})
+			})
+		})
+
+		Convey("When it lists only weak or malformed entity tags", func() {
+
+			req.Header.Set("If-Match", `W/"2", 3, "three"`)
+
+			Convey("Then I expect a precondition which can never be met", func() {
+
+				p := precondition(req)
+				So(p, ShouldNotBeNil)
+				So(p.Met(2), ShouldBeFalse)
+				So(p.Met(3), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestUnitNotModified(t *testing.T) {
+
+	Convey("Given a request with an If-None-Match header", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/id", nil)
+
+		Convey("Then I expect it to match the version of a user by weak comparison", func() {
+
+			req.Header.Set("If-None-Match", `"1", W/"3"`)
+
+			So(notModified(req, 3), ShouldBeTrue)
+			So(notModified(req, 1), ShouldBeTrue)
+			So(notModified(req, 2), ShouldBeFalse)
+		})
+
+		Convey("Then I expect a wildcard to match any version", func() {
+
+			req.Header.Set("If-None-Match", "*")
+
+			So(notModified(req, 2), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a request without an If-None-Match header", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/id", nil)
+
+		Convey("Then I expect it not to match", func() {
+
+			So(notModified(req, 1), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/bpsaunders/user-api/logging"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/service"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushInterval is the number of users written between flushes of an export, so that clients receive
+// users steadily rather than as the server's buffers fill
+const exportFlushInterval = 100
+
+// exportColumns holds the columns of a CSV export, as named in its header row
+var exportColumns = []string{"id", "first_name", "last_name", "email", "country", "created_at", "updated_at"}
+
+// ExportUsersHandler offers a handler by which to stream all users matching the listing filters
+type ExportUsersHandler struct {
+	service service.UserService
+}
+
+// NewExportUsersHandler returns a new ExportUsersHandler
+func NewExportUsersHandler(service service.UserService) ExportUsersHandler {
+	return ExportUsersHandler{
+		service,
+	}
+}
+
+func (h ExportUsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+
+	mediaType, ok := negotiateExport(r.Header.Get("Accept"))
+	if !ok {
+		renderProblem(w, r, newProblem(r, http.StatusNotAcceptable, problemNotAcceptable,
+			fmt.Sprintf("Users may only be exported as %s or %s", mediaTypeNDJSON, mediaTypeCSV)))
+		return
+	}
+
+	params := r.URL.Query()
+	query := &models.UserListQuery{
+		Country:     params.Get("country"),
+		EmailDomain: params.Get("email_domain"),
+		NamePrefix:  params.Get("name_prefix"),
+	}
+
+	export := newExportWriter(w, mediaType)
+
+	responseType, err := h.service.ExportUsers(r.Context(), query, export.write)
+	if responseType != service.Success {
+		if !export.started {
+			writeProblem(w, r, responseType, "", nil, err)
+			return
+		}
+		// the response is already under way, so can only be cut short
+		logger.Error(fmt.Sprintf("Export abandoned after %d users: %v", export.count, err))
+		return
+	}
+
+	err = export.finish()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to complete export: %v", err))
+		return
+	}
+
+	logger.WithField("users", export.count).Info("Users exported successfully")
+}
+
+// exportOffers maps the media ranges by which an export may be requested to the media type each selects
+var exportOffers = map[string]string{
+	mediaTypeNDJSON: mediaTypeNDJSON,
+	"*/*":           mediaTypeNDJSON,
+	"application/*": mediaTypeNDJSON,
+	mediaTypeCSV:    mediaTypeCSV,
+	"text/*":        mediaTypeCSV,
+}
+
+// negotiateExport chooses the media type of an export from an Accept header, preferring NDJSON where the client
+// has no preference
+func negotiateExport(accept string) (string, bool) {
+	return negotiate(accept, exportOffers, mediaTypeNDJSON)
+}
+
+// negotiate chooses the media type of a response from an Accept header, being that selected by the most preferred
+// of the media ranges offered, or the given default where the client has no preference
+func negotiate(accept string, offers map[string]string, preferred string) (string, bool) {
+
+	if strings.TrimSpace(accept) == "" {
+		return preferred, true
+	}
+
+	chosen, best := "", 0.0
+	for _, candidate := range strings.Split(accept, ",") {
+
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(candidate))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		if supported := offers[mediaType]; supported != "" && quality > best {
+			chosen, best = supported, quality
+		}
+	}
+
+	return chosen, chosen != ""
+}
+
+// exportWriter writes users to a streamed response one at a time, committing to a successful response only
+// once the first user is written, so that failures beforehand can still be rendered as problems
+type exportWriter struct {
+	w         http.ResponseWriter
+	mediaType string
+	csv       *csv.Writer
+	json      *json.Encoder
+	started   bool
+	count     int
+}
+
+func newExportWriter(w http.ResponseWriter, mediaType string) *exportWriter {
+
+	export := &exportWriter{
+		w:         w,
+		mediaType: mediaType,
+	}
+	if mediaType == mediaTypeCSV {
+		export.csv = csv.NewWriter(w)
+	} else {
+		export.json = json.NewEncoder(w)
+	}
+	return export
+}
+
+func (e *exportWriter) start() error {
+
+	if e.started {
+		return nil
+	}
+	e.started = true
+
+	e.w.Header().Set("Content-Type", e.mediaType)
+	e.w.Header().Set("Cache-Control", "no-store")
+	e.w.WriteHeader(http.StatusOK)
+
+	if e.csv != nil {
+		return e.csv.Write(exportColumns)
+	}
+	return nil
+}
+
+// write writes a user, flushing periodically. An error is returned once the client has gone away, which stops
+// the export
+func (e *exportWriter) write(user *models.User) error {
+
+	err := e.start()
+	if err != nil {
+		return err
+	}
+
+	if e.csv != nil {
+		err = e.csv.Write([]string{
+			user.ID,
+			user.FirstName,
+			user.LastName,
+			user.Email,
+			user.Country,
+			user.CreatedAt.Format(time.RFC3339Nano),
+			user.UpdatedAt.Format(time.RFC3339Nano),
+		})
+	} else {
+		err = e.json.Encode(user)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.count++
+	if e.count%exportFlushInterval == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+// finish completes an export, which may not have had any users to write
+func (e *exportWriter) finish() error {
+
+	err := e.start()
+	if err != nil {
+		return err
+	}
+	return e.flush()
+}
+
+func (e *exportWriter) flush() error {
+
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
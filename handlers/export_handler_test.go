@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/bpsaunders/user-api/auth"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/service"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitExportUsers(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewExportUsersHandler(svc)
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	users := []*models.User{
+		{ID: "1", FirstName: "Alice", LastName: "Smith", Email: "alice@mail.com", Country: "GB", CreatedAt: created, UpdatedAt: created},
+		{ID: "2", FirstName: "Bob", LastName: "Jones", Email: "bob@mail.com", Country: "GB", CreatedAt: created, UpdatedAt: created},
+	}
+
+	exportAll := func(_ context.Context, _ *models.UserListQuery, write func(*models.User) error) (service.ResponseType, error) {
+		for _, user := range users {
+			if err := write(user); err != nil {
+				return service.Error, err
+			}
+		}
+		return service.Success, nil
+	}
+
+	Convey("Given I export users filtered by country, as NDJSON", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/export?country=GB&email_domain=mail.com&name_prefix=a", nil)
+		req.Header.Set("Accept", "application/x-ndjson")
+		res := httptest.NewRecorder()
+
+		query := &models.UserListQuery{Country: "GB", EmailDomain: "mail.com", NamePrefix: "a"}
+		svc.EXPECT().ExportUsers(gomock.Any(), query, gomock.Any()).DoAndReturn(exportAll)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 200 response with a user on each line", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Header().Get("Content-Type"), ShouldEqual, "application/x-ndjson")
+			So(res.Flushed, ShouldBeTrue)
+
+			lines := strings.Split(strings.TrimSpace(res.Body.String()), "\n")
+			So(len(lines), ShouldEqual, 2)
+			So(lines[0], ShouldStartWith, `{"id":"1","first_name":"Alice"`)
+		})
+	})
+
+	Convey("Given I export users as CSV", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/export", nil)
+		req.Header.Set("Accept", "application/json;q=0.9, text/csv")
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().ExportUsers(gomock.Any(), &models.UserListQuery{}, gomock.Any()).DoAndReturn(exportAll)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 200 response with a header row, then a record for each user", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Header().Get("Content-Type"), ShouldEqual, "text/csv")
+			So(res.Body.String(), ShouldEqual, "id,first_name,last_name,email,country,created_at,updated_at\n"+
+				"1,Alice,Smith,alice@mail.com,GB,2020-01-01T00:00:00Z,2020-01-01T00:00:00Z\n"+
+				"2,Bob,Jones,bob@mail.com,GB,2020-01-01T00:00:00Z,2020-01-01T00:00:00Z\n")
+		})
+	})
+
+	Convey("Given I export users as CSV, but none match", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/export?country=FR", nil)
+		req.Header.Set("Accept", "text/csv")
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().ExportUsers(gomock.Any(), &models.UserListQuery{Country: "FR"}, gomock.Any()).Return(service.Success, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 200 response with only a header row", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Body.String(), ShouldEqual, "id,first_name,last_name,email,country,created_at,updated_at\n")
+		})
+	})
+
+	Convey("Given I export users in a media type which can't be exported", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/export", nil)
+		req.Header.Set("Accept", "application/xml")
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 406 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNotAcceptable)
+			So(res.Body.String(), ShouldContainSubstring, "/problems/not-acceptable")
+		})
+	})
+
+	Convey("Given the export fails before any user is written", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/export", nil)
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().ExportUsers(gomock.Any(), gomock.Any(), gomock.Any()).Return(service.Error, errors.New("error when exporting users"))
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 500 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+
+	Convey("Given the export fails after users have been written", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/export", nil)
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().ExportUsers(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ *models.UserListQuery, write func(*models.User) error) (service.ResponseType, error) {
+				_ = write(users[0])
+				return service.Error, errors.New("error when exporting users")
+			})
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect the response to be cut short, rather than followed by a problem", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Body.String(), ShouldNotContainSubstring, "problems")
+		})
+	})
+}
+
+func TestUnitExportRouteIsNotAUser(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+	authenticator := auth.NewMockAuthenticator(mockCtrl)
+	authenticator.EXPECT().Authenticate(gomock.Any()).Return(&auth.Principal{Scopes: []string{auth.ScopeUsersRead}}, nil)
+
+	router := mux.NewRouter()
+	Register(router, svc, authenticator)
+
+	Convey("Given I export users through the router", t, func() {
+
+		svc.EXPECT().ExportUsers(gomock.Any(), gomock.Any(), gomock.Any()).Return(service.Success, nil)
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/users/export", nil))
+
+		Convey("Then I expect the export to be served, rather than a user with the id 'export'", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+		})
+	})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/bpsaunders/user-api/logging"
+	"github.com/bpsaunders/user-api/service"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// health statuses reported by the health endpoints
+const (
+	healthStatusUp       = "up"
+	healthStatusDown     = "down"
+	healthStatusDraining = "draining"
+)
+
+// Health describes the status of the application, and of each component it depends upon
+type Health struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components,omitempty"`
+}
+
+// ComponentHealth describes the status of a component, and how long it took to check
+type ComponentHealth struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ReadinessHandler offers a handler by which to determine whether the application can serve traffic
+type ReadinessHandler struct {
+	service  service.UserService
+	draining *int32
+}
+
+// NewReadinessHandler returns a new ReadinessHandler
+func NewReadinessHandler(service service.UserService) ReadinessHandler {
+	return ReadinessHandler{
+		service:  service,
+		draining: new(int32),
+	}
+}
+
+// Drain causes readiness checks to fail from now on, so that traffic is routed elsewhere ahead of shutdown
+func (h ReadinessHandler) Drain() {
+
+	atomic.StoreInt32(h.draining, 1)
+	log.Info("readiness checks will now fail while the application drains")
+}
+
+func (h ReadinessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if atomic.LoadInt32(h.draining) == 1 {
+		writeHealth(w, r, &Health{Status: healthStatusDraining})
+		return
+	}
+
+	start := time.Now()
+	err := h.service.Ping(r.Context())
+
+	database := ComponentHealth{
+		Status:    healthStatusUp,
+		LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error(fmt.Sprintf("readiness check failed to reach the db: %v", err))
+		database.Status = healthStatusDown
+		database.Error = err.Error()
+	}
+
+	writeHealth(w, r, &Health{
+		Status: database.Status,
+		Components: map[string]ComponentHealth{
+			"database": database,
+		},
+	})
+}
+
+// liveness reports the process is up; it deliberately checks nothing else, so a
+// struggling dependency never causes the application to be restarted
+func liveness(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, r, &Health{Status: healthStatusUp})
+}
+
+// writeHealth renders a health report, failing with a 503 unless the application is up
+func writeHealth(w http.ResponseWriter, r *http.Request, health *Health) {
+
+	status := http.StatusOK
+	if health.Status != healthStatusUp {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, status, health)
+}
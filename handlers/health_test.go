@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/bpsaunders/user-api/service"
+	"github.com/golang/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitLiveness(t *testing.T) {
+
+	Convey("Given I check whether the application is live", t, func() {
+
+		res := httptest.NewRecorder()
+		liveness(res, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+
+		Convey("Then I expect it to be up", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+
+			var health Health
+			So(json.NewDecoder(res.Body).Decode(&health), ShouldBeNil)
+			So(health.Status, ShouldEqual, healthStatusUp)
+		})
+	})
+}
+
+func TestUnitReadiness(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	Convey("Given I check whether the application is ready", t, func() {
+
+		handler := NewReadinessHandler(svc)
+		req := httptest.NewRequest(http.MethodGet, "/health/ready", nil)
+
+		Convey("When the db is reachable", func() {
+
+			svc.EXPECT().Ping(gomock.Any()).Return(nil)
+
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			Convey("Then I expect it and the database component to be up", func() {
+
+				So(res.Code, ShouldEqual, http.StatusOK)
+				So(res.Header().Get("Cache-Control"), ShouldEqual, "no-store")
+
+				var health Health
+				So(json.NewDecoder(res.Body).Decode(&health), ShouldBeNil)
+				So(health.Status, ShouldEqual, healthStatusUp)
+				So(health.Components["database"].Status, ShouldEqual, healthStatusUp)
+				So(health.Components["database"].LatencyMS, ShouldBeGreaterThanOrEqualTo, 0)
+				So(health.Components["database"].Error, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the db is unreachable", func() {
+
+			svc.EXPECT().Ping(gomock.Any()).Return(errors.New("server selection timeout"))
+
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			Convey("Then I expect it and the database component to be down", func() {
+
+				So(res.Code, ShouldEqual, http.StatusServiceUnavailable)
+
+				var health Health
+				So(json.NewDecoder(res.Body).Decode(&health), ShouldBeNil)
+				So(health.Status, ShouldEqual, healthStatusDown)
+				So(health.Components["database"].Status, ShouldEqual, healthStatusDown)
+				So(health.Components["database"].Error, ShouldEqual, "server selection timeout")
+			})
+		})
+
+		Convey("When the application has begun to drain", func() {
+
+			handler.Drain()
+
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			Convey("Then I expect it to fail without checking the db", func() {
+
+				So(res.Code, ShouldEqual, http.StatusServiceUnavailable)
+
+				var health Health
+				So(json.NewDecoder(res.Body).Decode(&health), ShouldBeNil)
+				So(health.Status, ShouldEqual, healthStatusDraining)
+			})
+		})
+	})
+}
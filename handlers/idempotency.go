@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// idempotencyKeyHeader is the request header by which a client makes a request idempotent
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentReplayedHeader marks a response replayed from the original request with the same idempotency key
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+// idempotencyKeyMaxLength is the longest idempotency key accepted, ample for a UUID or similar
+const idempotencyKeyMaxLength = 255
+
+// invalidIdempotencyKeyDetail describes an idempotency key which isn't accepted
+const invalidIdempotencyKeyDetail = "The Idempotency-Key header must be no more than 255 printable ASCII characters"
+
+// idempotencyKey returns the idempotency key of a request, if it has one, and whether the key is valid
+func idempotencyKey(r *http.Request) (string, bool) {
+
+	key := r.Header.Get(idempotencyKeyHeader)
+	if len(key) > idempotencyKeyMaxLength {
+		return key, false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < '!' || key[i] > '~' {
+			return key, false
+		}
+	}
+	return key, true
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/service"
+	"github.com/golang/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitCreateUserIdempotently(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewCreateUserHandler(svc)
+
+	newRequest := func(key string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"email":"user@mail.com"}`))
+		req.Header.Set(idempotencyKeyHeader, key)
+		return req
+	}
+
+	Convey("Given I retry the creation of a user with the same idempotency key", t, func() {
+
+		res := httptest.NewRecorder()
+
+		created := &models.User{ID: "id", Version: 1, Links: models.Links{Self: "/users/id"}}
+		svc.EXPECT().CreateUserIdempotently(gomock.Any(), "key", &models.User{Email: "user@mail.com"}).
+			Return(service.Success, created, nil, true, nil)
+
+		handler.ServeHTTP(res, newRequest("key"))
+
+		Convey("Then I expect the original 201 response, marked as replayed", func() {
+
+			So(res.Code, ShouldEqual, http.StatusCreated)
+			So(res.Header().Get("Location"), ShouldEqual, "/users/id")
+			So(res.Header().Get("ETag"), ShouldEqual, `"1"`)
+			So(res.Header().Get(idempotentReplayedHeader), ShouldEqual, "true")
+		})
+	})
+
+	Convey("Given I create a user with a new idempotency key", t, func() {
+
+		res := httptest.NewRecorder()
+
+		created := &models.User{ID: "id", Version: 1, Links: models.Links{Self: "/users/id"}}
+		svc.EXPECT().CreateUserIdempotently(gomock.Any(), "key", gomock.Any()).Return(service.Success, created, nil, false, nil)
+
+		handler.ServeHTTP(res, newRequest("key"))
+
+		Convey("Then I expect a 201 response, not marked as replayed", func() {
+
+			So(res.Code, ShouldEqual, http.StatusCreated)
+			So(res.Header().Get(idempotentReplayedHeader), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given I reuse an idempotency key for a different user", t, func() {
+
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().CreateUserIdempotently(gomock.Any(), "key", gomock.Any()).Return(service.IdempotencyKeyReused, nil, nil, false, nil)
+
+		handler.ServeHTTP(res, newRequest("key"))
+
+		Convey("Then I expect a 422 problem", func() {
+
+			So(res.Code, ShouldEqual, http.StatusUnprocessableEntity)
+			So(res.Body.String(), ShouldContainSubstring, "/problems/idempotency-key-reused")
+		})
+	})
+
+	Convey("Given I retry a request which is still in progress", t, func() {
+
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().CreateUserIdempotently(gomock.Any(), "key", gomock.Any()).Return(service.IdempotencyKeyInUse, nil, nil, false, nil)
+
+		handler.ServeHTTP(res, newRequest("key"))
+
+		Convey("Then I expect a 409 problem", func() {
+
+			So(res.Code, ShouldEqual, http.StatusConflict)
+			So(res.Body.String(), ShouldContainSubstring, "/problems/idempotency-key-in-use")
+		})
+	})
+
+	Convey("Given I create a user with an idempotency key which isn't accepted", t, func() {
+
+		Convey("Then I expect a 400 problem, without the user being created", func() {
+
+			for _, key := range []string{"white space", strings.Repeat("k", idempotencyKeyMaxLength+1)} {
+
+				res := httptest.NewRecorder()
+
+				handler.ServeHTTP(res, newRequest(key))
+
+				So(res.Code, ShouldEqual, http.StatusBadRequest)
+				So(res.Body.String(), ShouldContainSubstring, "Idempotency-Key")
+			}
+		})
+	})
+}
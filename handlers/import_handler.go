@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bpsaunders/user-api/logging"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/service"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// media types in which a batch of users may be imported
+const (
+	mediaTypeJSON   = "application/json"
+	mediaTypeNDJSON = "application/x-ndjson"
+	mediaTypeCSV    = "text/csv"
+)
+
+// maxImportLineBytes bounds the length of a single line of an NDJSON import
+const maxImportLineBytes = 1 << 20
+
+// csvColumns holds the columns of a CSV import, by which the header row names them
+var csvColumns = []string{"first_name", "last_name", "email", "country"}
+
+// errUnsupportedMediaType is returned when a batch is submitted in a media type which can't be imported
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+// ImportUsersHandler offers a handler by which to create a batch of users
+type ImportUsersHandler struct {
+	service service.UserService
+}
+
+// NewImportUsersHandler returns a new ImportUsersHandler
+func NewImportUsersHandler(service service.UserService) ImportUsersHandler {
+	return ImportUsersHandler{
+		service,
+	}
+}
+
+func (h ImportUsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+
+	rows, err := parseImport(r)
+	if err == errUnsupportedMediaType {
+		renderProblem(w, r, newProblem(r, http.StatusUnsupportedMediaType, problemUnsupportedMediaType,
+			fmt.Sprintf("Users may only be imported as %s, %s or %s", mediaTypeJSON, mediaTypeNDJSON, mediaTypeCSV)))
+		return
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to parse batch of users: %v", err))
+		writeBodyProblem(w, r, malformedBodyDetail, err)
+		return
+	}
+
+	allOrNothing := r.URL.Query().Get("all_or_nothing") == "true"
+
+	responseType, report, validationErrors, err := h.service.ImportUsers(r.Context(), rows, allOrNothing)
+	if responseType != service.Success {
+		writeProblem(w, r, responseType, "", validationErrors, err)
+		return
+	}
+
+	logger.WithField("created", report.Created).WithField("failed", report.Failed).Info("Users imported")
+	writeJSON(w, r, http.StatusOK, report)
+}
+
+// parseImport reads the records of a batch of users from the request body, according to its media type. A record
+// which can't be parsed as a user is marked as malformed, rather than failing the whole batch
+func parseImport(r *http.Request) ([]*models.ImportRow, error) {
+
+	mediaType := mediaTypeJSON
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, errUnsupportedMediaType
+		}
+	}
+
+	switch mediaType {
+	case mediaTypeJSON:
+		return parseJSONImport(r.Body)
+	case mediaTypeNDJSON:
+		return parseNDJSONImport(r.Body)
+	case mediaTypeCSV:
+		return parseCSVImport(r.Body)
+	default:
+		return nil, errUnsupportedMediaType
+	}
+}
+
+// parseJSONImport reads a JSON array of users
+func parseJSONImport(body io.Reader) ([]*models.ImportRow, error) {
+
+	var records []json.RawMessage
+	err := json.NewDecoder(body).Decode(&records)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]*models.ImportRow, 0, len(records))
+	for i, record := range records {
+		rows = append(rows, parseJSONRecord(i+1, record))
+	}
+	return rows, nil
+}
+
+// parseNDJSONImport reads users as newline delimited JSON, one per line; blank lines are ignored
+func parseNDJSONImport(body io.Reader) ([]*models.ImportRow, error) {
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+
+	rows := make([]*models.ImportRow, 0)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		rows = append(rows, parseJSONRecord(len(rows)+1, line))
+	}
+
+	return rows, scanner.Err()
+}
+
+func parseJSONRecord(row int, record []byte) *models.ImportRow {
+
+	var user models.User
+	err := json.Unmarshal(record, &user)
+	if err != nil {
+		return &models.ImportRow{Row: row, Malformed: fmt.Sprintf("the record is not a valid user: %s", err)}
+	}
+	return &models.ImportRow{Row: row, User: &user}
+}
+
+// parseCSVImport reads users as CSV, with a header row naming the columns in any order
+func parseCSVImport(body io.Reader) ([]*models.ImportRow, error) {
+
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the header row is missing")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := csvColumnIndices(header)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]*models.ImportRow, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+
+		row := len(rows) + 1
+
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			rows = append(rows, &models.ImportRow{Row: row, Malformed: parseErr.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) != len(header) {
+			rows = append(rows, &models.ImportRow{Row: row, Malformed: fmt.Sprintf(
+				"the record has %d fields, but the header row has %d", len(record), len(header))})
+			continue
+		}
+
+		rows = append(rows, &models.ImportRow{Row: row, User: &models.User{
+			FirstName: record[columns["first_name"]],
+			LastName:  record[columns["last_name"]],
+			Email:     record[columns["email"]],
+			Country:   record[columns["country"]],
+		}})
+	}
+}
+
+// csvColumnIndices maps each column of a CSV import to its index, requiring every column and no other
+func csvColumnIndices(header []string) (map[string]int, error) {
+
+	indices := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !isCSVColumn(name) {
+			return nil, fmt.Errorf("unknown column in header row: %s", name)
+		}
+		if _, ok := indices[name]; ok {
+			return nil, fmt.Errorf("repeated column in header row: %s", name)
+		}
+		indices[name] = i
+	}
+
+	for _, column := range csvColumns {
+		if _, ok := indices[column]; !ok {
+			return nil, fmt.Errorf("missing column in header row: %s", column)
+		}
+	}
+	return indices, nil
+}
+
+func isCSVColumn(name string) bool {
+
+	for _, column := range csvColumns {
+		if name == column {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/service"
+	"github.com/bpsaunders/user-api/validators"
+	"github.com/golang/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitImportUsers(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewImportUsersHandler(svc)
+
+	report := &service.ImportReport{Created: 1, Rows: []*service.ImportRowResult{{Row: 1, Status: "created", ID: "id"}}}
+
+	alice := &models.User{FirstName: "Alice", LastName: "Smith", Email: "alice@mail.com", Country: "GB"}
+
+	importRequest := func(contentType string, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/users:batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		return req
+	}
+
+	Convey("Given I import a JSON array of users", t, func() {
+
+		req := importRequest("application/json", `[{"first_name":"Alice","last_name":"Smith","email":"alice@mail.com","country":"GB"},"bob"]`)
+		res := httptest.NewRecorder()
+
+		var rows []*models.ImportRow
+		svc.EXPECT().ImportUsers(gomock.Any(), gomock.Any(), false).
+			DoAndReturn(func(_ interface{}, r []*models.ImportRow, _ bool) (service.ResponseType, *service.ImportReport, []validators.ValidationError, error) {
+				rows = r
+				return service.Success, report, nil, nil
+			})
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect each element to be a row, those which aren't users being malformed", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Body.String(), ShouldContainSubstring, `"status":"created"`)
+			So(len(rows), ShouldEqual, 2)
+			So(rows[0], ShouldResemble, &models.ImportRow{Row: 1, User: alice})
+			So(rows[1].Row, ShouldEqual, 2)
+			So(rows[1].User, ShouldBeNil)
+			So(rows[1].Malformed, ShouldNotBeEmpty)
+		})
+	})
+
+	Convey("Given I import newline delimited JSON all or nothing", t, func() {
+
+		req := importRequest("application/x-ndjson; charset=utf-8",
+			"{\"first_name\":\"Alice\",\"last_name\":\"Smith\",\"email\":\"alice@mail.com\",\"country\":\"GB\"}\n\n{broken\n")
+		req.URL.RawQuery = "all_or_nothing=true"
+		res := httptest.NewRecorder()
+
+		var rows []*models.ImportRow
+		svc.EXPECT().ImportUsers(gomock.Any(), gomock.Any(), true).
+			DoAndReturn(func(_ interface{}, r []*models.ImportRow, _ bool) (service.ResponseType, *service.ImportReport, []validators.ValidationError, error) {
+				rows = r
+				return service.Success, report, nil, nil
+			})
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect each non-blank line to be a row", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(len(rows), ShouldEqual, 2)
+			So(rows[0], ShouldResemble, &models.ImportRow{Row: 1, User: alice})
+			So(rows[1].Row, ShouldEqual, 2)
+			So(rows[1].Malformed, ShouldNotBeEmpty)
+		})
+	})
+
+	Convey("Given I import all or nothing but the database doesn't support transactions", t, func() {
+
+		req := importRequest("application/json", "[{\"first_name\":\"Alice\",\"last_name\":\"Smith\",\"email\":\"alice@mail.com\",\"country\":\"GB\"}]")
+		req.URL.RawQuery = "all_or_nothing=true"
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().ImportUsers(gomock.Any(), gomock.Any(), true).Return(service.AtomicImportUnsupported, nil, nil, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect the import to be refused as not implemented", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNotImplemented)
+			So(res.Body.String(), ShouldContainSubstring, "/problems/atomic-import-unsupported")
+		})
+	})
+
+	Convey("Given I import CSV with a header row", t, func() {
+
+		req := importRequest("text/csv", "email,first_name,last_name,country\nalice@mail.com,Alice,Smith,GB\nbob@mail.com,Bob\n")
+		res := httptest.NewRecorder()
+
+		var rows []*models.ImportRow
+		svc.EXPECT().ImportUsers(gomock.Any(), gomock.Any(), false).
+			DoAndReturn(func(_ interface{}, r []*models.ImportRow, _ bool) (service.ResponseType, *service.ImportReport, []validators.ValidationError, error) {
+				rows = r
+				return service.Success, report, nil, nil
+			})
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect each record to be a row, by the columns named in the header", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(len(rows), ShouldEqual, 2)
+			So(rows[0], ShouldResemble, &models.ImportRow{Row: 1, User: alice})
+			So(rows[1].Row, ShouldEqual, 2)
+			So(rows[1].Malformed, ShouldEqual, "the record has 2 fields, but the header row has 4")
+		})
+	})
+
+	Convey("Given I import CSV with an unknown column", t, func() {
+
+		req := importRequest("text/csv", "email,first_name,last_name,country,password\n")
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 400 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+
+	Convey("Given I import users in an unsupported media type", t, func() {
+
+		req := importRequest("application/xml", "<users/>")
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 415 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusUnsupportedMediaType)
+			So(res.Body.String(), ShouldContainSubstring, "/problems/unsupported-media-type")
+		})
+	})
+
+	Convey("Given I import a batch which is invalid as a whole", t, func() {
+
+		req := importRequest("application/json", `[]`)
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().ImportUsers(gomock.Any(), []*models.ImportRow{}, false).Return(service.InvalidData, nil, []validators.ValidationError{{}}, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 400 response with a body", func() {
+
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+			So(res.Body.Len(), ShouldBeGreaterThan, 0)
+		})
+	})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"github.com/bpsaunders/user-api/logging"
+	"github.com/hashicorp/go-uuid"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern restricts the request ids accepted from clients, so they're safe to echo in logs and headers
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestID returns the id by which a request may be traced, generating one if not supplied by the client
+func requestID(r *http.Request) string {
+
+	if id := r.Header.Get(requestIDHeader); requestIDPattern.MatchString(id) {
+		return id
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return ""
+	}
+	r.Header.Set(requestIDHeader, id)
+	return id
+}
+
+// loggingMiddleware assigns each request an id, returned in the X-Request-ID header, and injects a log entry
+// carrying it into the request context. An access log line is written once the request has been served
+func loggingMiddleware(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id := requestID(r)
+		w.Header().Set(requestIDHeader, id)
+
+		entry := log.WithField("request_id", id)
+		r = r.WithContext(logging.NewContext(r.Context(), entry))
+
+		start := time.Now()
+		recorder := newStatusRecorder(w)
+
+		next.ServeHTTP(recorder, r)
+
+		entry.WithFields(log.Fields{
+			"method":      r.Method,
+			"route":       routeTemplate(r),
+			"status":      recorder.status,
+			"bytes":       recorder.bytes,
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+			"remote_addr": r.RemoteAddr,
+		}).Info("request served")
+	})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"github.com/bpsaunders/user-api/logging"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitLoggingMiddleware(t *testing.T) {
+
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	router := mux.NewRouter()
+	router.NotFoundHandler = loggingMiddleware(http.HandlerFunc(routeNotFound))
+	router.Use(loggingMiddleware)
+	router.HandleFunc("/things/{thing_id}", func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("thing fetched")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("thing"))
+	})
+
+	Convey("Given I make a request with a request id", t, func() {
+
+		hook.Reset()
+
+		req := httptest.NewRequest(http.MethodGet, "/things/123", nil)
+		req.Header.Set(requestIDHeader, "abc-123")
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		Convey("Then I expect the request id to be returned", func() {
+
+			So(res.Header().Get(requestIDHeader), ShouldEqual, "abc-123")
+		})
+
+		Convey("Then I expect the handler's log lines to carry the request id", func() {
+
+			So(len(hook.AllEntries()), ShouldEqual, 2)
+			So(hook.AllEntries()[0].Message, ShouldEqual, "thing fetched")
+			So(hook.AllEntries()[0].Data["request_id"], ShouldEqual, "abc-123")
+		})
+
+		Convey("Then I expect a single access log line describing the request", func() {
+
+			access := hook.LastEntry()
+			So(access.Message, ShouldEqual, "request served")
+			So(access.Data["request_id"], ShouldEqual, "abc-123")
+			So(access.Data["method"], ShouldEqual, http.MethodGet)
+			So(access.Data["route"], ShouldEqual, "/things/{thing_id}")
+			So(access.Data["status"], ShouldEqual, http.StatusAccepted)
+			So(access.Data["bytes"], ShouldEqual, 5)
+			So(access.Data["remote_addr"], ShouldEqual, req.RemoteAddr)
+			So(access.Data["duration_ms"], ShouldBeGreaterThanOrEqualTo, 0)
+		})
+	})
+
+	Convey("Given I make a request with an unsafe request id", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/things/123", nil)
+		req.Header.Set(requestIDHeader, "abc\n123")
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		Convey("Then I expect a new request id to be generated in its place", func() {
+
+			So(res.Header().Get(requestIDHeader), ShouldNotBeEmpty)
+			So(res.Header().Get(requestIDHeader), ShouldNotEqual, "abc\n123")
+		})
+	})
+
+	Convey("Given I make a request to an unknown route", t, func() {
+
+		hook.Reset()
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+		Convey("Then I expect the request to be logged against the same request id as the problem", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNotFound)
+
+			access := hook.LastEntry()
+			So(access.Message, ShouldEqual, "request served")
+			So(access.Data["route"], ShouldEqual, "unmatched")
+			So(access.Data["status"], ShouldEqual, http.StatusNotFound)
+			So(access.Data["request_id"], ShouldEqual, res.Header().Get(requestIDHeader))
+		})
+	})
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"github.com/bpsaunders/user-api/metrics"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// statusRecorder captures the status and size of a response, for use by middleware
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Flush allows streamed responses to be flushed through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// routeTemplate returns the template of the route matching a request, e.g. /users/{user_id}, so that
+// metrics aren't partitioned by raw paths
+func routeTemplate(r *http.Request) string {
+
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
+// metricsMiddleware records the count, latency and concurrency of requests, by route template, method and status
+func metricsMiddleware(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		route := routeTemplate(r)
+
+		metrics.HTTPRequestsInFlight.Inc(route, r.Method)
+		defer metrics.HTTPRequestsInFlight.Dec(route, r.Method)
+
+		start := time.Now()
+		recorder := newStatusRecorder(w)
+
+		next.ServeHTTP(recorder, r)
+
+		status := strconv.Itoa(recorder.status)
+		metrics.HTTPRequests.Inc(route, r.Method, status)
+		metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds(), route, r.Method, status)
+	})
+}
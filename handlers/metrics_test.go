@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"github.com/bpsaunders/user-api/metrics"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitMetricsMiddleware(t *testing.T) {
+
+	router := mux.NewRouter()
+	router.Use(metricsMiddleware)
+	router.HandleFunc("/things/{thing_id}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.Handle("/metrics", metrics.Handler())
+
+	Convey("Given I make a request to a route with a path variable", t, func() {
+
+		before := metrics.HTTPRequests.Value("/things/{thing_id}", http.MethodGet, "418")
+
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/123", nil))
+
+		Convey("Then I expect the request to be counted against the route template and status", func() {
+
+			So(metrics.HTTPRequests.Value("/things/{thing_id}", http.MethodGet, "418"), ShouldEqual, before+1)
+			So(metrics.HTTPRequestDuration.Count("/things/{thing_id}", http.MethodGet, "418"), ShouldBeGreaterThan, 0)
+			So(metrics.HTTPRequestsInFlight.Value("/things/{thing_id}", http.MethodGet), ShouldEqual, 0)
+		})
+
+		Convey("Then I expect it to be scrapeable from the metrics endpoint", func() {
+
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Header().Get("Content-Type"), ShouldStartWith, "text/plain")
+			So(res.Body.String(), ShouldContainSubstring, `http_requests_total{route="/things/{thing_id}",method="GET",status="418"}`)
+			So(strings.Contains(res.Body.String(), "/things/123"), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,823 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bpsaunders/user-api/auth"
+	"github.com/bpsaunders/user-api/countries"
+	"github.com/bpsaunders/user-api/logging"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/service"
+	"github.com/bpsaunders/user-api/validators"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const openAPIVersion = "3.0.3"
+const mediaTypeYAML = "application/yaml"
+
+// apiObject is an object within the OpenAPI description
+type apiObject map[string]interface{}
+
+// apiOperation describes a single route of the api. Problems are named by type, and responses are added for each
+type apiOperation struct {
+	method     string
+	path       string
+	id         string
+	summary    string
+	scope      string
+	parameters []apiObject
+	body       apiObject
+	responses  apiObject
+	problems   []string
+}
+
+// handlerProblems describes the problems raised by the handlers themselves, rather than on behalf of the service
+var handlerProblems = map[string]problemDetail{
+	problemRouteNotFound:        {http.StatusNotFound, "No resource exists at the requested path"},
+	problemMethodNotAllowed:     {http.StatusMethodNotAllowed, "The requested method is not supported by the resource"},
+	problemUnauthenticated:      {http.StatusUnauthorized, "An API key or bearer token is required, and must be verifiable"},
+	problemInsufficientScope:    {http.StatusForbidden, "The credentials provided lack the scope required"},
+	problemNotAcceptable:        {http.StatusNotAcceptable, "The response can't be produced in any of the media types accepted"},
+	problemUnsupportedMediaType: {http.StatusUnsupportedMediaType, "The request body is in a media type which can't be consumed"},
+	problemRequestTooLarge:      {http.StatusRequestEntityTooLarge, "The request body is larger than accepted"},
+}
+
+// serviceProblems holds the problems which any route backed by the service may raise
+var serviceProblems = []string{service.Error.String(), service.Timeout.String(), service.Cancelled.String()}
+
+var openAPIOnce sync.Once
+var openAPIJSON, openAPIYAML []byte
+var openAPIErr error
+
+// getOpenAPIJSON serves the OpenAPI description of the api as JSON
+func getOpenAPIJSON(w http.ResponseWriter, r *http.Request) {
+	writeOpenAPI(w, r, mediaTypeJSON)
+}
+
+// getOpenAPIYAML serves the OpenAPI description of the api as YAML
+func getOpenAPIYAML(w http.ResponseWriter, r *http.Request) {
+	writeOpenAPI(w, r, mediaTypeYAML)
+}
+
+// writeOpenAPI serves the OpenAPI description, which is rendered once upon first request as it never changes
+func writeOpenAPI(w http.ResponseWriter, r *http.Request, mediaType string) {
+
+	logger := logging.FromContext(r.Context())
+
+	openAPIOnce.Do(func() {
+		document := openAPIDocument()
+		if openAPIJSON, openAPIErr = json.MarshalIndent(document, "", "  "); openAPIErr != nil {
+			return
+		}
+		openAPIYAML, openAPIErr = marshalYAML(document)
+	})
+	if openAPIErr != nil {
+		logger.Error(fmt.Sprintf("Failed to render the OpenAPI description: %v", openAPIErr))
+		writeProblem(w, r, service.Error, "", nil, openAPIErr)
+		return
+	}
+
+	body := openAPIJSON
+	if mediaType == mediaTypeYAML {
+		body = openAPIYAML
+	}
+
+	logger.Info("OpenAPI description fetched successfully")
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		logger.Error(fmt.Sprintf("Error writing response: %v", err))
+	}
+}
+
+// openAPIDocument describes every route of the api, with the shapes of users and problems, and the rules by which
+// users are validated
+func openAPIDocument() apiObject {
+
+	paths := apiObject{}
+	for _, operation := range apiOperations() {
+		item, ok := paths[operation.path].(apiObject)
+		if !ok {
+			item = apiObject{}
+			paths[operation.path] = item
+		}
+		item[strings.ToLower(operation.method)] = operation.describe()
+	}
+
+	return apiObject{
+		"openapi": openAPIVersion,
+		"info": apiObject{
+			"title":       "user-api",
+			"description": "An API offering functionality with which to create and fetch users' data.",
+			"version":     "1.0.0",
+		},
+		"paths": paths,
+		"components": apiObject{
+			"schemas":    apiSchemas(),
+			"parameters": apiParameters(),
+			"responses":  apiProblemResponses(),
+			"securitySchemes": apiObject{
+				"apiKey": apiObject{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        auth.APIKeyHeader,
+					"description": "A static API key, granted the scopes it was configured with",
+				},
+				"bearerAuth": apiObject{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+					"description":  "A JWT, granted the scopes in its scope or scp claims",
+				},
+			},
+		},
+	}
+}
+
+// describe renders an operation, adding the responses for its problems and, where authenticated, its security
+func (o apiOperation) describe() apiObject {
+
+	responses := apiObject{}
+	for status, response := range o.responses {
+		responses[status] = response
+	}
+
+	problems := o.problems
+	if o.scope != "" {
+		problems = append([]string{problemUnauthenticated, problemInsufficientScope}, problems...)
+	}
+	for _, problemType := range problems {
+		status := strconv.Itoa(apiProblems()[problemType].status)
+		if _, ok := responses[status]; !ok {
+			responses[status] = ref("responses", problemType)
+		}
+	}
+
+	operation := apiObject{
+		"operationId": o.id,
+		"summary":     o.summary,
+		"responses":   responses,
+	}
+	if len(o.parameters) > 0 {
+		operation["parameters"] = o.parameters
+	}
+	if o.body != nil {
+		operation["requestBody"] = o.body
+	}
+	if o.scope != "" {
+		operation["security"] = []apiObject{{"apiKey": []string{}}, {"bearerAuth": []string{}}}
+		operation["x-required-scope"] = o.scope
+		operation["description"] = fmt.Sprintf("Requires the %s scope.", o.scope)
+	} else {
+		operation["security"] = []apiObject{}
+	}
+	return operation
+}
+
+// apiOperations describes every route registered by Register
+func apiOperations() []apiOperation {
+
+	userID := ref("parameters", "user_id")
+	limit := ref("parameters", "limit")
+	cursor := ref("parameters", "cursor")
+	filters := []apiObject{ref("parameters", "country"), ref("parameters", "email_domain"), ref("parameters", "name_prefix")}
+
+	userBody := apiObject{"required": true, "content": jsonContent(ref("schemas", "User"))}
+
+	userResponse := func(description string) apiObject {
+		return apiObject{
+			"description": description,
+			"headers":     apiObject{"ETag": apiObject{"description": "The version of the user", "schema": apiObject{"type": "string"}}},
+			"content":     jsonContent(ref("schemas", "User")),
+		}
+	}
+
+	health := apiObject{"description": "The application is healthy", "content": jsonContent(ref("schemas", "Health"))}
+
+	return []apiOperation{
+		{
+			method: http.MethodGet, path: "/health/live", id: "getLiveness",
+			summary:   "Report whether the application is running",
+			responses: apiObject{"200": health},
+		},
+		{
+			method: http.MethodGet, path: "/health/ready", id: "getReadiness",
+			summary: "Report whether the application can serve traffic, with the status of each component",
+			responses: apiObject{
+				"200": health,
+				"503": apiObject{"description": "A component is down, or the application is draining", "content": jsonContent(ref("schemas", "Health"))},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/health-check", id: "getHealthCheck",
+			summary:   "Report whether the application is running; an alias of /health/live for existing consumers",
+			responses: apiObject{"200": health},
+		},
+		{
+			method: http.MethodGet, path: "/metrics", id: "getMetrics",
+			summary: "Fetch metrics in the Prometheus text exposition format",
+			responses: apiObject{"200": apiObject{
+				"description": "The current metrics",
+				"content":     apiObject{"text/plain": apiObject{"schema": apiObject{"type": "string"}}},
+			}},
+		},
+		{
+			method: http.MethodGet, path: "/countries", id: "getCountries",
+			summary: "Fetch every ISO 3166-1 country a user may belong to",
+			responses: apiObject{"200": apiObject{
+				"description": "Every country, ordered by alpha-2 code",
+				"content":     jsonContent(apiObject{"type": "array", "items": ref("schemas", "Country")}),
+			}},
+		},
+		{
+			method: http.MethodGet, path: "/openapi.json", id: "getOpenAPIJSON",
+			summary: "Fetch this description of the api as JSON",
+			responses: apiObject{"200": apiObject{
+				"description": "The OpenAPI description",
+				"content":     jsonContent(apiObject{"type": "object"}),
+			}},
+		},
+		{
+			method: http.MethodGet, path: "/openapi.yaml", id: "getOpenAPIYAML",
+			summary: "Fetch this description of the api as YAML",
+			responses: apiObject{"200": apiObject{
+				"description": "The OpenAPI description",
+				"content":     apiObject{mediaTypeYAML: apiObject{"schema": apiObject{"type": "string"}}},
+			}},
+		},
+		{
+			method: http.MethodPost, path: "/users", id: "createUser", scope: auth.ScopeUsersWrite,
+			summary:    "Create a user",
+			parameters: []apiObject{ref("parameters", idempotencyKeyHeader)},
+			body:       userBody,
+			responses: apiObject{"201": apiObject{
+				"description": "The user was created",
+				"headers": apiObject{
+					"Location": apiObject{"description": "The location of the user", "schema": apiObject{"type": "string"}},
+					"ETag":     apiObject{"description": "The version of the user", "schema": apiObject{"type": "string"}},
+					idempotentReplayedHeader: apiObject{
+						"description": "Whether the response was replayed from an earlier request with the same Idempotency-Key",
+						"schema":      apiObject{"type": "boolean"},
+					},
+				},
+				"content": jsonContent(ref("schemas", "User")),
+			}},
+			problems: append([]string{
+				service.InvalidData.String(),
+				service.Conflict.String(),
+				service.IdempotencyKeyInUse.String(),
+				service.IdempotencyKeyReused.String(),
+				problemRequestTooLarge,
+			}, serviceProblems...),
+		},
+		{
+			method: http.MethodGet, path: "/users", id: "listUsers", scope: auth.ScopeUsersRead,
+			summary: "Fetch a page of users, optionally filtered and sorted, or the user with an email",
+			parameters: append([]apiObject{limit, cursor, ref("parameters", "sort")}, append(filters, apiObject{
+				"name": "include_total", "in": "query",
+				"description": "Whether to count every user matching the filters",
+				"schema":      apiObject{"type": "boolean", "default": false},
+			}, apiObject{
+				"name": "email", "in": "query",
+				"description": "Only the user with exactly this email, regardless of case, in place of every other parameter",
+				"schema":      apiObject{"type": "string"},
+			})...),
+			responses: apiObject{"200": apiObject{"description": "A page of users", "content": jsonContent(ref("schemas", "UserList"))}},
+			problems:  append([]string{service.InvalidData.String()}, serviceProblems...),
+		},
+		{
+			method: http.MethodPost, path: "/users:batch", id: "importUsers", scope: auth.ScopeUsersWrite,
+			summary: "Create a batch of users, reporting the outcome of each row",
+			parameters: []apiObject{{
+				"name": "all_or_nothing", "in": "query",
+				"description": "Whether to create no users at all unless every row can be created, which requires MongoDB to be deployed as a replica set",
+				"schema":      apiObject{"type": "boolean", "default": false},
+			}},
+			body: apiObject{"required": true, "content": apiObject{
+				mediaTypeJSON: apiObject{"schema": apiObject{
+					"type": "array", "items": ref("schemas", "User"), "minItems": 1, "maxItems": validators.MaxImportRows,
+				}},
+				mediaTypeNDJSON: apiObject{"schema": apiObject{
+					"type": "string", "description": "A user on each line; blank lines are ignored",
+				}},
+				mediaTypeCSV: apiObject{"schema": apiObject{
+					"type":        "string",
+					"description": "A header row naming the columns in any order, then a user on each row. The columns are: " + strings.Join(csvColumns, ", "),
+				}},
+			}},
+			responses: apiObject{"200": apiObject{"description": "The outcome of each row", "content": jsonContent(ref("schemas", "ImportReport"))}},
+			problems:  append([]string{service.InvalidData.String(), problemUnsupportedMediaType, problemRequestTooLarge, service.AtomicImportUnsupported.String()}, serviceProblems...),
+		},
+		{
+			method: http.MethodGet, path: "/users/export", id: "exportUsers", scope: auth.ScopeUsersRead,
+			summary:    "Stream every user matching the filters, in the media type negotiated by the Accept header",
+			parameters: filters,
+			responses: apiObject{"200": apiObject{"description": "Every matching user", "content": apiObject{
+				mediaTypeNDJSON: apiObject{"schema": apiObject{"type": "string", "description": "A user on each line"}},
+				mediaTypeCSV: apiObject{"schema": apiObject{
+					"type":        "string",
+					"description": "A header row, then a user on each row. The columns are: " + strings.Join(exportColumns, ", "),
+				}},
+			}}},
+			problems: append([]string{problemNotAcceptable}, serviceProblems...),
+		},
+		{
+			method: http.MethodGet, path: "/users/search", id: "searchUsers", scope: auth.ScopeUsersRead,
+			summary: "Search users by the words of their names and email, and prefixes of them, most relevant first",
+			parameters: []apiObject{{
+				"name": "q", "in": "query", "required": true,
+				"description": "The words to search by; a user holding a whole word ranks above one holding a word starting with it",
+				"schema":      apiObject{"type": "string", "maxLength": validators.SearchMaxLength},
+			}, limit},
+			responses: apiObject{"200": apiObject{"description": "The most relevant users", "content": jsonContent(ref("schemas", "UserList"))}},
+			problems:  append([]string{service.InvalidData.String()}, serviceProblems...),
+		},
+		{
+			method: http.MethodGet, path: "/users/stats", id: "getUserStats", scope: auth.ScopeUsersRead,
+			summary: "Count the users matching the filters by country, by email domain and by the interval in which they signed up",
+			parameters: []apiObject{
+				ref("parameters", "country"),
+				ref("parameters", "email_domain"),
+				{
+					"name": "from", "in": "query",
+					"description": "Only users created on or after this day, in UTC",
+					"schema":      apiObject{"type": "string", "format": "date"},
+				},
+				{
+					"name": "to", "in": "query",
+					"description": "Only users created on or before this day, in UTC",
+					"schema":      apiObject{"type": "string", "format": "date"},
+				},
+				{
+					"name": "interval", "in": "query",
+					"description": "The interval by which to count signups; weeks start on Monday",
+					"schema":      apiObject{"type": "string", "enum": models.StatsIntervals, "default": service.DefaultStatsInterval},
+				},
+				{
+					"name": "top", "in": "query",
+					"description": "The number of email domains to count, those with the most users",
+					"schema":      apiObject{"type": "integer", "minimum": 1, "maximum": validators.MaxStatsTop, "default": service.DefaultStatsTop},
+				},
+			},
+			responses: apiObject{"200": apiObject{"description": "The counts of users", "content": jsonContent(ref("schemas", "UserStats"))}},
+			problems:  append([]string{service.InvalidData.String()}, serviceProblems...),
+		},
+		{
+			method: http.MethodGet, path: "/users/{user_id}", id: "getUser", scope: auth.ScopeUsersRead,
+			summary:    "Fetch a user",
+			parameters: []apiObject{userID, ref("parameters", "If-None-Match")},
+			responses: apiObject{
+				"200": userResponse("The user"),
+				"304": apiObject{"description": "The user matches the version given in If-None-Match"},
+			},
+			problems: append([]string{service.NotFound.String()}, serviceProblems...),
+		},
+		{
+			method: http.MethodPut, path: "/users/{user_id}", id: "updateUser", scope: auth.ScopeUsersWrite,
+			summary:    "Replace a user",
+			parameters: []apiObject{userID, ref("parameters", "If-Match")},
+			body:       userBody,
+			responses:  apiObject{"200": userResponse("The updated user")},
+			problems: append([]string{service.InvalidData.String(), service.NotFound.String(), service.Conflict.String(),
+				service.PreconditionFailed.String(), problemRequestTooLarge}, serviceProblems...),
+		},
+		{
+			method: http.MethodPatch, path: "/users/{user_id}", id: "patchUser", scope: auth.ScopeUsersWrite,
+			summary:    "Change some fields of a user",
+			parameters: []apiObject{userID, ref("parameters", "If-Match")},
+			body: apiObject{"required": true, "content": apiObject{
+				"application/merge-patch+json": apiObject{"schema": ref("schemas", "UserPatch")},
+				mediaTypeJSON:                  apiObject{"schema": ref("schemas", "UserPatch")},
+			}},
+			responses: apiObject{"200": userResponse("The patched user")},
+			problems: append([]string{service.InvalidData.String(), service.NotFound.String(), service.Conflict.String(),
+				service.PreconditionFailed.String(), problemRequestTooLarge}, serviceProblems...),
+		},
+		{
+			method: http.MethodDelete, path: "/users/{user_id}", id: "deleteUser", scope: auth.ScopeUsersWrite,
+			summary:    "Delete a user, which may be restored until it's purged",
+			parameters: []apiObject{userID, ref("parameters", "If-Match")},
+			responses:  apiObject{"204": apiObject{"description": "The user was deleted"}},
+			problems:   append([]string{service.NotFound.String(), service.PreconditionFailed.String()}, serviceProblems...),
+		},
+		{
+			method: http.MethodPost, path: "/users/{user_id}:restore", id: "restoreUser", scope: auth.ScopeUsersWrite,
+			summary:    "Restore a deleted user, which has no effect on a user which isn't deleted",
+			parameters: []apiObject{userID},
+			responses: apiObject{"200": apiObject{
+				"description": "The user was restored",
+				"headers":     apiObject{"ETag": apiObject{"description": "The version of the user", "schema": apiObject{"type": "string"}}},
+				"content":     jsonContent(ref("schemas", "User")),
+			}},
+			problems: append([]string{service.NotFound.String(), service.Conflict.String()}, serviceProblems...),
+		},
+		{
+			method: http.MethodPost, path: "/users/{user_id}:erase", id: "eraseUser", scope: auth.ScopeUsersErase,
+			summary: "Irreversibly erase a user, deleted or not, replacing its names and email with a tombstone throughout",
+			parameters: []apiObject{userID, {
+				"name": "block_reregistration", "in": "query",
+				"description": "Whether the email of the user may never be registered again; ignored once the user is erased",
+				"schema":      apiObject{"type": "boolean", "default": false},
+			}},
+			responses: apiObject{"200": apiObject{
+				"description": "The user was erased, now or before, as the signed receipt describes",
+				"content":     jsonContent(ref("schemas", "ErasureReceipt")),
+			}},
+			problems: append([]string{service.InvalidData.String(), service.NotFound.String(), service.Conflict.String()}, serviceProblems...),
+		},
+		{
+			method: http.MethodGet, path: "/users/{user_id}/history", id: "getUserHistory", scope: auth.ScopeUsersRead,
+			summary:    "Fetch a page of the mutations of a user, most recent first",
+			parameters: []apiObject{userID, limit, cursor},
+			responses:  apiObject{"200": apiObject{"description": "A page of the history of the user", "content": jsonContent(ref("schemas", "AuditEventList"))}},
+			problems:   append([]string{service.InvalidData.String(), service.NotFound.String()}, serviceProblems...),
+		},
+		{
+			method: http.MethodGet, path: "/users/{user_id}/data-export", id: "exportUserData", scope: auth.ScopeUsersExport,
+			summary:    "Fetch everything held about a user, deleted or not, in the media type negotiated by the Accept header",
+			parameters: []apiObject{userID},
+			responses: apiObject{"200": apiObject{"description": "Everything held about the user", "content": apiObject{
+				mediaTypeJSON: apiObject{"schema": ref("schemas", "DataExport")},
+				mediaTypeZip: apiObject{"schema": apiObject{
+					"type": "string", "format": "binary", "description": "A zip archive holding the export as JSON, in " + dataExportFile,
+				}},
+			}}},
+			problems: append([]string{service.NotFound.String(), problemNotAcceptable}, serviceProblems...),
+		},
+		{
+			method: http.MethodGet, path: "/admin/log-level", id: "getLogLevel", scope: auth.ScopeAdmin,
+			summary:   "Fetch the level at which the application logs",
+			responses: apiObject{"200": apiObject{"description": "The current log level", "content": jsonContent(ref("schemas", "LogLevel"))}},
+		},
+		{
+			method: http.MethodPut, path: "/admin/log-level", id: "putLogLevel", scope: auth.ScopeAdmin,
+			summary:   "Change the level at which the application logs, until next changed or restarted",
+			body:      apiObject{"required": true, "content": jsonContent(ref("schemas", "LogLevel"))},
+			responses: apiObject{"200": apiObject{"description": "The new log level", "content": jsonContent(ref("schemas", "LogLevel"))}},
+			problems:  []string{service.InvalidData.String(), problemRequestTooLarge},
+		},
+	}
+}
+
+// apiSchemas describes users, and every other shape the api reads or writes
+func apiSchemas() apiObject {
+
+	name := func(description string) apiObject {
+		return apiObject{
+			"type":        "string",
+			"description": description,
+			"minLength":   validators.NameMinLength,
+			"maxLength":   validators.NameMaxLength,
+			"pattern":     validators.NamePattern,
+		}
+	}
+	email := apiObject{
+		"type":        "string",
+		"description": "The email of the user, unique regardless of case",
+		"maxLength":   validators.EmailMaxLength,
+		"pattern":     validators.EmailPattern,
+	}
+	country := apiObject{
+		"type":        "string",
+		"description": "An ISO 3166-1 alpha-2, alpha-3 or numeric country code, regardless of case, stored as alpha-2",
+		"enum":        countryCodes(),
+	}
+	timestamp := func(description string) apiObject {
+		return apiObject{"type": "string", "format": "date-time", "readOnly": true, "description": description}
+	}
+	readOnly := func(description string) apiObject {
+		return apiObject{"type": "string", "readOnly": true, "description": description}
+	}
+	nullable := func(description string) apiObject {
+		return apiObject{"type": "string", "nullable": true, "description": description}
+	}
+
+	return apiObject{
+		"User": apiObject{
+			"type":     "object",
+			"required": []string{"first_name", "last_name", "email", "country"},
+			"properties": apiObject{
+				"id":         readOnly("The id of the user, set by the api"),
+				"first_name": name("The first name of the user"),
+				"last_name":  name("The last name of the user"),
+				"email":      email,
+				"country":    country,
+				"created_at": timestamp("When the user was created"),
+				"updated_at": timestamp("When the user was last changed"),
+				"links":      ref("schemas", "Links"),
+			},
+		},
+		"UserPatch": apiObject{
+			"type":        "object",
+			"description": "A JSON merge patch of a user (RFC 7396); fields omitted are left unchanged",
+			"properties": apiObject{
+				"first_name": name("The first name of the user"),
+				"last_name":  name("The last name of the user"),
+				"email":      email,
+				"country":    country,
+			},
+		},
+		"Links": apiObject{
+			"type":       "object",
+			"readOnly":   true,
+			"properties": apiObject{"self": readOnly("The location of the resource")},
+		},
+		"UserList": apiObject{
+			"type":     "object",
+			"required": []string{"items"},
+			"properties": apiObject{
+				"items":       apiObject{"type": "array", "items": ref("schemas", "User")},
+				"next_cursor": apiObject{"type": "string", "description": "The cursor of the next page, absent on the last page"},
+				"total_count": apiObject{"type": "integer", "format": "int64", "description": "The number of users matching the filters, when requested"},
+			},
+		},
+		"AuditEvent": apiObject{
+			"type": "object",
+			"properties": apiObject{
+				"id":        apiObject{"type": "string"},
+				"user_id":   apiObject{"type": "string"},
+				"actor":     apiObject{"type": "string", "description": "The subject of the principal which made the change"},
+				"operation": apiObject{"type": "string", "enum": []string{"create", "update", "patch", "delete", "restore", "erase"}},
+				"timestamp": apiObject{"type": "string", "format": "date-time"},
+				"changes":   apiObject{"type": "array", "items": ref("schemas", "FieldChange")},
+			},
+		},
+		"FieldChange": apiObject{
+			"type": "object",
+			"properties": apiObject{
+				"field":  apiObject{"type": "string"},
+				"before": nullable("The value before the change, null where the user didn't exist"),
+				"after":  nullable("The value after the change, null where the user no longer exists"),
+			},
+		},
+		"AuditEventList": apiObject{
+			"type":     "object",
+			"required": []string{"items"},
+			"properties": apiObject{
+				"items":       apiObject{"type": "array", "items": ref("schemas", "AuditEvent")},
+				"next_cursor": apiObject{"type": "string", "description": "The cursor of the next page, absent on the last page"},
+			},
+		},
+		"DataExport": apiObject{
+			"type": "object",
+			"properties": apiObject{
+				"exported_at": apiObject{"type": "string", "format": "date-time"},
+				"user":        ref("schemas", "UserRecord"),
+				"history":     apiObject{"type": "array", "items": ref("schemas", "AuditEvent"), "description": "Every mutation of the user, most recent first"},
+				"idempotent_requests": apiObject{
+					"type": "array", "description": "The requests with an idempotency key which created the user, oldest first",
+					"items": ref("schemas", "IdempotentRequest"),
+				},
+			},
+		},
+		"IdempotentRequest": apiObject{
+			"type": "object",
+			"properties": apiObject{
+				"created_at": apiObject{"type": "string", "format": "date-time"},
+				"response":   apiObject{"type": "object", "description": "The response held to replay to retries of the request until its key expires"},
+			},
+		},
+		"UserRecord": apiObject{
+			"type":        "object",
+			"description": "A user exactly as stored",
+			"properties": apiObject{
+				"id":         apiObject{"type": "string"},
+				"first_name": apiObject{"type": "string"},
+				"last_name":  apiObject{"type": "string"},
+				"email":      apiObject{"type": "string"},
+				"country":    apiObject{"type": "string"},
+				"created_at": apiObject{"type": "string", "format": "date-time"},
+				"updated_at": apiObject{"type": "string", "format": "date-time"},
+				"version":    apiObject{"type": "integer", "format": "int64"},
+				"deleted_at": apiObject{"type": "string", "format": "date-time", "description": "When the user was deleted, absent unless it has been"},
+			},
+		},
+		"ErasureReceipt": apiObject{
+			"type": "object",
+			"properties": apiObject{
+				"user_id":                apiObject{"type": "string"},
+				"actor":                  apiObject{"type": "string", "description": "The subject of the principal which erased the user"},
+				"erased_at":              apiObject{"type": "string", "format": "date-time"},
+				"tombstone":              apiObject{"type": "string", "description": "The keyed hash of the email which replaced the names and email of the user"},
+				"reregistration_blocked": apiObject{"type": "boolean", "description": "Whether the email may never be registered again"},
+				"signature_algorithm":    apiObject{"type": "string", "enum": []string{"HMAC-SHA256"}},
+				"signature":              apiObject{"type": "string", "description": "The signature of every other field, by the api"},
+			},
+		},
+		"ImportReport": apiObject{
+			"type": "object",
+			"properties": apiObject{
+				"all_or_nothing": apiObject{"type": "boolean"},
+				"created":        apiObject{"type": "integer"},
+				"failed":         apiObject{"type": "integer"},
+				"rows":           apiObject{"type": "array", "items": ref("schemas", "ImportRowResult")},
+			},
+		},
+		"ImportRowResult": apiObject{
+			"type": "object",
+			"properties": apiObject{
+				"row":    apiObject{"type": "integer", "description": "The number of the row, from 1 in the order submitted"},
+				"status": apiObject{"type": "string", "enum": []string{"created", "malformed", "invalid", "duplicate", "skipped", "failed"}},
+				"id":     apiObject{"type": "string", "description": "The id of the user, where created"},
+				"detail": apiObject{"type": "string", "description": "Why the row wasn't created"},
+				"errors": apiObject{"type": "array", "items": ref("schemas", "ValidationError")},
+			},
+		},
+		"UserStats": apiObject{
+			"type": "object",
+			"properties": apiObject{
+				"total": apiObject{"type": "integer", "format": "int64"},
+				"countries": apiObject{"type": "array", "description": "Most users first", "items": apiObject{
+					"type": "object",
+					"properties": apiObject{
+						"country": apiObject{"type": "string"},
+						"count":   apiObject{"type": "integer", "format": "int64"},
+					},
+				}},
+				"email_domains": apiObject{"type": "array", "description": "The domains with the most users, most first", "items": apiObject{
+					"type": "object",
+					"properties": apiObject{
+						"domain": apiObject{"type": "string"},
+						"count":  apiObject{"type": "integer", "format": "int64"},
+					},
+				}},
+				"interval": apiObject{"type": "string", "enum": models.StatsIntervals},
+				"signups": apiObject{"type": "array", "description": "In order of time, omitting intervals without signups", "items": apiObject{
+					"type": "object",
+					"properties": apiObject{
+						"start": apiObject{"type": "string", "format": "date-time", "description": "The start of the interval, in UTC"},
+						"count": apiObject{"type": "integer", "format": "int64"},
+					},
+				}},
+				"generated_at": apiObject{"type": "string", "format": "date-time", "description": "When the counts were made, which may be a little while ago"},
+			},
+		},
+		"Country": apiObject{
+			"type": "object",
+			"properties": apiObject{
+				"alpha_2": apiObject{"type": "string"},
+				"alpha_3": apiObject{"type": "string"},
+				"numeric": apiObject{"type": "string"},
+				"name":    apiObject{"type": "string"},
+			},
+		},
+		"Health": apiObject{
+			"type": "object",
+			"properties": apiObject{
+				"status":     apiObject{"type": "string", "enum": []string{healthStatusUp, healthStatusDown, healthStatusDraining}},
+				"components": apiObject{"type": "object", "additionalProperties": ref("schemas", "ComponentHealth")},
+			},
+		},
+		"ComponentHealth": apiObject{
+			"type": "object",
+			"properties": apiObject{
+				"status":     apiObject{"type": "string", "enum": []string{healthStatusUp, healthStatusDown}},
+				"latency_ms": apiObject{"type": "number"},
+				"error":      apiObject{"type": "string"},
+			},
+		},
+		"LogLevel": apiObject{
+			"type":       "object",
+			"required":   []string{"level"},
+			"properties": apiObject{"level": apiObject{"type": "string", "enum": logging.Levels()}},
+		},
+		"Problem": apiObject{
+			"type":        "object",
+			"description": "An error response, following RFC 7807",
+			"required":    []string{"type", "title", "status"},
+			"properties": apiObject{
+				"type":       apiObject{"type": "string", "enum": problemTypes()},
+				"title":      apiObject{"type": "string"},
+				"status":     apiObject{"type": "integer"},
+				"detail":     apiObject{"type": "string"},
+				"instance":   apiObject{"type": "string", "description": "The path requested"},
+				"request_id": apiObject{"type": "string"},
+				"errors":     apiObject{"type": "array", "items": ref("schemas", "ValidationError")},
+			},
+		},
+		"ValidationError": apiObject{
+			"type":     "object",
+			"required": []string{"field", "error"},
+			"properties": apiObject{
+				"field":  apiObject{"type": "string", "description": "A JSON path into the body, or the name of a query parameter"},
+				"error":  apiObject{"type": "string", "enum": validators.ErrorCodes},
+				"params": apiObject{"type": "object", "description": "The bounds or allowed values which weren't met"},
+			},
+		},
+	}
+}
+
+// apiParameters describes the parameters shared between routes
+func apiParameters() apiObject {
+
+	sortField := "-?(" + strings.Join(validators.SortableFields, "|") + ")"
+	sortDescription := fmt.Sprintf("Fields to sort by, comma separated, each descending where prefixed with '-'. "+
+		"Sorting by names or email is refused where more than %d users match", service.MaxPersonalSortUsers)
+
+	return apiObject{
+		"user_id": apiObject{"name": "user_id", "in": "path", "required": true, "schema": apiObject{"type": "string"}},
+		"limit": apiObject{
+			"name": "limit", "in": "query",
+			"schema": apiObject{"type": "integer", "minimum": 1, "maximum": validators.MaxListLimit, "default": service.DefaultListLimit},
+		},
+		"cursor": apiObject{
+			"name": "cursor", "in": "query",
+			"description": "The next_cursor of the previous page, requested with the same sort",
+			"schema":      apiObject{"type": "string"},
+		},
+		"sort": apiObject{
+			"name": "sort", "in": "query",
+			"description": sortDescription,
+			"schema":      apiObject{"type": "string", "pattern": "^" + sortField + "(," + sortField + ")*$"},
+		},
+		"country": apiObject{
+			"name": "country", "in": "query",
+			"description": "Only users in the country with this code",
+			"schema":      apiObject{"type": "string"},
+		},
+		"email_domain": apiObject{
+			"name": "email_domain", "in": "query",
+			"description": "Only users whose email is at this domain",
+			"schema":      apiObject{"type": "string"},
+		},
+		"name_prefix": apiObject{
+			"name": "name_prefix", "in": "query",
+			"description": "Only users whose first or last name starts with this, regardless of case",
+			"schema":      apiObject{"type": "string"},
+		},
+		"If-Match": apiObject{
+			"name": "If-Match", "in": "header",
+			"description": "Only make the change if the user is still at this version",
+			"schema":      apiObject{"type": "string"},
+		},
+		idempotencyKeyHeader: apiObject{
+			"name": idempotencyKeyHeader, "in": "header",
+			"description": "A unique key for the request, so that retries of it are answered with the original response for 24 hours",
+			"schema":      apiObject{"type": "string", "maxLength": idempotencyKeyMaxLength, "pattern": "^[!-~]*$"},
+		},
+		"If-None-Match": apiObject{
+			"name": "If-None-Match", "in": "header",
+			"description": "Respond 304 rather than with the user, if it's still at this version",
+			"schema":      apiObject{"type": "string"},
+		},
+	}
+}
+
+// apiProblemResponses describes a response for every type of problem
+func apiProblemResponses() apiObject {
+
+	responses := apiObject{}
+	for problemType, pd := range apiProblems() {
+		responses[problemType] = apiObject{
+			"description": pd.detail,
+			"content":     apiObject{problemContentType: apiObject{"schema": ref("schemas", "Problem")}},
+		}
+	}
+	return responses
+}
+
+// apiProblems describes every type of problem, whether raised on behalf of the service or by the handlers
+func apiProblems() map[string]problemDetail {
+
+	problems := make(map[string]problemDetail, len(problemDetails)+len(handlerProblems))
+	for responseType, pd := range problemDetails {
+		problems[responseType.String()] = pd
+	}
+	for problemType, pd := range handlerProblems {
+		problems[problemType] = pd
+	}
+	return problems
+}
+
+func problemTypes() []string {
+
+	types := make([]string, 0)
+	for problemType := range apiProblems() {
+		types = append(types, problemTypePrefix+problemType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// countryCodes returns every code by which a country may be given
+func countryCodes() []string {
+
+	codes := make([]string, 0)
+	for _, country := range countries.All() {
+		codes = append(codes, country.Alpha2, country.Alpha3, country.Numeric)
+	}
+	return codes
+}
+
+func ref(component string, name string) apiObject {
+	return apiObject{"$ref": "#/components/" + component + "/" + name}
+}
+
+func jsonContent(schema apiObject) apiObject {
+	return apiObject{mediaTypeJSON: apiObject{"schema": schema}}
+}
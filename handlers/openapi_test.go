@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/bpsaunders/user-api/auth"
+	"github.com/bpsaunders/user-api/service"
+	"github.com/bpsaunders/user-api/validators"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitOpenAPIDescribesEveryRoute(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	router := mux.NewRouter()
+	Register(router, service.NewMockUserService(mockCtrl), auth.NewMockAuthenticator(mockCtrl))
+
+	paths := openAPIDocument()["paths"].(apiObject)
+
+	Convey("Given every route registered", t, func() {
+
+		registered := make(map[string]bool)
+		err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+
+			path, err := route.GetPathTemplate()
+			if err != nil {
+				return err
+			}
+			methods, err := route.GetMethods()
+			if err != nil {
+				// routes matching any method are described by their GET
+				methods = []string{http.MethodGet}
+			}
+
+			for _, method := range methods {
+				registered[method+" "+path] = true
+			}
+			return nil
+		})
+		So(err, ShouldBeNil)
+
+		Convey("Then I expect each to be described", func() {
+
+			for route := range registered {
+				parts := strings.SplitN(route, " ", 2)
+				item, ok := paths[parts[1]].(apiObject)
+				So(ok, ShouldBeTrue)
+				So(item, ShouldContainKey, strings.ToLower(parts[0]))
+			}
+		})
+
+		Convey("Then I expect nothing to be described which isn't registered", func() {
+
+			for path, item := range paths {
+				for method := range item.(apiObject) {
+					So(registered, ShouldContainKey, strings.ToUpper(method)+" "+path)
+				}
+			}
+		})
+	})
+}
+
+func TestUnitOpenAPI(t *testing.T) {
+
+	Convey("Given I fetch the OpenAPI description as JSON", t, func() {
+
+		res := httptest.NewRecorder()
+		getOpenAPIJSON(res, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+		Convey("Then I expect the user schema to carry the rules by which users are validated", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Header().Get("Content-Type"), ShouldEqual, "application/json")
+
+			var document struct {
+				OpenAPI    string `json:"openapi"`
+				Components struct {
+					Schemas map[string]struct {
+						Properties map[string]struct {
+							MaxLength int      `json:"maxLength"`
+							Pattern   string   `json:"pattern"`
+							Enum      []string `json:"enum"`
+						} `json:"properties"`
+					} `json:"schemas"`
+				} `json:"components"`
+			}
+			So(json.Unmarshal(res.Body.Bytes(), &document), ShouldBeNil)
+			So(document.OpenAPI, ShouldEqual, openAPIVersion)
+
+			user := document.Components.Schemas["User"].Properties
+			So(user["first_name"].MaxLength, ShouldEqual, validators.NameMaxLength)
+			So(user["first_name"].Pattern, ShouldEqual, validators.NamePattern)
+			So(user["email"].Pattern, ShouldEqual, validators.EmailPattern)
+			So(user["country"].Enum, ShouldContain, "GB")
+			So(user["country"].Enum, ShouldContain, "GBR")
+			So(user["country"].Enum, ShouldContain, "826")
+
+			problem := document.Components.Schemas["Problem"].Properties
+			So(problem["type"].Enum, ShouldContain, "/problems/invalid-data")
+			So(problem["type"].Enum, ShouldContain, "/problems/insufficient-scope")
+		})
+	})
+
+	Convey("Given I fetch the OpenAPI description as YAML", t, func() {
+
+		res := httptest.NewRecorder()
+		getOpenAPIYAML(res, httptest.NewRequest(http.MethodGet, "/openapi.yaml", nil))
+
+		Convey("Then I expect a YAML document", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Header().Get("Content-Type"), ShouldEqual, "application/yaml")
+			So(res.Body.String(), ShouldStartWith, "components:\n")
+			So(res.Body.String(), ShouldContainSubstring, "\nopenapi: \"3.0.3\"\n")
+			So(res.Body.String(), ShouldContainSubstring, "\n  /users/{user_id}:\n")
+		})
+	})
+}
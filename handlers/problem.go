@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bpsaunders/user-api/logging"
+	"github.com/bpsaunders/user-api/service"
+	"github.com/bpsaunders/user-api/validators"
+	"net/http"
+)
+
+const problemContentType = "application/problem+json"
+const problemTypePrefix = "/problems/"
+
+// types of problem raised by the handlers themselves, rather than on behalf of the service
+const (
+	problemRouteNotFound        = "route-not-found"
+	problemMethodNotAllowed     = "method-not-allowed"
+	problemUnauthenticated      = "unauthenticated"
+	problemInsufficientScope    = "insufficient-scope"
+	problemNotAcceptable        = "not-acceptable"
+	problemUnsupportedMediaType = "unsupported-media-type"
+	problemRequestTooLarge      = "request-too-large"
+)
+
+// Problem describes an error response, following RFC 7807 (problem details for HTTP APIs)
+type Problem struct {
+	Type      string                       `json:"type"`
+	Title     string                       `json:"title"`
+	Status    int                          `json:"status"`
+	Detail    string                       `json:"detail,omitempty"`
+	Instance  string                       `json:"instance,omitempty"`
+	RequestID string                       `json:"request_id,omitempty"`
+	Errors    []validators.ValidationError `json:"errors,omitempty"`
+}
+
+// problemDetail describes how a service response type is rendered as a problem
+type problemDetail struct {
+	status int
+	detail string
+}
+
+var problemDetails = map[service.ResponseType]problemDetail{
+	service.InvalidData:        {http.StatusBadRequest, "The request was invalid"},
+	service.Error:              {http.StatusInternalServerError, "An unexpected error occurred"},
+	service.Conflict:           {http.StatusConflict, "A user already exists with the given email"},
+	service.NotFound:           {http.StatusNotFound, "The requested user could not be found"},
+	service.Timeout:            {http.StatusGatewayTimeout, "The request could not be completed in time"},
+	service.Cancelled:          {http.StatusServiceUnavailable, "The request was cancelled before it could be completed"},
+	service.PreconditionFailed: {http.StatusPreconditionFailed, "The user doesn't exist at the version given in If-Match"},
+
+	service.IdempotencyKeyReused: {http.StatusUnprocessableEntity, "The Idempotency-Key has already been used for a different request"},
+	service.IdempotencyKeyInUse:  {http.StatusConflict, "A request with the same Idempotency-Key is still in progress"},
+
+	service.AtomicImportUnsupported: {http.StatusNotImplemented, "Importing all or nothing is unavailable, as it requires the database to be a MongoDB replica set"},
+}
+
+// writeProblem renders an unsuccessful service response as a problem, optionally overriding the default detail.
+// The underlying error is logged, but never exposed to the client
+func writeProblem(w http.ResponseWriter, r *http.Request, responseType service.ResponseType, detail string, validationErrors []validators.ValidationError, err error) {
+
+	pd, ok := problemDetails[responseType]
+	if !ok {
+		pd = problemDetails[service.Error]
+		responseType = service.Error
+	}
+
+	if detail == "" {
+		detail = pd.detail
+	}
+
+	logger := logging.FromContext(r.Context())
+	if pd.status >= http.StatusInternalServerError {
+		logger.Error(fmt.Sprintf("%s: %v", detail, err))
+	} else {
+		logger.Info(detail)
+		if len(validationErrors) > 0 {
+			logger.Debug(fmt.Sprintf("errors returned: %s", validationErrors))
+		}
+	}
+
+	problem := newProblem(r, pd.status, responseType.String(), detail)
+	problem.Errors = validationErrors
+
+	renderProblem(w, r, problem)
+}
+
+func newProblem(r *http.Request, status int, problemType string, detail string) *Problem {
+
+	return &Problem{
+		Type:      problemTypePrefix + problemType,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: requestID(r),
+	}
+}
+
+func renderProblem(w http.ResponseWriter, r *http.Request, problem *Problem) {
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set(requestIDHeader, problem.RequestID)
+	w.WriteHeader(problem.Status)
+	err := json.NewEncoder(w).Encode(problem)
+	if err != nil {
+		logging.FromContext(r.Context()).Error(fmt.Sprintf("Error writing response: %v", err))
+	}
+}
+
+// routeNotFound renders requests to unknown routes as problems
+func routeNotFound(w http.ResponseWriter, r *http.Request) {
+
+	logging.FromContext(r.Context()).Info(fmt.Sprintf("No route found for path: %s", r.URL.Path))
+	renderProblem(w, r, newProblem(r, http.StatusNotFound, problemRouteNotFound, "No resource exists at the requested path"))
+}
+
+// methodNotAllowed renders requests using unsupported methods as problems
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+
+	logging.FromContext(r.Context()).Info(fmt.Sprintf("Method %s not allowed for path: %s", r.Method, r.URL.Path))
+	renderProblem(w, r, newProblem(r, http.StatusMethodNotAllowed, problemMethodNotAllowed, "The requested method is not supported by the resource"))
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/bpsaunders/user-api/service"
+	"github.com/bpsaunders/user-api/validators"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitWriteProblem(t *testing.T) {
+
+	Convey("Given I render validation errors as a problem", t, func() {
+
+		req := httptest.NewRequest(http.MethodPost, "/users", nil)
+		req.Header.Set(requestIDHeader, "request-id")
+		res := httptest.NewRecorder()
+
+		validationErrors := []validators.ValidationError{{Field: "$.email", Error: "invalid_format"}}
+
+		writeProblem(res, req, service.InvalidData, "", validationErrors, nil)
+
+		var problem Problem
+		err := json.NewDecoder(res.Body).Decode(&problem)
+
+		Convey("Then I expect a 400 problem+json response", func() {
+
+			So(err, ShouldBeNil)
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+			So(res.Header().Get("Content-Type"), ShouldEqual, problemContentType)
+
+			Convey("Describing the problem, the request and the validation errors", func() {
+
+				So(problem.Type, ShouldEqual, "/problems/invalid-data")
+				So(problem.Title, ShouldEqual, "Bad Request")
+				So(problem.Status, ShouldEqual, http.StatusBadRequest)
+				So(problem.Detail, ShouldNotBeBlank)
+				So(problem.Instance, ShouldEqual, "/users")
+				So(problem.RequestID, ShouldEqual, "request-id")
+				So(problem.Errors, ShouldResemble, validationErrors)
+				So(res.Header().Get(requestIDHeader), ShouldEqual, "request-id")
+			})
+		})
+	})
+
+	Convey("Given I render an error as a problem", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/id", nil)
+		res := httptest.NewRecorder()
+
+		writeProblem(res, req, service.Error, "", nil, errors.New("sensitive details"))
+
+		var problem Problem
+		err := json.NewDecoder(res.Body).Decode(&problem)
+
+		Convey("Then I expect a 500 problem+json response", func() {
+
+			So(err, ShouldBeNil)
+			So(res.Code, ShouldEqual, http.StatusInternalServerError)
+			So(problem.Type, ShouldEqual, "/problems/error")
+
+			Convey("Which doesn't expose the error, but can be traced", func() {
+
+				So(problem.Detail, ShouldNotContainSubstring, "sensitive")
+				So(problem.RequestID, ShouldNotBeBlank)
+			})
+		})
+	})
+
+	Convey("Given I render each service response type as a problem", t, func() {
+
+		expected := map[service.ResponseType]int{
+			service.InvalidData: http.StatusBadRequest,
+			service.Error:       http.StatusInternalServerError,
+			service.Conflict:    http.StatusConflict,
+			service.NotFound:    http.StatusNotFound,
+			service.Timeout:     http.StatusGatewayTimeout,
+			service.Cancelled:   http.StatusServiceUnavailable,
+		}
+
+		Convey("Then I expect each to map to its status", func() {
+
+			for responseType, status := range expected {
+				res := httptest.NewRecorder()
+				writeProblem(res, httptest.NewRequest(http.MethodGet, "/users", nil), responseType, "", nil, nil)
+				So(res.Code, ShouldEqual, status)
+			}
+		})
+	})
+}
+
+func TestUnitUnknownRoutes(t *testing.T) {
+
+	router := mux.NewRouter()
+	Register(router, nil, nil)
+
+	Convey("Given I request a route which doesn't exist", t, func() {
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+		Convey("Then I expect a 404 problem", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNotFound)
+			So(res.Header().Get("Content-Type"), ShouldEqual, problemContentType)
+		})
+	})
+
+	Convey("Given I request a route with an unsupported method", t, func() {
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/users/id", nil))
+
+		Convey("Then I expect a 405 problem", func() {
+
+			So(res.Code, ShouldEqual, http.StatusMethodNotAllowed)
+			So(res.Header().Get("Content-Type"), ShouldEqual, problemContentType)
+		})
+	})
+}
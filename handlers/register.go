@@ -1,20 +1,58 @@
 package handlers
 
 import (
+	"github.com/bpsaunders/user-api/auth"
+	"github.com/bpsaunders/user-api/metrics"
 	"github.com/bpsaunders/user-api/service"
 	"github.com/gorilla/mux"
 	"net/http"
 )
 
-// Register registers handler functions against all available routes
-func Register(router *mux.Router, userService service.UserService) {
+// Register registers handler functions against all available routes, returning the readiness
+// handler so that it may be drained on shutdown. Routes exposing users, or administering the application, require
+// authentication
+func Register(router *mux.Router, userService service.UserService, authenticator auth.Authenticator) ReadinessHandler {
 
-	router.HandleFunc("/health-check", healthCheck)
-	router.Handle("/users", NewCreateUserHandler(userService)).Methods(http.MethodPost)
-	router.Handle("/users", NewGetAllUsersHandler(userService)).Methods(http.MethodGet)
-	router.Handle("/users/{user_id}", NewGetUserHandler(userService)).Methods(http.MethodGet)
-}
+	readiness := NewReadinessHandler(userService)
+
+	// unmatched requests bypass router middleware, so are logged explicitly
+	router.NotFoundHandler = loggingMiddleware(http.HandlerFunc(routeNotFound))
+	router.MethodNotAllowedHandler = loggingMiddleware(http.HandlerFunc(methodNotAllowed))
+
+	router.Use(loggingMiddleware, metricsMiddleware)
+
+	router.HandleFunc("/health/live", liveness).Methods(http.MethodGet)
+	router.Handle("/health/ready", readiness).Methods(http.MethodGet)
+	router.HandleFunc("/health-check", liveness)
+	router.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+	router.HandleFunc("/countries", getCountries).Methods(http.MethodGet)
+	router.HandleFunc("/openapi.json", getOpenAPIJSON).Methods(http.MethodGet)
+	router.HandleFunc("/openapi.yaml", getOpenAPIYAML).Methods(http.MethodGet)
+
+	read := func(h http.Handler) http.Handler { return requireScope(authenticator, auth.ScopeUsersRead, h) }
+	write := func(h http.Handler) http.Handler { return requireScope(authenticator, auth.ScopeUsersWrite, h) }
+	erase := func(h http.Handler) http.Handler { return requireScope(authenticator, auth.ScopeUsersErase, h) }
+	export := func(h http.Handler) http.Handler { return requireScope(authenticator, auth.ScopeUsersExport, h) }
+	admin := func(h http.Handler) http.Handler { return requireScope(authenticator, auth.ScopeAdmin, h) }
+
+	router.Handle("/users", write(NewCreateUserHandler(userService))).Methods(http.MethodPost)
+	router.Handle("/users", read(NewGetAllUsersHandler(userService))).Methods(http.MethodGet)
+	router.Handle("/users:batch", write(NewImportUsersHandler(userService))).Methods(http.MethodPost)
+	// registered ahead of /users/{user_id}, which would otherwise match them
+	router.Handle("/users/export", read(NewExportUsersHandler(userService))).Methods(http.MethodGet)
+	router.Handle("/users/search", read(NewSearchUsersHandler(userService))).Methods(http.MethodGet)
+	router.Handle("/users/stats", read(NewGetUserStatsHandler(userService))).Methods(http.MethodGet)
+	router.Handle("/users/{user_id}:restore", write(NewRestoreUserHandler(userService))).Methods(http.MethodPost)
+	router.Handle("/users/{user_id}:erase", erase(NewEraseUserHandler(userService))).Methods(http.MethodPost)
+	router.Handle("/users/{user_id}", read(NewGetUserHandler(userService))).Methods(http.MethodGet)
+	router.Handle("/users/{user_id}", write(NewUpdateUserHandler(userService))).Methods(http.MethodPut)
+	router.Handle("/users/{user_id}", write(NewPatchUserHandler(userService))).Methods(http.MethodPatch)
+	router.Handle("/users/{user_id}", write(NewDeleteUserHandler(userService))).Methods(http.MethodDelete)
+	router.Handle("/users/{user_id}/history", read(NewGetUserHistoryHandler(userService))).Methods(http.MethodGet)
+	router.Handle("/users/{user_id}/data-export", export(NewExportUserDataHandler(userService))).Methods(http.MethodGet)
+
+	router.Handle("/admin/log-level", admin(http.HandlerFunc(getLogLevel))).Methods(http.MethodGet)
+	router.Handle("/admin/log-level", admin(http.HandlerFunc(putLogLevel))).Methods(http.MethodPut)
 
-func healthCheck(w http.ResponseWriter, _ *http.Request) {
-	w.WriteHeader(http.StatusOK)
+	return readiness
 }
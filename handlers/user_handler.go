@@ -3,10 +3,11 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/bpsaunders/user-api/logging"
 	"github.com/bpsaunders/user-api/models"
 	"github.com/bpsaunders/user-api/service"
+	"github.com/bpsaunders/user-api/validators"
 	"github.com/gorilla/mux"
-	log "github.com/sirupsen/logrus"
 	"net/http"
 )
 
@@ -46,108 +47,399 @@ func NewGetAllUsersHandler(service service.UserService) GetAllUsersHandler {
 	}
 }
 
+// SearchUsersHandler offers a handler by which to search users by their names and email
+type SearchUsersHandler struct {
+	service service.UserService
+}
+
+// NewSearchUsersHandler returns a new SearchUsersHandler
+func NewSearchUsersHandler(service service.UserService) SearchUsersHandler {
+	return SearchUsersHandler{
+		service,
+	}
+}
+
+// GetUserStatsHandler offers a handler by which to fetch statistics of users
+type GetUserStatsHandler struct {
+	service service.UserService
+}
+
+// NewGetUserStatsHandler returns a new GetUserStatsHandler
+func NewGetUserStatsHandler(service service.UserService) GetUserStatsHandler {
+	return GetUserStatsHandler{
+		service,
+	}
+}
+
+// UpdateUserHandler offers a handler by which to fully replace a user
+type UpdateUserHandler struct {
+	service service.UserService
+}
+
+// NewUpdateUserHandler returns a new UpdateUserHandler
+func NewUpdateUserHandler(service service.UserService) UpdateUserHandler {
+	return UpdateUserHandler{
+		service,
+	}
+}
+
+// PatchUserHandler offers a handler by which to partially update a user
+type PatchUserHandler struct {
+	service service.UserService
+}
+
+// NewPatchUserHandler returns a new PatchUserHandler
+func NewPatchUserHandler(service service.UserService) PatchUserHandler {
+	return PatchUserHandler{
+		service,
+	}
+}
+
+// DeleteUserHandler offers a handler by which to delete a user
+type DeleteUserHandler struct {
+	service service.UserService
+}
+
+// NewDeleteUserHandler returns a new DeleteUserHandler
+func NewDeleteUserHandler(service service.UserService) DeleteUserHandler {
+	return DeleteUserHandler{
+		service,
+	}
+}
+
+// RestoreUserHandler offers a handler by which to restore a deleted user
+type RestoreUserHandler struct {
+	service service.UserService
+}
+
+// NewRestoreUserHandler returns a new RestoreUserHandler
+func NewRestoreUserHandler(service service.UserService) RestoreUserHandler {
+	return RestoreUserHandler{
+		service,
+	}
+}
+
+// GetUserHistoryHandler offers a handler by which to fetch the history of mutations to a user
+type GetUserHistoryHandler struct {
+	service service.UserService
+}
+
+// NewGetUserHistoryHandler returns a new GetUserHistoryHandler
+func NewGetUserHistoryHandler(service service.UserService) GetUserHistoryHandler {
+	return GetUserHistoryHandler{
+		service,
+	}
+}
+
 func (h CreateUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
+	logger := logging.FromContext(r.Context())
+
 	var user models.User
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		log.Error(fmt.Sprintf("Failed to decode request body to user struct: %v", err))
-		w.WriteHeader(http.StatusBadRequest)
+		logger.Error(fmt.Sprintf("Failed to decode request body to user struct: %v", err))
+		writeBodyProblem(w, r, malformedBodyDetail, err)
 		return
 	}
 
-	log.Debug(
+	logger.Debug(
 		fmt.Sprintf(
 			"Submitted user - first name: %s, last name: %s, email: %s, country: %s",
 			user.FirstName, user.LastName, user.Email, user.Country))
 
-	responseType, validationErrors, err := h.service.CreateUser(&user)
+	key, ok := idempotencyKey(r)
+	if !ok {
+		writeProblem(w, r, service.InvalidData, invalidIdempotencyKeyDetail, nil, nil)
+		return
+	}
+
+	var responseType service.ResponseType
+	var created *models.User
+	var validationErrors []validators.ValidationError
+	var replayed bool
+	if key != "" {
+		responseType, created, validationErrors, replayed, err = h.service.CreateUserIdempotently(r.Context(), key, &user)
+	} else {
+		responseType, created, validationErrors, err = h.service.CreateUser(r.Context(), &user)
+	}
+
+	if replayed {
+		w.Header().Set(idempotentReplayedHeader, "true")
+	}
+	if responseType != service.Success {
+		writeProblem(w, r, responseType, "", validationErrors, err)
+		return
+	}
+
+	if replayed {
+		logger.Info("User creation replayed successfully")
+	} else {
+		logger.Info("User created successfully")
+	}
+	w.Header().Set("Location", created.Links.Self)
+	w.Header().Set("ETag", etag(created.Version))
+	writeJSON(w, r, http.StatusCreated, created)
+}
+
+func (h GetUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
 
-	if responseType == service.Error {
-		log.Error(fmt.Sprintf("Error encountered when creating user: %v", err))
-		w.WriteHeader(http.StatusInternalServerError)
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
 		return
 	}
 
-	if responseType == service.Conflict {
-		log.Info("Attempt made to create a user that already exists")
-		w.WriteHeader(http.StatusConflict)
+	responseType, user, err := h.service.GetUser(r.Context(), userID)
+	if responseType != service.Success {
+		logger.Debug(fmt.Sprintf("User not fetched by id: %s", userID))
+		writeProblem(w, r, responseType, "", nil, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(user.Version))
+
+	// the client already holds the current version of the user, so needn't be sent it again
+	if notModified(r, user.Version) {
+		logger.Debug(fmt.Sprintf("User not modified with id: %s", userID))
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	if responseType == service.InvalidData {
-		log.Info("Invalid data submission")
-		log.Debug(fmt.Sprintf("errors returned: %s", validationErrors))
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(validationErrors)
-		if err != nil {
-			log.Error(fmt.Sprintf("Error writing response: %v", err))
-			w.WriteHeader(http.StatusInternalServerError)
+	logger.Info("User fetched successfully")
+	logger.Debug(fmt.Sprintf("User found with id: %s", userID))
+	writeJSON(w, r, http.StatusOK, user)
+}
+
+func (h GetAllUsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+
+	params := r.URL.Query()
+
+	// a user is found by its exact email alone, so the other parameters don't apply
+	if email := params.Get("email"); email != "" {
+		responseType, users, err := h.service.FindUsersByEmail(r.Context(), email)
+		if responseType != service.Success {
+			writeProblem(w, r, responseType, "", nil, err)
+			return
 		}
+
+		logger.Info("Users found by email successfully")
+		writeJSON(w, r, http.StatusOK, users)
 		return
 	}
 
-	log.Info("User created successfully")
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(user)
-	if err != nil {
-		log.Error(fmt.Sprintf("Error writing response: %v", err))
-		w.WriteHeader(http.StatusInternalServerError)
+	query := &models.UserListQuery{
+		Limit:        params.Get("limit"),
+		Cursor:       params.Get("cursor"),
+		Sort:         params.Get("sort"),
+		Country:      params.Get("country"),
+		EmailDomain:  params.Get("email_domain"),
+		NamePrefix:   params.Get("name_prefix"),
+		IncludeTotal: params.Get("include_total") == "true",
 	}
+
+	responseType, users, validationErrors, err := h.service.GetAllUsers(r.Context(), query)
+	if responseType != service.Success {
+		writeProblem(w, r, responseType, "", validationErrors, err)
+		return
+	}
+
+	logger.Info("Users fetched successfully")
+	writeJSON(w, r, http.StatusOK, users)
 }
 
-func (h GetUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (h SearchUsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	vars := mux.Vars(r)
-	userID := vars["user_id"]
-	if userID == "" {
-		log.Info("No userID in url")
-		w.WriteHeader(http.StatusBadRequest)
+	logger := logging.FromContext(r.Context())
+
+	params := r.URL.Query()
+	query := &models.UserSearchQuery{
+		Q:     params.Get("q"),
+		Limit: params.Get("limit"),
+	}
+
+	responseType, users, validationErrors, err := h.service.SearchUsers(r.Context(), query)
+	if responseType != service.Success {
+		writeProblem(w, r, responseType, "", validationErrors, err)
 		return
 	}
 
-	responseType, user, err := h.service.GetUser(userID)
-	if responseType == service.Error {
-		log.Error(fmt.Sprintf("Error encountered when fetching user: %v", err))
-		w.WriteHeader(http.StatusInternalServerError)
+	logger.Info("Users searched successfully")
+	writeJSON(w, r, http.StatusOK, users)
+}
+
+func (h GetUserStatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+
+	params := r.URL.Query()
+	query := &models.UserStatsQuery{
+		Country:     params.Get("country"),
+		EmailDomain: params.Get("email_domain"),
+		From:        params.Get("from"),
+		To:          params.Get("to"),
+		Interval:    params.Get("interval"),
+		Top:         params.Get("top"),
+	}
+
+	responseType, stats, validationErrors, err := h.service.GetUserStats(r.Context(), query)
+	if responseType != service.Success {
+		writeProblem(w, r, responseType, "", validationErrors, err)
 		return
 	}
 
-	if responseType == service.NotFound {
-		log.Info("User not found")
-		log.Debug(fmt.Sprintf("User not found by id: %s", userID))
-		w.WriteHeader(http.StatusNotFound)
+	logger.Info("User statistics fetched successfully")
+	writeJSON(w, r, http.StatusOK, stats)
+}
+
+func (h UpdateUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
 		return
 	}
 
-	log.Info("User fetched successfully")
-	log.Debug(fmt.Sprintf("User found with id: %s", userID))
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(user)
+	var user models.User
+	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		log.Error(fmt.Sprintf("Error writing response: %v", err))
-		w.WriteHeader(http.StatusInternalServerError)
+		logger.Error(fmt.Sprintf("Failed to decode request body to user struct: %v", err))
+		writeBodyProblem(w, r, malformedBodyDetail, err)
+		return
+	}
+
+	responseType, updated, validationErrors, err := h.service.UpdateUser(r.Context(), userID, &user, precondition(r))
+	if responseType != service.Success {
+		writeProblem(w, r, responseType, "", validationErrors, err)
+		return
 	}
+
+	logger.Info("User updated successfully")
+	w.Header().Set("ETag", etag(updated.Version))
+	writeJSON(w, r, http.StatusOK, updated)
 }
 
-func (h GetAllUsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (h PatchUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	responseType, users, err := h.service.GetAllUsers()
-	if responseType == service.Error {
-		log.Error(fmt.Sprintf("Error encountered when fetching users: %v", err))
-		w.WriteHeader(http.StatusInternalServerError)
+	logger := logging.FromContext(r.Context())
+
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
 		return
 	}
 
-	log.Info("Users fetched successfully")
+	// a merge patch document must be a JSON object to describe changes to a user
+	var patch map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to decode request body to merge patch: %v", err))
+		writeBodyProblem(w, r, "The request body must be a JSON merge patch object", err)
+		return
+	}
+
+	responseType, user, validationErrors, err := h.service.PatchUser(r.Context(), userID, patch, precondition(r))
+	if responseType != service.Success {
+		writeProblem(w, r, responseType, "", validationErrors, err)
+		return
+	}
+
+	logger.Info("User updated successfully")
+	w.Header().Set("ETag", etag(user.Version))
+	writeJSON(w, r, http.StatusOK, user)
+}
+
+func (h DeleteUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	responseType, err := h.service.DeleteUser(r.Context(), userID, precondition(r))
+	if responseType != service.Success {
+		writeProblem(w, r, responseType, "", nil, err)
+		return
+	}
+
+	logger.Info("User deleted successfully")
+	logger.Debug(fmt.Sprintf("User deleted with id: %s", userID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h RestoreUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	responseType, restored, err := h.service.RestoreUser(r.Context(), userID)
+	if responseType != service.Success {
+		writeProblem(w, r, responseType, "", nil, err)
+		return
+	}
+
+	logger.Info("User restored successfully")
+	logger.Debug(fmt.Sprintf("User restored with id: %s", userID))
+	w.Header().Set("ETag", etag(restored.Version))
+	writeJSON(w, r, http.StatusOK, restored)
+}
+
+const malformedBodyDetail = "The request body could not be read as a user"
+
+func (h GetUserHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	query := &models.UserHistoryQuery{
+		Limit:  params.Get("limit"),
+		Cursor: params.Get("cursor"),
+	}
+
+	responseType, history, validationErrors, err := h.service.GetUserHistory(r.Context(), userID, query)
+	if responseType != service.Success {
+		logger.Debug(fmt.Sprintf("History not fetched for user with id: %s", userID))
+		writeProblem(w, r, responseType, "", validationErrors, err)
+		return
+	}
+
+	logger.Info("User history fetched successfully")
+	writeJSON(w, r, http.StatusOK, history)
+}
+
+// userIDFromPath returns the user id from the url, rendering a problem if absent
+func userIDFromPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+
+	userID := mux.Vars(r)["user_id"]
+	if userID == "" {
+		logging.FromContext(r.Context()).Info("No userID in url")
+		writeProblem(w, r, service.InvalidData, "No user id was provided", nil, nil)
+		return "", false
+	}
+	return userID, true
+}
+
+// writeJSON renders a successful response
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(users)
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(body)
 	if err != nil {
-		log.Error(fmt.Sprintf("Error writing response: %v", err))
-		w.WriteHeader(http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error(fmt.Sprintf("Error writing response: %v", err))
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/bpsaunders/user-api/service"
 	"github.com/bpsaunders/user-api/validators"
 	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -40,7 +41,7 @@ func TestUnitCreateUser(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/users", body).WithContext(context.Background())
 		res := httptest.NewRecorder()
 
-		svc.EXPECT().CreateUser(&user).Return(service.Error, nil, errors.New("error when creating user"))
+		svc.EXPECT().CreateUser(gomock.Any(), &user).Return(service.Error, nil, nil, errors.New("error when creating user"))
 
 		handler.ServeHTTP(res, req)
 
@@ -64,7 +65,7 @@ func TestUnitCreateUser(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/users", body).WithContext(context.Background())
 		res := httptest.NewRecorder()
 
-		svc.EXPECT().CreateUser(&user).Return(service.Conflict, []validators.ValidationError{}, nil)
+		svc.EXPECT().CreateUser(gomock.Any(), &user).Return(service.Conflict, nil, []validators.ValidationError{}, nil)
 
 		handler.ServeHTTP(res, req)
 
@@ -88,7 +89,7 @@ func TestUnitCreateUser(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/users", body).WithContext(context.Background())
 		res := httptest.NewRecorder()
 
-		svc.EXPECT().CreateUser(&user).Return(service.InvalidData, []validators.ValidationError{{}}, nil)
+		svc.EXPECT().CreateUser(gomock.Any(), &user).Return(service.InvalidData, nil, []validators.ValidationError{{}}, nil)
 
 		handler.ServeHTTP(res, req)
 
@@ -113,14 +114,100 @@ func TestUnitCreateUser(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/users", body).WithContext(context.Background())
 		res := httptest.NewRecorder()
 
-		svc.EXPECT().CreateUser(&user).Return(service.Success, []validators.ValidationError{}, nil)
+		created := &models.User{ID: "id", Links: models.Links{Self: "/users/id"}}
+		svc.EXPECT().CreateUser(gomock.Any(), &user).Return(service.Success, created, []validators.ValidationError{}, nil)
 
 		handler.ServeHTTP(res, req)
 
-		Convey("Then I expect a 201 response with a body", func() {
+		Convey("Then I expect a 201 response with the created user", func() {
 
 			So(res.Code, ShouldEqual, http.StatusCreated)
-			So(res.Body, ShouldNotBeNil)
+
+			var body models.User
+			So(json.NewDecoder(res.Body).Decode(&body), ShouldBeNil)
+			So(body.ID, ShouldEqual, "id")
+			So(body.Links.Self, ShouldEqual, "/users/id")
+
+			Convey("And the location of the created user", func() {
+
+				So(res.Header().Get("Location"), ShouldEqual, "/users/id")
+			})
+		})
+	})
+}
+
+func TestUnitGetUser(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewGetUserHandler(svc)
+
+	Convey("Given I fetch a user which doesn't exist", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/id", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().GetUser(gomock.Any(), "id").Return(service.NotFound, nil, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 404 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+
+	Convey("Given I fetch a user which exists", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/id", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().GetUser(gomock.Any(), "id").Return(service.Success, &models.User{ID: "id", Version: 3}, nil)
+
+		Convey("When I don't hold a copy of the user", func() {
+
+			handler.ServeHTTP(res, req)
+
+			Convey("Then I expect a 200 response with the user, and its version as a strong ETag", func() {
+
+				So(res.Code, ShouldEqual, http.StatusOK)
+				So(res.Header().Get("ETag"), ShouldEqual, `"3"`)
+
+				var body models.User
+				So(json.NewDecoder(res.Body).Decode(&body), ShouldBeNil)
+				So(body.ID, ShouldEqual, "id")
+			})
+		})
+
+		Convey("When I hold a copy of the current version of the user", func() {
+
+			req.Header.Set("If-None-Match", `"3"`)
+
+			handler.ServeHTTP(res, req)
+
+			Convey("Then I expect a 304 response without a body", func() {
+
+				So(res.Code, ShouldEqual, http.StatusNotModified)
+				So(res.Header().Get("ETag"), ShouldEqual, `"3"`)
+				So(res.Body.Len(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When I hold a copy of a previous version of the user", func() {
+
+			req.Header.Set("If-None-Match", `"2"`)
+
+			handler.ServeHTTP(res, req)
+
+			Convey("Then I expect a 200 response with the user", func() {
+
+				So(res.Code, ShouldEqual, http.StatusOK)
+			})
 		})
 	})
 }
@@ -139,7 +226,7 @@ func TestUnitGetAllUsers(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/users", nil).WithContext(context.Background())
 		res := httptest.NewRecorder()
 
-		svc.EXPECT().GetAllUsers().Return(service.Error, nil, errors.New("error when fetching all users"))
+		svc.EXPECT().GetAllUsers(gomock.Any(), &models.UserListQuery{}).Return(service.Error, nil, nil, errors.New("error when fetching all users"))
 
 		handler.ServeHTTP(res, req)
 
@@ -149,12 +236,37 @@ func TestUnitGetAllUsers(t *testing.T) {
 		})
 	})
 
+	Convey("Given I fetch users with invalid query parameters", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users?limit=invalid", nil).WithContext(context.Background())
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().GetAllUsers(gomock.Any(), &models.UserListQuery{Limit: "invalid"}).Return(service.InvalidData, nil, []validators.ValidationError{{}}, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 400 response with a body", func() {
+
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+			So(res.Body.Len(), ShouldBeGreaterThan, 0)
+		})
+	})
+
 	Convey("Given I successfully fetch all users", t, func() {
 
-		req := httptest.NewRequest(http.MethodGet, "/users", nil).WithContext(context.Background())
+		req := httptest.NewRequest(http.MethodGet, "/users?limit=10&sort=-email&country=GB&email_domain=mail.com&name_prefix=bo&include_total=true", nil).WithContext(context.Background())
 		res := httptest.NewRecorder()
 
-		svc.EXPECT().GetAllUsers().Return(service.Success, &[]*models.User{}, nil)
+		query := &models.UserListQuery{
+			Limit:        "10",
+			Sort:         "-email",
+			Country:      "GB",
+			EmailDomain:  "mail.com",
+			NamePrefix:   "bo",
+			IncludeTotal: true,
+		}
+
+		svc.EXPECT().GetAllUsers(gomock.Any(), query).Return(service.Success, &models.UserList{Items: []*models.User{}}, nil, nil)
 
 		handler.ServeHTTP(res, req)
 
@@ -164,4 +276,525 @@ func TestUnitGetAllUsers(t *testing.T) {
 			So(res.Body, ShouldNotBeNil)
 		})
 	})
+
+	Convey("Given I fetch users by email, alongside other parameters", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users?email=Bob%40Example.com&country=FR", nil).WithContext(context.Background())
+		res := httptest.NewRecorder()
+
+		users := &models.UserList{Items: []*models.User{{ID: "id", Email: "bob@example.com"}}}
+		svc.EXPECT().FindUsersByEmail(gomock.Any(), "Bob@Example.com").Return(service.Success, users, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 200 response listing the user found by email alone", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Body.String(), ShouldContainSubstring, `"id":"id"`)
+		})
+	})
+
+	Convey("Given I fetch users by email and encounter errors", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users?email=bob@example.com", nil).WithContext(context.Background())
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().FindUsersByEmail(gomock.Any(), "bob@example.com").Return(service.Error, nil, errors.New("error when finding users by email"))
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 500 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+}
+
+func TestUnitSearchUsers(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewSearchUsersHandler(svc)
+
+	Convey("Given I search users without text", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/search", nil).WithContext(context.Background())
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().SearchUsers(gomock.Any(), &models.UserSearchQuery{}).Return(service.InvalidData, nil, []validators.ValidationError{{}}, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 400 response with a body", func() {
+
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+			So(res.Body.Len(), ShouldBeGreaterThan, 0)
+		})
+	})
+
+	Convey("Given I successfully search users", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/search?q=bob+jones&limit=5", nil).WithContext(context.Background())
+		res := httptest.NewRecorder()
+
+		users := &models.UserList{Items: []*models.User{{ID: "id"}}}
+		svc.EXPECT().SearchUsers(gomock.Any(), &models.UserSearchQuery{Q: "bob jones", Limit: "5"}).Return(service.Success, users, nil, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 200 response listing the users found", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Body.String(), ShouldContainSubstring, `"id":"id"`)
+		})
+	})
+}
+
+func TestUnitGetUserStats(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewGetUserStatsHandler(svc)
+
+	Convey("Given I fetch statistics of users with an invalid interval", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/stats?interval=year", nil).WithContext(context.Background())
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().GetUserStats(gomock.Any(), &models.UserStatsQuery{Interval: "year"}).Return(service.InvalidData, nil, []validators.ValidationError{{}}, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 400 response with a body", func() {
+
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+			So(res.Body.Len(), ShouldBeGreaterThan, 0)
+		})
+	})
+
+	Convey("Given I fetch statistics of users and encounter errors", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/stats", nil).WithContext(context.Background())
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().GetUserStats(gomock.Any(), &models.UserStatsQuery{}).Return(service.Error, nil, nil, errors.New("error"))
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 500 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+
+	Convey("Given I successfully fetch statistics of users", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/stats?country=GB&email_domain=example.com&from=2020-01-01&to=2020-01-31&interval=week&top=5", nil).WithContext(context.Background())
+		res := httptest.NewRecorder()
+
+		query := &models.UserStatsQuery{
+			Country:     "GB",
+			EmailDomain: "example.com",
+			From:        "2020-01-01",
+			To:          "2020-01-31",
+			Interval:    "week",
+			Top:         "5",
+		}
+		stats := &models.UserStats{Total: 2, Countries: []*models.CountryCount{{Country: "GB", Count: 2}}}
+		svc.EXPECT().GetUserStats(gomock.Any(), query).Return(service.Success, stats, nil, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 200 response with the statistics", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Body.String(), ShouldContainSubstring, `"total":2`)
+			So(res.Body.String(), ShouldContainSubstring, `"country":"GB"`)
+		})
+	})
+}
+
+func TestUnitUpdateUser(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewUpdateUserHandler(svc)
+
+	Convey("Given I update a user that doesn't exist", t, func() {
+
+		user := models.User{}
+
+		b, err := json.Marshal(user)
+		if err != nil {
+			t.Fatal("failed to marshal request body")
+		}
+
+		req := httptest.NewRequest(http.MethodPut, "/users/id", bytes.NewReader(b))
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().UpdateUser(gomock.Any(), "id", &user, gomock.Nil()).Return(service.NotFound, nil, []validators.ValidationError{}, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 404 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+
+	Convey("Given I update a user with an email belonging to another user", t, func() {
+
+		user := models.User{}
+
+		b, err := json.Marshal(user)
+		if err != nil {
+			t.Fatal("failed to marshal request body")
+		}
+
+		req := httptest.NewRequest(http.MethodPut, "/users/id", bytes.NewReader(b))
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().UpdateUser(gomock.Any(), "id", &user, gomock.Nil()).Return(service.Conflict, nil, []validators.ValidationError{}, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 409 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusConflict)
+		})
+	})
+
+	Convey("Given I update a user without errors", t, func() {
+
+		user := models.User{}
+
+		b, err := json.Marshal(user)
+		if err != nil {
+			t.Fatal("failed to marshal request body")
+		}
+
+		req := httptest.NewRequest(http.MethodPut, "/users/id", bytes.NewReader(b))
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		updated := &models.User{ID: "id", Links: models.Links{Self: "/users/id"}}
+		svc.EXPECT().UpdateUser(gomock.Any(), "id", &user, gomock.Nil()).Return(service.Success, updated, []validators.ValidationError{}, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 200 response with the updated user", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+
+			var body models.User
+			So(json.NewDecoder(res.Body).Decode(&body), ShouldBeNil)
+			So(body.ID, ShouldEqual, "id")
+		})
+	})
+}
+
+func TestUnitPatchUser(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewPatchUserHandler(svc)
+
+	Convey("Given I patch a user with a body which isn't a JSON object", t, func() {
+
+		req := httptest.NewRequest(http.MethodPatch, "/users/id", bytes.NewReader([]byte(`"not an object"`)))
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 400 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+
+	Convey("Given I patch a user with validation errors", t, func() {
+
+		req := httptest.NewRequest(http.MethodPatch, "/users/id", bytes.NewReader([]byte(`{"email":null}`)))
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().PatchUser(gomock.Any(), "id", map[string]interface{}{"email": nil}, gomock.Nil()).Return(service.InvalidData, nil, []validators.ValidationError{{}}, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 400 response with a body", func() {
+
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+			So(res.Body.Len(), ShouldBeGreaterThan, 0)
+		})
+	})
+
+	Convey("Given I patch a user without errors", t, func() {
+
+		req := httptest.NewRequest(http.MethodPatch, "/users/id", bytes.NewReader([]byte(`{"country":"FR"}`)))
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().PatchUser(gomock.Any(), "id", map[string]interface{}{"country": "FR"}, gomock.Nil()).Return(service.Success, &models.User{ID: "id"}, nil, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 200 response with a body", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Body.Len(), ShouldBeGreaterThan, 0)
+		})
+	})
+}
+
+func TestUnitDeleteUser(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewDeleteUserHandler(svc)
+
+	Convey("Given I delete a user and encounter errors", t, func() {
+
+		req := httptest.NewRequest(http.MethodDelete, "/users/id", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().DeleteUser(gomock.Any(), "id", gomock.Nil()).Return(service.Error, errors.New("error when deleting user"))
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 500 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+
+	Convey("Given I delete a user conditional upon a version which isn't current", t, func() {
+
+		req := httptest.NewRequest(http.MethodDelete, "/users/id", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		req.Header.Set("If-Match", `"2"`)
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().DeleteUser(gomock.Any(), "id", &models.Precondition{Versions: []int64{2}}).Return(service.PreconditionFailed, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 412 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusPreconditionFailed)
+		})
+	})
+
+	Convey("Given I delete a user and the operation times out", t, func() {
+
+		req := httptest.NewRequest(http.MethodDelete, "/users/id", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().DeleteUser(gomock.Any(), "id", gomock.Nil()).Return(service.Timeout, context.DeadlineExceeded)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 504 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusGatewayTimeout)
+		})
+	})
+
+	Convey("Given I delete a user and the request is cancelled", t, func() {
+
+		req := httptest.NewRequest(http.MethodDelete, "/users/id", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().DeleteUser(gomock.Any(), "id", gomock.Nil()).Return(service.Cancelled, context.Canceled)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 503 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusServiceUnavailable)
+		})
+	})
+
+	Convey("Given I delete a user that doesn't exist", t, func() {
+
+		req := httptest.NewRequest(http.MethodDelete, "/users/id", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().DeleteUser(gomock.Any(), "id", gomock.Nil()).Return(service.NotFound, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 404 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+
+	Convey("Given I delete a user successfully", t, func() {
+
+		req := httptest.NewRequest(http.MethodDelete, "/users/id", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().DeleteUser(gomock.Any(), "id", gomock.Nil()).Return(service.Success, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 204 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNoContent)
+		})
+	})
+}
+
+func TestUnitRestoreUser(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewRestoreUserHandler(svc)
+
+	Convey("Given I restore a user which doesn't exist", t, func() {
+
+		req := httptest.NewRequest(http.MethodPost, "/users/id:restore", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().RestoreUser(gomock.Any(), "id").Return(service.NotFound, nil, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 404 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+
+	Convey("Given I restore a user whose email has since been taken", t, func() {
+
+		req := httptest.NewRequest(http.MethodPost, "/users/id:restore", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().RestoreUser(gomock.Any(), "id").Return(service.Conflict, nil, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 409 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusConflict)
+		})
+	})
+
+	Convey("Given I restore a deleted user", t, func() {
+
+		req := httptest.NewRequest(http.MethodPost, "/users/id:restore", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		restored := &models.User{ID: "id", Version: 3, Links: models.Links{Self: "/users/id"}}
+		svc.EXPECT().RestoreUser(gomock.Any(), "id").Return(service.Success, restored, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 200 response with the restored user and its version", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Header().Get("ETag"), ShouldEqual, `"3"`)
+
+			var body models.User
+			So(json.NewDecoder(res.Body).Decode(&body), ShouldBeNil)
+			So(body.ID, ShouldEqual, "id")
+		})
+	})
+}
+
+func TestUnitGetUserHistory(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc := service.NewMockUserService(mockCtrl)
+
+	handler := NewGetUserHistoryHandler(svc)
+
+	Convey("Given I fetch the history of a user which doesn't exist", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/id/history", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().GetUserHistory(gomock.Any(), "id", &models.UserHistoryQuery{}).Return(service.NotFound, nil, nil, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 404 response", func() {
+
+			So(res.Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+
+	Convey("Given I fetch the history of a user with invalid query parameters", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/id/history?limit=0", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		svc.EXPECT().GetUserHistory(gomock.Any(), "id", &models.UserHistoryQuery{Limit: "0"}).Return(service.InvalidData, nil, []validators.ValidationError{{}}, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 400 response with a body", func() {
+
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+			So(res.Body.Len(), ShouldBeGreaterThan, 0)
+		})
+	})
+
+	Convey("Given I successfully fetch a page of the history of a user", t, func() {
+
+		req := httptest.NewRequest(http.MethodGet, "/users/id/history?limit=10&cursor=abc", nil)
+		req = mux.SetURLVars(req, map[string]string{"user_id": "id"})
+		res := httptest.NewRecorder()
+
+		history := &models.AuditEventList{
+			Items:      []*models.AuditEvent{{ID: "event", UserID: "id", Operation: "update"}},
+			NextCursor: "next",
+		}
+
+		svc.EXPECT().GetUserHistory(gomock.Any(), "id", &models.UserHistoryQuery{Limit: "10", Cursor: "abc"}).Return(service.Success, history, nil, nil)
+
+		handler.ServeHTTP(res, req)
+
+		Convey("Then I expect a 200 response with the page of events", func() {
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(res.Body.String(), ShouldContainSubstring, `"next_cursor":"next"`)
+			So(res.Body.String(), ShouldContainSubstring, `"operation":"update"`)
+		})
+	})
 }
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// plainYAMLScalar matches strings which may be written to YAML unquoted, without being mistaken for another type
+var plainYAMLScalar = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_./{}+\-]*$`)
+
+// yamlKeywords holds the plain scalars which YAML would read as booleans or null rather than strings
+var yamlKeywords = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true, "y": true, "n": true, "null": true,
+}
+
+// marshalYAML renders a value as YAML, by way of its JSON representation, so that it carries the same field names
+// and omissions as it would as JSON. Mappings are written with their keys sorted, so that output is deterministic
+func marshalYAML(v interface{}) ([]byte, error) {
+
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var generic interface{}
+	err = decoder.Decode(&generic)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	if isYAMLCollection(generic) {
+		lines = yamlLines(generic)
+	} else {
+		lines = []string{yamlScalar(generic)}
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// yamlLines renders a non-empty mapping or sequence in block style, as lines without a trailing newline
+func yamlLines(v interface{}) []string {
+
+	lines := make([]string, 0)
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child := value[key]
+			if !isYAMLCollection(child) {
+				lines = append(lines, yamlString(key)+": "+yamlScalar(child))
+				continue
+			}
+			lines = append(lines, yamlString(key)+":")
+			for _, line := range yamlLines(child) {
+				lines = append(lines, "  "+line)
+			}
+		}
+
+	case []interface{}:
+		for _, item := range value {
+			if !isYAMLCollection(item) {
+				lines = append(lines, "- "+yamlScalar(item))
+				continue
+			}
+			for i, line := range yamlLines(item) {
+				if i == 0 {
+					lines = append(lines, "- "+line)
+				} else {
+					lines = append(lines, "  "+line)
+				}
+			}
+		}
+	}
+
+	return lines
+}
+
+// isYAMLCollection determines whether a value is a mapping or sequence with at least one entry. Empty ones are
+// written inline, as scalars are
+func isYAMLCollection(v interface{}) bool {
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return len(value) > 0
+	case []interface{}:
+		return len(value) > 0
+	}
+	return false
+}
+
+func yamlScalar(v interface{}) string {
+
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		if value {
+			return "true"
+		}
+		return "false"
+	case json.Number:
+		return value.String()
+	case string:
+		return yamlString(value)
+	case map[string]interface{}:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	}
+	return "null"
+}
+
+// yamlString writes a string plainly where it's unambiguous, otherwise double quoted. A JSON string is a valid
+// double quoted YAML scalar, so JSON escaping is used
+func yamlString(s string) string {
+
+	if plainYAMLScalar.MatchString(s) && !yamlKeywords[strings.ToLower(s)] {
+		return s
+	}
+
+	var quoted bytes.Buffer
+	encoder := json.NewEncoder(&quoted)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	return strings.TrimSuffix(quoted.String(), "\n")
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitMarshalYAML(t *testing.T) {
+
+	Convey("Given a value with nested mappings, sequences and scalars", t, func() {
+
+		value := map[string]interface{}{
+			"name":    "user-api",
+			"200":     "ok",
+			"enabled": true,
+			"nothing": nil,
+			"tags":    []interface{}{"a", map[string]interface{}{"b": 1, "c": "yes"}},
+			"empty":   map[string]interface{}{},
+			"quoted":  "a: b",
+		}
+
+		Convey("Then I expect it rendered in block style, with keys sorted and ambiguous strings quoted", func() {
+
+			out, err := marshalYAML(value)
+
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, `"200": ok
+empty: {}
+enabled: true
+name: user-api
+nothing: null
+quoted: "a: b"
+tags:
+  - a
+  - b: 1
+    c: "yes"
+`)
+		})
+	})
+}
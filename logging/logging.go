@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying a log entry, so that everything logged while serving a request
+// may be correlated
+func NewContext(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, entry)
+}
+
+// FromContext returns the log entry carried by ctx, falling back to the standard logger when there is none
+func FromContext(ctx context.Context) *log.Entry {
+
+	if entry, ok := ctx.Value(contextKey{}).(*log.Entry); ok {
+		return entry
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// Level returns the name of the level at which the standard logger logs
+func Level() string {
+	return log.GetLevel().String()
+}
+
+// SetLevel sets the level at which the standard logger logs, by its lower case name, returning the previous level
+func SetLevel(level string) (string, error) {
+
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return "", err
+	}
+
+	previous := Level()
+	log.SetLevel(lvl)
+	return previous, nil
+}
+
+// Levels returns the names of every level at which the standard logger may log, most severe first
+func Levels() []string {
+
+	levels := make([]string, 0, len(log.AllLevels))
+	for _, level := range log.AllLevels {
+		levels = append(levels, level.String())
+	}
+	return levels
+}
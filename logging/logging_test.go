@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitFromContext(t *testing.T) {
+
+	Convey("Given a context carrying a log entry", t, func() {
+
+		entry := log.WithField("request_id", "123")
+		ctx := NewContext(context.Background(), entry)
+
+		Convey("Then I expect the same entry to be returned", func() {
+
+			So(FromContext(ctx), ShouldEqual, entry)
+		})
+	})
+
+	Convey("Given a context without a log entry", t, func() {
+
+		Convey("Then I expect an entry of the standard logger, without fields", func() {
+
+			entry := FromContext(context.Background())
+			So(entry.Logger, ShouldEqual, log.StandardLogger())
+			So(entry.Data, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestUnitSetLevel(t *testing.T) {
+
+	defer log.SetLevel(log.GetLevel())
+
+	Convey("Given the standard logger logs at info", t, func() {
+
+		log.SetLevel(log.InfoLevel)
+
+		Convey("When I set the level to debug", func() {
+
+			previous, err := SetLevel("debug")
+
+			Convey("Then I expect the level to change, and the previous level to be returned", func() {
+
+				So(err, ShouldBeNil)
+				So(previous, ShouldEqual, "info")
+				So(Level(), ShouldEqual, "debug")
+			})
+		})
+
+		Convey("When I set the level to one which doesn't exist", func() {
+
+			_, err := SetLevel("loud")
+
+			Convey("Then I expect an error, and the level to be unchanged", func() {
+
+				So(err, ShouldNotBeNil)
+				So(Level(), ShouldEqual, "info")
+			})
+		})
+	})
+
+	Convey("Given I list the levels", t, func() {
+
+		Convey("Then I expect every level, most severe first", func() {
+
+			So(Levels(), ShouldResemble, []string{"panic", "fatal", "error", "warning", "info", "debug", "trace"})
+		})
+	})
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"github.com/bpsaunders/user-api/auth"
 	"github.com/bpsaunders/user-api/config"
 	"github.com/bpsaunders/user-api/handlers"
+	"github.com/bpsaunders/user-api/logging"
 	"github.com/bpsaunders/user-api/service"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
@@ -18,41 +21,89 @@ import (
 func main() {
 
 	cfg, err := config.Get()
+	if report, ok := err.(*config.ValidationReport); ok {
+		for _, problem := range report.Problems {
+			log.Error(fmt.Sprintf("invalid configuration: %s", problem))
+		}
+		log.Error("error configuring service. Exiting")
+		os.Exit(1)
+	}
 	if err != nil {
 		log.Error(fmt.Sprintf("error configuring service: %s. Exiting", err))
 		os.Exit(1)
 	}
 
+	setLogFormat(cfg)
 	setLogLevel(cfg)
 
+	// flags are parsed on configuring, so any command follows them
+	if flag.Arg(0) == reencryptCommand {
+		os.Exit(reencrypt(cfg))
+	}
+
+	authenticator, err := auth.NewAuthenticator(cfg)
+	if err != nil {
+		log.Error(fmt.Sprintf("error configuring authentication: %s. Exiting", err))
+		os.Exit(1)
+	}
+
 	userService := service.NewUserService(cfg)
 	mainRouter := mux.NewRouter()
 
-	handlers.Register(mainRouter, userService)
+	readiness := handlers.Register(mainRouter, userService, authenticator)
+	bodyLimit := handlers.NewBodyLimit(cfg.MaxBodyBytes)
+	mainRouter.Use(bodyLimit.Middleware)
 
 	h := &http.Server{
-		Addr:    ":8888",
-		Handler: mainRouter,
+		Addr:         cfg.ListenAddr,
+		Handler:      mainRouter,
+		ReadTimeout:  time.Duration(cfg.ReadTimeout) * time.Millisecond,
+		WriteTimeout: time.Duration(cfg.WriteTimeout) * time.Millisecond,
+		IdleTimeout:  time.Duration(cfg.IdleTimeout) * time.Millisecond,
 	}
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
 	// run server in new go routine to allow app shutdown signal wait below
-	go func() {
-		err := h.ListenAndServe()
+	go func(cfg *config.Config) {
+		var err error
+		if cfg.TLSEnabled() {
+			log.Info(fmt.Sprintf("serving HTTPS on %s", cfg.ListenAddr))
+			err = h.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			log.Info(fmt.Sprintf("serving HTTP on %s", cfg.ListenAddr))
+			err = h.ListenAndServe()
+		}
 		if err != nil && err != http.ErrServerClosed {
+			log.Error(fmt.Sprintf("failed to serve requests: %s. Exiting", err))
 			os.Exit(1)
 		}
-	}()
+	}(cfg)
 
-	// wait for app shutdown message before attempting to close server gracefully
-	<-stop
+	// wait for app shutdown message before attempting to close server gracefully, reloading config when asked
+	for running := true; running; {
+		select {
+		case <-reload:
+			reloadConfig(bodyLimit)
+		case <-stop:
+			running = false
+		}
+	}
 
 	log.Info("shutting down server...")
 
-	userService.Shutdown()
-	timeout := time.Duration(5) * time.Second
+	// the shutdown settings may have been reloaded while serving
+	cfg, _ = config.Get()
+
+	// fail readiness checks for a while before closing the server, so that the load balancer drains us first
+	readiness.Drain()
+	time.Sleep(time.Duration(cfg.ShutdownDrainDelay) * time.Millisecond)
+
+	timeout := time.Duration(cfg.ShutdownGrace) * time.Millisecond
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
@@ -62,18 +113,81 @@ func main() {
 	} else {
 		log.Info("server shutdown gracefully")
 	}
+
+	// only release the db once in-flight requests have completed
+	userService.Shutdown()
 }
 
-func setLogLevel(cfg *config.Config) {
+// reloadConfig re-reads the configuration, applying each change which can be made while serving. An invalid
+// configuration is ignored, leaving the current one in place
+func reloadConfig(bodyLimit *handlers.BodyLimit) {
 
-	if cfg.LogLevel != "" {
-		log.Info(fmt.Sprintf("Log level set in environment, attempting to set log level to: %s", cfg.LogLevel))
-		lvl, err := log.ParseLevel(cfg.LogLevel)
-		if err != nil {
-			log.Error(fmt.Sprintf("failed to set log level: %s. Exiting", err))
-			os.Exit(1)
+	log.Info("reloading configuration...")
+
+	cfg, changes, err := config.Reload()
+	if report, ok := err.(*config.ValidationReport); ok {
+		for _, problem := range report.Problems {
+			log.Error(fmt.Sprintf("invalid configuration: %s", problem))
 		}
-		log.SetLevel(lvl)
-		log.Info("Log level set successfully")
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to reload configuration, keeping the current configuration: %s", err))
+		return
+	}
+
+	// the level is always reapplied, so that reloading undoes any level set through the admin endpoint
+	setLogLevel(cfg)
+
+	if len(changes) == 0 {
+		log.Info("configuration reloaded without changes")
+		return
+	}
+
+	// settings which can't be applied keep their current values, so that they're reported again on each reload
+	// until the application restarts
+	for _, change := range changes {
+
+		logger := log.WithField("setting", change.Setting).WithField("before", change.Before).WithField("after", change.After)
+		if !change.Reloadable {
+			logger.Warn("configuration change will only take effect on restart")
+			continue
+		}
+
+		switch change.Setting {
+		case "LOG_FORMAT":
+			setLogFormat(cfg)
+		case "MAX_BODY_BYTES":
+			bodyLimit.Set(cfg.MaxBodyBytes)
+		}
+		// logged as a warning, so that the change is recorded whatever the log level now is
+		logger.Warn("configuration change applied")
+	}
+}
+
+func setLogFormat(cfg *config.Config) {
+
+	if cfg.LogFormat == config.LogFormatJSON {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{})
+	}
+}
+
+// setLogLevel sets the configured log level, or info where none is configured. The level is validated with the
+// rest of the configuration, so can't be invalid here
+func setLogLevel(cfg *config.Config) {
+
+	level := cfg.LogLevel
+	if level == "" {
+		level = log.InfoLevel.String()
+	}
+
+	previous, err := logging.SetLevel(level)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to set log level: %s", err))
+		return
+	}
+	if previous != logging.Level() {
+		log.Info(fmt.Sprintf("Log level set to: %s", logging.Level()))
 	}
 }
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// Default is the registry of the application's metrics, exposed by Handler
+var Default = NewRegistry()
+
+// HTTPRequests counts requests served, by route template, method and status
+var HTTPRequests = NewCounterVec("http_requests_total",
+	"Total HTTP requests served, by route template, method and status", "route", "method", "status")
+
+// HTTPRequestDuration observes the latency of requests served, by route template, method and status
+var HTTPRequestDuration = NewHistogramVec("http_request_duration_seconds",
+	"Latency of HTTP requests served, in seconds, by route template, method and status", DefaultBuckets, "route", "method", "status")
+
+// HTTPRequestsInFlight gauges the requests currently being served, by route template and method
+var HTTPRequestsInFlight = NewGaugeVec("http_requests_in_flight",
+	"HTTP requests currently being served, by route template and method", "route", "method")
+
+// DBOperations counts db operations, by operation and outcome
+var DBOperations = NewCounterVec("db_operations_total",
+	"Total db operations, by operation and outcome", "operation", "outcome")
+
+// DBOperationDuration observes the latency of db operations, by operation
+var DBOperationDuration = NewHistogramVec("db_operation_duration_seconds",
+	"Latency of db operations, in seconds, by operation", DefaultBuckets, "operation")
+
+// ServiceResponses counts the outcomes of user service operations, by operation and response type
+var ServiceResponses = NewCounterVec("service_responses_total",
+	"Total user service responses, by operation and response type", "operation", "response_type")
+
+func init() {
+	Default.Register(HTTPRequests)
+	Default.Register(HTTPRequestDuration)
+	Default.Register(HTTPRequestsInFlight)
+	Default.Register(DBOperations)
+	Default.Register(DBOperationDuration)
+	Default.Register(ServiceResponses)
+}
+
+// Handler returns a handler exposing the default registry in the Prometheus text exposition format
+func Handler() http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		err := Default.Write(w)
+		if err != nil {
+			log.Error(fmt.Sprintf("Error writing metrics: %v", err))
+		}
+	})
+}
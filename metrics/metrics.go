@@ -0,0 +1,348 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of histogram buckets suited to request latencies
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector provides an interface by which a metric is written in the Prometheus text exposition format
+type Collector interface {
+	Write(w io.Writer) error
+}
+
+// Registry holds the collectors exposed by the application
+type Registry struct {
+	mtx        sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry returns a new, empty Registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a collector to the registry
+func (r *Registry) Register(collector Collector) {
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.collectors = append(r.collectors, collector)
+}
+
+// Write writes every registered collector in the Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) error {
+
+	r.mtx.Lock()
+	collectors := append([]Collector{}, r.collectors...)
+	r.mtx.Unlock()
+
+	for _, collector := range collectors {
+		if err := collector.Write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vec holds the series of a metric, keyed by label values
+type vec struct {
+	mtx        sync.RWMutex
+	name       string
+	help       string
+	metricType string
+	labels     []string
+	series     map[string]*series
+}
+
+type series struct {
+	mtx         sync.Mutex
+	labelValues []string
+	value       float64
+	buckets     []float64
+	counts      []uint64
+	count       uint64
+}
+
+func newVec(name, help, metricType string, labels []string) *vec {
+	return &vec{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labels:     labels,
+		series:     make(map[string]*series),
+	}
+}
+
+func (v *vec) get(labelValues []string, buckets []float64) *series {
+
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	v.mtx.RLock()
+	s, ok := v.series[key]
+	v.mtx.RUnlock()
+	if ok {
+		return s
+	}
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	if s, ok = v.series[key]; !ok {
+		s = &series{
+			labelValues: append([]string{}, labelValues...),
+			buckets:     buckets,
+			counts:      make([]uint64, len(buckets)),
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series of the metric ordered by label values, so output is stable between scrapes
+func (v *vec) sorted() []*series {
+
+	v.mtx.RLock()
+	defer v.mtx.RUnlock()
+
+	all := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labelValues, "\xff") < strings.Join(all[j].labelValues, "\xff")
+	})
+	return all
+}
+
+func (v *vec) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.metricType)
+	return err
+}
+
+// CounterVec is a monotonically increasing metric, partitioned by labels
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec returns a new CounterVec
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, "counter", labels)}
+}
+
+// Inc increments the counter for the given label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative value to the counter for the given label values
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+
+	if value < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.name))
+	}
+
+	s := c.get(labelValues, nil)
+	s.mtx.Lock()
+	s.value += value
+	s.mtx.Unlock()
+}
+
+// Value returns the current value of the counter for the given label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+
+	s := c.get(labelValues, nil)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.value
+}
+
+// Write writes the counter in the Prometheus text exposition format
+func (c *CounterVec) Write(w io.Writer) error {
+	return c.writeValues(w)
+}
+
+// GaugeVec is a metric which may go up and down, partitioned by labels
+type GaugeVec struct {
+	*vec
+}
+
+// NewGaugeVec returns a new GaugeVec
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, "gauge", labels)}
+}
+
+// Add adds a value, which may be negative, to the gauge for the given label values
+func (g *GaugeVec) Add(value float64, labelValues ...string) {
+
+	s := g.get(labelValues, nil)
+	s.mtx.Lock()
+	s.value += value
+	s.mtx.Unlock()
+}
+
+// Inc increments the gauge for the given label values
+func (g *GaugeVec) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec decrements the gauge for the given label values
+func (g *GaugeVec) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Value returns the current value of the gauge for the given label values
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+
+	s := g.get(labelValues, nil)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.value
+}
+
+// Write writes the gauge in the Prometheus text exposition format
+func (g *GaugeVec) Write(w io.Writer) error {
+	return g.writeValues(w)
+}
+
+func (v *vec) writeValues(w io.Writer) error {
+
+	if err := v.writeHeader(w); err != nil {
+		return err
+	}
+
+	for _, s := range v.sorted() {
+		s.mtx.Lock()
+		value := s.value
+		s.mtx.Unlock()
+
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, s.labelValues), formatValue(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistogramVec samples observations into buckets, partitioned by labels
+type HistogramVec struct {
+	*vec
+	buckets []float64
+}
+
+// NewHistogramVec returns a new HistogramVec with the given bucket upper bounds
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+
+	return &HistogramVec{newVec(name, help, "histogram", labels), sorted}
+}
+
+// Observe records an observation for the given label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+
+	s := h.get(labelValues, h.buckets)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for i, bound := range s.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+// Count returns the number of observations for the given label values
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+
+	s := h.get(labelValues, h.buckets)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.count
+}
+
+// Write writes the histogram in the Prometheus text exposition format
+func (h *HistogramVec) Write(w io.Writer) error {
+
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+
+	bucketLabels := append(append([]string{}, h.labels...), "le")
+
+	for _, s := range h.sorted() {
+		s.mtx.Lock()
+		counts := append([]uint64{}, s.counts...)
+		count, sum := s.count, s.value
+		s.mtx.Unlock()
+
+		for i, bound := range s.buckets {
+			labelValues := append(append([]string{}, s.labelValues...), formatValue(bound))
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(bucketLabels, labelValues), counts[i]); err != nil {
+				return err
+			}
+		}
+
+		infLabelValues := append(append([]string{}, s.labelValues...), "+Inf")
+		labels := formatLabels(h.labels, s.labelValues)
+
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, formatLabels(bucketLabels, infLabelValues), count,
+			h.name, labels, formatValue(sum),
+			h.name, labels, count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLabels(names, values []string) string {
+
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitCounterVec(t *testing.T) {
+
+	Convey("Given I increment a counter with different labels", t, func() {
+
+		counter := NewCounterVec("requests_total", "Total requests", "method", "path")
+		counter.Inc("GET", "/b")
+		counter.Inc("GET", "/a")
+		counter.Add(2, "GET", "/a")
+		counter.Inc("POST", `/"quoted"`)
+
+		Convey("Then I expect each series to hold its own value", func() {
+
+			So(counter.Value("GET", "/a"), ShouldEqual, 3)
+			So(counter.Value("GET", "/b"), ShouldEqual, 1)
+		})
+
+		Convey("Then I expect it to be written in the text exposition format, ordered by labels", func() {
+
+			var buf bytes.Buffer
+			So(counter.Write(&buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, `# HELP requests_total Total requests
+# TYPE requests_total counter
+requests_total{method="GET",path="/a"} 3
+requests_total{method="GET",path="/b"} 1
+requests_total{method="POST",path="/\"quoted\""} 1
+`)
+		})
+
+		Convey("Then I expect decrementing it to panic", func() {
+
+			So(func() { counter.Add(-1, "GET", "/a") }, ShouldPanic)
+		})
+
+		Convey("Then I expect using the wrong number of labels to panic", func() {
+
+			So(func() { counter.Inc("GET") }, ShouldPanic)
+		})
+	})
+}
+
+func TestUnitGaugeVec(t *testing.T) {
+
+	Convey("Given I increment and decrement a gauge", t, func() {
+
+		gauge := NewGaugeVec("in_flight", "In flight")
+		gauge.Inc()
+		gauge.Inc()
+		gauge.Dec()
+
+		Convey("Then I expect it to be written in the text exposition format", func() {
+
+			var buf bytes.Buffer
+			So(gauge.Write(&buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "# HELP in_flight In flight\n# TYPE in_flight gauge\nin_flight 1\n")
+		})
+	})
+}
+
+func TestUnitHistogramVec(t *testing.T) {
+
+	Convey("Given I observe values in a histogram", t, func() {
+
+		histogram := NewHistogramVec("latency_seconds", "Latency", []float64{1, 0.1}, "op")
+		histogram.Observe(0.05, "get")
+		histogram.Observe(0.5, "get")
+		histogram.Observe(5, "get")
+
+		Convey("Then I expect cumulative buckets, a sum and a count", func() {
+
+			So(histogram.Count("get"), ShouldEqual, 3)
+
+			var buf bytes.Buffer
+			So(histogram.Write(&buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, `# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="get",le="0.1"} 1
+latency_seconds_bucket{op="get",le="1"} 2
+latency_seconds_bucket{op="get",le="+Inf"} 3
+latency_seconds_sum{op="get"} 5.55
+latency_seconds_count{op="get"} 3
+`)
+		})
+	})
+}
+
+func TestUnitRegistry(t *testing.T) {
+
+	Convey("Given I register collectors", t, func() {
+
+		registry := NewRegistry()
+		first := NewCounterVec("first_total", "First")
+		second := NewCounterVec("second_total", "Second")
+		registry.Register(first)
+		registry.Register(second)
+		first.Inc()
+
+		Convey("Then I expect each to be written in the order registered", func() {
+
+			var buf bytes.Buffer
+			So(registry.Write(&buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "# HELP first_total First\n# TYPE first_total counter\nfirst_total 1\n"+
+				"# HELP second_total Second\n# TYPE second_total counter\n")
+		})
+	})
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// Cursor describes a position within a sorted list of users from which to continue paging
+type Cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	ID     string   `json:"id"`
+}
+
+// Encode returns an opaque, URL safe representation of the cursor
+func (c *Cursor) Encode() string {
+
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor from its opaque representation
+func DecodeCursor(encoded string) (*Cursor, error) {
+
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor Cursor
+	err = json.Unmarshal(b, &cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cursor, nil
+}
@@ -1,10 +1,100 @@
 package models
 
+import "time"
+
 // UserDao describes a user database entity
 type UserDao struct {
-	ID        string `bson:"_id"`
-	FirstName string `bson:"first_name"`
-	LastName  string `bson:"last_name"`
-	Email     string `bson:"email"`
-	Country   string `bson:"country"`
+	ID        string    `bson:"_id"`
+	FirstName string    `bson:"first_name"`
+	LastName  string    `bson:"last_name"`
+	Email     string    `bson:"email"`
+	Country   string    `bson:"country"`
+	CreatedAt time.Time `bson:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at"`
+
+	// Version is incremented on every write to the user, so that writes may be conditional upon it
+	Version int64 `bson:"version"`
+
+	// NormalisedEmail holds a lower-cased copy of the email, against which uniqueness is enforced. It's removed
+	// while the user is deleted, so that the email may be reused
+	NormalisedEmail string `bson:"normalised_email,omitempty"`
+
+	// DeletedAt marks a user as deleted, from which time it may be restored until it's purged
+	DeletedAt *time.Time `bson:"deleted_at,omitempty"`
+
+	// ErasedAt marks a user as irreversibly anonymised, upon which it's also deleted but never restored or purged
+	ErasedAt *time.Time `bson:"erased_at,omitempty"`
+}
+
+// AuditEventDao describes an audit event database entity, recording a single mutation of a user. Audit events
+// are only ever appended, never updated or removed
+type AuditEventDao struct {
+	ID        string           `bson:"_id"`
+	UserID    string           `bson:"user_id"`
+	Actor     string           `bson:"actor"`
+	Operation string           `bson:"operation"`
+	Timestamp time.Time        `bson:"timestamp"`
+	Changes   []FieldChangeDao `bson:"changes"`
+
+	// Sequence orders the events of a user, being the version of the user an event produced, or the version
+	// after its last on deletion. Versions only ever advance, so the order is that in which mutations were made
+	Sequence int64 `bson:"sequence"`
+}
+
+// FieldChangeDao describes the value of a user field before and after a mutation. A nil value denotes the field
+// of a user which didn't exist, before its creation or after its deletion
+type FieldChangeDao struct {
+	Field  string  `bson:"field"`
+	Before *string `bson:"before"`
+	After  *string `bson:"after"`
+}
+
+// IdempotencyRecordDao describes a request made with an idempotency key, so that a retry of the request may be
+// answered with the response to the original, rather than being carried out again
+type IdempotencyRecordDao struct {
+	ID          string    `bson:"_id"`
+	Fingerprint string    `bson:"fingerprint"`
+	CreatedAt   time.Time `bson:"created_at"`
+
+	// Response holds the encoded response to the request, or nil while the request is in progress
+	Response []byte `bson:"response"`
+
+	// UserID holds the id of the user the request created, once it's completed, if it created one
+	UserID string `bson:"user_id"`
+}
+
+// ErasureReceiptDao describes the erasure of a user, as proof that it was carried out. There's at most one receipt
+// per user, so it's stored by the id of the user
+type ErasureReceiptDao struct {
+	UserID    string    `bson:"_id"`
+	Actor     string    `bson:"actor"`
+	ErasedAt  time.Time `bson:"erased_at"`
+	Tombstone string    `bson:"tombstone"`
+
+	// ReregistrationBlocked records whether the email of the user may never again be registered
+	ReregistrationBlocked bool `bson:"reregistration_blocked"`
+
+	// Signature authenticates the other fields of the receipt, so that it can't be forged or altered
+	SignatureAlgorithm string `bson:"signature_algorithm"`
+	Signature          string `bson:"signature"`
+}
+
+// UserStatsDao describes counts of users aggregated by the db
+type UserStatsDao struct {
+	Total        int64            `bson:"total"`
+	Countries    []GroupCountDao  `bson:"countries"`
+	EmailDomains []GroupCountDao  `bson:"email_domains"`
+	Signups      []SignupCountDao `bson:"signups"`
+}
+
+// GroupCountDao describes the number of users sharing the value of a field
+type GroupCountDao struct {
+	Value string `bson:"_id"`
+	Count int64  `bson:"count"`
+}
+
+// SignupCountDao describes the number of users created within an interval, by the time at which it starts
+type SignupCountDao struct {
+	Start time.Time `bson:"_id"`
+	Count int64     `bson:"count"`
 }
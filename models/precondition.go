@@ -0,0 +1,24 @@
+package models
+
+// Precondition describes the versions of a user upon which a write is conditional, as given by an If-Match header
+type Precondition struct {
+	// Any is set when the write may apply to any version of the user, so long as it exists
+	Any bool
+
+	Versions []int64
+}
+
+// Met determines whether the precondition holds for the given version of a user; a nil precondition always holds
+func (p *Precondition) Met(version int64) bool {
+
+	if p == nil || p.Any {
+		return true
+	}
+
+	for _, v := range p.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitPreconditionMet(t *testing.T) {
+
+	Convey("Given there is no precondition", t, func() {
+
+		var precondition *Precondition
+
+		Convey("Then I expect it to be met by any version", func() {
+
+			So(precondition.Met(1), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a precondition upon any version", t, func() {
+
+		precondition := &Precondition{Any: true}
+
+		Convey("Then I expect it to be met by any version", func() {
+
+			So(precondition.Met(1), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a precondition upon particular versions", t, func() {
+
+		precondition := &Precondition{Versions: []int64{2, 3}}
+
+		Convey("Then I expect it to be met by only those versions", func() {
+
+			So(precondition.Met(2), ShouldBeTrue)
+			So(precondition.Met(3), ShouldBeTrue)
+			So(precondition.Met(4), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a precondition without any versions", t, func() {
+
+		precondition := &Precondition{}
+
+		Convey("Then I expect it never to be met", func() {
+
+			So(precondition.Met(1), ShouldBeFalse)
+		})
+	})
+}
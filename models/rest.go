@@ -1,10 +1,174 @@
 package models
 
-// User describes a user REST resource
+import (
+	"encoding/json"
+	"time"
+)
+
+// User describes a user REST resource. The id, timestamps and links are set by the api, never the client
 type User struct {
-	ID        string `json:"id,omitempty"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Email     string `json:"email"`
-	Country   string `json:"country"`
+	ID        string    `json:"id,omitempty"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	Country   string    `json:"country"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Links     Links     `json:"links"`
+
+	// Version is exposed as an entity tag rather than in the body
+	Version int64 `json:"-"`
+}
+
+// Links describes the locations of a REST resource
+type Links struct {
+	Self string `json:"self"`
+}
+
+// UserList describes a page of user REST resources
+type UserList struct {
+	Items      []*User `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	TotalCount *int64  `json:"total_count,omitempty"`
+}
+
+// UserListQuery describes the raw query parameters by which a list of users is requested
+type UserListQuery struct {
+	Limit        string
+	Cursor       string
+	Sort         string
+	Country      string
+	EmailDomain  string
+	NamePrefix   string
+	IncludeTotal bool
+}
+
+// UserSearchQuery describes the raw query parameters by which users are searched
+type UserSearchQuery struct {
+	Q     string
+	Limit string
+}
+
+// the intervals by which signups may be counted. Weeks start on Monday, and every interval starts at midnight UTC
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// StatsIntervals holds every interval by which signups may be counted
+var StatsIntervals = []string{IntervalDay, IntervalWeek, IntervalMonth}
+
+// UserStatsQuery describes the raw query parameters by which statistics of users are requested
+type UserStatsQuery struct {
+	Country     string
+	EmailDomain string
+	From        string
+	To          string
+	Interval    string
+	Top         string
+}
+
+// UserStats describes counts of the users matching the filters of a request, as they were when generated
+type UserStats struct {
+	Total        int64           `json:"total"`
+	Countries    []*CountryCount `json:"countries"`
+	EmailDomains []*DomainCount  `json:"email_domains"`
+	Interval     string          `json:"interval"`
+	Signups      []*SignupCount  `json:"signups"`
+	GeneratedAt  time.Time       `json:"generated_at"`
+}
+
+// CountryCount describes the number of users in a country
+type CountryCount struct {
+	Country string `json:"country"`
+	Count   int64  `json:"count"`
+}
+
+// DomainCount describes the number of users with emails in a domain
+type DomainCount struct {
+	Domain string `json:"domain"`
+	Count  int64  `json:"count"`
+}
+
+// SignupCount describes the number of users created within an interval, by the time at which it starts
+type SignupCount struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+// AuditEvent describes a mutation of a user, as recorded in its history
+type AuditEvent struct {
+	ID        string        `json:"id"`
+	UserID    string        `json:"user_id"`
+	Actor     string        `json:"actor"`
+	Operation string        `json:"operation"`
+	Timestamp time.Time     `json:"timestamp"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// FieldChange describes the value of a user field before and after a mutation, null where the user didn't exist
+type FieldChange struct {
+	Field  string  `json:"field"`
+	Before *string `json:"before"`
+	After  *string `json:"after"`
+}
+
+// AuditEventList describes a page of the history of a user, most recent first
+type AuditEventList struct {
+	Items      []*AuditEvent `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// UserHistoryQuery describes the raw query parameters by which the history of a user is requested
+type UserHistoryQuery struct {
+	Limit  string
+	Cursor string
+}
+
+// DataExport describes everything held about a user, as handed to them upon a subject access request
+type DataExport struct {
+	ExportedAt         time.Time            `json:"exported_at"`
+	User               *UserRecord          `json:"user"`
+	History            []*AuditEvent        `json:"history"`
+	IdempotentRequests []*IdempotentRequest `json:"idempotent_requests"`
+}
+
+// IdempotentRequest describes a request made with an idempotency key which created a user, and the response held
+// to replay to its retries until the key expires
+type IdempotentRequest struct {
+	CreatedAt time.Time       `json:"created_at"`
+	Response  json.RawMessage `json:"response"`
+}
+
+// UserRecord describes a user exactly as stored, including the fields the api otherwise keeps to itself
+type UserRecord struct {
+	ID        string     `json:"id"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	Email     string     `json:"email"`
+	Country   string     `json:"country"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Version   int64      `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ErasureReceipt describes the erasure of a user, signed by the api
+type ErasureReceipt struct {
+	UserID                string    `json:"user_id"`
+	Actor                 string    `json:"actor"`
+	ErasedAt              time.Time `json:"erased_at"`
+	Tombstone             string    `json:"tombstone"`
+	ReregistrationBlocked bool      `json:"reregistration_blocked"`
+	SignatureAlgorithm    string    `json:"signature_algorithm"`
+	Signature             string    `json:"signature"`
+}
+
+// ImportRow describes a record submitted for bulk import, numbered from 1 in the order submitted. A record which
+// couldn't be parsed as a user carries the reason in place of the user
+type ImportRow struct {
+	Row       int
+	User      *User
+	Malformed string
 }
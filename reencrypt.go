@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/bpsaunders/user-api/config"
+	"github.com/bpsaunders/user-api/db"
+	log "github.com/sirupsen/logrus"
+)
+
+// reencryptCommand is the command by which the application re-encrypts the personal data it stores under the
+// current master key, rather than serving requests
+const reencryptCommand = "reencrypt"
+
+// reencrypt re-encrypts every record which isn't encrypted under the current master key, returning the status
+// with which to exit
+func reencrypt(cfg *config.Config) int {
+
+	if cfg.StorageBackend != config.StorageBackendMongoDB {
+		log.Error(fmt.Sprintf("personal data is only encrypted when stored in %s; nothing to re-encrypt. Exiting", config.StorageBackendMongoDB))
+		return 1
+	}
+
+	client := db.NewDatabaseClient(cfg)
+	defer client.Shutdown()
+
+	log.Info("re-encrypting personal data under the current master key...")
+
+	reencrypted, skipped, err := client.Reencrypt(context.Background())
+	logger := log.WithField("reencrypted", reencrypted).WithField("skipped", skipped)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to re-encrypt personal data: %s. Exiting", err))
+		return 1
+	}
+
+	// a record is skipped if it changes meanwhile, which only leaves it under a retired key if it was written by an
+	// instance yet to be given the current one
+	if skipped > 0 {
+		logger.Warn("some records changed while being re-encrypted; run again once every instance has the current master key, before retiring any other")
+		return 1
+	}
+
+	logger.Info("personal data re-encrypted; retired master keys may now be removed")
+	return 0
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/bpsaunders/user-api/auth"
+	"github.com/bpsaunders/user-api/logging"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/hashicorp/go-uuid"
+	"strconv"
+	"time"
+)
+
+// operations recorded in the history of a user
+const (
+	operationCreate  = "create"
+	operationUpdate  = "update"
+	operationPatch   = "patch"
+	operationDelete  = "delete"
+	operationRestore = "restore"
+	operationErase   = "erase"
+)
+
+// unknownActor is recorded as the actor of a mutation made on behalf of no authenticated principal
+const unknownActor = "unknown"
+
+// auditedFields holds the bson names of the user fields whose changes are recorded in the history of a user
+var auditedFields = []string{"first_name", "last_name", "email", "country", "created_at", "updated_at", "version"}
+
+// recordAudit appends an audit event for a successful mutation of a user, from its state before to its state
+// after; one or the other is nil where the user didn't exist. The mutation has already been made by this point,
+// so a failure to record it is logged rather than failing the request
+func (service *UserServiceImpl) recordAudit(ctx context.Context, operation string, before *models.UserDao, after *models.UserDao) {
+
+	event, err := newAuditEvent(ctx, operation, before, after)
+	if err == nil {
+		err = service.db.CreateAuditEvent(ctx, event)
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithField("user_id", event.UserID).WithField("operation", operation).
+			Error(fmt.Sprintf("failed to record an audit event: %v", err))
+	}
+}
+
+// newAuditEvent returns the audit event of a mutation of a user, from its state before to its state after
+func newAuditEvent(ctx context.Context, operation string, before *models.UserDao, after *models.UserDao) (*models.AuditEventDao, error) {
+
+	event := &models.AuditEventDao{
+		Actor:     actor(ctx),
+		Operation: operation,
+		Timestamp: now(),
+		Changes:   diff(before, after),
+	}
+	if after != nil {
+		event.UserID, event.Sequence = after.ID, after.Version
+	} else {
+		event.UserID, event.Sequence = before.ID, before.Version+1
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return event, err
+	}
+	event.ID = id
+
+	return event, nil
+}
+
+// actor identifies the principal on whose behalf a mutation is made
+func actor(ctx context.Context) string {
+
+	principal, ok := auth.FromContext(ctx)
+	if !ok || principal == nil {
+		return unknownActor
+	}
+	return principal.Subject
+}
+
+// diff returns the audited fields whose values differ between two states of a user
+func diff(before *models.UserDao, after *models.UserDao) []models.FieldChangeDao {
+
+	changes := make([]models.FieldChangeDao, 0)
+	for _, field := range auditedFields {
+		b, a := auditedValue(before, field), auditedValue(after, field)
+		if b == nil || a == nil || *b != *a {
+			changes = append(changes, models.FieldChangeDao{
+				Field:  field,
+				Before: b,
+				After:  a,
+			})
+		}
+	}
+	return changes
+}
+
+// auditedValue returns the value of a user field as it is recorded in the history of a user, or nil if the
+// user doesn't exist
+func auditedValue(entity *models.UserDao, field string) *string {
+
+	if entity == nil {
+		return nil
+	}
+
+	var value string
+	switch field {
+	case "first_name":
+		value = entity.FirstName
+	case "last_name":
+		value = entity.LastName
+	case "email":
+		value = entity.Email
+	case "country":
+		value = entity.Country
+	case "created_at":
+		value = entity.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		value = entity.UpdatedAt.Format(time.RFC3339Nano)
+	case "version":
+		value = strconv.FormatInt(entity.Version, 10)
+	}
+	return &value
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"errors"
+	"github.com/bpsaunders/user-api/auth"
+	"github.com/bpsaunders/user-api/db"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/transformers"
+	"github.com/bpsaunders/user-api/validators"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitDiff(t *testing.T) {
+
+	before := &models.UserDao{
+		ID:        id,
+		FirstName: "firstName",
+		LastName:  "lastName",
+		Email:     "old@mail.com",
+		Country:   "GB",
+		CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Version:   1,
+	}
+
+	Convey("Given a user is modified", t, func() {
+
+		after := *before
+		after.Email = "new@mail.com"
+		after.UpdatedAt = time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+		after.Version = 2
+
+		changes := diff(before, &after)
+
+		Convey("Then I expect only the fields which changed to be recorded", func() {
+
+			So(changes, ShouldResemble, []models.FieldChangeDao{
+				{Field: "email", Before: stringPointer("old@mail.com"), After: stringPointer("new@mail.com")},
+				{Field: "updated_at", Before: stringPointer("2020-01-01T00:00:00Z"), After: stringPointer("2020-02-01T00:00:00Z")},
+				{Field: "version", Before: stringPointer("1"), After: stringPointer("2")},
+			})
+		})
+	})
+
+	Convey("Given a user is deleted", t, func() {
+
+		changes := diff(before, nil)
+
+		Convey("Then I expect every field to be recorded, without a value after", func() {
+
+			So(len(changes), ShouldEqual, len(auditedFields))
+			for _, change := range changes {
+				So(change.Before, ShouldNotBeNil)
+				So(change.After, ShouldBeNil)
+			}
+		})
+	})
+}
+
+func TestUnitGetUserHistory(t *testing.T) {
+
+	svc := &UserServiceImpl{
+		transformer: transformers.NewUserTransformer(),
+		validator:   validators.NewUserValidator(),
+		db:          db.NewMemoryClient(),
+	}
+
+	principalCtx := auth.NewContext(ctx, &auth.Principal{Subject: "api-key:admin"})
+
+	Convey("Given I create, patch and delete a user", t, func() {
+
+		responseType, created, _, err := svc.CreateUser(principalCtx, &models.User{
+			FirstName: "firstName",
+			LastName:  "lastName",
+			Email:     "user@mail.com",
+			Country:   "GB",
+		})
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+
+		responseType, _, _, err = svc.PatchUser(principalCtx, created.ID, map[string]interface{}{"first_name": "changed"}, nil)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+
+		responseType, err = svc.DeleteUser(ctx, created.ID, nil)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+
+		Convey("When I fetch the history of the deleted user", func() {
+
+			responseType, history, validationErrors, err := svc.GetUserHistory(ctx, created.ID, &models.UserHistoryQuery{})
+
+			Convey("Then I expect every mutation, most recent first, with its actor and changes", func() {
+
+				So(responseType, ShouldEqual, Success)
+				So(len(validationErrors), ShouldEqual, 0)
+				So(err, ShouldBeNil)
+				So(len(history.Items), ShouldEqual, 3)
+				So(history.NextCursor, ShouldBeEmpty)
+
+				deleted, patched, createdEvent := history.Items[0], history.Items[1], history.Items[2]
+
+				So(deleted.Operation, ShouldEqual, operationDelete)
+				So(deleted.Actor, ShouldEqual, unknownActor)
+
+				So(patched.Operation, ShouldEqual, operationPatch)
+				So(patched.Actor, ShouldEqual, "api-key:admin")
+				So(patched.Changes[0], ShouldResemble, models.FieldChange{
+					Field:  "first_name",
+					Before: stringPointer("firstName"),
+					After:  stringPointer("changed"),
+				})
+
+				So(createdEvent.Operation, ShouldEqual, operationCreate)
+				So(createdEvent.UserID, ShouldEqual, created.ID)
+				So(createdEvent.Changes[0].Before, ShouldBeNil)
+			})
+		})
+
+		Convey("When I page through the history of the deleted user", func() {
+
+			_, first, _, err := svc.GetUserHistory(ctx, created.ID, &models.UserHistoryQuery{Limit: "2"})
+
+			So(err, ShouldBeNil)
+			So(len(first.Items), ShouldEqual, 2)
+			So(first.NextCursor, ShouldNotBeEmpty)
+
+			_, second, _, err := svc.GetUserHistory(ctx, created.ID, &models.UserHistoryQuery{Limit: "2", Cursor: first.NextCursor})
+
+			Convey("Then I expect the remaining event on the next page", func() {
+
+				So(err, ShouldBeNil)
+				So(len(second.Items), ShouldEqual, 1)
+				So(second.Items[0].Operation, ShouldEqual, operationCreate)
+				So(second.NextCursor, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given I fetch the history of a user which has never existed", t, func() {
+
+		responseType, history, _, err := svc.GetUserHistory(ctx, "missing", &models.UserHistoryQuery{})
+
+		Convey("Then I expect a 'not-found' response type", func() {
+
+			So(responseType, ShouldEqual, NotFound)
+			So(history, ShouldBeNil)
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Given I fetch the history of a user with an invalid limit", t, func() {
+
+		responseType, history, validationErrors, err := svc.GetUserHistory(ctx, id, &models.UserHistoryQuery{Limit: "0"})
+
+		Convey("Then I expect an 'invalid-data' response type, with validation errors", func() {
+
+			So(responseType, ShouldEqual, InvalidData)
+			So(history, ShouldBeNil)
+			So(len(validationErrors), ShouldEqual, 1)
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func TestUnitRecordAuditFailure(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	client := db.NewMockClient(mockCtrl)
+
+	svc := &UserServiceImpl{
+		transformer: transformers.NewUserTransformer(),
+		validator:   validators.NewUserValidator(),
+		db:          client,
+	}
+
+	Convey("Given I delete a user, but the audit event can't be recorded", t, func() {
+
+		client.EXPECT().DeleteUser(gomock.Any(), id, db.AnyVersion).Return(&models.UserDao{ID: id, Version: 1}, nil)
+		client.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(errors.New("audit unavailable"))
+
+		responseType, err := svc.DeleteUser(ctx, id, nil)
+
+		Convey("Then I expect the delete, which has already been made, to succeed regardless", func() {
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func stringPointer(s string) *string {
+	return &s
+}
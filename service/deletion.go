@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/bpsaunders/user-api/db"
+	"github.com/bpsaunders/user-api/models"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// RestoreUser restores a deleted user according to an id, returning the representation of the restored user.
+// Restoring a user which isn't deleted has no effect, so the user is returned as it stands. An erased user is
+// gone for good, so is never found
+func (service *UserServiceImpl) RestoreUser(ctx context.Context, id string) (ResponseType, *models.User, error) {
+
+	ctx, cancel := service.writeContext(ctx)
+	defer cancel()
+
+	deleted, err := service.db.GetDeletedUser(ctx, id)
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+	if deleted == nil {
+		return service.currentUser(ctx, id)
+	}
+	if deleted.ErasedAt != nil {
+		return NotFound, nil, nil
+	}
+
+	entity := *deleted
+	entity.DeletedAt = nil
+	entity.UpdatedAt = now()
+	entity.Version = deleted.Version + 1
+
+	// the email may have been reused since the user was deleted, in which case it can't be restored
+	err = service.db.RestoreUser(ctx, &entity, deleted.Version)
+	if err == db.ErrDuplicateEmail {
+		return Conflict, nil, nil
+	}
+	if err == db.ErrVersionConflict {
+		// restored or purged concurrently
+		return service.currentUser(ctx, id)
+	}
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+
+	service.recordAudit(ctx, operationRestore, nil, &entity)
+
+	return Success, service.transformer.ToRest(&entity), nil
+}
+
+// currentUser returns the representation of a user which isn't deleted, if it exists
+func (service *UserServiceImpl) currentUser(ctx context.Context, id string) (ResponseType, *models.User, error) {
+
+	entity, err := service.db.GetUser(ctx, id)
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+	if entity == nil {
+		return NotFound, nil, nil
+	}
+
+	return Success, service.transformer.ToRest(entity), nil
+}
+
+// purgeDeletedUsers permanently removes users which have been deleted for longer than the retention period,
+// returning how many were removed
+func (service *UserServiceImpl) purgeDeletedUsers(ctx context.Context) (int64, error) {
+
+	ctx, cancel := service.writeContext(ctx)
+	defer cancel()
+
+	return service.db.PurgeUsers(ctx, now().Add(-service.retention))
+}
+
+// purgePeriodically purges deleted users on start-up, then at every interval, until the service is shut down
+func (service *UserServiceImpl) purgePeriodically(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := service.purgeDeletedUsers(context.Background())
+		if err != nil {
+			log.Error(fmt.Sprintf("failed to purge deleted users: %v", err))
+		} else if purged > 0 {
+			log.Info(fmt.Sprintf("purged %d users deleted more than %s ago", purged, service.retention))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-service.stopPurging:
+			return
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"github.com/bpsaunders/user-api/db"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/transformers"
+	"github.com/bpsaunders/user-api/validators"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitRestoreUser(t *testing.T) {
+
+	newService := func() *UserServiceImpl {
+		return &UserServiceImpl{
+			transformer: transformers.NewUserTransformer(),
+			validator:   validators.NewUserValidator(),
+			db:          db.NewMemoryClient(),
+		}
+	}
+
+	Convey("Given I delete a user", t, func() {
+
+		svc := newService()
+
+		_, created, _, err := svc.CreateUser(ctx, importUser("user@mail.com"))
+		So(err, ShouldBeNil)
+
+		responseType, err := svc.DeleteUser(ctx, created.ID, nil)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+
+		Convey("Then I expect it not to be found, and its email to be free", func() {
+
+			responseType, _, err := svc.GetUser(ctx, created.ID)
+
+			So(responseType, ShouldEqual, NotFound)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("When I restore it", func() {
+
+			responseType, restored, err := svc.RestoreUser(ctx, created.ID)
+
+			Convey("Then I expect it back, at a later version, with the restoration in its history", func() {
+
+				So(responseType, ShouldEqual, Success)
+				So(err, ShouldBeNil)
+				So(restored.ID, ShouldEqual, created.ID)
+				So(restored.Email, ShouldEqual, created.Email)
+				So(restored.Version, ShouldEqual, created.Version+2)
+
+				responseType, fetched, _ := svc.GetUser(ctx, created.ID)
+				So(responseType, ShouldEqual, Success)
+				So(fetched.Version, ShouldEqual, restored.Version)
+
+				_, history, _, _ := svc.GetUserHistory(ctx, created.ID, &models.UserHistoryQuery{})
+				So(history.Items[0].Operation, ShouldEqual, operationRestore)
+				So(history.Items[1].Operation, ShouldEqual, operationDelete)
+			})
+
+			Convey("And restore it again", func() {
+
+				responseType, again, err := svc.RestoreUser(ctx, created.ID)
+
+				Convey("Then I expect it as it stands, unchanged", func() {
+
+					So(responseType, ShouldEqual, Success)
+					So(err, ShouldBeNil)
+					So(again.Version, ShouldEqual, restored.Version)
+				})
+			})
+		})
+
+		Convey("When its email is taken before I restore it", func() {
+
+			responseType, _, _, _ := svc.CreateUser(ctx, importUser("USER@mail.com"))
+			So(responseType, ShouldEqual, Success)
+
+			responseType, restored, err := svc.RestoreUser(ctx, created.ID)
+
+			Convey("Then I expect a 'conflict' response type", func() {
+
+				So(responseType, ShouldEqual, Conflict)
+				So(restored, ShouldBeNil)
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I restore a user which doesn't exist", t, func() {
+
+		responseType, restored, err := newService().RestoreUser(ctx, "missing")
+
+		Convey("Then I expect a 'not-found' response type", func() {
+
+			So(responseType, ShouldEqual, NotFound)
+			So(restored, ShouldBeNil)
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func TestUnitPurgeDeletedUsers(t *testing.T) {
+
+	Convey("Given I delete a user", t, func() {
+
+		client := db.NewMemoryClient()
+
+		svc := &UserServiceImpl{
+			transformer: transformers.NewUserTransformer(),
+			validator:   validators.NewUserValidator(),
+			db:          client,
+			retention:   time.Hour,
+			stopPurging: make(chan struct{}),
+		}
+
+		_, created, _, err := svc.CreateUser(ctx, importUser("user@mail.com"))
+		So(err, ShouldBeNil)
+
+		responseType, _ := svc.DeleteUser(ctx, created.ID, nil)
+		So(responseType, ShouldEqual, Success)
+
+		Convey("Then I expect it not to be purged within the retention period", func() {
+
+			purged, err := svc.purgeDeletedUsers(ctx)
+
+			So(err, ShouldBeNil)
+			So(purged, ShouldEqual, 0)
+
+			responseType, _, _ := svc.RestoreUser(ctx, created.ID)
+			So(responseType, ShouldEqual, Success)
+		})
+
+		Convey("Then I expect it to be purged periodically once the retention period has passed", func() {
+
+			svc.retention = -time.Minute
+			go svc.purgePeriodically(time.Millisecond)
+			defer svc.Shutdown()
+
+			deadline := time.Now().Add(time.Second)
+			for time.Now().Before(deadline) {
+				if deleted, _ := client.GetDeletedUser(ctx, created.ID); deleted == nil {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			responseType, _, _ := svc.RestoreUser(ctx, created.ID)
+			So(responseType, ShouldEqual, NotFound)
+		})
+	})
+}
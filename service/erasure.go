@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/bpsaunders/user-api/db"
+	"github.com/bpsaunders/user-api/models"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"time"
+)
+
+// signatureAlgorithm is the algorithm by which erasure receipts are signed
+const signatureAlgorithm = "HMAC-SHA256"
+
+// erasedFields holds the bson names of the user fields which identify its subject, so are replaced by the
+// tombstone of its email upon erasure, in the user and its history alike
+var erasedFields = db.PersonalFields
+
+// newErasureKey returns the configured key by which erased emails are hashed and erasure receipts signed. The key
+// is required wherever users are stored in mongo; users stored in memory don't outlive the application, so a random
+// key serves them as well as any
+func newErasureKey(configured string) []byte {
+
+	if configured != "" {
+		return []byte(configured)
+	}
+
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal(err)
+	}
+	return key
+}
+
+// ExportUserData gathers everything held about a user, deleted or not, for a subject access request: the user
+// exactly as stored, its full history, and the responses held to replay to retries of the requests which created
+// it. Nothing is held about an erased user, so it's not found
+func (service *UserServiceImpl) ExportUserData(ctx context.Context, id string) (ResponseType, *models.DataExport, error) {
+
+	ctx, cancel := service.readContext(ctx)
+	defer cancel()
+
+	entity, err := service.anyUser(ctx, id)
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+	if entity == nil || entity.ErasedAt != nil {
+		return NotFound, nil, nil
+	}
+
+	events, err := service.db.GetAuditEvents(ctx, &db.AuditQuery{UserID: id})
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+
+	records, err := service.db.GetUserIdempotencyRecords(ctx, id)
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+
+	return Success, &models.DataExport{
+		ExportedAt:         now(),
+		User:               service.transformer.ToRecord(entity),
+		History:            *service.transformer.ToRestAuditEvents(events),
+		IdempotentRequests: service.transformer.ToRestIdempotentRequests(records),
+	}, nil
+}
+
+// EraseUser irreversibly anonymises a user, deleted or not, returning a signed receipt of its erasure. Its names
+// and email are replaced, in the user and its history, by a tombstone: a keyed hash of its email. Where blocked,
+// the email may never again be registered. Erasing a user which has already been erased has no effect, so its
+// receipt is returned as it stands
+func (service *UserServiceImpl) EraseUser(ctx context.Context, id string, blockReregistration bool) (ResponseType, *models.ErasureReceipt, error) {
+
+	ctx, cancel := service.writeContext(ctx)
+	defer cancel()
+
+	receipt, err := service.db.GetErasureReceipt(ctx, id)
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+	if receipt != nil {
+		return Success, service.transformer.ToRestErasureReceipt(receipt), nil
+	}
+
+	entity, err := service.anyUser(ctx, id)
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+	if entity == nil {
+		return NotFound, nil, nil
+	}
+
+	// a user erased without a receipt was interrupted before it was issued, so the erasure is completed
+	if entity.ErasedAt == nil {
+		var responseType ResponseType
+		responseType, entity, err = service.anonymise(ctx, entity, blockReregistration)
+		if responseType != Success {
+			return responseType, nil, err
+		}
+	}
+
+	tombstone := entity.Email
+
+	err = service.db.RedactAuditEvents(ctx, id, erasedFields, tombstone)
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+
+	err = service.redactIdempotentResponses(ctx, id, tombstone)
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+
+	// the email may be blocked by the tombstone of another user erased before, so the block is checked as it stands
+	blocked, err := service.db.UserExistsWithEmail(ctx, tombstone)
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+
+	receipt = &models.ErasureReceiptDao{
+		UserID:                id,
+		Actor:                 actor(ctx),
+		ErasedAt:              *entity.ErasedAt,
+		Tombstone:             tombstone,
+		ReregistrationBlocked: blocked,
+		SignatureAlgorithm:    signatureAlgorithm,
+	}
+	receipt.Signature = service.sign(receipt)
+
+	err = service.db.CreateErasureReceipt(ctx, receipt)
+	if err == db.ErrErasureReceiptExists {
+		// erased concurrently, so the receipt issued first stands
+		receipt, err = service.db.GetErasureReceipt(ctx, id)
+	}
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+
+	return Success, service.transformer.ToRestErasureReceipt(receipt), nil
+}
+
+// anonymise replaces the names and email of a user with the tombstone of its email, deleting it if it isn't
+// already, and returns the user as erased
+func (service *UserServiceImpl) anonymise(ctx context.Context, entity *models.UserDao, blockReregistration bool) (ResponseType, *models.UserDao, error) {
+
+	tombstone := service.tombstone(entity.Email)
+
+	erasedAt := now()
+
+	erased := *entity
+	erased.FirstName = tombstone
+	erased.LastName = tombstone
+	erased.Email = tombstone
+	erased.NormalisedEmail = ""
+	if blockReregistration {
+		erased.NormalisedEmail = tombstone
+	}
+	if erased.DeletedAt == nil {
+		erased.DeletedAt = &erasedAt
+	}
+	erased.ErasedAt = &erasedAt
+	erased.UpdatedAt = erasedAt
+	erased.Version = entity.Version + 1
+
+	err := service.db.EraseUser(ctx, &erased, entity.Version)
+	if err == db.ErrDuplicateEmail {
+		// the email is already blocked, by the tombstone of another user erased before
+		erased.NormalisedEmail = ""
+		err = service.db.EraseUser(ctx, &erased, entity.Version)
+	}
+	if err == db.ErrVersionConflict {
+		return Conflict, nil, nil
+	}
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+
+	// the state before erasure is recorded as redacted, as the rest of the history is
+	redacted := *entity
+	redacted.FirstName = tombstone
+	redacted.LastName = tombstone
+	redacted.Email = tombstone
+	service.recordAudit(ctx, operationErase, &redacted, &erased)
+
+	return Success, &erased, nil
+}
+
+// anyUser fetches a user according to an id, whether deleted or not
+func (service *UserServiceImpl) anyUser(ctx context.Context, id string) (*models.UserDao, error) {
+
+	entity, err := service.db.GetUser(ctx, id)
+	if err != nil || entity != nil {
+		return entity, err
+	}
+
+	return service.db.GetDeletedUser(ctx, id)
+}
+
+// emailErased determines whether an email belongs to an erased user which blocked its re-registration
+func (service *UserServiceImpl) emailErased(ctx context.Context, email string) (bool, error) {
+
+	return service.db.UserExistsWithEmail(ctx, service.tombstone(email))
+}
+
+// tombstone returns the hash which stands in for the email of an erased user. It's keyed, so that it can't be
+// reversed by hashing candidate emails, and the same for an email regardless of case
+func (service *UserServiceImpl) tombstone(email string) string {
+
+	return service.hmac("tombstone", db.NormaliseEmail(email))
+}
+
+// sign returns the signature of an erasure receipt, over every other field of the receipt
+func (service *UserServiceImpl) sign(receipt *models.ErasureReceiptDao) string {
+
+	return service.hmac("erasure-receipt", receipt.UserID, receipt.Actor, receipt.ErasedAt.Format(time.RFC3339Nano),
+		receipt.Tombstone, strconv.FormatBool(receipt.ReregistrationBlocked), receipt.SignatureAlgorithm)
+}
+
+// hmac returns a HMAC-SHA256 of a sequence of values under the erasure key, encoded so that no two sequences
+// collide. The first value names the purpose of the hash, so that hashes made for one purpose can't pass for another
+func (service *UserServiceImpl) hmac(values ...string) string {
+
+	encoded, _ := json.Marshal(values)
+	mac := hmac.New(sha256.New, service.erasureKey)
+	mac.Write(encoded)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"errors"
+	"github.com/bpsaunders/user-api/db"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/transformers"
+	"github.com/bpsaunders/user-api/validators"
+	"github.com/golang/mock/gomock"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newErasureService(key string) *UserServiceImpl {
+	return &UserServiceImpl{
+		transformer: transformers.NewUserTransformer(),
+		validator:   validators.NewUserValidator(),
+		db:          db.NewMemoryClient(),
+		erasureKey:  []byte(key),
+	}
+}
+
+func TestUnitExportUserData(t *testing.T) {
+
+	Convey("Given I create and update a user", t, func() {
+
+		svc := newErasureService("key")
+
+		_, created, _, err := svc.CreateUser(ctx, importUser("user@mail.com"))
+		So(err, ShouldBeNil)
+
+		_, updated, _, err := svc.PatchUser(ctx, created.ID, map[string]interface{}{"country": "FR"}, nil)
+		So(err, ShouldBeNil)
+
+		Convey("When I export their data", func() {
+
+			responseType, export, err := svc.ExportUserData(ctx, created.ID)
+
+			Convey("Then I expect the user as stored, with its full history", func() {
+
+				So(responseType, ShouldEqual, Success)
+				So(err, ShouldBeNil)
+				So(export.User.Email, ShouldEqual, "user@mail.com")
+				So(export.User.Country, ShouldEqual, "FR")
+				So(export.User.Version, ShouldEqual, updated.Version)
+				So(export.User.DeletedAt, ShouldBeNil)
+				So(len(export.History), ShouldEqual, 2)
+				So(export.History[0].Operation, ShouldEqual, operationPatch)
+				So(export.ExportedAt.IsZero(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When I delete the user, then export their data", func() {
+
+			responseType, _ := svc.DeleteUser(ctx, created.ID, nil)
+			So(responseType, ShouldEqual, Success)
+
+			responseType, export, err := svc.ExportUserData(ctx, created.ID)
+
+			Convey("Then I expect the deleted user, as it's still held", func() {
+
+				So(responseType, ShouldEqual, Success)
+				So(err, ShouldBeNil)
+				So(export.User.DeletedAt, ShouldNotBeNil)
+				So(len(export.History), ShouldEqual, 3)
+			})
+		})
+
+		Convey("When I erase the user, then export their data", func() {
+
+			responseType, _, _ := svc.EraseUser(ctx, created.ID, false)
+			So(responseType, ShouldEqual, Success)
+
+			responseType, export, err := svc.ExportUserData(ctx, created.ID)
+
+			Convey("Then I expect a 'not-found' response type, as nothing is held about them", func() {
+
+				So(responseType, ShouldEqual, NotFound)
+				So(export, ShouldBeNil)
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I create a user with an idempotency key", t, func() {
+
+		svc := newErasureService("key")
+
+		_, created, _, _, err := svc.CreateUserIdempotently(ctx, "key", importUser("user@mail.com"))
+		So(err, ShouldBeNil)
+
+		Convey("When I export their data", func() {
+
+			responseType, export, err := svc.ExportUserData(ctx, created.ID)
+
+			Convey("Then I expect the response held to replay to retries of the request which created them", func() {
+
+				So(responseType, ShouldEqual, Success)
+				So(err, ShouldBeNil)
+				So(len(export.IdempotentRequests), ShouldEqual, 1)
+				So(string(export.IdempotentRequests[0].Response), ShouldContainSubstring, "user@mail.com")
+			})
+		})
+	})
+
+	Convey("Given I export the data of a user which doesn't exist", t, func() {
+
+		responseType, export, err := newErasureService("key").ExportUserData(ctx, "missing")
+
+		Convey("Then I expect a 'not-found' response type", func() {
+
+			So(responseType, ShouldEqual, NotFound)
+			So(export, ShouldBeNil)
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func TestUnitEraseUser(t *testing.T) {
+
+	Convey("Given I create a user", t, func() {
+
+		svc := newErasureService("key")
+
+		_, created, _, err := svc.CreateUser(ctx, importUser("user@mail.com"))
+		So(err, ShouldBeNil)
+
+		Convey("When I erase it, blocking its email from re-registration", func() {
+
+			responseType, receipt, err := svc.EraseUser(ctx, created.ID, true)
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+
+			Convey("Then I expect a signed receipt, bearing the tombstone of its email", func() {
+
+				So(receipt.UserID, ShouldEqual, created.ID)
+				So(receipt.Tombstone, ShouldEqual, svc.tombstone("USER@mail.com"))
+				So(receipt.ReregistrationBlocked, ShouldBeTrue)
+				So(receipt.SignatureAlgorithm, ShouldEqual, signatureAlgorithm)
+				So(receipt.Signature, ShouldEqual, svc.sign(&models.ErasureReceiptDao{
+					UserID:                receipt.UserID,
+					Actor:                 receipt.Actor,
+					ErasedAt:              receipt.ErasedAt,
+					Tombstone:             receipt.Tombstone,
+					ReregistrationBlocked: receipt.ReregistrationBlocked,
+					SignatureAlgorithm:    receipt.SignatureAlgorithm,
+				}))
+			})
+
+			Convey("Then I expect the user to be gone for good", func() {
+
+				responseType, _, _ := svc.GetUser(ctx, created.ID)
+				So(responseType, ShouldEqual, NotFound)
+
+				responseType, _, _ = svc.RestoreUser(ctx, created.ID)
+				So(responseType, ShouldEqual, NotFound)
+			})
+
+			Convey("Then I expect its names and email to be replaced throughout its history", func() {
+
+				_, history, _, err := svc.GetUserHistory(ctx, created.ID, &models.UserHistoryQuery{})
+				So(err, ShouldBeNil)
+				So(history.Items[0].Operation, ShouldEqual, operationErase)
+
+				for _, event := range history.Items {
+					for _, change := range event.Changes {
+						if change.Field == "email" || change.Field == "first_name" || change.Field == "last_name" {
+							So(*change.After, ShouldEqual, receipt.Tombstone)
+						}
+					}
+				}
+			})
+
+			Convey("Then I expect its email to be blocked from re-registration", func() {
+
+				responseType, _, _, err := svc.CreateUser(ctx, importUser("User@mail.com"))
+				So(responseType, ShouldEqual, Conflict)
+				So(err, ShouldBeNil)
+
+				_, report, _, err := svc.ImportUsers(ctx, []*models.ImportRow{{Row: 1, User: importUser("user@mail.com")}}, false)
+				So(err, ShouldBeNil)
+				So(report.Rows[0].Status, ShouldEqual, importDuplicate)
+			})
+
+			Convey("And erase it again", func() {
+
+				responseType, again, err := svc.EraseUser(ctx, created.ID, false)
+
+				Convey("Then I expect the original receipt", func() {
+
+					So(responseType, ShouldEqual, Success)
+					So(err, ShouldBeNil)
+					So(again, ShouldResemble, receipt)
+				})
+			})
+		})
+
+		Convey("When I erase it without blocking its email", func() {
+
+			responseType, receipt, _ := svc.EraseUser(ctx, created.ID, false)
+			So(responseType, ShouldEqual, Success)
+
+			Convey("Then I expect its email to be free to register again", func() {
+
+				So(receipt.ReregistrationBlocked, ShouldBeFalse)
+
+				responseType, _, _, err := svc.CreateUser(ctx, importUser("user@mail.com"))
+				So(responseType, ShouldEqual, Success)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When I delete it, then erase it", func() {
+
+			responseType, _ := svc.DeleteUser(ctx, created.ID, nil)
+			So(responseType, ShouldEqual, Success)
+
+			responseType, receipt, err := svc.EraseUser(ctx, created.ID, true)
+
+			Convey("Then I expect it to be erased all the same", func() {
+
+				So(responseType, ShouldEqual, Success)
+				So(err, ShouldBeNil)
+				So(receipt.ReregistrationBlocked, ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given I create a user with an idempotency key", t, func() {
+
+		svc := newErasureService("key")
+
+		_, created, _, _, err := svc.CreateUserIdempotently(ctx, "key", importUser("user@mail.com"))
+		So(err, ShouldBeNil)
+
+		Convey("When I erase it, then retry the request with the same key", func() {
+
+			responseType, receipt, _ := svc.EraseUser(ctx, created.ID, false)
+			So(responseType, ShouldEqual, Success)
+
+			responseType, replayed, _, wasReplayed, err := svc.CreateUserIdempotently(ctx, "key", importUser("user@mail.com"))
+
+			Convey("Then I expect the response to be replayed without its names and email", func() {
+
+				So(responseType, ShouldEqual, Success)
+				So(wasReplayed, ShouldBeTrue)
+				So(err, ShouldBeNil)
+				So(replayed.ID, ShouldEqual, created.ID)
+				So(replayed.FirstName, ShouldEqual, receipt.Tombstone)
+				So(replayed.LastName, ShouldEqual, receipt.Tombstone)
+				So(replayed.Email, ShouldEqual, receipt.Tombstone)
+
+				records, err := svc.db.GetUserIdempotencyRecords(ctx, created.ID)
+				So(err, ShouldBeNil)
+				So(string(records[0].Response), ShouldNotContainSubstring, "user@mail.com")
+			})
+		})
+	})
+
+	Convey("Given I erase the same email twice, blocking it each time", t, func() {
+
+		svc := newErasureService("key")
+
+		_, first, _, _ := svc.CreateUser(ctx, importUser("user@mail.com"))
+		responseType, _ := svc.DeleteUser(ctx, first.ID, nil)
+		So(responseType, ShouldEqual, Success)
+
+		_, second, _, _ := svc.CreateUser(ctx, importUser("user@mail.com"))
+
+		responseType, _, _ = svc.EraseUser(ctx, first.ID, true)
+		So(responseType, ShouldEqual, Success)
+
+		responseType, receipt, err := svc.EraseUser(ctx, second.ID, true)
+
+		Convey("Then I expect both to be erased, and the email to remain blocked", func() {
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+			So(receipt.ReregistrationBlocked, ShouldBeTrue)
+		})
+	})
+
+	Convey("Given I erase the same email under different keys", t, func() {
+
+		Convey("Then I expect different tombstones, so they can't be matched without the key", func() {
+
+			So(newErasureService("key").tombstone("user@mail.com"), ShouldNotEqual, newErasureService("other").tombstone("user@mail.com"))
+		})
+	})
+
+	Convey("Given I erase a user which doesn't exist", t, func() {
+
+		responseType, receipt, err := newErasureService("key").EraseUser(ctx, "missing", true)
+
+		Convey("Then I expect a 'not-found' response type", func() {
+
+			So(responseType, ShouldEqual, NotFound)
+			So(receipt, ShouldBeNil)
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func TestUnitEraseUserErrors(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	client := db.NewMockClient(mockCtrl)
+
+	svc := &UserServiceImpl{
+		transformer: transformers.NewUserTransformer(),
+		validator:   validators.NewUserValidator(),
+		db:          client,
+	}
+
+	Convey("Given the user is modified while it's being erased", t, func() {
+
+		client.EXPECT().GetErasureReceipt(gomock.Any(), "id").Return(nil, nil)
+		client.EXPECT().GetUser(gomock.Any(), "id").Return(&models.UserDao{ID: "id", Email: "user@mail.com", Version: 1}, nil)
+		client.EXPECT().EraseUser(gomock.Any(), gomock.Any(), int64(1)).Return(db.ErrVersionConflict)
+
+		responseType, receipt, err := svc.EraseUser(ctx, "id", true)
+
+		Convey("Then I expect a 'conflict' response type, without a receipt", func() {
+
+			So(responseType, ShouldEqual, Conflict)
+			So(receipt, ShouldBeNil)
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Given the responses held for retries of the request which created the user can't be fetched", t, func() {
+
+		dbErr := errors.New("error fetching idempotency records")
+
+		client.EXPECT().GetErasureReceipt(gomock.Any(), "id").Return(nil, nil)
+		client.EXPECT().GetUser(gomock.Any(), "id").Return(&models.UserDao{ID: "id", Email: "user@mail.com", Version: 1}, nil)
+		client.EXPECT().EraseUser(gomock.Any(), gomock.Any(), int64(1)).Return(nil)
+		client.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil)
+		client.EXPECT().RedactAuditEvents(gomock.Any(), "id", erasedFields, gomock.Any()).Return(nil)
+		client.EXPECT().GetUserIdempotencyRecords(gomock.Any(), "id").Return(nil, dbErr)
+
+		responseType, receipt, err := svc.EraseUser(ctx, "id", true)
+
+		Convey("Then I expect an 'error' response type, without a receipt being issued", func() {
+
+			So(responseType, ShouldEqual, Error)
+			So(receipt, ShouldBeNil)
+			So(err, ShouldEqual, dbErr)
+		})
+	})
+
+	Convey("Given the history of the user can't be redacted", t, func() {
+
+		dbErr := errors.New("error redacting audit events")
+
+		client.EXPECT().GetErasureReceipt(gomock.Any(), "id").Return(nil, nil)
+		client.EXPECT().GetUser(gomock.Any(), "id").Return(&models.UserDao{ID: "id", Email: "user@mail.com", Version: 1}, nil)
+		client.EXPECT().EraseUser(gomock.Any(), gomock.Any(), int64(1)).Return(nil)
+		client.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil)
+		client.EXPECT().RedactAuditEvents(gomock.Any(), "id", erasedFields, svc.tombstone("user@mail.com")).Return(dbErr)
+
+		responseType, receipt, err := svc.EraseUser(ctx, "id", true)
+
+		Convey("Then I expect an 'error' response type, without a receipt being issued", func() {
+
+			So(responseType, ShouldEqual, Error)
+			So(receipt, ShouldBeNil)
+			So(err, ShouldEqual, dbErr)
+		})
+	})
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/bpsaunders/user-api/db"
+	"github.com/bpsaunders/user-api/logging"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/validators"
+)
+
+// idempotentResponse is the response to a request made with an idempotency key, as stored to be replayed
+type idempotentResponse struct {
+	Outcome string                       `json:"outcome"`
+	User    *models.User                 `json:"user,omitempty"`
+	Version int64                        `json:"version,omitempty"`
+	Errors  []validators.ValidationError `json:"errors,omitempty"`
+}
+
+// replayableOutcomes are those responses which a retry of the request would also get, so are stored to be
+// replayed. Any other response is transient, so a retry is carried out afresh
+var replayableOutcomes = map[ResponseType]bool{
+	Success:     true,
+	InvalidData: true,
+	Conflict:    true,
+}
+
+// CreateUserIdempotently creates a user as CreateUser does, at most once per idempotency key. A retry of the
+// request with the same key is answered with the response to the original, reported as replayed, until the key
+// expires after db.IdempotencyTTL. Keys are held per actor, so one client can't collide with another's
+func (service *UserServiceImpl) CreateUserIdempotently(ctx context.Context, key string, rest *models.User) (ResponseType, *models.User, []validators.ValidationError, bool, error) {
+
+	ctx, cancel := service.writeContext(ctx)
+	defer cancel()
+
+	logger := logging.FromContext(ctx)
+
+	record := &models.IdempotencyRecordDao{
+		ID:          digest(actor(ctx), key),
+		Fingerprint: digest(rest.FirstName, rest.LastName, rest.Email, rest.Country),
+		CreatedAt:   now(),
+	}
+
+	// claiming the key first means concurrent retries can't both create the user
+	err := service.db.CreateIdempotencyRecord(ctx, record)
+	if err == db.ErrIdempotencyKeyExists {
+		return service.replay(ctx, record)
+	}
+	if err != nil {
+		return errorResponse(ctx), nil, nil, false, err
+	}
+
+	responseType, user, validationErrors, err := service.CreateUser(ctx, rest)
+
+	if !replayableOutcomes[responseType] {
+		service.releaseIdempotencyKey(ctx, record.ID)
+		return responseType, user, validationErrors, false, err
+	}
+
+	// the record is held against the user it created, so that the response can be exported and erased with it
+	var userID string
+
+	response := &idempotentResponse{Outcome: responseType.String(), User: user, Errors: validationErrors}
+	if user != nil {
+		response.Version = user.Version
+		userID = user.ID
+	}
+
+	encoded, encodeErr := json.Marshal(response)
+	if encodeErr == nil {
+		encodeErr = service.db.CompleteIdempotencyRecord(ctx, record.ID, userID, encoded)
+	}
+	if encodeErr != nil {
+		// the user has been created regardless, so rather than fail the request, the key is freed for retries
+		logger.Error(fmt.Sprintf("failed to store the response to a request with an idempotency key: %v", encodeErr))
+		service.releaseIdempotencyKey(ctx, record.ID)
+	}
+
+	return responseType, user, validationErrors, false, err
+}
+
+// replay answers a request whose idempotency key is already held with the stored response to the original
+// request, provided the requests are the same and the original has completed
+func (service *UserServiceImpl) replay(ctx context.Context, record *models.IdempotencyRecordDao) (ResponseType, *models.User, []validators.ValidationError, bool, error) {
+
+	existing, err := service.db.GetIdempotencyRecord(ctx, record.ID, record.Fingerprint)
+	if err != nil {
+		return errorResponse(ctx), nil, nil, false, err
+	}
+
+	// a record gone since it was found to exist has just been released, so is treated as still in use
+	if existing == nil || existing.Response == nil {
+		return IdempotencyKeyInUse, nil, nil, false, nil
+	}
+	if existing.Fingerprint != record.Fingerprint {
+		return IdempotencyKeyReused, nil, nil, false, nil
+	}
+
+	var response idempotentResponse
+	err = json.Unmarshal(existing.Response, &response)
+	if err != nil {
+		return Error, nil, nil, false, err
+	}
+
+	responseType, ok := parseResponseType(response.Outcome)
+	if !ok {
+		return Error, nil, nil, false, fmt.Errorf("unknown outcome of a request with an idempotency key: %s", response.Outcome)
+	}
+	if response.User != nil {
+		response.User.Version = response.Version
+	}
+
+	logging.FromContext(ctx).Debug("Replaying the response to a request with the same idempotency key")
+
+	return responseType, response.User, response.Errors, true, nil
+}
+
+// redactIdempotentResponses replaces the names and email of a user, in the responses held to replay to retries of
+// the requests which created it, by a tombstone. The keys stay held, so that a retry is answered with the redacted
+// response rather than creating the user afresh
+func (service *UserServiceImpl) redactIdempotentResponses(ctx context.Context, userID string, tombstone string) error {
+
+	records, err := service.db.GetUserIdempotencyRecords(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+
+		var response idempotentResponse
+		err = json.Unmarshal(record.Response, &response)
+		if err != nil {
+			return err
+		}
+		if response.User == nil {
+			continue
+		}
+
+		response.User.FirstName = tombstone
+		response.User.LastName = tombstone
+		response.User.Email = tombstone
+
+		encoded, err := json.Marshal(response)
+		if err != nil {
+			return err
+		}
+
+		err = service.db.CompleteIdempotencyRecord(ctx, record.ID, userID, encoded)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseIdempotencyKey removes the record of a request which didn't complete, so that it may be retried. The
+// request may have run out of time, so the record is removed within a time limit of its own
+func (service *UserServiceImpl) releaseIdempotencyKey(ctx context.Context, id string) {
+
+	releaseCtx, cancel := service.writeContext(context.Background())
+	defer cancel()
+
+	err := service.db.DeleteIdempotencyRecord(releaseCtx, id)
+	if err != nil {
+		logging.FromContext(ctx).Error(fmt.Sprintf("failed to release an idempotency key: %v", err))
+	}
+}
+
+// digest returns a SHA-256 hash of a sequence of values, encoded so that no two sequences collide
+func digest(values ...string) string {
+
+	encoded, _ := json.Marshal(values)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
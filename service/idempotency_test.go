@@ -0,0 +1,190 @@
+package service
+
+import (
+	"errors"
+	"github.com/bpsaunders/user-api/auth"
+	"github.com/bpsaunders/user-api/db"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/transformers"
+	"github.com/bpsaunders/user-api/validators"
+	"github.com/golang/mock/gomock"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitCreateUserIdempotently(t *testing.T) {
+
+	newService := func() *UserServiceImpl {
+		return &UserServiceImpl{
+			transformer: transformers.NewUserTransformer(),
+			validator:   validators.NewUserValidator(),
+			db:          db.NewMemoryClient(),
+		}
+	}
+
+	Convey("Given I create a user with an idempotency key", t, func() {
+
+		svc := newService()
+
+		responseType, created, _, replayed, err := svc.CreateUserIdempotently(ctx, "key", importUser("user@mail.com"))
+
+		So(responseType, ShouldEqual, Success)
+		So(replayed, ShouldBeFalse)
+		So(err, ShouldBeNil)
+
+		Convey("When I retry the same request with the same key", func() {
+
+			responseType, retried, _, replayed, err := svc.CreateUserIdempotently(ctx, "key", importUser("user@mail.com"))
+
+			Convey("Then I expect the original response to be replayed", func() {
+
+				So(responseType, ShouldEqual, Success)
+				So(replayed, ShouldBeTrue)
+				So(err, ShouldBeNil)
+				So(retried.ID, ShouldEqual, created.ID)
+				So(retried.Version, ShouldEqual, created.Version)
+				So(retried.CreatedAt.Equal(created.CreatedAt), ShouldBeTrue)
+			})
+		})
+
+		Convey("When I reuse the key for a different request", func() {
+
+			responseType, user, _, replayed, err := svc.CreateUserIdempotently(ctx, "key", importUser("other@mail.com"))
+
+			Convey("Then I expect an 'idempotency-key-reused' response type", func() {
+
+				So(responseType, ShouldEqual, IdempotencyKeyReused)
+				So(user, ShouldBeNil)
+				So(replayed, ShouldBeFalse)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When another actor makes the same request with the same key", func() {
+
+			other := auth.NewContext(ctx, &auth.Principal{Subject: "other"})
+			responseType, _, _, replayed, err := svc.CreateUserIdempotently(other, "key", importUser("user@mail.com"))
+
+			Convey("Then I expect their request to be carried out afresh", func() {
+
+				So(responseType, ShouldEqual, Conflict)
+				So(replayed, ShouldBeFalse)
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given I create an invalid user with an idempotency key", t, func() {
+
+		svc := newService()
+
+		responseType, _, validationErrors, _, _ := svc.CreateUserIdempotently(ctx, "key", importUser("not-an-email"))
+		So(responseType, ShouldEqual, InvalidData)
+
+		Convey("When I retry the same request with the same key", func() {
+
+			responseType, _, replayedErrors, replayed, err := svc.CreateUserIdempotently(ctx, "key", importUser("not-an-email"))
+
+			Convey("Then I expect the validation errors to be replayed", func() {
+
+				So(responseType, ShouldEqual, InvalidData)
+				So(replayed, ShouldBeTrue)
+				So(err, ShouldBeNil)
+				So(len(replayedErrors), ShouldEqual, len(validationErrors))
+				So(replayedErrors[0].Field, ShouldEqual, validationErrors[0].Field)
+			})
+		})
+	})
+
+	Convey("Given I concurrently make the same request with the same key", t, func() {
+
+		svc := newService()
+
+		const attempts = 20
+
+		var wg sync.WaitGroup
+		responseTypes := make(chan ResponseType, attempts)
+
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				responseType, _, _, replayed, _ := svc.CreateUserIdempotently(ctx, "key", importUser("user@mail.com"))
+				if replayed {
+					responseType = -1
+				}
+				responseTypes <- responseType
+			}()
+		}
+		wg.Wait()
+		close(responseTypes)
+
+		Convey("Then I expect the user to be created once, and never to conflict", func() {
+
+			results := make(map[ResponseType]int)
+			for responseType := range responseTypes {
+				results[responseType]++
+			}
+
+			So(results[Success], ShouldEqual, 1)
+			So(results[Conflict], ShouldEqual, 0)
+			So(results[-1]+results[IdempotencyKeyInUse], ShouldEqual, attempts-1)
+		})
+	})
+}
+
+func TestUnitCreateUserIdempotentlyErrors(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	client := db.NewMockClient(mockCtrl)
+
+	svc := &UserServiceImpl{
+		transformer: transformers.NewUserTransformer(),
+		validator:   validators.NewUserValidator(),
+		db:          client,
+	}
+
+	Convey("Given the user can't be saved to the db", t, func() {
+
+		var recordID string
+		client.EXPECT().CreateIdempotencyRecord(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ interface{}, record *models.IdempotencyRecordDao) error {
+				recordID = record.ID
+				return nil
+			})
+		client.EXPECT().UserExistsWithEmail(gomock.Any(), gomock.Any()).Return(false, nil)
+		client.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(errors.New("error saving the user to the db"))
+
+		Convey("Then I expect an 'error' response type, and the key to be released for a retry", func() {
+
+			client.EXPECT().DeleteIdempotencyRecord(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ interface{}, id string) error {
+					So(id, ShouldEqual, recordID)
+					return nil
+				})
+
+			responseType, _, _, replayed, err := svc.CreateUserIdempotently(ctx, "key", importUser("user@mail.com"))
+
+			So(responseType, ShouldEqual, Error)
+			So(replayed, ShouldBeFalse)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given the key can't be claimed", t, func() {
+
+		client.EXPECT().CreateIdempotencyRecord(gomock.Any(), gomock.Any()).Return(errors.New("error saving the record to the db"))
+
+		Convey("Then I expect an 'error' response type, without the user being created", func() {
+
+			responseType, _, _, _, err := svc.CreateUserIdempotently(ctx, "key", importUser("user@mail.com"))
+
+			So(responseType, ShouldEqual, Error)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
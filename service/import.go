@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/bpsaunders/user-api/countries"
+	"github.com/bpsaunders/user-api/db"
+	"github.com/bpsaunders/user-api/logging"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/validators"
+	"github.com/hashicorp/go-uuid"
+	"time"
+)
+
+// statuses of the rows of an import
+const (
+	importCreated   = "created"
+	importMalformed = "malformed"
+	importInvalid   = "invalid"
+	importDuplicate = "duplicate"
+	importSkipped   = "skipped"
+	importFailed    = "failed"
+)
+
+// importRowsPerTimeout is the number of rows an import may write within the configured write timeout; larger
+// imports are given a multiple of it
+const importRowsPerTimeout = 1000
+
+// ImportReport describes the outcome of importing a batch of users, row by row
+type ImportReport struct {
+	AllOrNothing bool               `json:"all_or_nothing"`
+	Created      int                `json:"created"`
+	Failed       int                `json:"failed"`
+	Rows         []*ImportRowResult `json:"rows"`
+}
+
+// ImportRowResult describes the outcome of importing a single row; the id of the user if created, or why not
+type ImportRowResult struct {
+	Row    int                          `json:"row"`
+	Status string                       `json:"status"`
+	ID     string                       `json:"id,omitempty"`
+	Detail string                       `json:"detail,omitempty"`
+	Errors []validators.ValidationError `json:"errors,omitempty"`
+}
+
+// ImportUsers validates and creates a batch of users, reporting the outcome of each row. Rows are created
+// independently of one another unless all or nothing is requested, in which case no row is created unless every
+// row can be
+func (service *UserServiceImpl) ImportUsers(ctx context.Context, rows []*models.ImportRow, allOrNothing bool) (ResponseType, *ImportReport, []validators.ValidationError, error) {
+
+	ctx, cancel := service.importContext(ctx, len(rows))
+	defer cancel()
+
+	// validate the batch as a whole first
+	validationErrors := service.validator.ValidateImport(rows)
+	if len(validationErrors) > 0 {
+		return InvalidData, nil, validationErrors, nil
+	}
+
+	report := &ImportReport{
+		AllOrNothing: allOrNothing,
+		Rows:         make([]*ImportRowResult, len(rows)),
+	}
+
+	// indices of the rows which remain candidates for creation
+	candidates := make([]int, 0, len(rows))
+	emails := make(map[string]bool)
+
+	for i, row := range rows {
+
+		result := &ImportRowResult{Row: row.Row}
+		report.Rows[i] = result
+
+		if row.User == nil {
+			result.Status = importMalformed
+			result.Detail = row.Malformed
+			continue
+		}
+
+		if errs := service.validator.Validate(row.User); len(errs) > 0 {
+			result.Status = importInvalid
+			result.Errors = errs
+			continue
+		}
+
+		// the first row with an email is the one created
+		email := db.NormaliseEmail(row.User.Email)
+		if emails[email] {
+			result.Status = importDuplicate
+			result.Detail = "The email is repeated by an earlier row"
+			continue
+		}
+		emails[email] = true
+
+		candidates = append(candidates, i)
+	}
+
+	candidates, err := service.excludeExistingEmails(ctx, rows, candidates, report)
+	if err != nil {
+		return errorResponse(ctx), nil, validationErrors, err
+	}
+
+	if allOrNothing && len(candidates) < len(rows) {
+		return Success, service.skip(report, candidates), validationErrors, nil
+	}
+
+	entities := make([]*models.UserDao, 0, len(candidates))
+	events := make([]*models.AuditEventDao, 0, len(candidates))
+	for _, i := range candidates {
+		entity, err := service.newEntity(rows[i].User)
+		if err != nil {
+			return errorResponse(ctx), nil, validationErrors, err
+		}
+		event, err := newAuditEvent(ctx, operationCreate, nil, entity)
+		if err != nil {
+			return errorResponse(ctx), nil, validationErrors, err
+		}
+		entities = append(entities, entity)
+		events = append(events, event)
+	}
+
+	if len(entities) == 0 {
+		return Success, service.skip(report, candidates), validationErrors, nil
+	}
+
+	// the users are recorded in their history as they're created; only if they're created independently of one
+	// another may they be created without being recorded, which is logged rather than failing the import
+	errs, err := service.db.CreateUsers(ctx, entities, events, allOrNothing)
+	if err == db.ErrTransactionsUnsupported {
+		logging.FromContext(ctx).Error(fmt.Sprintf("failed to import users all or nothing: %v", err))
+		return AtomicImportUnsupported, nil, validationErrors, nil
+	}
+	if err != nil && errs == nil {
+		return errorResponse(ctx), nil, validationErrors, err
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error(fmt.Sprintf("failed to record the audit events of an import: %v", err))
+	}
+
+	for j, err := range errs {
+
+		result := report.Rows[candidates[j]]
+
+		switch err {
+		case nil:
+			result.Status = importCreated
+			result.ID = entities[j].ID
+			report.Created++
+		case db.ErrDuplicateEmail:
+			result.Status = importDuplicate
+			result.Detail = "A user already exists with the email"
+		case db.ErrBatchAborted:
+			result.Status = importSkipped
+		default:
+			logging.FromContext(ctx).Error(fmt.Sprintf("failed to import row %d: %v", result.Row, err))
+			result.Status = importFailed
+		}
+	}
+
+	report.Failed = len(rows) - report.Created
+
+	return Success, report, validationErrors, nil
+}
+
+// importContext bounds an import by the configured write timeout for each importRowsPerTimeout rows it holds, or
+// part thereof
+func (service *UserServiceImpl) importContext(ctx context.Context, rows int) (context.Context, context.CancelFunc) {
+
+	batches := (rows + importRowsPerTimeout - 1) / importRowsPerTimeout
+	if batches < 1 {
+		batches = 1
+	}
+	return withTimeout(ctx, time.Duration(batches)*service.writeTimeout)
+}
+
+// excludeExistingEmails marks the candidate rows whose emails already belong to users as duplicates, returning
+// the candidates which remain. An email blocked by an erased user is reported as taken, so as not to reveal the
+// erasure
+func (service *UserServiceImpl) excludeExistingEmails(ctx context.Context, rows []*models.ImportRow, candidates []int, report *ImportReport) ([]int, error) {
+
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	// an erased user holds the tombstone of its email in its place, so both are checked at once
+	emails := make([]string, 0, 2*len(candidates))
+	for _, i := range candidates {
+		emails = append(emails, rows[i].User.Email, service.tombstone(rows[i].User.Email))
+	}
+
+	existing, err := service.db.ExistingEmails(ctx, emails)
+	if err != nil {
+		return nil, err
+	}
+
+	taken := make(map[string]bool)
+	for _, email := range existing {
+		taken[db.NormaliseEmail(email)] = true
+	}
+
+	remaining := make([]int, 0, len(candidates))
+	for _, i := range candidates {
+		email := rows[i].User.Email
+		if taken[db.NormaliseEmail(email)] || taken[service.tombstone(email)] {
+			report.Rows[i].Status = importDuplicate
+			report.Rows[i].Detail = "A user already exists with the email"
+			continue
+		}
+		remaining = append(remaining, i)
+	}
+
+	return remaining, nil
+}
+
+// newEntity converts a validated user to a db entity to be created, with a new id, its creation time and first
+// version
+func (service *UserServiceImpl) newEntity(rest *models.User) (*models.UserDao, error) {
+
+	// store countries by their alpha-2 code, however they were submitted
+	rest.Country = countries.Normalise(rest.Country)
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	rest.ID = id
+
+	entity := service.transformer.ToEntity(rest)
+	entity.CreatedAt = now()
+	entity.UpdatedAt = entity.CreatedAt
+	entity.Version = 1
+
+	return entity, nil
+}
+
+// skip marks the candidate rows as skipped, none having been created
+func (service *UserServiceImpl) skip(report *ImportReport, candidates []int) *ImportReport {
+
+	for _, i := range candidates {
+		report.Rows[i].Status = importSkipped
+	}
+
+	report.Failed = len(report.Rows)
+	return report
+}
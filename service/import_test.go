@@ -0,0 +1,256 @@
+package service
+
+import (
+	"errors"
+	"github.com/bpsaunders/user-api/db"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/transformers"
+	"github.com/bpsaunders/user-api/validators"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitImportUsers(t *testing.T) {
+
+	newService := func() *UserServiceImpl {
+		return &UserServiceImpl{
+			transformer: transformers.NewUserTransformer(),
+			validator:   validators.NewUserValidator(),
+			db:          db.NewMemoryClient(),
+		}
+	}
+
+	newRows := func() []*models.ImportRow {
+		return []*models.ImportRow{
+			{Row: 1, User: importUser("new@mail.com")},
+			{Row: 2, Malformed: "record on line 2: wrong number of fields"},
+			{Row: 3, User: importUser("not-an-email")},
+			{Row: 4, User: importUser("NEW@mail.com")},
+			{Row: 5, User: importUser("existing@mail.com")},
+			{Row: 6, User: importUser("other@mail.com")},
+		}
+	}
+
+	Convey("Given a user already exists", t, func() {
+
+		svc := newService()
+
+		responseType, _, _, err := svc.CreateUser(ctx, importUser("existing@mail.com"))
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+
+		Convey("When I import a batch of users, some of which can't be created", func() {
+
+			responseType, report, validationErrors, err := svc.ImportUsers(ctx, newRows(), false)
+
+			Convey("Then I expect the valid rows to be created, and the reason every other row wasn't", func() {
+
+				So(responseType, ShouldEqual, Success)
+				So(len(validationErrors), ShouldEqual, 0)
+				So(err, ShouldBeNil)
+				So(report.Created, ShouldEqual, 2)
+				So(report.Failed, ShouldEqual, 4)
+
+				So(statuses(report), ShouldResemble, []string{
+					importCreated, importMalformed, importInvalid, importDuplicate, importDuplicate, importCreated,
+				})
+				So(report.Rows[1].Detail, ShouldEqual, "record on line 2: wrong number of fields")
+				So(len(report.Rows[2].Errors), ShouldEqual, 1)
+
+				Convey("And the created users should be stored, with their countries normalised", func() {
+
+					_, user, err := svc.GetUser(ctx, report.Rows[5].ID)
+
+					So(err, ShouldBeNil)
+					So(user.Email, ShouldEqual, "other@mail.com")
+					So(user.Country, ShouldEqual, "GB")
+				})
+
+				Convey("And the creation of each user should be recorded in its history", func() {
+
+					_, history, _, err := svc.GetUserHistory(ctx, report.Rows[0].ID, &models.UserHistoryQuery{})
+
+					So(err, ShouldBeNil)
+					So(len(history.Items), ShouldEqual, 1)
+					So(history.Items[0].Operation, ShouldEqual, operationCreate)
+				})
+			})
+		})
+
+		Convey("When I import a batch of users all or nothing, some of which can't be created", func() {
+
+			responseType, report, _, err := svc.ImportUsers(ctx, newRows(), true)
+
+			Convey("Then I expect no rows to be created, the valid rows being skipped", func() {
+
+				So(responseType, ShouldEqual, Success)
+				So(err, ShouldBeNil)
+				So(report.AllOrNothing, ShouldBeTrue)
+				So(report.Created, ShouldEqual, 0)
+				So(report.Failed, ShouldEqual, 6)
+
+				So(statuses(report), ShouldResemble, []string{
+					importSkipped, importMalformed, importInvalid, importDuplicate, importDuplicate, importSkipped,
+				})
+
+				_, list, _, err := svc.GetAllUsers(ctx, &models.UserListQuery{})
+
+				So(err, ShouldBeNil)
+				So(len(list.Items), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When I import a batch of valid users all or nothing", func() {
+
+			responseType, report, _, err := svc.ImportUsers(ctx, []*models.ImportRow{
+				{Row: 1, User: importUser("first@mail.com")},
+				{Row: 2, User: importUser("second@mail.com")},
+			}, true)
+
+			Convey("Then I expect every row to be created", func() {
+
+				So(responseType, ShouldEqual, Success)
+				So(err, ShouldBeNil)
+				So(report.Created, ShouldEqual, 2)
+				So(report.Failed, ShouldEqual, 0)
+				So(statuses(report), ShouldResemble, []string{importCreated, importCreated})
+
+				_, history, _, err := svc.GetUserHistory(ctx, report.Rows[1].ID, &models.UserHistoryQuery{})
+
+				So(err, ShouldBeNil)
+				So(len(history.Items), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given I import an empty batch of users", t, func() {
+
+		responseType, report, validationErrors, err := newService().ImportUsers(ctx, []*models.ImportRow{}, false)
+
+		Convey("Then I expect an 'invalid-data' response type, with validation errors", func() {
+
+			So(responseType, ShouldEqual, InvalidData)
+			So(report, ShouldBeNil)
+			So(len(validationErrors), ShouldEqual, 1)
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func TestUnitImportUsersErrors(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	client := db.NewMockClient(mockCtrl)
+
+	svc := &UserServiceImpl{
+		transformer: transformers.NewUserTransformer(),
+		validator:   validators.NewUserValidator(),
+		db:          client,
+	}
+
+	Convey("Given I encounter errors when checking which emails are taken", t, func() {
+
+		dbErr := errors.New("error when checking emails")
+
+		client.EXPECT().ExistingEmails(gomock.Any(), []string{"new@mail.com", svc.tombstone("new@mail.com")}).Return(nil, dbErr)
+
+		responseType, report, _, err := svc.ImportUsers(ctx, []*models.ImportRow{{Row: 1, User: importUser("new@mail.com")}}, false)
+
+		Convey("Then I expect an 'error' response type, without any user being created", func() {
+
+			So(responseType, ShouldEqual, Error)
+			So(report, ShouldBeNil)
+			So(err, ShouldEqual, dbErr)
+		})
+	})
+
+	Convey("Given another user takes an email while the batch is being imported", t, func() {
+
+		client.EXPECT().ExistingEmails(gomock.Any(), gomock.Any()).Return([]string{}, nil)
+		client.EXPECT().CreateUsers(gomock.Any(), gomock.Any(), gomock.Any(), false).Return([]error{db.ErrDuplicateEmail}, nil)
+
+		responseType, report, _, err := svc.ImportUsers(ctx, []*models.ImportRow{{Row: 1, User: importUser("new@mail.com")}}, false)
+
+		Convey("Then I expect the row to be reported as a duplicate", func() {
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+			So(statuses(report), ShouldResemble, []string{importDuplicate})
+		})
+	})
+
+	Convey("Given I create the users of a batch but encounter errors when recording their creation", t, func() {
+
+		client.EXPECT().ExistingEmails(gomock.Any(), gomock.Any()).Return([]string{}, nil)
+		client.EXPECT().CreateUsers(gomock.Any(), gomock.Any(), gomock.Len(1), false).Return([]error{nil}, errors.New("error when recording events"))
+
+		responseType, report, _, err := svc.ImportUsers(ctx, []*models.ImportRow{{Row: 1, User: importUser("new@mail.com")}}, false)
+
+		Convey("Then I expect the row to be reported as created, as it can't be undone", func() {
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+			So(statuses(report), ShouldResemble, []string{importCreated})
+		})
+	})
+
+	Convey("Given I import a batch all or nothing but the database doesn't support transactions", t, func() {
+
+		client.EXPECT().ExistingEmails(gomock.Any(), gomock.Any()).Return([]string{}, nil)
+		client.EXPECT().CreateUsers(gomock.Any(), gomock.Any(), gomock.Any(), true).Return(nil, db.ErrTransactionsUnsupported)
+
+		responseType, report, _, err := svc.ImportUsers(ctx, []*models.ImportRow{{Row: 1, User: importUser("new@mail.com")}}, true)
+
+		Convey("Then I expect the import to be reported unsupported rather than failed", func() {
+
+			So(responseType, ShouldEqual, AtomicImportUnsupported)
+			So(err, ShouldBeNil)
+			So(report, ShouldBeNil)
+		})
+	})
+}
+
+func TestUnitImportContext(t *testing.T) {
+
+	svc := &UserServiceImpl{writeTimeout: time.Second}
+
+	Convey("Given I import batches of users of several sizes", t, func() {
+
+		Convey("Then I expect each to be given the write timeout for every 1000 rows, or part thereof", func() {
+
+			for rows, timeout := range map[int]time.Duration{1: time.Second, 1000: time.Second, 1001: 2 * time.Second, 10000: 10 * time.Second} {
+
+				ctx, cancel := svc.importContext(ctx, rows)
+				deadline, ok := ctx.Deadline()
+				cancel()
+
+				So(ok, ShouldBeTrue)
+				So(time.Until(deadline), ShouldBeBetweenOrEqual, timeout-time.Second/2, timeout)
+			}
+		})
+	})
+}
+
+func statuses(report *ImportReport) []string {
+
+	result := make([]string, 0)
+	for _, row := range report.Rows {
+		result = append(result, row.Status)
+	}
+	return result
+}
+
+func importUser(email string) *models.User {
+
+	return &models.User{
+		FirstName: "firstName",
+		LastName:  "lastName",
+		Email:     email,
+		Country:   "gbr",
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"github.com/bpsaunders/user-api/metrics"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/validators"
+)
+
+// InstrumentedUserService decorates a UserService, counting the response type of each operation
+type InstrumentedUserService struct {
+	service UserService
+}
+
+// NewInstrumentedUserService returns a UserService which counts the response types of the given service
+func NewInstrumentedUserService(service UserService) UserService {
+	return &InstrumentedUserService{
+		service: service,
+	}
+}
+
+func observe(operation string, responseType ResponseType) {
+	metrics.ServiceResponses.Inc(operation, responseType.String())
+}
+
+// CreateUser counts the response types of creating a user
+func (s *InstrumentedUserService) CreateUser(ctx context.Context, rest *models.User) (ResponseType, *models.User, []validators.ValidationError, error) {
+
+	responseType, user, validationErrors, err := s.service.CreateUser(ctx, rest)
+	observe("create_user", responseType)
+	return responseType, user, validationErrors, err
+}
+
+// CreateUserIdempotently counts the response types of creating a user with an idempotency key
+func (s *InstrumentedUserService) CreateUserIdempotently(ctx context.Context, key string, rest *models.User) (ResponseType, *models.User, []validators.ValidationError, bool, error) {
+
+	responseType, user, validationErrors, replayed, err := s.service.CreateUserIdempotently(ctx, key, rest)
+	observe("create_user_idempotently", responseType)
+	return responseType, user, validationErrors, replayed, err
+}
+
+// GetUser counts the response types of fetching a user
+func (s *InstrumentedUserService) GetUser(ctx context.Context, id string) (ResponseType, *models.User, error) {
+
+	responseType, user, err := s.service.GetUser(ctx, id)
+	observe("get_user", responseType)
+	return responseType, user, err
+}
+
+// GetAllUsers counts the response types of fetching users
+func (s *InstrumentedUserService) GetAllUsers(ctx context.Context, query *models.UserListQuery) (ResponseType, *models.UserList, []validators.ValidationError, error) {
+
+	responseType, users, validationErrors, err := s.service.GetAllUsers(ctx, query)
+	observe("get_all_users", responseType)
+	return responseType, users, validationErrors, err
+}
+
+// FindUsersByEmail counts the response types of finding users by email
+func (s *InstrumentedUserService) FindUsersByEmail(ctx context.Context, email string) (ResponseType, *models.UserList, error) {
+
+	responseType, users, err := s.service.FindUsersByEmail(ctx, email)
+	observe("find_users_by_email", responseType)
+	return responseType, users, err
+}
+
+// SearchUsers counts the response types of searching users
+func (s *InstrumentedUserService) SearchUsers(ctx context.Context, query *models.UserSearchQuery) (ResponseType, *models.UserList, []validators.ValidationError, error) {
+
+	responseType, users, validationErrors, err := s.service.SearchUsers(ctx, query)
+	observe("search_users", responseType)
+	return responseType, users, validationErrors, err
+}
+
+// GetUserStats counts the response types of fetching statistics of users
+func (s *InstrumentedUserService) GetUserStats(ctx context.Context, query *models.UserStatsQuery) (ResponseType, *models.UserStats, []validators.ValidationError, error) {
+
+	responseType, stats, validationErrors, err := s.service.GetUserStats(ctx, query)
+	observe("get_user_stats", responseType)
+	return responseType, stats, validationErrors, err
+}
+
+// ExportUsers counts the response types of exporting users
+func (s *InstrumentedUserService) ExportUsers(ctx context.Context, query *models.UserListQuery, write func(user *models.User) error) (ResponseType, error) {
+
+	responseType, err := s.service.ExportUsers(ctx, query, write)
+	observe("export_users", responseType)
+	return responseType, err
+}
+
+// UpdateUser counts the response types of replacing a user
+func (s *InstrumentedUserService) UpdateUser(ctx context.Context, id string, rest *models.User, precondition *models.Precondition) (ResponseType, *models.User, []validators.ValidationError, error) {
+
+	responseType, user, validationErrors, err := s.service.UpdateUser(ctx, id, rest, precondition)
+	observe("update_user", responseType)
+	return responseType, user, validationErrors, err
+}
+
+// PatchUser counts the response types of patching a user
+func (s *InstrumentedUserService) PatchUser(ctx context.Context, id string, patch map[string]interface{}, precondition *models.Precondition) (ResponseType, *models.User, []validators.ValidationError, error) {
+
+	responseType, user, validationErrors, err := s.service.PatchUser(ctx, id, patch, precondition)
+	observe("patch_user", responseType)
+	return responseType, user, validationErrors, err
+}
+
+// DeleteUser counts the response types of deleting a user
+func (s *InstrumentedUserService) DeleteUser(ctx context.Context, id string, precondition *models.Precondition) (ResponseType, error) {
+
+	responseType, err := s.service.DeleteUser(ctx, id, precondition)
+	observe("delete_user", responseType)
+	return responseType, err
+}
+
+// ImportUsers counts the response types of importing a batch of users
+func (s *InstrumentedUserService) ImportUsers(ctx context.Context, rows []*models.ImportRow, allOrNothing bool) (ResponseType, *ImportReport, []validators.ValidationError, error) {
+
+	responseType, report, validationErrors, err := s.service.ImportUsers(ctx, rows, allOrNothing)
+	observe("import_users", responseType)
+	return responseType, report, validationErrors, err
+}
+
+// RestoreUser counts the response types of restoring a deleted user
+func (s *InstrumentedUserService) RestoreUser(ctx context.Context, id string) (ResponseType, *models.User, error) {
+
+	responseType, user, err := s.service.RestoreUser(ctx, id)
+	observe("restore_user", responseType)
+	return responseType, user, err
+}
+
+// ExportUserData counts the response types of exporting everything held about a user
+func (s *InstrumentedUserService) ExportUserData(ctx context.Context, id string) (ResponseType, *models.DataExport, error) {
+
+	responseType, export, err := s.service.ExportUserData(ctx, id)
+	observe("export_user_data", responseType)
+	return responseType, export, err
+}
+
+// EraseUser counts the response types of erasing a user
+func (s *InstrumentedUserService) EraseUser(ctx context.Context, id string, blockReregistration bool) (ResponseType, *models.ErasureReceipt, error) {
+
+	responseType, receipt, err := s.service.EraseUser(ctx, id, blockReregistration)
+	observe("erase_user", responseType)
+	return responseType, receipt, err
+}
+
+// GetUserHistory counts the response types of fetching the history of a user
+func (s *InstrumentedUserService) GetUserHistory(ctx context.Context, id string, query *models.UserHistoryQuery) (ResponseType, *models.AuditEventList, []validators.ValidationError, error) {
+
+	responseType, history, validationErrors, err := s.service.GetUserHistory(ctx, id, query)
+	observe("get_user_history", responseType)
+	return responseType, history, validationErrors, err
+}
+
+// Ping checks the health of the decorated service; health checks aren't counted as responses
+func (s *InstrumentedUserService) Ping(ctx context.Context) error {
+	return s.service.Ping(ctx)
+}
+
+// Shutdown shuts down the decorated service
+func (s *InstrumentedUserService) Shutdown() {
+	s.service.Shutdown()
+}
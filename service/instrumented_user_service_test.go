@@ -0,0 +1,46 @@
+package service
+
+import (
+	"github.com/bpsaunders/user-api/metrics"
+	"github.com/golang/mock/gomock"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitInstrumentedUserService(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mock := NewMockUserService(mockCtrl)
+	svc := NewInstrumentedUserService(mock)
+
+	Convey("Given I fetch a user which doesn't exist through an instrumented service", t, func() {
+
+		before := metrics.ServiceResponses.Value("get_user", NotFound.String())
+
+		mock.EXPECT().GetUser(gomock.Any(), id).Return(NotFound, nil, nil)
+
+		responseType, user, err := svc.GetUser(ctx, id)
+
+		Convey("Then I expect the decorated service's response to be returned", func() {
+
+			So(responseType, ShouldEqual, NotFound)
+			So(user, ShouldBeNil)
+			So(err, ShouldBeNil)
+
+			Convey("And the response type to be counted", func() {
+
+				So(metrics.ServiceResponses.Value("get_user", NotFound.String()), ShouldEqual, before+1)
+			})
+		})
+	})
+
+	Convey("Verify the decorated service is shutdown on application shutdown", t, func() {
+
+		mock.EXPECT().Shutdown().Times(1)
+
+		svc.Shutdown()
+	})
+}
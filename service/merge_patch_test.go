@@ -0,0 +1,53 @@
+package service
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitMergePatch(t *testing.T) {
+
+	Convey("Given I have a target document", t, func() {
+
+		target := map[string]interface{}{
+			"a": "b",
+			"c": map[string]interface{}{
+				"d": "e",
+				"f": "g",
+			},
+		}
+
+		Convey("When I apply a merge patch to it", func() {
+
+			patch := map[string]interface{}{
+				"a": "z",
+				"c": map[string]interface{}{
+					"f": nil,
+				},
+			}
+
+			result := mergePatch(target, patch)
+
+			Convey("Then I expect members to be replaced, merged and removed", func() {
+
+				So(result, ShouldResemble, map[string]interface{}{
+					"a": "z",
+					"c": map[string]interface{}{
+						"d": "e",
+					},
+				})
+			})
+		})
+
+		Convey("When I apply a patch which isn't an object", func() {
+
+			result := mergePatch(target, "replacement")
+
+			Convey("Then I expect the target to be replaced", func() {
+
+				So(result, ShouldEqual, "replacement")
+			})
+		})
+	})
+}
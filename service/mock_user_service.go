@@ -5,6 +5,7 @@
 package service
 
 import (
+	context "context"
 	models "github.com/bpsaunders/user-api/models"
 	validators "github.com/bpsaunders/user-api/validators"
 	gomock "github.com/golang/mock/gomock"
@@ -35,41 +36,139 @@ func (m *MockUserService) EXPECT() *MockUserServiceMockRecorder {
 }
 
 // CreateUser mocks base method
-func (m *MockUserService) CreateUser(arg0 *models.User) (ResponseType, []validators.ValidationError, error) {
+func (m *MockUserService) CreateUser(arg0 context.Context, arg1 *models.User) (ResponseType, *models.User, []validators.ValidationError, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateUser", arg0)
+	ret := m.ctrl.Call(m, "CreateUser", arg0, arg1)
 	ret0, _ := ret[0].(ResponseType)
-	ret1, _ := ret[1].([]validators.ValidationError)
+	ret1, _ := ret[1].(*models.User)
+	ret2, _ := ret[2].([]validators.ValidationError)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// CreateUser indicates an expected call of CreateUser
+func (mr *MockUserServiceMockRecorder) CreateUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUserService)(nil).CreateUser), arg0, arg1)
+}
+
+// CreateUserIdempotently mocks base method
+func (m *MockUserService) CreateUserIdempotently(arg0 context.Context, arg1 string, arg2 *models.User) (ResponseType, *models.User, []validators.ValidationError, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUserIdempotently", arg0, arg1, arg2)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(*models.User)
+	ret2, _ := ret[2].([]validators.ValidationError)
+	ret3, _ := ret[3].(bool)
+	ret4, _ := ret[4].(error)
+	return ret0, ret1, ret2, ret3, ret4
+}
+
+// CreateUserIdempotently indicates an expected call of CreateUserIdempotently
+func (mr *MockUserServiceMockRecorder) CreateUserIdempotently(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUserIdempotently", reflect.TypeOf((*MockUserService)(nil).CreateUserIdempotently), arg0, arg1, arg2)
+}
+
+// DeleteUser mocks base method
+func (m *MockUserService) DeleteUser(arg0 context.Context, arg1 string, arg2 *models.Precondition) (ResponseType, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteUser indicates an expected call of DeleteUser
+func (mr *MockUserServiceMockRecorder) DeleteUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUserService)(nil).DeleteUser), arg0, arg1, arg2)
+}
+
+// EraseUser mocks base method
+func (m *MockUserService) EraseUser(arg0 context.Context, arg1 string, arg2 bool) (ResponseType, *models.ErasureReceipt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EraseUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(*models.ErasureReceipt)
 	ret2, _ := ret[2].(error)
 	return ret0, ret1, ret2
 }
 
-// CreateUser indicates an expected call of CreateUser
-func (mr *MockUserServiceMockRecorder) CreateUser(arg0 interface{}) *gomock.Call {
+// EraseUser indicates an expected call of EraseUser
+func (mr *MockUserServiceMockRecorder) EraseUser(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUserService)(nil).CreateUser), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EraseUser", reflect.TypeOf((*MockUserService)(nil).EraseUser), arg0, arg1, arg2)
 }
 
-// GetAllUsers mocks base method
-func (m *MockUserService) GetAllUsers() (ResponseType, *[]*models.User, error) {
+// ExportUserData mocks base method
+func (m *MockUserService) ExportUserData(arg0 context.Context, arg1 string) (ResponseType, *models.DataExport, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllUsers")
+	ret := m.ctrl.Call(m, "ExportUserData", arg0, arg1)
 	ret0, _ := ret[0].(ResponseType)
-	ret1, _ := ret[1].(*[]*models.User)
+	ret1, _ := ret[1].(*models.DataExport)
 	ret2, _ := ret[2].(error)
 	return ret0, ret1, ret2
 }
 
+// ExportUserData indicates an expected call of ExportUserData
+func (mr *MockUserServiceMockRecorder) ExportUserData(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportUserData", reflect.TypeOf((*MockUserService)(nil).ExportUserData), arg0, arg1)
+}
+
+// ExportUsers mocks base method
+func (m *MockUserService) ExportUsers(arg0 context.Context, arg1 *models.UserListQuery, arg2 func(*models.User) error) (ResponseType, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportUsers", arg0, arg1, arg2)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportUsers indicates an expected call of ExportUsers
+func (mr *MockUserServiceMockRecorder) ExportUsers(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportUsers", reflect.TypeOf((*MockUserService)(nil).ExportUsers), arg0, arg1, arg2)
+}
+
+// FindUsersByEmail mocks base method
+func (m *MockUserService) FindUsersByEmail(arg0 context.Context, arg1 string) (ResponseType, *models.UserList, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindUsersByEmail", arg0, arg1)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(*models.UserList)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// FindUsersByEmail indicates an expected call of FindUsersByEmail
+func (mr *MockUserServiceMockRecorder) FindUsersByEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUsersByEmail", reflect.TypeOf((*MockUserService)(nil).FindUsersByEmail), arg0, arg1)
+}
+
+// GetAllUsers mocks base method
+func (m *MockUserService) GetAllUsers(arg0 context.Context, arg1 *models.UserListQuery) (ResponseType, *models.UserList, []validators.ValidationError, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllUsers", arg0, arg1)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(*models.UserList)
+	ret2, _ := ret[2].([]validators.ValidationError)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
 // GetAllUsers indicates an expected call of GetAllUsers
-func (mr *MockUserServiceMockRecorder) GetAllUsers() *gomock.Call {
+func (mr *MockUserServiceMockRecorder) GetAllUsers(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllUsers", reflect.TypeOf((*MockUserService)(nil).GetAllUsers))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllUsers", reflect.TypeOf((*MockUserService)(nil).GetAllUsers), arg0, arg1)
 }
 
 // GetUser mocks base method
-func (m *MockUserService) GetUser(arg0 string) (ResponseType, *models.User, error) {
+func (m *MockUserService) GetUser(arg0 context.Context, arg1 string) (ResponseType, *models.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUser", arg0)
+	ret := m.ctrl.Call(m, "GetUser", arg0, arg1)
 	ret0, _ := ret[0].(ResponseType)
 	ret1, _ := ret[1].(*models.User)
 	ret2, _ := ret[2].(error)
@@ -77,9 +176,124 @@ func (m *MockUserService) GetUser(arg0 string) (ResponseType, *models.User, erro
 }
 
 // GetUser indicates an expected call of GetUser
-func (mr *MockUserServiceMockRecorder) GetUser(arg0 interface{}) *gomock.Call {
+func (mr *MockUserServiceMockRecorder) GetUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockUserService)(nil).GetUser), arg0, arg1)
+}
+
+// GetUserHistory mocks base method
+func (m *MockUserService) GetUserHistory(arg0 context.Context, arg1 string, arg2 *models.UserHistoryQuery) (ResponseType, *models.AuditEventList, []validators.ValidationError, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserHistory", arg0, arg1, arg2)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(*models.AuditEventList)
+	ret2, _ := ret[2].([]validators.ValidationError)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// GetUserHistory indicates an expected call of GetUserHistory
+func (mr *MockUserServiceMockRecorder) GetUserHistory(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserHistory", reflect.TypeOf((*MockUserService)(nil).GetUserHistory), arg0, arg1, arg2)
+}
+
+// GetUserStats mocks base method
+func (m *MockUserService) GetUserStats(arg0 context.Context, arg1 *models.UserStatsQuery) (ResponseType, *models.UserStats, []validators.ValidationError, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserStats", arg0, arg1)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(*models.UserStats)
+	ret2, _ := ret[2].([]validators.ValidationError)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// GetUserStats indicates an expected call of GetUserStats
+func (mr *MockUserServiceMockRecorder) GetUserStats(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserStats", reflect.TypeOf((*MockUserService)(nil).GetUserStats), arg0, arg1)
+}
+
+// ImportUsers mocks base method
+func (m *MockUserService) ImportUsers(arg0 context.Context, arg1 []*models.ImportRow, arg2 bool) (ResponseType, *ImportReport, []validators.ValidationError, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportUsers", arg0, arg1, arg2)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(*ImportReport)
+	ret2, _ := ret[2].([]validators.ValidationError)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// ImportUsers indicates an expected call of ImportUsers
+func (mr *MockUserServiceMockRecorder) ImportUsers(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportUsers", reflect.TypeOf((*MockUserService)(nil).ImportUsers), arg0, arg1, arg2)
+}
+
+// PatchUser mocks base method
+func (m *MockUserService) PatchUser(arg0 context.Context, arg1 string, arg2 map[string]interface{}, arg3 *models.Precondition) (ResponseType, *models.User, []validators.ValidationError, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PatchUser", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(*models.User)
+	ret2, _ := ret[2].([]validators.ValidationError)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// PatchUser indicates an expected call of PatchUser
+func (mr *MockUserServiceMockRecorder) PatchUser(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockUserService)(nil).GetUser), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchUser", reflect.TypeOf((*MockUserService)(nil).PatchUser), arg0, arg1, arg2, arg3)
+}
+
+// Ping mocks base method
+func (m *MockUserService) Ping(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping
+func (mr *MockUserServiceMockRecorder) Ping(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockUserService)(nil).Ping), arg0)
+}
+
+// RestoreUser mocks base method
+func (m *MockUserService) RestoreUser(arg0 context.Context, arg1 string) (ResponseType, *models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreUser", arg0, arg1)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(*models.User)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// RestoreUser indicates an expected call of RestoreUser
+func (mr *MockUserServiceMockRecorder) RestoreUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreUser", reflect.TypeOf((*MockUserService)(nil).RestoreUser), arg0, arg1)
+}
+
+// SearchUsers mocks base method
+func (m *MockUserService) SearchUsers(arg0 context.Context, arg1 *models.UserSearchQuery) (ResponseType, *models.UserList, []validators.ValidationError, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", arg0, arg1)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(*models.UserList)
+	ret2, _ := ret[2].([]validators.ValidationError)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// SearchUsers indicates an expected call of SearchUsers
+func (mr *MockUserServiceMockRecorder) SearchUsers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockUserService)(nil).SearchUsers), arg0, arg1)
 }
 
 // Shutdown mocks base method
@@ -93,3 +307,20 @@ func (mr *MockUserServiceMockRecorder) Shutdown() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockUserService)(nil).Shutdown))
 }
+
+// UpdateUser mocks base method
+func (m *MockUserService) UpdateUser(arg0 context.Context, arg1 string, arg2 *models.User, arg3 *models.Precondition) (ResponseType, *models.User, []validators.ValidationError, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUser", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(ResponseType)
+	ret1, _ := ret[1].(*models.User)
+	ret2, _ := ret[2].([]validators.ValidationError)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// UpdateUser indicates an expected call of UpdateUser
+func (mr *MockUserServiceMockRecorder) UpdateUser(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockUserService)(nil).UpdateUser), arg0, arg1, arg2, arg3)
+}
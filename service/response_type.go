@@ -18,6 +18,25 @@ const (
 
 	// Success response
 	Success
+
+	// Timeout response, where an operation couldn't complete within its deadline
+	Timeout
+
+	// Cancelled response, where an operation was abandoned by its caller
+	Cancelled
+
+	// PreconditionFailed response, where a write was conditional upon a version of a user which isn't current
+	PreconditionFailed
+
+	// IdempotencyKeyReused response, where an idempotency key is reused for a different request
+	IdempotencyKeyReused
+
+	// IdempotencyKeyInUse response, where a request with the same idempotency key is still in progress
+	IdempotencyKeyInUse
+
+	// AtomicImportUnsupported response, where an all or nothing import can't be made as the database doesn't support
+	// transactions
+	AtomicImportUnsupported
 )
 
 var values = [...]string{
@@ -26,9 +45,26 @@ var values = [...]string{
 	"conflict",
 	"not-found",
 	"success",
+	"timeout",
+	"cancelled",
+	"precondition-failed",
+	"idempotency-key-reused",
+	"idempotency-key-in-use",
+	"atomic-import-unsupported",
 }
 
 // String representation of `ResponseType`
 func (a ResponseType) String() string {
 	return values[a]
 }
+
+// parseResponseType returns the response type with the given string representation
+func parseResponseType(s string) (ResponseType, bool) {
+
+	for i, value := range values {
+		if value == s {
+			return ResponseType(i), true
+		}
+	}
+	return Error, false
+}
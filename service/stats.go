@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"github.com/bpsaunders/user-api/countries"
+	"github.com/bpsaunders/user-api/db"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/validators"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultStatsInterval is the interval by which signups are counted, where one isn't requested
+const DefaultStatsInterval = models.IntervalMonth
+
+// DefaultStatsTop is the number of email domains counted, where one isn't requested
+const DefaultStatsTop = 10
+
+// statsCache holds statistics of users for a short time after they're generated, by the query which generated
+// them, so that dashboards polling for them don't each aggregate every user. A nil cache holds nothing
+type statsCache struct {
+	mtx     sync.Mutex
+	ttl     time.Duration
+	entries map[db.UserStatsQuery]*cachedStats
+}
+
+type cachedStats struct {
+	stats   *models.UserStats
+	expires time.Time
+}
+
+func newStatsCache(ttl time.Duration) *statsCache {
+	return &statsCache{
+		ttl:     ttl,
+		entries: make(map[db.UserStatsQuery]*cachedStats),
+	}
+}
+
+// get returns the statistics generated by a query, unless they've expired. They're shared by every caller, so
+// mustn't be changed
+func (c *statsCache) get(query db.UserStatsQuery) (*models.UserStats, bool) {
+
+	if c == nil {
+		return nil, false
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, ok := c.entries[query]
+	if !ok || !time.Now().Before(entry.expires) {
+		return nil, false
+	}
+	return entry.stats, true
+}
+
+// put holds the statistics generated by a query until they expire, removing any others which have expired
+func (c *statsCache) put(query db.UserStatsQuery, stats *models.UserStats) {
+
+	if c == nil {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := time.Now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+
+	c.entries[query] = &cachedStats{stats: stats, expires: now.Add(c.ttl)}
+}
+
+// GetUserStats returns counts of the users matching a query: by country, by the email domains with the most users,
+// and by the interval in which they were created. Statistics are cached briefly, so may be slightly out of date
+func (service *UserServiceImpl) GetUserStats(ctx context.Context, query *models.UserStatsQuery) (ResponseType, *models.UserStats, []validators.ValidationError, error) {
+
+	ctx, cancel := service.readContext(ctx)
+	defer cancel()
+
+	// validate the query parameters first
+	validationErrors := service.validator.ValidateStatsQuery(query)
+	if len(validationErrors) > 0 {
+		return InvalidData, nil, validationErrors, nil
+	}
+
+	dbQuery, err := toStatsQuery(query)
+	if err != nil {
+		return errorResponse(ctx), nil, validationErrors, err
+	}
+
+	if stats, ok := service.stats.get(*dbQuery); ok {
+		return Success, stats, validationErrors, nil
+	}
+
+	entity, err := service.db.GetUserStats(ctx, dbQuery)
+	if err != nil {
+		return errorResponse(ctx), nil, validationErrors, err
+	}
+
+	stats := service.transformer.ToRestStats(entity)
+	stats.Interval = dbQuery.Interval
+	stats.GeneratedAt = now()
+
+	service.stats.put(*dbQuery, stats)
+
+	return Success, stats, validationErrors, nil
+}
+
+// toStatsQuery converts validated query parameters to a db stats query. Dates are whole days in UTC, so users are
+// counted up to the end of the last
+func toStatsQuery(query *models.UserStatsQuery) (*db.UserStatsQuery, error) {
+
+	dbQuery := &db.UserStatsQuery{
+		Country:     countries.Normalise(query.Country),
+		EmailDomain: query.EmailDomain,
+		Interval:    DefaultStatsInterval,
+		TopDomains:  DefaultStatsTop,
+	}
+
+	if query.Interval != "" {
+		dbQuery.Interval = query.Interval
+	}
+
+	if query.Top != "" {
+		top, err := strconv.Atoi(query.Top)
+		if err != nil {
+			return nil, err
+		}
+		dbQuery.TopDomains = top
+	}
+
+	if query.From != "" {
+		from, err := time.Parse(validators.DateLayout, query.From)
+		if err != nil {
+			return nil, err
+		}
+		dbQuery.CreatedFrom = from
+	}
+
+	if query.To != "" {
+		to, err := time.Parse(validators.DateLayout, query.To)
+		if err != nil {
+			return nil, err
+		}
+		dbQuery.CreatedBefore = to.AddDate(0, 0, 1)
+	}
+
+	return dbQuery, nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"github.com/bpsaunders/user-api/db"
+	"github.com/bpsaunders/user-api/models"
+	"github.com/bpsaunders/user-api/transformers"
+	"github.com/bpsaunders/user-api/validators"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitGetUserStats(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	client := db.NewMockClient(mockCtrl)
+
+	newService := func(ttl time.Duration) *UserServiceImpl {
+		return &UserServiceImpl{
+			transformer: transformers.NewUserTransformer(),
+			validator:   validators.NewUserValidator(),
+			db:          client,
+			stats:       newStatsCache(ttl),
+		}
+	}
+
+	defaults := &db.UserStatsQuery{Interval: DefaultStatsInterval, TopDomains: DefaultStatsTop}
+
+	Convey("Given I fetch statistics with invalid query parameters", t, func() {
+
+		responseType, stats, validationErrors, err := newService(time.Minute).GetUserStats(ctx, &models.UserStatsQuery{Interval: "year"})
+
+		Convey("Then I expect an 'invalid-data' response type, with the validation errors", func() {
+
+			So(responseType, ShouldEqual, InvalidData)
+			So(len(validationErrors), ShouldEqual, 1)
+			So(stats, ShouldBeNil)
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Given I fetch statistics with every parameter", t, func() {
+
+		query := &models.UserStatsQuery{
+			Country:     "gb",
+			EmailDomain: "example.com",
+			From:        "2020-01-01",
+			To:          "2020-01-31",
+			Interval:    models.IntervalWeek,
+			Top:         "5",
+		}
+
+		client.EXPECT().GetUserStats(gomock.Any(), &db.UserStatsQuery{
+			Country:       "GB",
+			EmailDomain:   "example.com",
+			CreatedFrom:   time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+			CreatedBefore: time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC),
+			Interval:      models.IntervalWeek,
+			TopDomains:    5,
+		}).Return(&models.UserStatsDao{Total: 2}, nil)
+
+		responseType, stats, _, err := newService(time.Minute).GetUserStats(ctx, query)
+
+		Convey("Then I expect users to be counted up to the end of the last day, by the interval requested", func() {
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+			So(stats.Total, ShouldEqual, 2)
+			So(stats.Interval, ShouldEqual, models.IntervalWeek)
+			So(stats.GeneratedAt, ShouldNotBeZeroValue)
+		})
+	})
+
+	Convey("Given I fetch the same statistics twice in quick succession", t, func() {
+
+		svc := newService(time.Minute)
+
+		client.EXPECT().GetUserStats(gomock.Any(), defaults).Return(&models.UserStatsDao{Total: 1}, nil).Times(1)
+
+		_, first, _, err := svc.GetUserStats(ctx, &models.UserStatsQuery{})
+		So(err, ShouldBeNil)
+
+		_, second, _, err := svc.GetUserStats(ctx, &models.UserStatsQuery{Interval: DefaultStatsInterval})
+		So(err, ShouldBeNil)
+
+		Convey("Then I expect the users to be counted only once", func() {
+
+			So(second, ShouldEqual, first)
+		})
+
+		Convey("Then I expect other statistics to be counted afresh", func() {
+
+			client.EXPECT().GetUserStats(gomock.Any(), &db.UserStatsQuery{Country: "FR", Interval: DefaultStatsInterval, TopDomains: DefaultStatsTop}).
+				Return(&models.UserStatsDao{}, nil)
+
+			_, other, _, err := svc.GetUserStats(ctx, &models.UserStatsQuery{Country: "FR"})
+
+			So(err, ShouldBeNil)
+			So(other.Total, ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given I fetch statistics again once they've expired", t, func() {
+
+		svc := newService(time.Millisecond)
+
+		client.EXPECT().GetUserStats(gomock.Any(), defaults).Return(&models.UserStatsDao{Total: 1}, nil).Times(2)
+
+		_, _, _, err := svc.GetUserStats(ctx, &models.UserStatsQuery{})
+		So(err, ShouldBeNil)
+
+		time.Sleep(5 * time.Millisecond)
+
+		_, stats, _, err := svc.GetUserStats(ctx, &models.UserStatsQuery{})
+
+		Convey("Then I expect the users to be counted afresh, and the expired statistics removed", func() {
+
+			So(err, ShouldBeNil)
+			So(stats.Total, ShouldEqual, 1)
+			So(len(svc.stats.entries), ShouldEqual, 1)
+		})
+	})
+
+	Convey("Given I encounter errors when fetching statistics", t, func() {
+
+		dbErr := errors.New("error when counting users")
+		client.EXPECT().GetUserStats(gomock.Any(), defaults).Return(nil, dbErr)
+
+		responseType, stats, _, err := newService(time.Minute).GetUserStats(ctx, &models.UserStatsQuery{})
+
+		Convey("Then I expect an 'error' response type", func() {
+
+			So(responseType, ShouldEqual, Error)
+			So(stats, ShouldBeNil)
+			So(err, ShouldEqual, dbErr)
+		})
+	})
+}
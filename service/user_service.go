@@ -1,82 +1,153 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/bpsaunders/user-api/config"
+	"github.com/bpsaunders/user-api/countries"
 	"github.com/bpsaunders/user-api/db"
 	"github.com/bpsaunders/user-api/models"
 	"github.com/bpsaunders/user-api/transformers"
 	"github.com/bpsaunders/user-api/validators"
-	"github.com/hashicorp/go-uuid"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // UserService provides an interface by which to interact with a User resource
 type UserService interface {
-	CreateUser(rest *models.User) (ResponseType, []validators.ValidationError, error)
-	GetUser(id string) (ResponseType, *models.User, error)
-	GetAllUsers() (ResponseType, *[]*models.User, error)
+	CreateUser(ctx context.Context, rest *models.User) (ResponseType, *models.User, []validators.ValidationError, error)
+	CreateUserIdempotently(ctx context.Context, key string, rest *models.User) (ResponseType, *models.User, []validators.ValidationError, bool, error)
+	GetUser(ctx context.Context, id string) (ResponseType, *models.User, error)
+	GetAllUsers(ctx context.Context, query *models.UserListQuery) (ResponseType, *models.UserList, []validators.ValidationError, error)
+	FindUsersByEmail(ctx context.Context, email string) (ResponseType, *models.UserList, error)
+	SearchUsers(ctx context.Context, query *models.UserSearchQuery) (ResponseType, *models.UserList, []validators.ValidationError, error)
+	GetUserStats(ctx context.Context, query *models.UserStatsQuery) (ResponseType, *models.UserStats, []validators.ValidationError, error)
+	ExportUsers(ctx context.Context, query *models.UserListQuery, write func(user *models.User) error) (ResponseType, error)
+	UpdateUser(ctx context.Context, id string, rest *models.User, precondition *models.Precondition) (ResponseType, *models.User, []validators.ValidationError, error)
+	PatchUser(ctx context.Context, id string, patch map[string]interface{}, precondition *models.Precondition) (ResponseType, *models.User, []validators.ValidationError, error)
+	DeleteUser(ctx context.Context, id string, precondition *models.Precondition) (ResponseType, error)
+	RestoreUser(ctx context.Context, id string) (ResponseType, *models.User, error)
+	ExportUserData(ctx context.Context, id string) (ResponseType, *models.DataExport, error)
+	EraseUser(ctx context.Context, id string, blockReregistration bool) (ResponseType, *models.ErasureReceipt, error)
+	ImportUsers(ctx context.Context, rows []*models.ImportRow, allOrNothing bool) (ResponseType, *ImportReport, []validators.ValidationError, error)
+	GetUserHistory(ctx context.Context, id string, query *models.UserHistoryQuery) (ResponseType, *models.AuditEventList, []validators.ValidationError, error)
+	Ping(ctx context.Context) error
 	Shutdown()
 }
 
+// DefaultListLimit is the page size used when fetching users, or their history, without a limit
+const DefaultListLimit = 20
+
+// MaxPersonalSortUsers is the most users which may match a list sorted by names or email, as it's sorted in memory
+const MaxPersonalSortUsers = db.MaxPersonalSortUsers
+
 // UserServiceImpl provides a concrete implementation of the UserService interface
 type UserServiceImpl struct {
 	transformer transformers.UserTransform
 	validator   validators.UserValidate
 	db          db.Client
+
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	// deleted users are purged once they've been deleted for longer than the retention period
+	retention   time.Duration
+	stopPurging chan struct{}
+
+	// erased emails are hashed, and erasure receipts signed, with the erasure key
+	erasureKey []byte
+
+	stats *statsCache
 }
 
 // NewUserService returns a new concrete implementation of the UserService interface
 func NewUserService(cfg *config.Config) UserService {
-	return &UserServiceImpl{
+
+	service := &UserServiceImpl{
 		transformer: transformers.NewUserTransformer(),
 		validator:   validators.NewUserValidator(),
-		db:          db.NewDatabaseClient(cfg),
+		db:          db.NewInstrumentedClient(newDatabaseClient(cfg)),
+
+		readTimeout:  time.Duration(cfg.DBReadTimeout) * time.Millisecond,
+		writeTimeout: time.Duration(cfg.DBWriteTimeout) * time.Millisecond,
+
+		retention:   time.Duration(cfg.DeletedUserRetention) * time.Hour,
+		stopPurging: make(chan struct{}),
+
+		erasureKey: newErasureKey(cfg.ErasureKey),
+
+		stats: newStatsCache(time.Duration(cfg.StatsCacheTTL) * time.Millisecond),
+	}
+	go service.purgePeriodically(time.Duration(cfg.PurgeInterval) * time.Millisecond)
+
+	return NewInstrumentedUserService(service)
+}
+
+// newDatabaseClient returns the db client for the configured storage backend
+func newDatabaseClient(cfg *config.Config) db.Client {
+
+	if cfg.StorageBackend == config.StorageBackendMemory {
+		log.Info("using in-memory storage; data will not persist beyond the life of the application")
+		return db.NewMemoryClient()
 	}
+
+	return db.NewDatabaseClient(cfg)
 }
 
-// CreateUser validates and creates a user resource
-func (service *UserServiceImpl) CreateUser(rest *models.User) (ResponseType, []validators.ValidationError, error) {
+// CreateUser validates and creates a user resource, returning the representation of the created user
+func (service *UserServiceImpl) CreateUser(ctx context.Context, rest *models.User) (ResponseType, *models.User, []validators.ValidationError, error) {
+
+	ctx, cancel := service.writeContext(ctx)
+	defer cancel()
 
 	// validate the resource first
 	validationErrors := service.validator.Validate(rest)
 	if len(validationErrors) > 0 {
-		return InvalidData, validationErrors, nil
+		return InvalidData, nil, validationErrors, nil
 	}
 
-	userExists, err := service.db.UserExistsWithEmail(rest.Email)
+	// an erased user may have blocked its email from being registered again
+	erased, err := service.emailErased(ctx, rest.Email)
 	if err != nil {
-		return Error, validationErrors, err
+		return errorResponse(ctx), nil, validationErrors, err
 	}
-	if userExists {
-		return Conflict, validationErrors, err
+	if erased {
+		return Conflict, nil, validationErrors, nil
 	}
 
-	// no validation errors; generate a unique id and stamp it on the rest resource
-	id, err := uuid.GenerateUUID()
+	// no validation errors; transform the rest resource to a DAO entity, with a unique id
+	entity, err := service.newEntity(rest)
 	if err != nil {
-		return Error, validationErrors, err
+		return errorResponse(ctx), nil, validationErrors, err
 	}
-	rest.ID = id
 
-	// transformer the rest resource to a DAO entity
-	entity := service.transformer.ToEntity(rest)
-
-	// save entity to the db
-	err = service.db.CreateUser(entity)
+	// save entity to the db; email uniqueness is enforced atomically by the db
+	err = service.db.CreateUser(ctx, entity)
+	if err == db.ErrDuplicateEmail {
+		return Conflict, nil, validationErrors, nil
+	}
 	if err != nil {
-		return Error, validationErrors, err
+		return errorResponse(ctx), nil, validationErrors, err
 	}
 
-	return Success, validationErrors, err
+	service.recordAudit(ctx, operationCreate, nil, entity)
+
+	return Success, service.transformer.ToRest(entity), validationErrors, nil
 }
 
 // GetUser fetches an individual user according to an id
-func (service *UserServiceImpl) GetUser(id string) (ResponseType, *models.User, error) {
+func (service *UserServiceImpl) GetUser(ctx context.Context, id string) (ResponseType, *models.User, error) {
+
+	ctx, cancel := service.readContext(ctx)
+	defer cancel()
 
 	// fetch the db entity
-	entity, err := service.db.GetUser(id)
+	entity, err := service.db.GetUser(ctx, id)
 
 	if err != nil {
-		return Error, nil, err
+		return errorResponse(ctx), nil, err
 	}
 
 	// if nil entity, no results were found so cascade that up to the handler
@@ -87,21 +158,479 @@ func (service *UserServiceImpl) GetUser(id string) (ResponseType, *models.User,
 	return Success, service.transformer.ToRest(entity), err
 }
 
-// GetAllUsers returns an array of all users
-func (service *UserServiceImpl) GetAllUsers() (ResponseType, *[]*models.User, error) {
+// GetAllUsers returns a page of users matching a query
+func (service *UserServiceImpl) GetAllUsers(ctx context.Context, query *models.UserListQuery) (ResponseType, *models.UserList, []validators.ValidationError, error) {
+
+	ctx, cancel := service.readContext(ctx)
+	defer cancel()
+
+	// validate the query parameters first
+	validationErrors := service.validator.ValidateListQuery(query)
+	if len(validationErrors) > 0 {
+		return InvalidData, nil, validationErrors, nil
+	}
+
+	dbQuery, err := toDatabaseQuery(query)
+	if err != nil {
+		return errorResponse(ctx), nil, validationErrors, err
+	}
+
+	// fetch one more entity than requested, to determine whether there's a further page
+	pageSize := dbQuery.Limit
+	dbQuery.Limit++
+
+	entities, err := service.db.GetAllUsers(ctx, dbQuery)
+	if err == db.ErrTooManyToSort {
+		// names and email are sorted in memory, so the filters must narrow the users enough to do so
+		return InvalidData, nil, validators.ValidateSortSize(MaxPersonalSortUsers), nil
+	}
+	if err != nil {
+		return errorResponse(ctx), nil, validationErrors, err
+	}
+
+	list := &models.UserList{}
+
+	if len(*entities) > pageSize {
+		page := (*entities)[:pageSize]
+		entities = &page
+
+		last := page[pageSize-1]
+		cursor := &models.Cursor{
+			Sort: query.Sort,
+			ID:   last.ID,
+		}
+		for _, field := range dbQuery.Sort {
+			cursor.Values = append(cursor.Values, db.SortValue(last, field.Field))
+		}
+		list.NextCursor = cursor.Encode()
+	}
+
+	list.Items = *service.transformer.ToRestArray(entities)
+
+	if query.IncludeTotal {
+		count, err := service.db.CountUsers(ctx, &dbQuery.Filter)
+		if err != nil {
+			return errorResponse(ctx), nil, validationErrors, err
+		}
+		list.TotalCount = &count
+	}
+
+	return Success, list, validationErrors, nil
+}
+
+// toDatabaseQuery converts validated query parameters to a db query
+func toDatabaseQuery(query *models.UserListQuery) (*db.UserQuery, error) {
+
+	dbQuery := &db.UserQuery{
+		Filter: toDatabaseFilter(query),
+		Limit:  DefaultListLimit,
+	}
+
+	if query.Limit != "" {
+		limit, err := strconv.Atoi(query.Limit)
+		if err != nil {
+			return nil, err
+		}
+		dbQuery.Limit = limit
+	}
+
+	if query.Sort != "" {
+		for _, field := range strings.Split(query.Sort, ",") {
+			dbQuery.Sort = append(dbQuery.Sort, db.SortField{
+				Field:      strings.TrimPrefix(field, "-"),
+				Descending: strings.HasPrefix(field, "-"),
+			})
+		}
+	}
+
+	if query.Cursor != "" {
+		cursor, err := models.DecodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		dbQuery.After = cursor
+	}
+
+	return dbQuery, nil
+}
+
+// toDatabaseFilter converts the filters of query parameters to a db filter
+func toDatabaseFilter(query *models.UserListQuery) db.UserFilter {
+
+	return db.UserFilter{
+		Country:     countries.Normalise(query.Country),
+		EmailDomain: query.EmailDomain,
+		NamePrefix:  query.NamePrefix,
+	}
+}
+
+// FindUsersByEmail returns the list of users with an email, regardless of case: the user it belongs to, if any
+func (service *UserServiceImpl) FindUsersByEmail(ctx context.Context, email string) (ResponseType, *models.UserList, error) {
+
+	ctx, cancel := service.readContext(ctx)
+	defer cancel()
+
+	entity, err := service.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		return errorResponse(ctx), nil, err
+	}
+
+	entities := make([]*models.UserDao, 0, 1)
+	if entity != nil {
+		entities = append(entities, entity)
+	}
+
+	return Success, &models.UserList{Items: *service.transformer.ToRestArray(&entities)}, nil
+}
+
+// SearchUsers returns the users which best match a search of their names and email, most relevant first
+func (service *UserServiceImpl) SearchUsers(ctx context.Context, query *models.UserSearchQuery) (ResponseType, *models.UserList, []validators.ValidationError, error) {
 
-	// fetch the db entities
-	entities, err := service.db.GetAllUsers()
+	ctx, cancel := service.readContext(ctx)
+	defer cancel()
 
+	// validate the query parameters first
+	validationErrors := service.validator.ValidateSearchQuery(query)
+	if len(validationErrors) > 0 {
+		return InvalidData, nil, validationErrors, nil
+	}
+
+	search := &db.UserSearch{Text: query.Q, Limit: DefaultListLimit}
+	if query.Limit != "" {
+		limit, err := strconv.Atoi(query.Limit)
+		if err != nil {
+			return errorResponse(ctx), nil, validationErrors, err
+		}
+		search.Limit = limit
+	}
+
+	entities, err := service.db.SearchUsers(ctx, search)
 	if err != nil {
-		return Error, nil, err
+		return errorResponse(ctx), nil, validationErrors, err
 	}
 
-	return Success, service.transformer.ToRestArray(entities), err
+	return Success, &models.UserList{Items: *service.transformer.ToRestArray(entities)}, validationErrors, nil
+}
+
+// ExportUsers calls write with each user matching the filters of a query, in order of id, as they're read from
+// the db. An export may take far longer than any single read, so is bound only by its context, which is done if
+// the client goes away. Exporting stops at the first error, be it from the db or from write
+func (service *UserServiceImpl) ExportUsers(ctx context.Context, query *models.UserListQuery, write func(user *models.User) error) (ResponseType, error) {
+
+	filter := toDatabaseFilter(query)
+
+	err := service.db.StreamUsers(ctx, &filter, func(entity *models.UserDao) error {
+		return write(service.transformer.ToRest(entity))
+	})
+	if err != nil {
+		return errorResponse(ctx), err
+	}
+
+	return Success, nil
+}
+
+// UpdateUser validates and fully replaces an existing user resource, subject to a precondition, returning the
+// representation of the updated user
+func (service *UserServiceImpl) UpdateUser(ctx context.Context, id string, rest *models.User, precondition *models.Precondition) (ResponseType, *models.User, []validators.ValidationError, error) {
+
+	ctx, cancel := service.writeContext(ctx)
+	defer cancel()
+
+	// the id in the path always takes precedence over any id in the resource
+	rest.ID = id
+
+	// validate the resource first
+	validationErrors := service.validator.Validate(rest)
+	if len(validationErrors) > 0 {
+		return InvalidData, nil, validationErrors, nil
+	}
+
+	existing, err := service.db.GetUser(ctx, id)
+	if err != nil {
+		return errorResponse(ctx), nil, validationErrors, err
+	}
+	if existing == nil {
+		return missingUser(precondition), nil, validationErrors, nil
+	}
+	if !precondition.Met(existing.Version) {
+		return PreconditionFailed, nil, validationErrors, nil
+	}
+
+	return service.saveUser(ctx, operationUpdate, existing, rest, validationErrors)
+}
+
+// PatchUser applies a JSON merge patch to an existing user resource, subject to a precondition, then validates
+// and saves the result
+func (service *UserServiceImpl) PatchUser(ctx context.Context, id string, patch map[string]interface{}, precondition *models.Precondition) (ResponseType, *models.User, []validators.ValidationError, error) {
+
+	ctx, cancel := service.writeContext(ctx)
+	defer cancel()
+
+	entity, err := service.db.GetUser(ctx, id)
+	if err != nil {
+		return errorResponse(ctx), nil, nil, err
+	}
+	if entity == nil {
+		return missingUser(precondition), nil, nil, nil
+	}
+	if !precondition.Met(entity.Version) {
+		return PreconditionFailed, nil, nil, nil
+	}
+
+	// apply the patch to the JSON representation of the existing resource
+	current, err := json.Marshal(service.transformer.ToRest(entity))
+	if err != nil {
+		return errorResponse(ctx), nil, nil, err
+	}
+
+	var document interface{}
+	err = json.Unmarshal(current, &document)
+	if err != nil {
+		return errorResponse(ctx), nil, nil, err
+	}
+
+	patched, err := json.Marshal(mergePatch(document, patch))
+	if err != nil {
+		return errorResponse(ctx), nil, nil, err
+	}
+
+	var rest models.User
+	err = json.Unmarshal(patched, &rest)
+	if err != nil {
+		// the patch has produced a document that no longer describes a user
+		return InvalidData, nil, validators.ValidateUnmarshal(err), nil
+	}
+	rest.ID = id
+
+	validationErrors := service.validator.Validate(&rest)
+	if len(validationErrors) > 0 {
+		return InvalidData, nil, validationErrors, nil
+	}
+
+	return service.saveUser(ctx, operationPatch, entity, &rest, validationErrors)
+}
+
+// saveUser persists a validated update to an existing user, honouring email uniqueness, and returns the
+// representation of the updated user. The update is conditional upon the user not having been modified since
+// it was read, so concurrent writes can't be lost
+func (service *UserServiceImpl) saveUser(ctx context.Context, operation string, existing *models.UserDao, rest *models.User, validationErrors []validators.ValidationError) (ResponseType, *models.User, []validators.ValidationError, error) {
+
+	// store countries by their alpha-2 code, however they were submitted
+	rest.Country = countries.Normalise(rest.Country)
+
+	entity := service.transformer.ToEntity(rest)
+	entity.CreatedAt = existing.CreatedAt
+	entity.UpdatedAt = now()
+	entity.Version = existing.Version + 1
+
+	// the email may only be changed to one which doesn't already belong to another user
+	err := service.db.UpdateUser(ctx, entity, existing.Version)
+	if err == db.ErrDuplicateEmail {
+		return Conflict, nil, validationErrors, nil
+	}
+	if err == db.ErrVersionConflict {
+		return PreconditionFailed, nil, validationErrors, nil
+	}
+	if err != nil {
+		return errorResponse(ctx), nil, validationErrors, err
+	}
+
+	service.recordAudit(ctx, operation, existing, entity)
+
+	return Success, service.transformer.ToRest(entity), validationErrors, nil
+}
+
+// DeleteUser removes a user according to an id, subject to a precondition. The user may be restored until it's
+// purged, once the retention period has passed
+func (service *UserServiceImpl) DeleteUser(ctx context.Context, id string, precondition *models.Precondition) (ResponseType, error) {
+
+	ctx, cancel := service.writeContext(ctx)
+	defer cancel()
+
+	version := db.AnyVersion
+
+	// a precondition can only be checked against the version of the user as it stands
+	if precondition != nil {
+		existing, err := service.db.GetUser(ctx, id)
+		if err != nil {
+			return errorResponse(ctx), err
+		}
+		if existing == nil {
+			return missingUser(precondition), nil
+		}
+		if !precondition.Met(existing.Version) {
+			return PreconditionFailed, nil
+		}
+		version = existing.Version
+	}
+
+	deleted, err := service.db.DeleteUser(ctx, id, version)
+	if err == db.ErrVersionConflict {
+		return PreconditionFailed, nil
+	}
+	if err != nil {
+		return errorResponse(ctx), err
+	}
+
+	if deleted == nil {
+		return missingUser(precondition), nil
+	}
+
+	service.recordAudit(ctx, operationDelete, deleted, nil)
+
+	return Success, nil
+}
+
+// missingUser determines the response type for a write to a user which doesn't exist. A precondition can't hold
+// without a current version of the user, so fails, even if it would hold for any version (RFC 7232 §3.1)
+func missingUser(precondition *models.Precondition) ResponseType {
+
+	if precondition != nil {
+		return PreconditionFailed
+	}
+	return NotFound
+}
+
+// GetUserHistory returns a page of the audit events recorded against a user, most recent first. The history of
+// a deleted user remains available
+func (service *UserServiceImpl) GetUserHistory(ctx context.Context, id string, query *models.UserHistoryQuery) (ResponseType, *models.AuditEventList, []validators.ValidationError, error) {
+
+	ctx, cancel := service.readContext(ctx)
+	defer cancel()
+
+	// validate the query parameters first
+	validationErrors := service.validator.ValidateHistoryQuery(query)
+	if len(validationErrors) > 0 {
+		return InvalidData, nil, validationErrors, nil
+	}
+
+	auditQuery, err := toAuditQuery(id, query)
+	if err != nil {
+		return errorResponse(ctx), nil, validationErrors, err
+	}
+
+	// fetch one more event than requested, to determine whether there's a further page
+	pageSize := auditQuery.Limit
+	auditQuery.Limit++
+
+	events, err := service.db.GetAuditEvents(ctx, auditQuery)
+	if err != nil {
+		return errorResponse(ctx), nil, validationErrors, err
+	}
+
+	// a user without history either doesn't exist, or hasn't been modified since before the audit trail began
+	if len(*events) == 0 && auditQuery.Before == 0 {
+		entity, err := service.db.GetUser(ctx, id)
+		if err != nil {
+			return errorResponse(ctx), nil, validationErrors, err
+		}
+		if entity == nil {
+			return NotFound, nil, validationErrors, nil
+		}
+	}
+
+	list := &models.AuditEventList{}
+
+	if len(*events) > pageSize {
+		page := (*events)[:pageSize]
+		events = &page
+
+		last := page[pageSize-1]
+		cursor := &models.Cursor{
+			Sort:   validators.HistorySort,
+			Values: []string{strconv.FormatInt(last.Sequence, 10)},
+			ID:     last.ID,
+		}
+		list.NextCursor = cursor.Encode()
+	}
+
+	list.Items = *service.transformer.ToRestAuditEvents(events)
+
+	return Success, list, validationErrors, nil
+}
+
+// toAuditQuery converts validated query parameters to a db query for the history of a user
+func toAuditQuery(id string, query *models.UserHistoryQuery) (*db.AuditQuery, error) {
+
+	auditQuery := &db.AuditQuery{
+		UserID: id,
+		Limit:  DefaultListLimit,
+	}
+
+	if query.Limit != "" {
+		limit, err := strconv.Atoi(query.Limit)
+		if err != nil {
+			return nil, err
+		}
+		auditQuery.Limit = limit
+	}
+
+	if query.Cursor != "" {
+		cursor, err := models.DecodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		auditQuery.Before, err = strconv.ParseInt(cursor.Values[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return auditQuery, nil
+}
+
+// now returns the current time, truncated to the millisecond precision with which mongodb stores dates, so
+// that the timestamps of a user are the same when returned on write as when later read back
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// readContext bounds an operation which reads from the db by the configured read timeout
+func (service *UserServiceImpl) readContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, service.readTimeout)
+}
+
+// writeContext bounds an operation which writes to the db by the configured write timeout
+func (service *UserServiceImpl) writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, service.writeTimeout)
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// errorResponse determines the response type for a failed operation, distinguishing an operation which
+// ran out of time, or whose request was abandoned, from any other error
+func errorResponse(ctx context.Context) ResponseType {
+
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return Timeout
+	case context.Canceled:
+		return Cancelled
+	default:
+		return Error
+	}
+}
+
+// Ping checks the db backing the service is reachable, within the configured read timeout
+func (service *UserServiceImpl) Ping(ctx context.Context) error {
+
+	ctx, cancel := service.readContext(ctx)
+	defer cancel()
+
+	return service.db.Ping(ctx)
 }
 
 // Shutdown provides functionality to clean up resources on application shutdown
 func (service *UserServiceImpl) Shutdown() {
 
+	if service.stopPurging != nil {
+		close(service.stopPurging)
+	}
 	service.db.Shutdown()
 }
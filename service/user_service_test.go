@@ -1,13 +1,16 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"github.com/bpsaunders/user-api/db"
 	"github.com/bpsaunders/user-api/models"
 	"github.com/bpsaunders/user-api/transformers"
 	"github.com/bpsaunders/user-api/validators"
 	"github.com/golang/mock/gomock"
+	"sync"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -15,6 +18,8 @@ import (
 const email = "email"
 const id = "id"
 
+var ctx = context.Background()
+
 func TestUnitCreateUser(t *testing.T) {
 
 	mockCtrl := gomock.NewController(t)
@@ -40,11 +45,12 @@ func TestUnitCreateUser(t *testing.T) {
 
 		validator.EXPECT().Validate(&rest).Return(validationErrors)
 
-		responseType, validationErrs, err := svc.CreateUser(&rest)
+		responseType, user, validationErrs, err := svc.CreateUser(ctx, &rest)
 
 		Convey("Then I expect an 'invalid-data' response type", func() {
 
 			So(responseType, ShouldEqual, InvalidData)
+			So(user, ShouldBeNil)
 
 			Convey("And validation errors should be returned", func() {
 
@@ -58,32 +64,18 @@ func TestUnitCreateUser(t *testing.T) {
 		})
 	})
 
-	Convey("Given I attempt to create a rest resource without validation errors", t, func() {
-
-		var validationErrors []validators.ValidationError
-
-		validator.EXPECT().Validate(&rest).Return(validationErrors)
-
-		Convey("But the user already exists", func() {
-
-			client.EXPECT().UserExistsWithEmail(email).Return(true, nil)
+	Convey("Given I attempt to create a user whose email was blocked by an erased user", t, func() {
 
-			responseType, validationErrs, err := svc.CreateUser(&rest)
+		validator.EXPECT().Validate(&rest).Return(nil)
+		client.EXPECT().UserExistsWithEmail(gomock.Any(), svc.tombstone(email)).Return(true, nil)
 
-			Convey("Then I expect a 'conflict' response type", func() {
-
-				So(responseType, ShouldEqual, Conflict)
-
-				Convey("But validation errors should be empty", func() {
-
-					So(len(validationErrs), ShouldEqual, 0)
+		responseType, user, _, err := svc.CreateUser(ctx, &rest)
 
-					Convey("And no errors should be present", func() {
+		Convey("Then I expect a 'conflict' response type, as though the email were taken", func() {
 
-						So(err, ShouldBeNil)
-					})
-				})
-			})
+			So(responseType, ShouldEqual, Conflict)
+			So(user, ShouldBeNil)
+			So(err, ShouldBeNil)
 		})
 	})
 
@@ -92,26 +84,29 @@ func TestUnitCreateUser(t *testing.T) {
 		var validationErrors []validators.ValidationError
 
 		validator.EXPECT().Validate(&rest).Return(validationErrors)
+		client.EXPECT().UserExistsWithEmail(gomock.Any(), svc.tombstone(email)).Return(false, nil)
 
-		Convey("But I am returned an error when checking if the user exists", func() {
+		entity := models.UserDao{}
+
+		transformer.EXPECT().ToEntity(&rest).Return(&entity)
 
-			dbErr := errors.New("error when checking if a user exists")
+		Convey("But a user already exists with the email", func() {
 
-			client.EXPECT().UserExistsWithEmail(email).Return(false, dbErr)
+			client.EXPECT().CreateUser(gomock.Any(), &entity).Return(db.ErrDuplicateEmail)
 
-			responseType, validationErrs, err := svc.CreateUser(&rest)
+			responseType, _, validationErrs, err := svc.CreateUser(ctx, &rest)
 
-			Convey("Then I expect an 'error' response type", func() {
+			Convey("Then I expect a 'conflict' response type", func() {
 
-				So(responseType, ShouldEqual, Error)
+				So(responseType, ShouldEqual, Conflict)
 
 				Convey("But validation errors should be empty", func() {
 
 					So(len(validationErrs), ShouldEqual, 0)
 
-					Convey("And errors should be returned", func() {
+					Convey("And no errors should be present", func() {
 
-						So(err, ShouldEqual, dbErr)
+						So(err, ShouldBeNil)
 					})
 				})
 			})
@@ -123,11 +118,10 @@ func TestUnitCreateUser(t *testing.T) {
 		var validationErrors []validators.ValidationError
 
 		validator.EXPECT().Validate(&rest).Return(validationErrors)
+		client.EXPECT().UserExistsWithEmail(gomock.Any(), svc.tombstone(email)).Return(false, nil)
 
 		Convey("And the user doesn't exist", func() {
 
-			client.EXPECT().UserExistsWithEmail(email).Return(false, nil)
-
 			Convey("Then the REST resource is transformed to a db entity", func() {
 
 				entity := models.UserDao{}
@@ -138,9 +132,9 @@ func TestUnitCreateUser(t *testing.T) {
 
 					dbErr := errors.New("error saving the user to the db")
 
-					client.EXPECT().CreateUser(&entity).Return(dbErr)
+					client.EXPECT().CreateUser(gomock.Any(), &entity).Return(dbErr)
 
-					responseType, validationErrs, err := svc.CreateUser(&rest)
+					responseType, _, validationErrs, err := svc.CreateUser(ctx, &rest)
 
 					Convey("Then I expect an 'error' response type", func() {
 
@@ -166,11 +160,10 @@ func TestUnitCreateUser(t *testing.T) {
 		var validationErrors []validators.ValidationError
 
 		validator.EXPECT().Validate(&rest).Return(validationErrors)
+		client.EXPECT().UserExistsWithEmail(gomock.Any(), svc.tombstone(email)).Return(false, nil)
 
 		Convey("And the user doesn't exist", func() {
 
-			client.EXPECT().UserExistsWithEmail(email).Return(false, nil)
-
 			Convey("Then the REST resource is transformed to a db entity", func() {
 
 				entity := models.UserDao{}
@@ -179,13 +172,24 @@ func TestUnitCreateUser(t *testing.T) {
 
 				Convey("And if there's an error when saving the user to the db", func() {
 
-					client.EXPECT().CreateUser(&entity).Return(nil)
+					client.EXPECT().CreateUser(gomock.Any(), &entity).Return(nil)
+					client.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil)
 
-					responseType, validationErrs, err := svc.CreateUser(&rest)
+					created := models.User{}
+					transformer.EXPECT().ToRest(&entity).Return(&created)
 
-					Convey("Then I expect a 'success' response type", func() {
+					responseType, user, validationErrs, err := svc.CreateUser(ctx, &rest)
+
+					Convey("Then I expect a 'success' response type, with the representation of the created user", func() {
 
 						So(responseType, ShouldEqual, Success)
+						So(user, ShouldEqual, &created)
+
+						Convey("And the entity should have been stamped with its creation time", func() {
+
+							So(entity.CreatedAt.IsZero(), ShouldBeFalse)
+							So(entity.UpdatedAt, ShouldEqual, entity.CreatedAt)
+						})
 
 						Convey("And validation errors should be empty", func() {
 
@@ -208,6 +212,89 @@ func TestUnitCreateUser(t *testing.T) {
 	})
 }
 
+func TestUnitCreateUserNormalisesCountry(t *testing.T) {
+
+	client := db.NewMemoryClient()
+
+	svc := &UserServiceImpl{
+		transformer: transformers.NewUserTransformer(),
+		validator:   validators.NewUserValidator(),
+		db:          client,
+	}
+
+	Convey("Given I create a user with an alpha-3 country code", t, func() {
+
+		user := &models.User{
+			FirstName: "firstName",
+			LastName:  "lastName",
+			Email:     "user@mail.com",
+			Country:   "gbr",
+		}
+
+		responseType, created, _, err := svc.CreateUser(ctx, user)
+
+		Convey("Then I expect the user to be stored with the alpha-2 code", func() {
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+			So(created.Country, ShouldEqual, "GB")
+
+			entity, err := client.GetUser(ctx, user.ID)
+
+			So(err, ShouldBeNil)
+			So(entity.Country, ShouldEqual, "GB")
+		})
+	})
+}
+
+func TestUnitCreateUserConcurrently(t *testing.T) {
+
+	svc := &UserServiceImpl{
+		transformer: transformers.NewUserTransformer(),
+		validator:   validators.NewUserValidator(),
+		db:          db.NewMemoryClient(),
+	}
+
+	Convey("Given I concurrently create users with the same email in different cases", t, func() {
+
+		const attempts = 20
+
+		var wg sync.WaitGroup
+		responseTypes := make(chan ResponseType, attempts)
+
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				user := &models.User{
+					FirstName: "firstName",
+					LastName:  "lastName",
+					Email:     "user@mail.com",
+					Country:   "GB",
+				}
+				if i%2 == 0 {
+					user.Email = "User@Mail.com"
+				}
+				responseType, _, _, _ := svc.CreateUser(ctx, user)
+				responseTypes <- responseType
+			}(i)
+		}
+		wg.Wait()
+		close(responseTypes)
+
+		Convey("Then I expect only one to succeed, and the rest to conflict", func() {
+
+			results := make(map[ResponseType]int)
+			for responseType := range responseTypes {
+				results[responseType]++
+			}
+
+			So(results[Success], ShouldEqual, 1)
+			So(results[Conflict], ShouldEqual, attempts-1)
+		})
+	})
+}
+
 func TestUnitGetUser(t *testing.T) {
 
 	mockCtrl := gomock.NewController(t)
@@ -227,9 +314,9 @@ func TestUnitGetUser(t *testing.T) {
 
 		dbErr := errors.New("error when fetching a user")
 
-		client.EXPECT().GetUser(id).Return(nil, dbErr)
+		client.EXPECT().GetUser(gomock.Any(), id).Return(nil, dbErr)
 
-		responseType, user, err := svc.GetUser(id)
+		responseType, user, err := svc.GetUser(ctx, id)
 
 		Convey("Then I expect an 'error' response type", func() {
 
@@ -249,9 +336,9 @@ func TestUnitGetUser(t *testing.T) {
 
 	Convey("Given I don't find the user I'm fetching", t, func() {
 
-		client.EXPECT().GetUser(id).Return(nil, nil)
+		client.EXPECT().GetUser(gomock.Any(), id).Return(nil, nil)
 
-		responseType, user, err := svc.GetUser(id)
+		responseType, user, err := svc.GetUser(ctx, id)
 
 		Convey("Then I expect a 'not-found' response type", func() {
 
@@ -273,13 +360,13 @@ func TestUnitGetUser(t *testing.T) {
 
 		entity := models.UserDao{}
 
-		client.EXPECT().GetUser(id).Return(&entity, nil)
+		client.EXPECT().GetUser(gomock.Any(), id).Return(&entity, nil)
 
 		rest := models.User{}
 
 		transformer.EXPECT().ToRest(&entity).Return(&rest)
 
-		responseType, user, err := svc.GetUser(id)
+		responseType, user, err := svc.GetUser(ctx, id)
 
 		Convey("Then I expect a 'success' response type", func() {
 
@@ -298,6 +385,59 @@ func TestUnitGetUser(t *testing.T) {
 	})
 }
 
+func TestUnitGetUserDeadlines(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	transformer := transformers.NewMockUserTransform(mockCtrl)
+	validator := validators.NewMockUserValidate(mockCtrl)
+	client := db.NewMockClient(mockCtrl)
+
+	svc := &UserServiceImpl{
+		transformer: transformer,
+		validator:   validator,
+		db:          client,
+		readTimeout: time.Millisecond,
+	}
+
+	Convey("Given fetching a user takes longer than the read timeout", t, func() {
+
+		client.EXPECT().GetUser(gomock.Any(), id).DoAndReturn(func(ctx context.Context, id string) (*models.UserDao, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+		responseType, user, err := svc.GetUser(ctx, id)
+
+		Convey("Then I expect a 'timeout' response type", func() {
+
+			So(responseType, ShouldEqual, Timeout)
+			So(user, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given the request is cancelled whilst fetching a user", t, func() {
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		client.EXPECT().GetUser(gomock.Any(), id).DoAndReturn(func(ctx context.Context, id string) (*models.UserDao, error) {
+			return nil, ctx.Err()
+		})
+
+		responseType, user, err := svc.GetUser(cancelled, id)
+
+		Convey("Then I expect a 'cancelled' response type", func() {
+
+			So(responseType, ShouldEqual, Cancelled)
+			So(user, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
 func TestUnitGetAllUsers(t *testing.T) {
 
 	mockCtrl := gomock.NewController(t)
@@ -313,13 +453,40 @@ func TestUnitGetAllUsers(t *testing.T) {
 		db:          client,
 	}
 
+	Convey("Given I fetch users with invalid query parameters", t, func() {
+
+		query := &models.UserListQuery{Limit: "invalid"}
+
+		validationErrors := []validators.ValidationError{{}}
+
+		validator.EXPECT().ValidateListQuery(query).Return(validationErrors)
+
+		responseType, users, validationErrs, err := svc.GetAllUsers(ctx, query)
+
+		Convey("Then I expect an 'invalid-data' response type", func() {
+
+			So(responseType, ShouldEqual, InvalidData)
+
+			Convey("And validation errors should be returned", func() {
+
+				So(validationErrs, ShouldResemble, validationErrors)
+				So(users, ShouldBeNil)
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+
 	Convey("Given I encounter errors when fetching all users", t, func() {
 
+		query := &models.UserListQuery{}
+
+		validator.EXPECT().ValidateListQuery(query).Return(nil)
+
 		dbErr := errors.New("error when fetching all users")
 
-		client.EXPECT().GetAllUsers().Return(nil, dbErr)
+		client.EXPECT().GetAllUsers(gomock.Any(), &db.UserQuery{Limit: DefaultListLimit + 1}).Return(nil, dbErr)
 
-		responseType, users, err := svc.GetAllUsers()
+		responseType, users, _, err := svc.GetAllUsers(ctx, query)
 
 		Convey("Then I expect an 'error' response type", func() {
 
@@ -337,25 +504,35 @@ func TestUnitGetAllUsers(t *testing.T) {
 		})
 	})
 
-	Convey("Given I successfully fetch all users", t, func() {
+	Convey("Given I successfully fetch the last page of users", t, func() {
+
+		query := &models.UserListQuery{Country: "GB", IncludeTotal: true}
+
+		validator.EXPECT().ValidateListQuery(query).Return(nil)
 
 		entities := make([]*models.UserDao, 0)
 
-		client.EXPECT().GetAllUsers().Return(&entities, nil)
+		dbQuery := &db.UserQuery{Filter: db.UserFilter{Country: "GB"}, Limit: DefaultListLimit + 1}
+
+		client.EXPECT().GetAllUsers(gomock.Any(), dbQuery).Return(&entities, nil)
 
 		restResources := make([]*models.User, 0)
 
 		transformer.EXPECT().ToRestArray(&entities).Return(&restResources)
 
-		responseType, users, err := svc.GetAllUsers()
+		client.EXPECT().CountUsers(gomock.Any(), &db.UserFilter{Country: "GB"}).Return(int64(0), nil)
+
+		responseType, users, _, err := svc.GetAllUsers(ctx, query)
 
 		Convey("Then I expect a 'success' response type", func() {
 
 			So(responseType, ShouldEqual, Success)
 
-			Convey("And users should be returned", func() {
+			Convey("And users should be returned without a next cursor", func() {
 
-				So(users, ShouldEqual, &restResources)
+				So(users.Items, ShouldResemble, restResources)
+				So(users.NextCursor, ShouldBeBlank)
+				So(*users.TotalCount, ShouldEqual, 0)
 
 				Convey("And errors should not be returned", func() {
 
@@ -364,6 +541,806 @@ func TestUnitGetAllUsers(t *testing.T) {
 			})
 		})
 	})
+
+	Convey("Given I fetch users sorted by personal data, matching too many users to sort", t, func() {
+
+		query := &models.UserListQuery{Sort: "last_name"}
+
+		validator.EXPECT().ValidateListQuery(query).Return(nil)
+
+		client.EXPECT().GetAllUsers(gomock.Any(), gomock.Any()).Return(nil, db.ErrTooManyToSort)
+
+		responseType, users, validationErrors, err := svc.GetAllUsers(ctx, query)
+
+		Convey("Then I expect an 'invalid data' response type, with an error for sort", func() {
+
+			So(responseType, ShouldEqual, InvalidData)
+			So(users, ShouldBeNil)
+			So(err, ShouldBeNil)
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, "sort")
+		})
+	})
+
+	Convey("Given I successfully fetch a page of users with further pages", t, func() {
+
+		query := &models.UserListQuery{Limit: "1", Sort: "-last_name"}
+
+		validator.EXPECT().ValidateListQuery(query).Return(nil)
+
+		entities := []*models.UserDao{
+			{ID: "1", LastName: "Smith"},
+			{ID: "2", LastName: "Jones"},
+		}
+
+		dbQuery := &db.UserQuery{Sort: []db.SortField{{Field: "last_name", Descending: true}}, Limit: 2}
+
+		client.EXPECT().GetAllUsers(gomock.Any(), dbQuery).Return(&entities, nil)
+
+		restResources := []*models.User{{ID: "1"}}
+
+		transformer.EXPECT().ToRestArray(&[]*models.UserDao{entities[0]}).Return(&restResources)
+
+		responseType, users, _, err := svc.GetAllUsers(ctx, query)
+
+		Convey("Then I expect a 'success' response type", func() {
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+
+			Convey("And a cursor pointing at the last user on the page", func() {
+
+				cursor, err := models.DecodeCursor(users.NextCursor)
+
+				So(err, ShouldBeNil)
+				So(cursor, ShouldResemble, &models.Cursor{Sort: "-last_name", Values: []string{"Smith"}, ID: "1"})
+				So(users.TotalCount, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestUnitFindUsersByEmail(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	transformer := transformers.NewMockUserTransform(mockCtrl)
+	client := db.NewMockClient(mockCtrl)
+
+	svc := &UserServiceImpl{
+		transformer: transformer,
+		db:          client,
+	}
+
+	Convey("Given I find users by an email which belongs to a user", t, func() {
+
+		entity := &models.UserDao{ID: "id", Email: "bob@example.com"}
+		client.EXPECT().GetUserByEmail(gomock.Any(), "Bob@Example.com").Return(entity, nil)
+
+		rest := []*models.User{{ID: "id"}}
+		transformer.EXPECT().ToRestArray(&[]*models.UserDao{entity}).Return(&rest)
+
+		responseType, users, err := svc.FindUsersByEmail(ctx, "Bob@Example.com")
+
+		Convey("Then I expect a list of only that user", func() {
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+			So(users.Items, ShouldResemble, rest)
+		})
+	})
+
+	Convey("Given I find users by an email which belongs to no user", t, func() {
+
+		client.EXPECT().GetUserByEmail(gomock.Any(), "nobody@example.com").Return(nil, nil)
+
+		rest := make([]*models.User, 0)
+		transformer.EXPECT().ToRestArray(&[]*models.UserDao{}).Return(&rest)
+
+		responseType, users, err := svc.FindUsersByEmail(ctx, "nobody@example.com")
+
+		Convey("Then I expect an empty list rather than 'not-found'", func() {
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+			So(users.Items, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given I encounter errors when finding users by email", t, func() {
+
+		dbErr := errors.New("error when fetching a user by email")
+		client.EXPECT().GetUserByEmail(gomock.Any(), "bob@example.com").Return(nil, dbErr)
+
+		responseType, users, err := svc.FindUsersByEmail(ctx, "bob@example.com")
+
+		Convey("Then I expect an 'error' response type", func() {
+
+			So(responseType, ShouldEqual, Error)
+			So(users, ShouldBeNil)
+			So(err, ShouldEqual, dbErr)
+		})
+	})
+}
+
+func TestUnitSearchUsers(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	transformer := transformers.NewMockUserTransform(mockCtrl)
+	validator := validators.NewMockUserValidate(mockCtrl)
+	client := db.NewMockClient(mockCtrl)
+
+	svc := &UserServiceImpl{
+		transformer: transformer,
+		validator:   validator,
+		db:          client,
+	}
+
+	Convey("Given I search users with invalid query parameters", t, func() {
+
+		query := &models.UserSearchQuery{}
+
+		validationErrors := []validators.ValidationError{{}}
+		validator.EXPECT().ValidateSearchQuery(query).Return(validationErrors)
+
+		responseType, users, validationErrs, err := svc.SearchUsers(ctx, query)
+
+		Convey("Then I expect an 'invalid-data' response type, with the validation errors", func() {
+
+			So(responseType, ShouldEqual, InvalidData)
+			So(validationErrs, ShouldResemble, validationErrors)
+			So(users, ShouldBeNil)
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Given I search users without a limit", t, func() {
+
+		query := &models.UserSearchQuery{Q: "bob"}
+		validator.EXPECT().ValidateSearchQuery(query).Return(nil)
+
+		entities := []*models.UserDao{{ID: "id"}}
+		client.EXPECT().SearchUsers(gomock.Any(), &db.UserSearch{Text: "bob", Limit: DefaultListLimit}).Return(&entities, nil)
+
+		rest := []*models.User{{ID: "id"}}
+		transformer.EXPECT().ToRestArray(&entities).Return(&rest)
+
+		responseType, users, _, err := svc.SearchUsers(ctx, query)
+
+		Convey("Then I expect the most relevant users, up to the default limit", func() {
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+			So(users.Items, ShouldResemble, rest)
+			So(users.NextCursor, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given I encounter errors when searching users", t, func() {
+
+		query := &models.UserSearchQuery{Q: "bob", Limit: "5"}
+		validator.EXPECT().ValidateSearchQuery(query).Return(nil)
+
+		dbErr := errors.New("error when searching users")
+		client.EXPECT().SearchUsers(gomock.Any(), &db.UserSearch{Text: "bob", Limit: 5}).Return(nil, dbErr)
+
+		responseType, users, _, err := svc.SearchUsers(ctx, query)
+
+		Convey("Then I expect an 'error' response type", func() {
+
+			So(responseType, ShouldEqual, Error)
+			So(users, ShouldBeNil)
+			So(err, ShouldEqual, dbErr)
+		})
+	})
+}
+
+func TestUnitExportUsers(t *testing.T) {
+
+	client := db.NewMemoryClient()
+
+	svc := &UserServiceImpl{
+		transformer: transformers.NewUserTransformer(),
+		validator:   validators.NewUserValidator(),
+		db:          client,
+	}
+
+	for _, user := range []*models.UserDao{
+		{ID: "a", Email: "a@mail.com", Country: "GB"},
+		{ID: "b", Email: "b@mail.com", Country: "FR"},
+		{ID: "c", Email: "c@mail.com", Country: "GB"},
+	} {
+		if err := client.CreateUser(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("Given I export users filtered by country, by its alpha-3 code", t, func() {
+
+		exported := make([]*models.User, 0)
+		responseType, err := svc.ExportUsers(ctx, &models.UserListQuery{Country: "gbr"}, func(user *models.User) error {
+			exported = append(exported, user)
+			return nil
+		})
+
+		Convey("Then I expect each matching user to be written, in order of id", func() {
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+			So(len(exported), ShouldEqual, 2)
+			So(exported[0].ID, ShouldEqual, "a")
+			So(exported[1].ID, ShouldEqual, "c")
+			So(exported[1].Links.Self, ShouldEqual, "/users/c")
+		})
+	})
+
+	Convey("Given the client goes away while users are being exported", t, func() {
+
+		cancelled, cancel := context.WithCancel(ctx)
+
+		written := 0
+		responseType, err := svc.ExportUsers(cancelled, &models.UserListQuery{}, func(user *models.User) error {
+			written++
+			cancel()
+			return nil
+		})
+
+		Convey("Then I expect the export to stop with a 'cancelled' response type", func() {
+
+			So(responseType, ShouldEqual, Cancelled)
+			So(err, ShouldNotBeNil)
+			So(written, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestUnitUpdateUser(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	transformer := transformers.NewMockUserTransform(mockCtrl)
+	validator := validators.NewMockUserValidate(mockCtrl)
+	client := db.NewMockClient(mockCtrl)
+
+	svc := &UserServiceImpl{
+		transformer: transformer,
+		validator:   validator,
+		db:          client,
+	}
+
+	rest := models.User{
+		Email: email,
+	}
+
+	Convey("Given I attempt to update a rest resource with validation errors", t, func() {
+
+		validationErrors := []validators.ValidationError{{}}
+
+		validator.EXPECT().Validate(&rest).Return(validationErrors)
+
+		responseType, _, validationErrs, err := svc.UpdateUser(ctx, id, &rest, nil)
+
+		Convey("Then I expect an 'invalid-data' response type", func() {
+
+			So(responseType, ShouldEqual, InvalidData)
+
+			Convey("And validation errors should be returned", func() {
+
+				So(validationErrs, ShouldResemble, validationErrors)
+
+				Convey("And no errors should be present", func() {
+
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+	})
+
+	Convey("Given I attempt to update a rest resource without validation errors", t, func() {
+
+		var validationErrors []validators.ValidationError
+
+		validator.EXPECT().Validate(&rest).Return(validationErrors)
+
+		Convey("But the user doesn't exist", func() {
+
+			client.EXPECT().GetUser(gomock.Any(), id).Return(nil, nil)
+
+			responseType, _, _, err := svc.UpdateUser(ctx, id, &rest, nil)
+
+			Convey("Then I expect a 'not-found' response type", func() {
+
+				So(responseType, ShouldEqual, NotFound)
+
+				Convey("And no errors should be present", func() {
+
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+	})
+
+	Convey("Given I attempt to update a rest resource without validation errors", t, func() {
+
+		var validationErrors []validators.ValidationError
+
+		validator.EXPECT().Validate(&rest).Return(validationErrors)
+
+		Convey("And the user exists", func() {
+
+			client.EXPECT().GetUser(gomock.Any(), id).Return(&models.UserDao{ID: id}, nil)
+
+			Convey("But the email belongs to another user", func() {
+
+				entity := models.UserDao{}
+
+				transformer.EXPECT().ToEntity(&rest).Return(&entity)
+				client.EXPECT().UpdateUser(gomock.Any(), &entity, int64(0)).Return(db.ErrDuplicateEmail)
+
+				responseType, _, _, err := svc.UpdateUser(ctx, id, &rest, nil)
+
+				Convey("Then I expect a 'conflict' response type", func() {
+
+					So(responseType, ShouldEqual, Conflict)
+
+					Convey("And no errors should be present", func() {
+
+						So(err, ShouldBeNil)
+					})
+				})
+			})
+		})
+	})
+
+	Convey("Given I attempt to update a rest resource without validation errors", t, func() {
+
+		var validationErrors []validators.ValidationError
+
+		validator.EXPECT().Validate(&rest).Return(validationErrors)
+
+		Convey("And the user exists", func() {
+
+			createdAt := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+			client.EXPECT().GetUser(gomock.Any(), id).Return(&models.UserDao{ID: id, CreatedAt: createdAt, Version: 3}, nil)
+
+			Convey("And the email doesn't belong to another user", func() {
+
+				Convey("Then the REST resource is transformed to a db entity", func() {
+
+					entity := models.UserDao{}
+
+					transformer.EXPECT().ToEntity(&rest).Return(&entity)
+
+					Convey("And the user is updated in the db", func() {
+
+						client.EXPECT().UpdateUser(gomock.Any(), &entity, int64(3)).Return(nil)
+						client.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil)
+
+						updated := models.User{}
+						transformer.EXPECT().ToRest(&entity).Return(&updated)
+
+						responseType, user, validationErrs, err := svc.UpdateUser(ctx, id, &rest, nil)
+
+						Convey("Then I expect a 'success' response type, with the representation of the updated user", func() {
+
+							So(responseType, ShouldEqual, Success)
+							So(user, ShouldEqual, &updated)
+
+							Convey("And the entity should keep its creation time, but be stamped with the time of the update", func() {
+
+								So(entity.CreatedAt, ShouldEqual, createdAt)
+								So(entity.UpdatedAt.After(createdAt), ShouldBeTrue)
+							})
+
+							Convey("And the entity should be at the next version", func() {
+
+								So(entity.Version, ShouldEqual, 4)
+							})
+
+							Convey("And validation errors should be empty", func() {
+
+								So(len(validationErrs), ShouldEqual, 0)
+
+								Convey("And no errors should be returned", func() {
+
+									So(err, ShouldBeNil)
+
+									Convey("And the id from the path should be stamped on the REST resource", func() {
+
+										So(rest.ID, ShouldEqual, id)
+									})
+								})
+							})
+						})
+					})
+				})
+			})
+		})
+	})
+}
+
+func TestUnitUpdateUserPreconditions(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	transformer := transformers.NewMockUserTransform(mockCtrl)
+	validator := validators.NewMockUserValidate(mockCtrl)
+	client := db.NewMockClient(mockCtrl)
+
+	svc := &UserServiceImpl{
+		transformer: transformer,
+		validator:   validator,
+		db:          client,
+	}
+
+	rest := models.User{
+		Email: email,
+	}
+
+	Convey("Given I update a user which doesn't exist, conditional upon any version", t, func() {
+
+		validator.EXPECT().Validate(&rest).Return(nil)
+		client.EXPECT().GetUser(gomock.Any(), id).Return(nil, nil)
+
+		responseType, user, _, err := svc.UpdateUser(ctx, id, &rest, &models.Precondition{Any: true})
+
+		Convey("Then I expect a 'precondition-failed' response type, as no version of the user can match", func() {
+
+			So(responseType, ShouldEqual, PreconditionFailed)
+			So(user, ShouldBeNil)
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Given I update a user conditional upon a version", t, func() {
+
+		validator.EXPECT().Validate(&rest).Return(nil)
+		client.EXPECT().GetUser(gomock.Any(), id).Return(&models.UserDao{ID: id, Version: 3}, nil)
+
+		Convey("When the user is at another version", func() {
+
+			responseType, user, _, err := svc.UpdateUser(ctx, id, &rest, &models.Precondition{Versions: []int64{2}})
+
+			Convey("Then I expect a 'precondition-failed' response type, without the user being updated", func() {
+
+				So(responseType, ShouldEqual, PreconditionFailed)
+				So(user, ShouldBeNil)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When the user is at the version, but is modified before it can be updated", func() {
+
+			entity := models.UserDao{}
+
+			transformer.EXPECT().ToEntity(&rest).Return(&entity)
+			client.EXPECT().UpdateUser(gomock.Any(), &entity, int64(3)).Return(db.ErrVersionConflict)
+
+			responseType, user, _, err := svc.UpdateUser(ctx, id, &rest, &models.Precondition{Versions: []int64{3}})
+
+			Convey("Then I expect a 'precondition-failed' response type", func() {
+
+				So(responseType, ShouldEqual, PreconditionFailed)
+				So(user, ShouldBeNil)
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestUnitPatchUser(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	transformer := transformers.NewMockUserTransform(mockCtrl)
+	validator := validators.NewMockUserValidate(mockCtrl)
+	client := db.NewMockClient(mockCtrl)
+
+	svc := &UserServiceImpl{
+		transformer: transformer,
+		validator:   validator,
+		db:          client,
+	}
+
+	Convey("Given I attempt to patch a user that doesn't exist", t, func() {
+
+		client.EXPECT().GetUser(gomock.Any(), id).Return(nil, nil)
+
+		responseType, user, _, err := svc.PatchUser(ctx, id, map[string]interface{}{}, nil)
+
+		Convey("Then I expect a 'not-found' response type", func() {
+
+			So(responseType, ShouldEqual, NotFound)
+
+			Convey("And user should be nil", func() {
+
+				So(user, ShouldBeNil)
+
+				Convey("And no errors should be present", func() {
+
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+	})
+
+	Convey("Given I attempt to patch a user that doesn't exist, conditional upon a version", t, func() {
+
+		client.EXPECT().GetUser(gomock.Any(), id).Return(nil, nil)
+
+		responseType, user, _, err := svc.PatchUser(ctx, id, map[string]interface{}{}, &models.Precondition{Versions: []int64{1}})
+
+		Convey("Then I expect a 'precondition-failed' response type, as no version of the user can match", func() {
+
+			So(responseType, ShouldEqual, PreconditionFailed)
+			So(user, ShouldBeNil)
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Given I attempt to patch a user that exists", t, func() {
+
+		entity := models.UserDao{ID: id}
+
+		client.EXPECT().GetUser(gomock.Any(), id).Return(&entity, nil)
+
+		transformer.EXPECT().ToRest(&entity).Return(&models.User{
+			FirstName: "firstName",
+			LastName:  "lastName",
+			Email:     email,
+			Country:   "GB",
+		})
+
+		patched := models.User{
+			ID:        id,
+			FirstName: "firstName",
+			LastName:  "newLastName",
+			Email:     email,
+		}
+
+		patch := map[string]interface{}{
+			"last_name": "newLastName",
+			"country":   nil,
+		}
+
+		Convey("But the patch gives a field a value of the wrong type", func() {
+
+			responseType, user, validationErrs, err := svc.PatchUser(ctx, id, map[string]interface{}{"email": 5}, nil)
+
+			Convey("Then I expect an 'invalid-data' response type, with an error naming the field and its type", func() {
+
+				So(responseType, ShouldEqual, InvalidData)
+				So(user, ShouldBeNil)
+				So(len(validationErrs), ShouldEqual, 1)
+				So(validationErrs[0].Field, ShouldEqual, "$.email")
+				So(validationErrs[0].Params["expected_type"], ShouldEqual, "string")
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("But the patched resource has validation errors", func() {
+
+			validationErrors := []validators.ValidationError{{}}
+
+			validator.EXPECT().Validate(&patched).Return(validationErrors)
+
+			responseType, user, validationErrs, err := svc.PatchUser(ctx, id, patch, nil)
+
+			Convey("Then I expect an 'invalid-data' response type", func() {
+
+				So(responseType, ShouldEqual, InvalidData)
+				So(user, ShouldBeNil)
+				So(validationErrs, ShouldResemble, validationErrors)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("And the patched resource is valid", func() {
+
+			var validationErrors []validators.ValidationError
+
+			validator.EXPECT().Validate(&patched).Return(validationErrors)
+			updated := models.UserDao{}
+
+			transformer.EXPECT().ToEntity(&patched).Return(&updated)
+			client.EXPECT().UpdateUser(gomock.Any(), &updated, int64(0)).Return(nil)
+			client.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil)
+			transformer.EXPECT().ToRest(&updated).Return(&patched)
+
+			responseType, user, validationErrs, err := svc.PatchUser(ctx, id, patch, nil)
+
+			Convey("Then I expect a 'success' response type with the patched user", func() {
+
+				So(responseType, ShouldEqual, Success)
+				So(user, ShouldResemble, &patched)
+				So(len(validationErrs), ShouldEqual, 0)
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestUnitDeleteUser(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	transformer := transformers.NewMockUserTransform(mockCtrl)
+	validator := validators.NewMockUserValidate(mockCtrl)
+	client := db.NewMockClient(mockCtrl)
+
+	svc := &UserServiceImpl{
+		transformer: transformer,
+		validator:   validator,
+		db:          client,
+	}
+
+	Convey("Given I encounter errors when deleting a user", t, func() {
+
+		dbErr := errors.New("error when deleting a user")
+
+		client.EXPECT().DeleteUser(gomock.Any(), id, db.AnyVersion).Return(nil, dbErr)
+
+		responseType, err := svc.DeleteUser(ctx, id, nil)
+
+		Convey("Then I expect an 'error' response type", func() {
+
+			So(responseType, ShouldEqual, Error)
+
+			Convey("And errors should be returned", func() {
+
+				So(err, ShouldEqual, dbErr)
+			})
+		})
+	})
+
+	Convey("Given I don't find the user I'm deleting", t, func() {
+
+		client.EXPECT().DeleteUser(gomock.Any(), id, db.AnyVersion).Return(nil, nil)
+
+		responseType, err := svc.DeleteUser(ctx, id, nil)
+
+		Convey("Then I expect a 'not-found' response type", func() {
+
+			So(responseType, ShouldEqual, NotFound)
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Given I delete a user conditional upon a version", t, func() {
+
+		Convey("When the user doesn't exist", func() {
+
+			client.EXPECT().GetUser(gomock.Any(), id).Return(nil, nil)
+
+			responseType, err := svc.DeleteUser(ctx, id, &models.Precondition{Any: true})
+
+			Convey("Then I expect a 'precondition-failed' response type, as no version of the user can match", func() {
+
+				So(responseType, ShouldEqual, PreconditionFailed)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When the user is at the version, but is deleted before it can be deleted again", func() {
+
+			client.EXPECT().GetUser(gomock.Any(), id).Return(&models.UserDao{ID: id, Version: 3}, nil)
+			client.EXPECT().DeleteUser(gomock.Any(), id, int64(3)).Return(nil, nil)
+
+			responseType, err := svc.DeleteUser(ctx, id, &models.Precondition{Versions: []int64{3}})
+
+			Convey("Then I expect a 'precondition-failed' response type", func() {
+
+				So(responseType, ShouldEqual, PreconditionFailed)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When the user is at another version", func() {
+
+			client.EXPECT().GetUser(gomock.Any(), id).Return(&models.UserDao{ID: id, Version: 3}, nil)
+
+			responseType, err := svc.DeleteUser(ctx, id, &models.Precondition{Versions: []int64{2}})
+
+			Convey("Then I expect a 'precondition-failed' response type, without the user being deleted", func() {
+
+				So(responseType, ShouldEqual, PreconditionFailed)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When the user is at the version", func() {
+
+			client.EXPECT().GetUser(gomock.Any(), id).Return(&models.UserDao{ID: id, Version: 3}, nil)
+
+			Convey("But is modified before it can be deleted", func() {
+
+				client.EXPECT().DeleteUser(gomock.Any(), id, int64(3)).Return(nil, db.ErrVersionConflict)
+
+				responseType, err := svc.DeleteUser(ctx, id, &models.Precondition{Versions: []int64{3}})
+
+				Convey("Then I expect a 'precondition-failed' response type", func() {
+
+					So(responseType, ShouldEqual, PreconditionFailed)
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("And is deleted conditional upon that version", func() {
+
+				client.EXPECT().DeleteUser(gomock.Any(), id, int64(3)).Return(&models.UserDao{ID: id, Version: 3}, nil)
+				client.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil)
+
+				responseType, err := svc.DeleteUser(ctx, id, &models.Precondition{Versions: []int64{3}})
+
+				Convey("Then I expect a 'success' response type", func() {
+
+					So(responseType, ShouldEqual, Success)
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+	})
+
+	Convey("Given I delete the user successfully", t, func() {
+
+		client.EXPECT().DeleteUser(gomock.Any(), id, db.AnyVersion).Return(&models.UserDao{ID: id, Version: 1}, nil)
+		client.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil)
+
+		responseType, err := svc.DeleteUser(ctx, id, nil)
+
+		Convey("Then I expect a 'success' response type", func() {
+
+			So(responseType, ShouldEqual, Success)
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func TestUnitPing(t *testing.T) {
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	client := db.NewMockClient(mockCtrl)
+
+	svc := &UserServiceImpl{
+		db:          client,
+		readTimeout: time.Second,
+	}
+
+	Convey("Given I ping the db through the service", t, func() {
+
+		Convey("When the db is reachable", func() {
+
+			client.EXPECT().Ping(gomock.Any()).DoAndReturn(func(ctx context.Context) error {
+				_, hasDeadline := ctx.Deadline()
+				So(hasDeadline, ShouldBeTrue)
+				return nil
+			})
+
+			Convey("Then I expect no error, the ping having been bounded by the read timeout", func() {
+
+				So(svc.Ping(ctx), ShouldBeNil)
+			})
+		})
+
+		Convey("When the db is unreachable", func() {
+
+			client.EXPECT().Ping(gomock.Any()).Return(errors.New("unreachable"))
+
+			Convey("Then I expect the error to be returned", func() {
+
+				So(svc.Ping(ctx), ShouldNotBeNil)
+			})
+		})
+	})
 }
 
 func TestUnitShutdown(t *testing.T) {
@@ -47,6 +47,20 @@ func (mr *MockUserTransformMockRecorder) ToEntity(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ToEntity", reflect.TypeOf((*MockUserTransform)(nil).ToEntity), arg0)
 }
 
+// ToRecord mocks base method
+func (m *MockUserTransform) ToRecord(arg0 *models.UserDao) *models.UserRecord {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ToRecord", arg0)
+	ret0, _ := ret[0].(*models.UserRecord)
+	return ret0
+}
+
+// ToRecord indicates an expected call of ToRecord
+func (mr *MockUserTransformMockRecorder) ToRecord(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ToRecord", reflect.TypeOf((*MockUserTransform)(nil).ToRecord), arg0)
+}
+
 // ToRest mocks base method
 func (m *MockUserTransform) ToRest(arg0 *models.UserDao) *models.User {
 	m.ctrl.T.Helper()
@@ -74,3 +88,59 @@ func (mr *MockUserTransformMockRecorder) ToRestArray(arg0 interface{}) *gomock.C
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ToRestArray", reflect.TypeOf((*MockUserTransform)(nil).ToRestArray), arg0)
 }
+
+// ToRestAuditEvents mocks base method
+func (m *MockUserTransform) ToRestAuditEvents(arg0 *[]*models.AuditEventDao) *[]*models.AuditEvent {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ToRestAuditEvents", arg0)
+	ret0, _ := ret[0].(*[]*models.AuditEvent)
+	return ret0
+}
+
+// ToRestAuditEvents indicates an expected call of ToRestAuditEvents
+func (mr *MockUserTransformMockRecorder) ToRestAuditEvents(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ToRestAuditEvents", reflect.TypeOf((*MockUserTransform)(nil).ToRestAuditEvents), arg0)
+}
+
+// ToRestErasureReceipt mocks base method
+func (m *MockUserTransform) ToRestErasureReceipt(arg0 *models.ErasureReceiptDao) *models.ErasureReceipt {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ToRestErasureReceipt", arg0)
+	ret0, _ := ret[0].(*models.ErasureReceipt)
+	return ret0
+}
+
+// ToRestErasureReceipt indicates an expected call of ToRestErasureReceipt
+func (mr *MockUserTransformMockRecorder) ToRestErasureReceipt(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ToRestErasureReceipt", reflect.TypeOf((*MockUserTransform)(nil).ToRestErasureReceipt), arg0)
+}
+
+// ToRestIdempotentRequests mocks base method
+func (m *MockUserTransform) ToRestIdempotentRequests(arg0 []*models.IdempotencyRecordDao) []*models.IdempotentRequest {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ToRestIdempotentRequests", arg0)
+	ret0, _ := ret[0].([]*models.IdempotentRequest)
+	return ret0
+}
+
+// ToRestIdempotentRequests indicates an expected call of ToRestIdempotentRequests
+func (mr *MockUserTransformMockRecorder) ToRestIdempotentRequests(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ToRestIdempotentRequests", reflect.TypeOf((*MockUserTransform)(nil).ToRestIdempotentRequests), arg0)
+}
+
+// ToRestStats mocks base method
+func (m *MockUserTransform) ToRestStats(arg0 *models.UserStatsDao) *models.UserStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ToRestStats", arg0)
+	ret0, _ := ret[0].(*models.UserStats)
+	return ret0
+}
+
+// ToRestStats indicates an expected call of ToRestStats
+func (mr *MockUserTransformMockRecorder) ToRestStats(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ToRestStats", reflect.TypeOf((*MockUserTransform)(nil).ToRestStats), arg0)
+}
@@ -1,6 +1,7 @@
 package transformers
 
 import (
+	"encoding/json"
 	"github.com/bpsaunders/user-api/models"
 )
 
@@ -9,6 +10,11 @@ type UserTransform interface {
 	ToRest(entity *models.UserDao) *models.User
 	ToRestArray(entities *[]*models.UserDao) *[]*models.User
 	ToEntity(rest *models.User) *models.UserDao
+	ToRestAuditEvents(entities *[]*models.AuditEventDao) *[]*models.AuditEvent
+	ToRecord(entity *models.UserDao) *models.UserRecord
+	ToRestErasureReceipt(entity *models.ErasureReceiptDao) *models.ErasureReceipt
+	ToRestIdempotentRequests(entities []*models.IdempotencyRecordDao) []*models.IdempotentRequest
+	ToRestStats(entity *models.UserStatsDao) *models.UserStats
 }
 
 // UserTransformer is a concrete implementation of the UserTransform interface
@@ -19,18 +25,29 @@ func NewUserTransformer() UserTransform {
 	return &UserTransformer{}
 }
 
-// ToRest converts a database entity to a REST resource
+// usersPath is the path under which user resources are located
+const usersPath = "/users/"
+
+// ToRest converts a database entity to a REST resource, carrying its id, timestamps and links
 func (*UserTransformer) ToRest(entity *models.UserDao) *models.User {
 
 	return &models.User{
+		ID:        entity.ID,
 		FirstName: entity.FirstName,
 		LastName:  entity.LastName,
 		Email:     entity.Email,
 		Country:   entity.Country,
+		CreatedAt: entity.CreatedAt,
+		UpdatedAt: entity.UpdatedAt,
+		Version:   entity.Version,
+		Links: models.Links{
+			Self: usersPath + entity.ID,
+		},
 	}
 }
 
-// ToEntity converts a REST resource to a database entity
+// ToEntity converts a REST resource to a database entity. Timestamps are the preserve of the service
+// layer, so are never taken from the REST resource
 func (*UserTransformer) ToEntity(rest *models.User) *models.UserDao {
 
 	return &models.UserDao{
@@ -49,11 +66,106 @@ func (t *UserTransformer) ToRestArray(entities *[]*models.UserDao) *[]*models.Us
 
 	if len(*entities) > 0 {
 		for _, entity := range *entities {
-			rest := t.ToRest(entity)
-			rest.ID = entity.ID
-			arr = append(arr, rest)
+			arr = append(arr, t.ToRest(entity))
+		}
+	}
+
+	return &arr
+}
+
+// ToRestAuditEvents converts an array of audit event database entities to an array of REST resources
+func (*UserTransformer) ToRestAuditEvents(entities *[]*models.AuditEventDao) *[]*models.AuditEvent {
+
+	arr := make([]*models.AuditEvent, 0, len(*entities))
+
+	for _, entity := range *entities {
+		changes := make([]models.FieldChange, 0, len(entity.Changes))
+		for _, change := range entity.Changes {
+			changes = append(changes, models.FieldChange{
+				Field:  change.Field,
+				Before: change.Before,
+				After:  change.After,
+			})
 		}
+
+		arr = append(arr, &models.AuditEvent{
+			ID:        entity.ID,
+			UserID:    entity.UserID,
+			Actor:     entity.Actor,
+			Operation: entity.Operation,
+			Timestamp: entity.Timestamp,
+			Changes:   changes,
+		})
 	}
 
 	return &arr
 }
+
+// ToRecord converts a database entity to a record of the user exactly as stored, for export to its subject
+func (*UserTransformer) ToRecord(entity *models.UserDao) *models.UserRecord {
+
+	return &models.UserRecord{
+		ID:        entity.ID,
+		FirstName: entity.FirstName,
+		LastName:  entity.LastName,
+		Email:     entity.Email,
+		Country:   entity.Country,
+		CreatedAt: entity.CreatedAt,
+		UpdatedAt: entity.UpdatedAt,
+		Version:   entity.Version,
+		DeletedAt: entity.DeletedAt,
+	}
+}
+
+// ToRestErasureReceipt converts an erasure receipt database entity to a REST resource
+func (*UserTransformer) ToRestErasureReceipt(entity *models.ErasureReceiptDao) *models.ErasureReceipt {
+
+	return &models.ErasureReceipt{
+		UserID:                entity.UserID,
+		Actor:                 entity.Actor,
+		ErasedAt:              entity.ErasedAt,
+		Tombstone:             entity.Tombstone,
+		ReregistrationBlocked: entity.ReregistrationBlocked,
+		SignatureAlgorithm:    entity.SignatureAlgorithm,
+		Signature:             entity.Signature,
+	}
+}
+
+// ToRestIdempotentRequests converts idempotency record database entities to the requests they describe, each with
+// the response held to replay to its retries, for export to the subject of the user the requests created
+func (*UserTransformer) ToRestIdempotentRequests(entities []*models.IdempotencyRecordDao) []*models.IdempotentRequest {
+
+	arr := make([]*models.IdempotentRequest, 0, len(entities))
+
+	for _, entity := range entities {
+		arr = append(arr, &models.IdempotentRequest{
+			CreatedAt: entity.CreatedAt,
+			Response:  json.RawMessage(entity.Response),
+		})
+	}
+
+	return arr
+}
+
+// ToRestStats converts counts of users aggregated by the db to a REST resource
+func (*UserTransformer) ToRestStats(entity *models.UserStatsDao) *models.UserStats {
+
+	stats := &models.UserStats{
+		Total:        entity.Total,
+		Countries:    make([]*models.CountryCount, 0, len(entity.Countries)),
+		EmailDomains: make([]*models.DomainCount, 0, len(entity.EmailDomains)),
+		Signups:      make([]*models.SignupCount, 0, len(entity.Signups)),
+	}
+
+	for _, group := range entity.Countries {
+		stats.Countries = append(stats.Countries, &models.CountryCount{Country: group.Value, Count: group.Count})
+	}
+	for _, group := range entity.EmailDomains {
+		stats.EmailDomains = append(stats.EmailDomains, &models.DomainCount{Domain: group.Value, Count: group.Count})
+	}
+	for _, bucket := range entity.Signups {
+		stats.Signups = append(stats.Signups, &models.SignupCount{Start: bucket.Start, Count: bucket.Count})
+	}
+
+	return stats
+}
@@ -1,8 +1,10 @@
 package transformers
 
 import (
+	"encoding/json"
 	"github.com/bpsaunders/user-api/models"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -13,6 +15,9 @@ const lastName = "lastName"
 const email = "email"
 const country = "country"
 
+var createdAt = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+var updatedAt = time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC)
+
 func TestUnitToRest(t *testing.T) {
 
 	transformer := NewUserTransformer()
@@ -25,19 +30,28 @@ func TestUnitToRest(t *testing.T) {
 			LastName:  lastName,
 			Email:     email,
 			Country:   country,
+			CreatedAt: createdAt,
+			UpdatedAt: updatedAt,
 		}
 
 		Convey("When I transform the entity to a REST resource", func() {
 
 			rest := transformer.ToRest(entity)
 
-			Convey("Then I expect all fields besides id to be mapped to the REST resource", func() {
+			Convey("Then I expect all fields including id and timestamps to be mapped to the REST resource", func() {
 
 				So(rest.FirstName, ShouldEqual, firstName)
 				So(rest.LastName, ShouldEqual, lastName)
 				So(rest.Email, ShouldEqual, email)
 				So(rest.Country, ShouldEqual, country)
-				So(rest.ID, ShouldEqual, "")
+				So(rest.ID, ShouldEqual, id)
+				So(rest.CreatedAt, ShouldEqual, createdAt)
+				So(rest.UpdatedAt, ShouldEqual, updatedAt)
+			})
+
+			Convey("Then I expect the REST resource to link to itself", func() {
+
+				So(rest.Links.Self, ShouldEqual, "/users/"+id)
 			})
 		})
 	})
@@ -55,6 +69,8 @@ func TestUnitToEntity(t *testing.T) {
 			LastName:  lastName,
 			Email:     email,
 			Country:   country,
+			CreatedAt: createdAt,
+			UpdatedAt: updatedAt,
 		}
 
 		Convey("When I transform the REST resource to a database entity", func() {
@@ -69,6 +85,12 @@ func TestUnitToEntity(t *testing.T) {
 				So(entity.Country, ShouldEqual, country)
 				So(entity.ID, ShouldEqual, id)
 			})
+
+			Convey("Then I expect timestamps not to be taken from the REST resource", func() {
+
+				So(entity.CreatedAt.IsZero(), ShouldBeTrue)
+				So(entity.UpdatedAt.IsZero(), ShouldBeTrue)
+			})
 		})
 	})
 }
@@ -103,7 +125,197 @@ func TestUnitToRestArray(t *testing.T) {
 				So(rest.Email, ShouldEqual, email)
 				So(rest.Country, ShouldEqual, country)
 				So(rest.ID, ShouldEqual, id)
+				So(rest.Links.Self, ShouldEqual, "/users/"+id)
+			})
+		})
+	})
+}
+
+func TestUnitToRestAuditEvents(t *testing.T) {
+
+	transformer := NewUserTransformer()
+
+	Convey("Given I have an array containing an audit event db entity", t, func() {
+
+		before := "old@mail.com"
+		after := "new@mail.com"
+
+		entity := &models.AuditEventDao{
+			ID:        "event",
+			UserID:    id,
+			Actor:     "api-key:admin",
+			Operation: "update",
+			Timestamp: updatedAt,
+			Changes:   []models.FieldChangeDao{{Field: "email", Before: &before, After: &after}},
+		}
+
+		entityArray := []*models.AuditEventDao{entity}
+
+		Convey("When I transform the entity array to a REST array", func() {
+
+			restArray := transformer.ToRestAuditEvents(&entityArray)
+
+			Convey("Then I expect every field and change to be mapped to the REST resource in the array", func() {
+
+				So(len(*restArray), ShouldEqual, 1)
+				So((*restArray)[0], ShouldResemble, &models.AuditEvent{
+					ID:        "event",
+					UserID:    id,
+					Actor:     "api-key:admin",
+					Operation: "update",
+					Timestamp: updatedAt,
+					Changes:   []models.FieldChange{{Field: "email", Before: &before, After: &after}},
+				})
 			})
 		})
 	})
 }
+
+func TestUnitToRecord(t *testing.T) {
+
+	transformer := NewUserTransformer()
+
+	Convey("Given I have a deleted user db entity", t, func() {
+
+		deletedAt := updatedAt
+		entity := &models.UserDao{
+			ID:              id,
+			FirstName:       firstName,
+			LastName:        lastName,
+			Email:           email,
+			Country:         country,
+			CreatedAt:       createdAt,
+			UpdatedAt:       updatedAt,
+			Version:         2,
+			NormalisedEmail: email,
+			DeletedAt:       &deletedAt,
+		}
+
+		Convey("When I transform the entity to a record", func() {
+
+			record := transformer.ToRecord(entity)
+
+			Convey("Then I expect every field, including its version and deletion, to be mapped to the record", func() {
+
+				So(record, ShouldResemble, &models.UserRecord{
+					ID:        id,
+					FirstName: firstName,
+					LastName:  lastName,
+					Email:     email,
+					Country:   country,
+					CreatedAt: createdAt,
+					UpdatedAt: updatedAt,
+					Version:   2,
+					DeletedAt: &deletedAt,
+				})
+			})
+		})
+	})
+}
+
+func TestUnitToRestErasureReceipt(t *testing.T) {
+
+	transformer := NewUserTransformer()
+
+	Convey("Given I have an erasure receipt db entity", t, func() {
+
+		entity := &models.ErasureReceiptDao{
+			UserID:                id,
+			Actor:                 "api-key:admin",
+			ErasedAt:              updatedAt,
+			Tombstone:             "tombstone",
+			ReregistrationBlocked: true,
+			SignatureAlgorithm:    "HMAC-SHA256",
+			Signature:             "signature",
+		}
+
+		Convey("When I transform the entity to a REST resource", func() {
+
+			rest := transformer.ToRestErasureReceipt(entity)
+
+			Convey("Then I expect every field, including its signature, to be mapped to the REST resource", func() {
+
+				So(rest, ShouldResemble, &models.ErasureReceipt{
+					UserID:                id,
+					Actor:                 "api-key:admin",
+					ErasedAt:              updatedAt,
+					Tombstone:             "tombstone",
+					ReregistrationBlocked: true,
+					SignatureAlgorithm:    "HMAC-SHA256",
+					Signature:             "signature",
+				})
+			})
+		})
+	})
+}
+
+func TestUnitToRestIdempotentRequests(t *testing.T) {
+
+	transformer := NewUserTransformer()
+
+	Convey("Given I have an idempotency record db entity", t, func() {
+
+		entities := []*models.IdempotencyRecordDao{{
+			ID:          "key",
+			Fingerprint: "fingerprint",
+			CreatedAt:   createdAt,
+			Response:    []byte(`{"outcome":"Success"}`),
+			UserID:      id,
+		}}
+
+		Convey("When I transform the entity to a REST resource", func() {
+
+			rest := transformer.ToRestIdempotentRequests(entities)
+
+			Convey("Then I expect its time and response to be mapped, and nothing by which the request is matched", func() {
+
+				So(rest, ShouldResemble, []*models.IdempotentRequest{{
+					CreatedAt: createdAt,
+					Response:  json.RawMessage(`{"outcome":"Success"}`),
+				}})
+			})
+		})
+	})
+}
+
+func TestUnitToRestStats(t *testing.T) {
+
+	transformer := NewUserTransformer()
+
+	Convey("Given I have counts of users aggregated by the db", t, func() {
+
+		entity := &models.UserStatsDao{
+			Total:        3,
+			Countries:    []models.GroupCountDao{{Value: "GB", Count: 2}, {Value: "FR", Count: 1}},
+			EmailDomains: []models.GroupCountDao{{Value: "example.com", Count: 3}},
+			Signups:      []models.SignupCountDao{{Start: createdAt, Count: 3}},
+		}
+
+		Convey("When I transform the entity to a REST resource", func() {
+
+			rest := transformer.ToRestStats(entity)
+
+			Convey("Then I expect each count to be mapped to the REST resource, by what it counts", func() {
+
+				So(rest, ShouldResemble, &models.UserStats{
+					Total:        3,
+					Countries:    []*models.CountryCount{{Country: "GB", Count: 2}, {Country: "FR", Count: 1}},
+					EmailDomains: []*models.DomainCount{{Domain: "example.com", Count: 3}},
+					Signups:      []*models.SignupCount{{Start: createdAt, Count: 3}},
+				})
+			})
+		})
+	})
+
+	Convey("Given I have counts of no users", t, func() {
+
+		rest := transformer.ToRestStats(&models.UserStatsDao{})
+
+		Convey("Then I expect empty arrays rather than nulls", func() {
+
+			So(rest.Countries, ShouldNotBeNil)
+			So(rest.EmailDomains, ShouldNotBeNil)
+			So(rest.Signups, ShouldNotBeNil)
+		})
+	})
+}
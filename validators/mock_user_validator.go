@@ -46,3 +46,73 @@ func (mr *MockUserValidateMockRecorder) Validate(arg0 interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Validate", reflect.TypeOf((*MockUserValidate)(nil).Validate), arg0)
 }
+
+// ValidateHistoryQuery mocks base method
+func (m *MockUserValidate) ValidateHistoryQuery(arg0 *models.UserHistoryQuery) []ValidationError {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateHistoryQuery", arg0)
+	ret0, _ := ret[0].([]ValidationError)
+	return ret0
+}
+
+// ValidateHistoryQuery indicates an expected call of ValidateHistoryQuery
+func (mr *MockUserValidateMockRecorder) ValidateHistoryQuery(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateHistoryQuery", reflect.TypeOf((*MockUserValidate)(nil).ValidateHistoryQuery), arg0)
+}
+
+// ValidateImport mocks base method
+func (m *MockUserValidate) ValidateImport(arg0 []*models.ImportRow) []ValidationError {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateImport", arg0)
+	ret0, _ := ret[0].([]ValidationError)
+	return ret0
+}
+
+// ValidateImport indicates an expected call of ValidateImport
+func (mr *MockUserValidateMockRecorder) ValidateImport(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateImport", reflect.TypeOf((*MockUserValidate)(nil).ValidateImport), arg0)
+}
+
+// ValidateListQuery mocks base method
+func (m *MockUserValidate) ValidateListQuery(arg0 *models.UserListQuery) []ValidationError {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateListQuery", arg0)
+	ret0, _ := ret[0].([]ValidationError)
+	return ret0
+}
+
+// ValidateListQuery indicates an expected call of ValidateListQuery
+func (mr *MockUserValidateMockRecorder) ValidateListQuery(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateListQuery", reflect.TypeOf((*MockUserValidate)(nil).ValidateListQuery), arg0)
+}
+
+// ValidateSearchQuery mocks base method
+func (m *MockUserValidate) ValidateSearchQuery(arg0 *models.UserSearchQuery) []ValidationError {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateSearchQuery", arg0)
+	ret0, _ := ret[0].([]ValidationError)
+	return ret0
+}
+
+// ValidateSearchQuery indicates an expected call of ValidateSearchQuery
+func (mr *MockUserValidateMockRecorder) ValidateSearchQuery(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateSearchQuery", reflect.TypeOf((*MockUserValidate)(nil).ValidateSearchQuery), arg0)
+}
+
+// ValidateStatsQuery mocks base method
+func (m *MockUserValidate) ValidateStatsQuery(arg0 *models.UserStatsQuery) []ValidationError {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateStatsQuery", arg0)
+	ret0, _ := ret[0].([]ValidationError)
+	return ret0
+}
+
+// ValidateStatsQuery indicates an expected call of ValidateStatsQuery
+func (mr *MockUserValidateMockRecorder) ValidateStatsQuery(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateStatsQuery", reflect.TypeOf((*MockUserValidate)(nil).ValidateStatsQuery), arg0)
+}
@@ -0,0 +1,36 @@
+package validators
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"strconv"
+)
+
+// HistorySort is the fixed order of the history of a user, most recent first, to which history cursors are bound
+const HistorySort = "-sequence"
+
+// ValidateHistoryQuery provides functionality with which to validate the parameters of a request for the history
+// of a user
+func (*UserValidator) ValidateHistoryQuery(query *models.UserHistoryQuery) []ValidationError {
+
+	validationErrors := make([]ValidationError, 0)
+
+	validateLimit(query.Limit, &validationErrors)
+	validateHistoryCursor(query.Cursor, &validationErrors)
+
+	return validationErrors
+}
+
+func validateHistoryCursor(cursor string, validationErrors *[]ValidationError) {
+
+	count := len(*validationErrors)
+	validateCursor(cursor, HistorySort, validationErrors)
+	if cursor == "" || len(*validationErrors) > count {
+		return
+	}
+
+	// Reject if the cursor doesn't hold the sequence of an event
+	decoded, _ := models.DecodeCursor(cursor)
+	if sequence, err := strconv.ParseInt(decoded.Values[0], 10, 64); err != nil || sequence < 1 {
+		*validationErrors = append(*validationErrors, newValidationError(cursorParam, invalidCursor))
+	}
+}
@@ -0,0 +1,27 @@
+package validators
+
+import "github.com/bpsaunders/user-api/models"
+
+// batchField identifies the batch as a whole, rather than any one record within it
+const batchField = "$"
+
+// MaxImportRows is the largest batch of users which may be imported at once
+const MaxImportRows = 10000
+
+// ValidateImport provides functionality with which to validate a batch of users for import, as a whole. Each
+// record within the batch is validated as a user in its own right
+func (*UserValidator) ValidateImport(rows []*models.ImportRow) []ValidationError {
+
+	validationErrors := make([]ValidationError, 0)
+
+	if len(rows) == 0 || len(rows) > MaxImportRows {
+		// Reject if the batch is empty, or too large to be imported at once
+		params := map[string]interface{}{
+			minValue: 1,
+			maxValue: MaxImportRows,
+		}
+		validationErrors = append(validationErrors, newValidationErrorWithParams(batchField, invalidLength, params))
+	}
+
+	return validationErrors
+}
@@ -0,0 +1,115 @@
+package validators
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"strconv"
+	"strings"
+)
+
+const limitParam = "limit"
+const sortParam = "sort"
+const cursorParam = "cursor"
+
+// MaxListLimit is the largest page of users which may be requested
+const MaxListLimit = 100
+
+// SortableFields holds the user fields by which a list of users may be sorted
+var SortableFields = []string{firstNameField, lastNameField, emailField, countryField}
+
+// ValidateListQuery provides functionality with which to validate the parameters of a request for a list of users
+func (*UserValidator) ValidateListQuery(query *models.UserListQuery) []ValidationError {
+
+	validationErrors := make([]ValidationError, 0)
+
+	validateLimit(query.Limit, &validationErrors)
+	validateSort(query.Sort, &validationErrors)
+	validateCursor(query.Cursor, query.Sort, &validationErrors)
+
+	return validationErrors
+}
+
+func validateLimit(limit string, validationErrors *[]ValidationError) {
+	validateCount(limitParam, limit, MaxListLimit, validationErrors)
+}
+
+func validateCount(param string, count string, max int, validationErrors *[]ValidationError) {
+
+	if count == "" {
+		return
+	}
+
+	value, err := strconv.Atoi(count)
+	if err != nil {
+		// Reject if the count isn't an integer
+		*validationErrors = append(*validationErrors, newValidationError(param, invalidFormat))
+	} else if value < 1 || value > max {
+		// Reject if the count is outside of the permitted range
+		params := map[string]interface{}{
+			minValue: 1,
+			maxValue: max,
+		}
+		*validationErrors = append(*validationErrors, newValidationErrorWithParams(param, invalidValue, params))
+	}
+}
+
+func validateSort(sort string, validationErrors *[]ValidationError) {
+
+	if sort == "" {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimPrefix(field, "-")
+		if !isSortable(field) || seen[field] {
+			// Reject if sorting by an unknown field, or by the same field twice
+			params := map[string]interface{}{
+				allowedValues: SortableFields,
+			}
+			*validationErrors = append(*validationErrors, newValidationErrorWithParams(sortParam, invalidSortField, params))
+			return
+		}
+		seen[field] = true
+	}
+}
+
+func isSortable(field string) bool {
+
+	for _, sortable := range SortableFields {
+		if field == sortable {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSortSize returns the validation error of a sort by personal data matching more users than may be sorted
+func ValidateSortSize(max int) []ValidationError {
+
+	params := map[string]interface{}{
+		maxValue: max,
+	}
+	return []ValidationError{newValidationErrorWithParams(sortParam, tooManyToSort, params)}
+}
+
+func validateCursor(cursor string, sort string, validationErrors *[]ValidationError) {
+
+	if cursor == "" {
+		return
+	}
+
+	decoded, err := models.DecodeCursor(cursor)
+
+	// Reject if the cursor is malformed, or was issued for a differently sorted list
+	if err != nil || decoded.Sort != sort || len(decoded.Values) != sortFieldCount(sort) {
+		*validationErrors = append(*validationErrors, newValidationError(cursorParam, invalidCursor))
+	}
+}
+
+func sortFieldCount(sort string) int {
+
+	if sort == "" {
+		return 0
+	}
+	return len(strings.Split(sort, ","))
+}
@@ -0,0 +1,37 @@
+package validators
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"strings"
+	"unicode/utf8"
+)
+
+const searchParam = "q"
+
+// SearchMaxLength bounds the length of the text by which users are searched
+const SearchMaxLength = 100
+
+// ValidateSearchQuery provides functionality with which to validate the parameters of a search for users
+func (*UserValidator) ValidateSearchQuery(query *models.UserSearchQuery) []ValidationError {
+
+	validationErrors := make([]ValidationError, 0)
+
+	validateSearchText(query.Q, &validationErrors)
+	validateLimit(query.Limit, &validationErrors)
+
+	return validationErrors
+}
+
+func validateSearchText(text string, validationErrors *[]ValidationError) {
+
+	if strings.TrimSpace(text) == "" {
+		// Reject if there's nothing to search by
+		*validationErrors = append(*validationErrors, newValidationError(searchParam, mandatoryElementMissing))
+	} else if utf8.RuneCountInString(text) > SearchMaxLength {
+		// Reject if the search text is longer than permitted
+		params := map[string]interface{}{
+			maxChars: SearchMaxLength,
+		}
+		*validationErrors = append(*validationErrors, newValidationErrorWithParams(searchParam, invalidLength, params))
+	}
+}
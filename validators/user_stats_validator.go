@@ -0,0 +1,71 @@
+package validators
+
+import (
+	"github.com/bpsaunders/user-api/models"
+	"time"
+)
+
+const intervalParam = "interval"
+const fromParam = "from"
+const toParam = "to"
+const topParam = "top"
+
+// DateLayout is the layout of the dates bounding the creation of users counted in statistics
+const DateLayout = "2006-01-02"
+
+// MaxStatsTop is the largest number of email domains which may be counted in statistics
+const MaxStatsTop = 100
+
+// ValidateStatsQuery provides functionality with which to validate the parameters of a request for statistics of
+// users
+func (*UserValidator) ValidateStatsQuery(query *models.UserStatsQuery) []ValidationError {
+
+	validationErrors := make([]ValidationError, 0)
+
+	validateInterval(query.Interval, &validationErrors)
+	from, fromOK := validateDate(fromParam, query.From, &validationErrors)
+	to, toOK := validateDate(toParam, query.To, &validationErrors)
+	validateCount(topParam, query.Top, MaxStatsTop, &validationErrors)
+
+	// Reject if the range of dates is empty
+	if fromOK && toOK && to.Before(from) {
+		validationErrors = append(validationErrors, newValidationError(toParam, invalidValue))
+	}
+
+	return validationErrors
+}
+
+func validateInterval(interval string, validationErrors *[]ValidationError) {
+
+	if interval == "" {
+		return
+	}
+
+	for _, allowed := range models.StatsIntervals {
+		if interval == allowed {
+			return
+		}
+	}
+
+	// Reject if counting by an unknown interval
+	params := map[string]interface{}{
+		allowedValues: models.StatsIntervals,
+	}
+	*validationErrors = append(*validationErrors, newValidationErrorWithParams(intervalParam, invalidValue, params))
+}
+
+// validateDate validates an optional date, returning it and whether it was given validly
+func validateDate(param string, date string, validationErrors *[]ValidationError) (time.Time, bool) {
+
+	if date == "" {
+		return time.Time{}, false
+	}
+
+	value, err := time.Parse(DateLayout, date)
+	if err != nil {
+		// Reject if the date isn't in the expected layout
+		*validationErrors = append(*validationErrors, newValidationError(param, invalidFormat))
+		return time.Time{}, false
+	}
+	return value, true
+}
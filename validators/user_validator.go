@@ -1,6 +1,7 @@
 package validators
 
 import (
+	"github.com/bpsaunders/user-api/countries"
 	"github.com/bpsaunders/user-api/models"
 	"regexp"
 )
@@ -10,13 +11,30 @@ const lastNameField = "last_name"
 const emailField = "email"
 const countryField = "country"
 
-var nameRegex = regexp.MustCompile("^[\\w'\\-,.][^0-9_!¡?÷¿/\\\\+=@#$%ˆ&*(){}|~<>;:[\\]]*$")
-var emailRegex = regexp.MustCompile("^[\\w-.]+@([\\w-]+\\.)+[\\w-]{2,4}$")
-var countryRegex = regexp.MustCompile("^[A-Z]{2}$")
+// NameMinLength and NameMaxLength bound the length of a user's first and last names
+const NameMinLength = 2
+const NameMaxLength = 30
+
+// EmailMaxLength bounds the length of a user's email
+const EmailMaxLength = 120
+
+// NamePattern is the regular expression which a user's first and last names must match
+const NamePattern = `^[\w'\-,.][^0-9_!¡?÷¿/\\+=@#$%ˆ&*(){}|~<>;:[\]]*$`
+
+// EmailPattern is the regular expression which a user's email must match
+const EmailPattern = `^[\w-.]+@([\w-]+\.)+[\w-]{2,4}$`
+
+var nameRegex = regexp.MustCompile(NamePattern)
+var emailRegex = regexp.MustCompile(EmailPattern)
 
 // UserValidate provides an interface by which to validate a user
 type UserValidate interface {
 	Validate(rest *models.User) []ValidationError
+	ValidateListQuery(query *models.UserListQuery) []ValidationError
+	ValidateSearchQuery(query *models.UserSearchQuery) []ValidationError
+	ValidateStatsQuery(query *models.UserStatsQuery) []ValidationError
+	ValidateHistoryQuery(query *models.UserHistoryQuery) []ValidationError
+	ValidateImport(rows []*models.ImportRow) []ValidationError
 }
 
 // UserValidator implements the UserValidate interface
@@ -45,11 +63,11 @@ func validateNameField(name string, nameField string, validationErrors *[]Valida
 	if name == "" {
 		// Reject if name is blank
 		*validationErrors = append(*validationErrors, newValidationError(jsonFieldPrefix+nameField, mandatoryElementMissing))
-	} else if len(name) < 2 || len(name) > 30 {
-		// Reject if name is fewer than chars, or longer than 30 chars
+	} else if len(name) < NameMinLength || len(name) > NameMaxLength {
+		// Reject if name is fewer than 2 chars, or longer than 30 chars
 		params := map[string]interface{}{
-			minChars: 2,
-			maxChars: 30,
+			minChars: NameMinLength,
+			maxChars: NameMaxLength,
 		}
 		*validationErrors = append(*validationErrors, newValidationErrorWithParams(jsonFieldPrefix+nameField, invalidLength, params))
 	} else if !nameRegex.MatchString(name) {
@@ -63,10 +81,10 @@ func validateEmail(email string, validationErrors *[]ValidationError) {
 	if email == "" {
 		// Reject if email is blank
 		*validationErrors = append(*validationErrors, newValidationError(jsonFieldPrefix+emailField, mandatoryElementMissing))
-	} else if len(email) > 120 {
+	} else if len(email) > EmailMaxLength {
 		// Reject if email is longer than 120 chars
 		params := map[string]interface{}{
-			maxChars: 120,
+			maxChars: EmailMaxLength,
 		}
 		*validationErrors = append(*validationErrors, newValidationErrorWithParams(jsonFieldPrefix+emailField, invalidLength, params))
 	} else if !emailRegex.MatchString(email) {
@@ -80,9 +98,8 @@ func validateCountry(country string, validationErrors *[]ValidationError) {
 	if country == "" {
 		// Reject if country is blank
 		*validationErrors = append(*validationErrors, newValidationError(jsonFieldPrefix+countryField, mandatoryElementMissing))
-	} else if !countryRegex.MatchString(country) {
-		// Reject if country doesn't match a country code format
-		// TODO: this is a rudimentary check - in future we should look to make sure this is a valid country code
+	} else if _, ok := countries.Lookup(country); !ok {
+		// Reject if country isn't an ISO 3166-1 alpha-2, alpha-3 or numeric country code
 		*validationErrors = append(*validationErrors, newValidationError(jsonFieldPrefix+countryField, invalidCountryCode))
 	}
 }
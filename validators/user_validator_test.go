@@ -1,6 +1,7 @@
 package validators
 
 import (
+	"encoding/json"
 	"github.com/bpsaunders/user-api/models"
 	"strings"
 	"testing"
@@ -334,6 +335,371 @@ func TestUnitValidate(t *testing.T) {
 	})
 }
 
+func TestUnitValidateCountry(t *testing.T) {
+
+	validator := NewUserValidator()
+
+	Convey("Given I validate users with well-formed but unassigned country codes", t, func() {
+
+		for _, country := range []string{"ZZ", "QQ", "XXX", "000"} {
+
+			user := createValidUser()
+			user.Country = country
+			validationErrors := validator.Validate(user)
+
+			Convey("Then I expect 1 error for "+country+", stating it is an invalid country code", func() {
+
+				So(len(validationErrors), ShouldEqual, 1)
+				So(validationErrors[0].Field, ShouldEqual, jsonFieldPrefix+countryField)
+				So(validationErrors[0].Error, ShouldEqual, invalidCountryCode)
+			})
+		}
+	})
+
+	Convey("Given I validate users with alpha-3, numeric and lower case country codes", t, func() {
+
+		for _, country := range []string{"GBR", "826", "gb", "gbr"} {
+
+			user := createValidUser()
+			user.Country = country
+			validationErrors := validator.Validate(user)
+
+			Convey("Then I expect no errors for "+country, func() {
+
+				So(len(validationErrors), ShouldEqual, 0)
+			})
+		}
+	})
+}
+
+func TestUnitValidateListQuery(t *testing.T) {
+
+	validator := NewUserValidator()
+
+	Convey("Given I validate an empty list query", t, func() {
+
+		validationErrors := validator.ValidateListQuery(&models.UserListQuery{})
+
+		Convey("Then I expect no errors", func() {
+
+			So(len(validationErrors), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given I validate a fully populated list query", t, func() {
+
+		cursor := &models.Cursor{Sort: "last_name,-email", Values: []string{"a", "b"}, ID: "id"}
+
+		validationErrors := validator.ValidateListQuery(&models.UserListQuery{
+			Limit:  "100",
+			Sort:   "last_name,-email",
+			Cursor: cursor.Encode(),
+		})
+
+		Convey("Then I expect no errors", func() {
+
+			So(len(validationErrors), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given I validate a list query with a limit which isn't a number", t, func() {
+
+		validationErrors := validator.ValidateListQuery(&models.UserListQuery{Limit: "ten"})
+
+		Convey("Then I expect 1 error for limit, stating it is an invalid format", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, limitParam)
+			So(validationErrors[0].Error, ShouldEqual, invalidFormat)
+		})
+	})
+
+	Convey("Given I validate a list query with a limit that's too large", t, func() {
+
+		validationErrors := validator.ValidateListQuery(&models.UserListQuery{Limit: "101"})
+
+		Convey("Then I expect 1 error for limit, stating it is an invalid value", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, limitParam)
+			So(validationErrors[0].Error, ShouldEqual, invalidValue)
+			So(validationErrors[0].Params[maxValue], ShouldEqual, MaxListLimit)
+		})
+	})
+
+	Convey("Given I validate a list query sorted by an unknown field", t, func() {
+
+		validationErrors := validator.ValidateListQuery(&models.UserListQuery{Sort: "email,-password"})
+
+		Convey("Then I expect 1 error for sort, stating it is an invalid sort field", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, sortParam)
+			So(validationErrors[0].Error, ShouldEqual, invalidSortField)
+		})
+	})
+
+	Convey("Given I validate a list query with a malformed cursor", t, func() {
+
+		validationErrors := validator.ValidateListQuery(&models.UserListQuery{Cursor: "!!!"})
+
+		Convey("Then I expect 1 error for cursor, stating it is invalid", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, cursorParam)
+			So(validationErrors[0].Error, ShouldEqual, invalidCursor)
+		})
+	})
+
+	Convey("Given I validate a list query with a cursor issued for a different sort", t, func() {
+
+		cursor := &models.Cursor{Sort: "email", Values: []string{"a"}, ID: "id"}
+
+		validationErrors := validator.ValidateListQuery(&models.UserListQuery{Sort: "country", Cursor: cursor.Encode()})
+
+		Convey("Then I expect 1 error for cursor, stating it is invalid", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, cursorParam)
+			So(validationErrors[0].Error, ShouldEqual, invalidCursor)
+		})
+	})
+}
+
+func TestUnitValidateSearchQuery(t *testing.T) {
+
+	validator := NewUserValidator()
+
+	Convey("Given I validate a search query with text and a limit", t, func() {
+
+		validationErrors := validator.ValidateSearchQuery(&models.UserSearchQuery{Q: "bob", Limit: "5"})
+
+		Convey("Then I expect no errors", func() {
+
+			So(len(validationErrors), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given I validate a search query without text", t, func() {
+
+		validationErrors := validator.ValidateSearchQuery(&models.UserSearchQuery{Q: "  "})
+
+		Convey("Then I expect 1 error for q, stating it is missing", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, searchParam)
+			So(validationErrors[0].Error, ShouldEqual, mandatoryElementMissing)
+		})
+	})
+
+	Convey("Given I validate a search query with text that's too long, and a limit that's too large", t, func() {
+
+		validationErrors := validator.ValidateSearchQuery(&models.UserSearchQuery{
+			Q:     strings.Repeat("é", SearchMaxLength+1),
+			Limit: "101",
+		})
+
+		Convey("Then I expect 1 error for q, stating it is an invalid length, and 1 for limit", func() {
+
+			So(len(validationErrors), ShouldEqual, 2)
+			So(validationErrors[0].Field, ShouldEqual, searchParam)
+			So(validationErrors[0].Error, ShouldEqual, invalidLength)
+			So(validationErrors[0].Params[maxChars], ShouldEqual, SearchMaxLength)
+			So(validationErrors[1].Field, ShouldEqual, limitParam)
+		})
+	})
+}
+
+func TestUnitValidateStatsQuery(t *testing.T) {
+
+	validator := NewUserValidator()
+
+	Convey("Given I validate a fully populated stats query", t, func() {
+
+		validationErrors := validator.ValidateStatsQuery(&models.UserStatsQuery{
+			Country:     "GB",
+			EmailDomain: "example.com",
+			From:        "2020-01-01",
+			To:          "2020-01-01",
+			Interval:    "week",
+			Top:         "100",
+		})
+
+		Convey("Then I expect no errors", func() {
+
+			So(len(validationErrors), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given I validate a stats query with an unknown interval, malformed dates and too many domains", t, func() {
+
+		validationErrors := validator.ValidateStatsQuery(&models.UserStatsQuery{
+			From:     "01/02/2020",
+			To:       "2020-02-30",
+			Interval: "year",
+			Top:      "101",
+		})
+
+		Convey("Then I expect an error for each", func() {
+
+			So(len(validationErrors), ShouldEqual, 4)
+			So(validationErrors[0].Field, ShouldEqual, intervalParam)
+			So(validationErrors[0].Params[allowedValues], ShouldResemble, models.StatsIntervals)
+			So(validationErrors[1].Field, ShouldEqual, fromParam)
+			So(validationErrors[1].Error, ShouldEqual, invalidFormat)
+			So(validationErrors[2].Field, ShouldEqual, toParam)
+			So(validationErrors[2].Error, ShouldEqual, invalidFormat)
+			So(validationErrors[3].Field, ShouldEqual, topParam)
+			So(validationErrors[3].Params[maxValue], ShouldEqual, MaxStatsTop)
+		})
+	})
+
+	Convey("Given I validate a stats query with dates in the wrong order", t, func() {
+
+		validationErrors := validator.ValidateStatsQuery(&models.UserStatsQuery{From: "2020-02-01", To: "2020-01-31"})
+
+		Convey("Then I expect 1 error for to, stating it is an invalid value", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, toParam)
+			So(validationErrors[0].Error, ShouldEqual, invalidValue)
+		})
+	})
+}
+
+func TestUnitValidateHistoryQuery(t *testing.T) {
+
+	validator := NewUserValidator()
+
+	Convey("Given I validate a history query with a limit and a cursor issued for the history of a user", t, func() {
+
+		cursor := &models.Cursor{Sort: HistorySort, Values: []string{"3"}, ID: "id"}
+
+		validationErrors := validator.ValidateHistoryQuery(&models.UserHistoryQuery{
+			Limit:  "10",
+			Cursor: cursor.Encode(),
+		})
+
+		Convey("Then I expect no errors", func() {
+
+			So(len(validationErrors), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given I validate a history query with a limit that's too large", t, func() {
+
+		validationErrors := validator.ValidateHistoryQuery(&models.UserHistoryQuery{Limit: "101"})
+
+		Convey("Then I expect 1 error for limit, stating it is an invalid value", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, limitParam)
+			So(validationErrors[0].Error, ShouldEqual, invalidValue)
+		})
+	})
+
+	Convey("Given I validate a history query with a cursor issued for a list of users", t, func() {
+
+		cursor := &models.Cursor{Sort: "email", Values: []string{"a"}, ID: "id"}
+
+		validationErrors := validator.ValidateHistoryQuery(&models.UserHistoryQuery{Cursor: cursor.Encode()})
+
+		Convey("Then I expect 1 error for cursor, stating it is invalid", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, cursorParam)
+			So(validationErrors[0].Error, ShouldEqual, invalidCursor)
+		})
+	})
+
+	Convey("Given I validate a history query with a cursor which doesn't hold a sequence", t, func() {
+
+		cursor := &models.Cursor{Sort: HistorySort, Values: []string{"first"}, ID: "id"}
+
+		validationErrors := validator.ValidateHistoryQuery(&models.UserHistoryQuery{Cursor: cursor.Encode()})
+
+		Convey("Then I expect 1 error for cursor, stating it is invalid", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, cursorParam)
+			So(validationErrors[0].Error, ShouldEqual, invalidCursor)
+		})
+	})
+}
+
+func TestUnitValidateImport(t *testing.T) {
+
+	validator := NewUserValidator()
+
+	Convey("Given I validate a batch of users for import", t, func() {
+
+		validationErrors := validator.ValidateImport([]*models.ImportRow{{Row: 1, User: createValidUser()}})
+
+		Convey("Then I expect no errors", func() {
+
+			So(len(validationErrors), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given I validate an empty batch of users for import", t, func() {
+
+		validationErrors := validator.ValidateImport([]*models.ImportRow{})
+
+		Convey("Then I expect 1 error for the batch, stating it is an invalid length", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, batchField)
+			So(validationErrors[0].Error, ShouldEqual, invalidLength)
+			So(validationErrors[0].Params[maxValue], ShouldEqual, MaxImportRows)
+		})
+	})
+
+	Convey("Given I validate a batch of users too large to import at once", t, func() {
+
+		validationErrors := validator.ValidateImport(make([]*models.ImportRow, MaxImportRows+1))
+
+		Convey("Then I expect 1 error for the batch, stating it is an invalid length", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, batchField)
+		})
+	})
+}
+
+func TestUnitValidateUnmarshal(t *testing.T) {
+
+	Convey("Given I unmarshal a document holding a field of the wrong type", t, func() {
+
+		var user models.User
+		err := json.Unmarshal([]byte(`{"email": 5}`), &user)
+
+		validationErrors := ValidateUnmarshal(err)
+
+		Convey("Then I expect 1 error for the field, naming the type expected of it", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, jsonFieldPrefix+emailField)
+			So(validationErrors[0].Error, ShouldEqual, invalidType)
+			So(validationErrors[0].Params[expectedType], ShouldEqual, "string")
+		})
+	})
+
+	Convey("Given I unmarshal a document which fails otherwise", t, func() {
+
+		var user models.User
+		err := json.Unmarshal([]byte(`{"created_at": "yesterday"}`), &user)
+
+		validationErrors := ValidateUnmarshal(err)
+
+		Convey("Then I expect 1 error for the whole document, stating it is an invalid format", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, jsonRoot)
+			So(validationErrors[0].Error, ShouldEqual, invalidFormat)
+		})
+	})
+}
+
 func createValidUser() *models.User {
 
 	return &models.User{
@@ -343,3 +709,19 @@ func createValidUser() *models.User {
 		Country:   "GB",
 	}
 }
+
+func TestUnitValidateSortSize(t *testing.T) {
+
+	Convey("Given too many users match a sort by personal data", t, func() {
+
+		validationErrors := ValidateSortSize(10000)
+
+		Convey("Then I expect 1 error for sort, stating the most users which may be sorted", func() {
+
+			So(len(validationErrors), ShouldEqual, 1)
+			So(validationErrors[0].Field, ShouldEqual, sortParam)
+			So(validationErrors[0].Error, ShouldEqual, tooManyToSort)
+			So(validationErrors[0].Params[maxValue], ShouldEqual, 10000)
+		})
+	})
+}
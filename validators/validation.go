@@ -1,15 +1,44 @@
 package validators
 
-const jsonFieldPrefix = "$."
+import (
+	"encoding/json"
+	"reflect"
+)
+
+const jsonRoot = "$"
+const jsonFieldPrefix = jsonRoot + "."
 
 const mandatoryElementMissing = "mandatory_element_missing"
 const invalidLength = "invalid_length"
 const invalidChars = "invalid_characters"
 const invalidFormat = "invalid_format"
 const invalidCountryCode = "invalid_country_code"
+const invalidValue = "invalid_value"
+const invalidSortField = "invalid_sort_field"
+const invalidCursor = "invalid_cursor"
+const invalidType = "invalid_type"
+const tooManyToSort = "too_many_to_sort"
+
+// ErrorCodes holds every error which validation may report against a field or parameter
+var ErrorCodes = []string{
+	mandatoryElementMissing,
+	invalidLength,
+	invalidChars,
+	invalidFormat,
+	invalidCountryCode,
+	invalidValue,
+	invalidSortField,
+	invalidCursor,
+	invalidType,
+	tooManyToSort,
+}
 
 const minChars = "min_chars"
 const maxChars = "max_chars"
+const minValue = "min_value"
+const maxValue = "max_value"
+const allowedValues = "allowed_values"
+const expectedType = "expected_type"
 
 // ValidationError holds details of any validation errors
 type ValidationError struct {
@@ -32,3 +61,37 @@ func newValidationErrorWithParams(field string, error string, params map[string]
 		Params: params,
 	}
 }
+
+// ValidateUnmarshal returns the validation errors of a document which couldn't be unmarshalled into a resource,
+// naming the field holding a value of the wrong type and the type expected of it where possible
+func ValidateUnmarshal(err error) []ValidationError {
+
+	typeErr, ok := err.(*json.UnmarshalTypeError)
+	if !ok || typeErr.Field == "" {
+		return []ValidationError{newValidationError(jsonRoot, invalidFormat)}
+	}
+
+	params := map[string]interface{}{
+		expectedType: jsonType(typeErr.Type),
+	}
+	return []ValidationError{newValidationErrorWithParams(jsonFieldPrefix+typeErr.Field, invalidType, params)}
+}
+
+// jsonType returns the name of the JSON type into which a Go type is unmarshalled
+func jsonType(t reflect.Type) string {
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "string"
+	}
+}